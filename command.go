@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"merchant-bank-api/service"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runCommand runs an administrative command instead of starting the HTTP server.
+// It returns the process exit code.
+func runCommand(s *Server, args []string) int {
+	switch args[0] {
+	case "verify-history":
+		return s.verifyHistory()
+	case "mock-verifier":
+		return s.mockVerifier()
+	case "settle":
+		return s.settle(args[1:])
+	case "reconcile":
+		return s.reconcile(args[1:])
+	case "bill-subscriptions":
+		return s.billSubscriptions()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\navailable commands: verify-history, mock-verifier, settle, reconcile, bill-subscriptions\n", args[0])
+		return 2
+	}
+}
+
+// verifyHistory verifies the history hash chain and prints the report.
+// It exits with 1 if the chain is broken.
+func (s *Server) verifyHistory() int {
+	report, err := s.hs.VerifyChain()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify-history: %v\n", err)
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// mockVerifier serves the mock transaction verification provider until the process is stopped.
+// Point VERIFIER_URL at it to verify payments locally.
+func (s *Server) mockVerifier() int {
+	fmt.Printf("mock verifier listening on %s\n", s.vc.Mock.Addr)
+	if err := http.ListenAndServe(s.vc.Mock.Addr, service.NewMockVerifierHandler(s.vc.Mock)); err != nil {
+		fmt.Fprintf(os.Stderr, "mock-verifier: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// settle settles the business day given as YYYY-MM-DD, by default the previous one, and prints
+// the batches it created.
+func (s *Server) settle(args []string) int {
+	businessDate := s.st.PreviousBusinessDate()
+	if len(args) > 0 {
+		businessDate = args[0]
+	}
+	run, err := s.st.Settle(businessDate, "command")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "settle: %v\n", err)
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(run, "", "  ")
+	fmt.Println(string(out))
+	return 0
+}
+
+// reconcile imports an acquirer settlement file, or a camt.053 statement if the file name ends in
+// .xml, and prints the reconciliation summary.
+// It exits with 1 if any item is not matched.
+func (s *Server) reconcile(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: reconcile FILE.csv|FILE.xml")
+		return 2
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reconcile: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	importFile := s.rc.Import
+	if strings.EqualFold(filepath.Ext(args[0]), ".xml") {
+		importFile = s.rc.ImportStatement
+	}
+	report, err := importFile(filepath.Base(args[0]), file, "command")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reconcile: %v\n", err)
+		return 1
+	}
+
+	report.Items = nil
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if report.Summary.Missing+report.Summary.Extra+report.Summary.AmountMismatch > 0 {
+		return 1
+	}
+	return 0
+}
+
+// billSubscriptions bills the subscriptions due now and prints the billing run.
+func (s *Server) billSubscriptions() int {
+	run, err := s.sub.BillDue()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bill-subscriptions: %v\n", err)
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(run, "", "  ")
+	fmt.Println(string(out))
+	return 0
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -16,8 +17,155 @@ type JwtConfig struct {
 	Issuer string
 }
 
+// AuditConfig configures the tamper-evident history log.
+type AuditConfig struct {
+	SigningKey         string
+	CheckpointInterval int
+}
+
+// OutboxConfig configures the payment event outbox dispatcher.
+// Retention is how long delivered and discarded events are kept before they are compacted away.
+type OutboxConfig struct {
+	DispatchInterval time.Duration
+	Retention        time.Duration
+}
+
+// WebhookConfig configures merchant webhook deliveries.
+// AllowPrivateTargets lets endpoints point at loopback and private addresses, for local development only.
+type WebhookConfig struct {
+	MaxAttempts         int
+	InitialBackoff      time.Duration
+	MaxBackoff          time.Duration
+	Timeout             time.Duration
+	PollInterval        time.Duration
+	AllowPrivateTargets bool
+}
+
+// StreamConfig configures the real-time event stream.
+type StreamConfig struct {
+	PollInterval      time.Duration
+	HeartbeatInterval time.Duration
+}
+
+// VerifierConfig configures the transaction verification provider client.
+// An empty URL disables verification and approves every transaction.
+type VerifierConfig struct {
+	URL              string
+	Timeout          time.Duration
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	Mock             VerifierMockConfig
+}
+
+// VerifierMockConfig configures the local mock verification provider used for development and tests.
+type VerifierMockConfig struct {
+	Addr         string
+	DeclineAbove float64
+	FailureRate  float64
+	Latency      time.Duration
+}
+
+// RiskConfig configures the payment risk engine.
+// An empty RulesFile disables the risk rules and allows every payment.
+type RiskConfig struct {
+	RulesFile string
+}
+
+// ScreeningConfig configures sanctions list screening. Scores run from 0 to 100; an empty
+// ListFile disables screening.
+type ScreeningConfig struct {
+	ListFile        string
+	AliasFile       string
+	ReviewThreshold float64
+	BlockThreshold  float64
+}
+
+// AMLConfig configures transaction monitoring.
+// An empty RulesFile disables monitoring.
+type AMLConfig struct {
+	RulesFile string
+}
+
+// FXConfig configures currency conversion.
+// RatesFile is the exchange rate table; without it only same-currency payments are possible.
+// ReportingCurrency is the currency limits, risk rules and AML thresholds are expressed in; payment
+// amounts are converted into it before they are compared or added up.
+type FXConfig struct {
+	RatesFile         string
+	ReportingCurrency string
+}
+
+// SettlementConfig configures end-of-day settlement. Business days follow Location, and the
+// scheduler settles the previous day at RunAt ("15:04"); an empty RunAt disables the scheduler.
+// Payouts are debited from the settlement account of DebtorName, identified by DebtorIBAN or
+// DebtorAccount and DebtorBIC.
+type SettlementConfig struct {
+	Location      *time.Location
+	RunAt         string
+	DebtorName    string
+	DebtorIBAN    string
+	DebtorAccount string
+	DebtorBIC     string
+}
+
+// DisputeConfig configures disputes. Merchants have ResponseWindow to submit evidence, which is
+// stored under EvidenceDir, and overdue disputes are checked every SweepInterval.
+type DisputeConfig struct {
+	ResponseWindow   time.Duration
+	EvidenceDir      string
+	MaxEvidenceBytes int64
+	SweepInterval    time.Duration
+}
+
+// SubscriptionConfig configures recurring billing. Due subscriptions are billed every
+// BillingInterval, and a failed charge is retried after each delay of RetrySchedule in turn
+// before the subscription is canceled.
+type SubscriptionConfig struct {
+	BillingInterval time.Duration
+	RetrySchedule   []time.Duration
+}
+
+// ScheduledPaymentConfig configures scheduled payments. Due payments are executed every
+// PollInterval, and payments can be scheduled at most MaxHorizon ahead.
+type ScheduledPaymentConfig struct {
+	PollInterval time.Duration
+	MaxHorizon   time.Duration
+}
+
+// InvoiceConfig configures invoices. Payment links point at BaseURL, the public address of the API.
+type InvoiceConfig struct {
+	BaseURL string
+}
+
+// QRConfig configures merchant QR codes. Merchant account information is published under
+// GlobalUniqueID, and CountryCode and MerchantCity fill the merchant's location. Dynamic codes
+// can be paid for DynamicTTL after they are issued.
+type QRConfig struct {
+	GlobalUniqueID string
+	CountryCode    string
+	MerchantCity   string
+	DynamicTTL     time.Duration
+}
+
 type Config struct {
 	JwtConfig
+	AuditConfig
+	OutboxConfig
+	WebhookConfig
+	StreamConfig
+	VerifierConfig
+	RiskConfig
+	ScreeningConfig
+	AMLConfig
+	FXConfig
+	SettlementConfig
+	DisputeConfig
+	SubscriptionConfig
+	ScheduledPaymentConfig
+	InvoiceConfig
+	QRConfig
 }
 
 func (c *Config) readConfig() error {
@@ -36,9 +184,188 @@ func (c *Config) readConfig() error {
 	if c.JwtConfig.Key == "" {
 		return errors.New("JWT_KEY not set in.env")
 	}
+
+	interval, _ := strconv.Atoi(os.Getenv("AUDIT_CHECKPOINT_INTERVAL"))
+	if interval <= 0 {
+		interval = 100
+	}
+	c.AuditConfig = AuditConfig{
+		SigningKey:         os.Getenv("AUDIT_SIGNING_KEY"),
+		CheckpointInterval: interval,
+	}
+
+	if c.AuditConfig.SigningKey == "" {
+		return errors.New("AUDIT_SIGNING_KEY not set in.env")
+	}
+
+	c.OutboxConfig = OutboxConfig{
+		DispatchInterval: durationEnv("OUTBOX_DISPATCH_INTERVAL", time.Second),
+		Retention:        durationEnv("OUTBOX_RETENTION", 24*time.Hour),
+	}
+
+	maxAttempts, _ := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	if maxAttempts <= 0 {
+		maxAttempts = 8
+	}
+	c.WebhookConfig = WebhookConfig{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: durationEnv("WEBHOOK_INITIAL_BACKOFF", 10*time.Second),
+		MaxBackoff:     durationEnv("WEBHOOK_MAX_BACKOFF", time.Hour),
+		Timeout:        durationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		PollInterval:   time.Second,
+	}
+	c.WebhookConfig.AllowPrivateTargets, _ = strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"))
+
+	c.StreamConfig = StreamConfig{
+		PollInterval:      durationEnv("STREAM_POLL_INTERVAL", 500*time.Millisecond),
+		HeartbeatInterval: durationEnv("STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+	}
+
+	maxRetries, err := strconv.Atoi(os.Getenv("VERIFIER_MAX_RETRIES"))
+	if err != nil || maxRetries < 0 {
+		maxRetries = 2
+	}
+	threshold, _ := strconv.Atoi(os.Getenv("VERIFIER_FAILURE_THRESHOLD"))
+	if threshold <= 0 {
+		threshold = 5
+	}
+	mockAddr := os.Getenv("VERIFIER_MOCK_ADDR")
+	if mockAddr == "" {
+		mockAddr = ":8081"
+	}
+	declineAbove, _ := strconv.ParseFloat(os.Getenv("VERIFIER_MOCK_DECLINE_ABOVE"), 64)
+	failureRate, _ := strconv.ParseFloat(os.Getenv("VERIFIER_MOCK_FAILURE_RATE"), 64)
+	c.VerifierConfig = VerifierConfig{
+		URL:              os.Getenv("VERIFIER_URL"),
+		Timeout:          durationEnv("VERIFIER_TIMEOUT", 5*time.Second),
+		MaxRetries:       maxRetries,
+		RetryBackoff:     durationEnv("VERIFIER_RETRY_BACKOFF", 200*time.Millisecond),
+		FailureThreshold: threshold,
+		OpenTimeout:      durationEnv("VERIFIER_OPEN_TIMEOUT", 30*time.Second),
+		Mock: VerifierMockConfig{
+			Addr:         mockAddr,
+			DeclineAbove: declineAbove,
+			FailureRate:  failureRate,
+			Latency:      durationEnv("VERIFIER_MOCK_LATENCY", 0),
+		},
+	}
+
+	c.RiskConfig = RiskConfig{RulesFile: os.Getenv("RISK_RULES_FILE")}
+
+	reviewThreshold, err := strconv.ParseFloat(os.Getenv("SANCTIONS_REVIEW_THRESHOLD"), 64)
+	if err != nil || reviewThreshold <= 0 {
+		reviewThreshold = 85
+	}
+	blockThreshold, err := strconv.ParseFloat(os.Getenv("SANCTIONS_BLOCK_THRESHOLD"), 64)
+	if err != nil || blockThreshold < reviewThreshold {
+		blockThreshold = max(95, reviewThreshold)
+	}
+	c.ScreeningConfig = ScreeningConfig{
+		ListFile:        os.Getenv("SANCTIONS_LIST_FILE"),
+		AliasFile:       os.Getenv("SANCTIONS_ALIAS_FILE"),
+		ReviewThreshold: reviewThreshold,
+		BlockThreshold:  blockThreshold,
+	}
+
+	c.AMLConfig = AMLConfig{RulesFile: os.Getenv("AML_RULES_FILE")}
+	c.FXConfig = FXConfig{
+		RatesFile:         os.Getenv("FX_RATES_FILE"),
+		ReportingCurrency: strings.ToUpper(stringEnv("REPORTING_CURRENCY", "IDR")),
+	}
+
+	location, err := time.LoadLocation(os.Getenv("SETTLEMENT_TIMEZONE"))
+	if err != nil || os.Getenv("SETTLEMENT_TIMEZONE") == "" {
+		location = time.Local
+	}
+	c.SettlementConfig = SettlementConfig{
+		Location:      location,
+		RunAt:         os.Getenv("SETTLEMENT_RUN_AT"),
+		DebtorName:    os.Getenv("PAYOUT_DEBTOR_NAME"),
+		DebtorIBAN:    os.Getenv("PAYOUT_DEBTOR_IBAN"),
+		DebtorAccount: os.Getenv("PAYOUT_DEBTOR_ACCOUNT"),
+		DebtorBIC:     os.Getenv("PAYOUT_DEBTOR_BIC"),
+	}
+
+	responseDays, _ := strconv.Atoi(os.Getenv("DISPUTE_RESPONSE_DAYS"))
+	if responseDays <= 0 {
+		responseDays = 7
+	}
+	maxEvidence, _ := strconv.ParseInt(os.Getenv("DISPUTE_EVIDENCE_MAX_BYTES"), 10, 64)
+	if maxEvidence <= 0 {
+		maxEvidence = 5 << 20
+	}
+	evidenceDir := os.Getenv("DISPUTE_EVIDENCE_DIR")
+	if evidenceDir == "" {
+		evidenceDir = "database/dispute_evidence"
+	}
+	c.DisputeConfig = DisputeConfig{
+		ResponseWindow:   time.Duration(responseDays) * 24 * time.Hour,
+		EvidenceDir:      evidenceDir,
+		MaxEvidenceBytes: maxEvidence,
+		SweepInterval:    durationEnv("DISPUTE_SWEEP_INTERVAL", time.Minute),
+	}
+
+	retrySchedule := []time.Duration{24 * time.Hour, 72 * time.Hour, 120 * time.Hour}
+	if value := os.Getenv("SUBSCRIPTION_RETRY_SCHEDULE"); value != "" {
+		var delays []time.Duration
+		for _, part := range strings.Split(value, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(part))
+			if err != nil || d <= 0 {
+				delays = nil
+				break
+			}
+			delays = append(delays, d)
+		}
+		if delays != nil {
+			retrySchedule = delays
+		}
+	}
+	c.SubscriptionConfig = SubscriptionConfig{
+		BillingInterval: durationEnv("SUBSCRIPTION_BILLING_INTERVAL", time.Minute),
+		RetrySchedule:   retrySchedule,
+	}
+
+	maxDays, _ := strconv.Atoi(os.Getenv("SCHEDULED_PAYMENT_MAX_DAYS"))
+	if maxDays <= 0 {
+		maxDays = 365
+	}
+	c.ScheduledPaymentConfig = ScheduledPaymentConfig{
+		PollInterval: durationEnv("SCHEDULED_PAYMENT_POLL_INTERVAL", 30*time.Second),
+		MaxHorizon:   time.Duration(maxDays) * 24 * time.Hour,
+	}
+
+	baseURL := strings.TrimRight(os.Getenv("INVOICE_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	c.InvoiceConfig = InvoiceConfig{BaseURL: baseURL}
+
+	c.QRConfig = QRConfig{
+		GlobalUniqueID: stringEnv("QR_GLOBAL_UNIQUE_ID", "ID.CO.MERCHANTBANKAPI.WWW"),
+		CountryCode:    stringEnv("QR_COUNTRY_CODE", "ID"),
+		MerchantCity:   stringEnv("QR_MERCHANT_CITY", "JAKARTA"),
+		DynamicTTL:     durationEnv("QR_DYNAMIC_TTL", 15*time.Minute),
+	}
 	return nil
 }
 
+// stringEnv reads a string from the environment, or returns def if it is unset or empty.
+func stringEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// durationEnv reads a duration such as "30s" from the environment, or returns def if it is unset or invalid.
+func durationEnv(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
 func NewConfig() (*Config, error) {
 	config := &Config{}
 	err := config.readConfig()
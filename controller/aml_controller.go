@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type amlController struct {
+	service service.AMLService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// sarRequest selects the format of a suspicious activity report.
+type sarRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json text"`
+}
+
+// listAlertsHandler handles GET requests for the transaction monitoring alerts.
+func (c *amlController) listAlertsHandler(ctx *gin.Context) {
+	var filter dto.AMLAlertFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetAlerts(filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// scanHandler handles POST requests to run the monitoring rules over every stored payment.
+func (c *amlController) scanHandler(ctx *gin.Context) {
+	data, err := c.service.Scan()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// listCasesHandler handles GET requests for the AML cases.
+func (c *amlController) listCasesHandler(ctx *gin.Context) {
+	var filter dto.AMLCaseFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetCases(filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getCaseHandler handles GET requests for one case and its alerts.
+func (c *amlController) getCaseHandler(ctx *gin.Context) {
+	data, err := c.service.GetCase(ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// addNoteHandler handles POST requests to add an investigator's note to a case.
+func (c *amlController) addNoteHandler(ctx *gin.Context) {
+	var payload dto.AMLCaseNoteRequest
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.AddNote(callerFrom(ctx), ctx.Param("id"), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// closeCaseHandler handles POST requests to close a case with a disposition.
+func (c *amlController) closeCaseHandler(ctx *gin.Context) {
+	var payload dto.AMLCaseCloseRequest
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.CloseCase(callerFrom(ctx), ctx.Param("id"), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// sarHandler handles GET requests to export a case's suspicious activity report as a JSON or text attachment.
+func (c *amlController) sarHandler(ctx *gin.Context) {
+	var req sarRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	data, err := c.service.ExportSAR(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if req.Format == "text" {
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.txt"`, data.ReportID))
+		ctx.Header("Content-Type", "text/plain; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		writeSARText(ctx.Writer, data)
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, data.ReportID))
+	ctx.JSON(http.StatusOK, data)
+}
+
+// writeSARText writes a suspicious activity report as a plain text document.
+func writeSARText(w io.Writer, r dto.SuspiciousActivityReport) {
+	fmt.Fprintf(w, "SUSPICIOUS ACTIVITY REPORT %s\n\n", r.ReportID)
+	fmt.Fprintf(w, "Case:         %s (%s", r.CaseID, r.CaseStatus)
+	if r.Disposition != "" {
+		fmt.Fprintf(w, ", %s", r.Disposition)
+	}
+	fmt.Fprintf(w, ")\nGenerated:    %s by %s\n", r.GeneratedAt, r.GeneratedBy)
+	fmt.Fprintf(w, "Subject:      %s %s", r.Subject.Type, r.Subject.ID)
+	if r.Subject.Name != "" {
+		fmt.Fprintf(w, ", %s", r.Subject.Name)
+	}
+	if r.Subject.Username != "" {
+		fmt.Fprintf(w, " (username %s)", r.Subject.Username)
+	}
+	fmt.Fprintf(w, "\nActivity:     %s to %s\nTotal amount: %.2f\n\n", r.ActivityStart, r.ActivityEnd, r.TotalAmount)
+
+	fmt.Fprintf(w, "NARRATIVE\n%s\n\nALERTS\n", r.Narrative)
+	for _, alert := range r.Alerts {
+		fmt.Fprintf(w, "- %s [%s] %s\n", alert.ID, alert.Rule, alert.Description)
+	}
+
+	fmt.Fprintf(w, "\nTRANSACTIONS\n")
+	for _, p := range r.Transactions {
+		fmt.Fprintf(w, "- %s  %s  customer %s  merchant %s  %.2f  %s", p.Timestamp, p.TransactionID, p.CustomerID, p.MerchantID, p.Amount, p.Status)
+		if p.RefundedAt != "" {
+			fmt.Fprintf(w, "  refunded %s", p.RefundedAt)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "\nINVESTIGATION NOTES\n")
+	if len(r.Notes) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, note := range r.Notes {
+		fmt.Fprintf(w, "- %s (user %s): %s\n", note.CreatedAt, note.Author, note.Text)
+	}
+}
+
+func (c *amlController) Route() {
+	aml := c.rg.Group("aml", c.am.FilterAuth(models.RoleAdmin))
+	aml.GET("/alerts", c.listAlertsHandler)
+	aml.POST("/scan", c.scanHandler)
+	aml.GET("/cases", c.listCasesHandler)
+	aml.GET("/cases/:id", c.getCaseHandler)
+	aml.POST("/cases/:id/notes", c.addNoteHandler)
+	aml.POST("/cases/:id/close", c.closeCaseHandler)
+	aml.GET("/cases/:id/sar", c.sarHandler)
+}
+
+func NewAMLController(as service.AMLService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *amlController {
+	return &amlController{service: as, am: am, rg: rg}
+}
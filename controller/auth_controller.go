@@ -16,14 +16,14 @@ type authController struct {
 
 func (c *authController) logoutHandler(ctx *gin.Context) {
 	var logoutRequest dto.LogoutRequest
-	if err := ctx.ShouldBindJSON(&logoutRequest); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	if !bindJSON(ctx, &logoutRequest) {
 		return
 	}
+	logoutRequest.Meta = requestMeta(ctx)
 
 	_, err := c.service.Logout(logoutRequest)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, "filed to logout")
+		ctx.Error(err)
 		return
 	}
 
@@ -32,14 +32,13 @@ func (c *authController) logoutHandler(ctx *gin.Context) {
 
 func (c *authController) loginHandler(ctx *gin.Context) {
 	var payload dto.LoginRequest
-	err := ctx.ShouldBindJSON(&payload)
-	if err != nil {
-		ctx.JSON(http.StatusOK, gin.H{"error": "Invalid request payload", "details": err.Error()})
+	if !bindJSON(ctx, &payload) {
 		return
 	}
+	payload.Meta = requestMeta(ctx)
 	data, err := c.service.PostLogin(payload)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, "filed to login")
+		ctx.Error(err)
 		return
 	}
 	ctx.JSON(http.StatusOK, data)
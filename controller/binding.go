@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+	"merchant-bank-api/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindQuery decodes and validates the query string into obj.
+// On failure it records a malformed or validation error on the context and returns false.
+func bindQuery(ctx *gin.Context, obj any) bool {
+	return handleBindError(ctx, ctx.ShouldBindQuery(obj))
+}
+
+// bindJSON decodes and validates the JSON request body into obj.
+// On failure it records a malformed or validation error on the context for the error middleware
+// and returns false.
+func bindJSON(ctx *gin.Context, obj any) bool {
+	return handleBindError(ctx, ctx.ShouldBindJSON(obj))
+}
+
+// handleBindError records a binding error on the context and reports whether binding succeeded.
+func handleBindError(ctx *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	if fields := util.ValidationErrors(err); fields != nil {
+		ctx.Error(service.NewValidationError("request payload failed validation", fields))
+		return false
+	}
+
+	ctx.Error(service.NewMalformedError("invalid request payload", err))
+	return false
+}
+
+// callerFrom returns the authenticated caller stored on the context by the auth middleware.
+func callerFrom(ctx *gin.Context) dto.Caller {
+	caller, _ := ctx.MustGet(dto.CallerContextKey).(dto.Caller)
+	return caller
+}
+
+// requestMeta returns the correlation ID and client details of the current request.
+func requestMeta(ctx *gin.Context) models.RequestMeta {
+	return models.RequestMeta{
+		CorrelationID: ctx.GetString(middleware.CorrelationIDKey),
+		IP:            ctx.ClientIP(),
+		UserAgent:     ctx.Request.UserAgent(),
+	}
+}
@@ -16,26 +16,29 @@ type customerController struct {
 }
 
 func (c *customerController) getAllHandlers(ctx *gin.Context) {
-	data, _ := c.service.GetAllCustomer()
+	data, err := c.service.GetAllCustomer()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
 	ctx.JSON(http.StatusOK, data)
 }
 
 // postHandler handles POST requests to create a new customer.
 // It expects a JSON payload containing the customer details in the request body.
-// If the payload is invalid, it returns a 200 status code with an error message in the response body.
+// If the payload is malformed it returns a 400 status code, and if it fails validation it returns
+// a 422 status code listing each invalid field.
 // If the customer is successfully created, it returns a 200 status code with the created customer data in the response body.
-// If an error occurs during the creation process, it returns a 500 status code with a generic error message.
+// If the username is taken it returns a 409 status code; other failures return a 500 problem response.
 func (c *customerController) postHandler(ctx *gin.Context) {
 	var payload dto.CustomerPayload
-	err := ctx.ShouldBindJSON(&payload)
-	if err != nil {
-		ctx.JSON(http.StatusOK, gin.H{"error": "Invalid request payload", "details": err.Error()})
+	if !bindJSON(ctx, &payload) {
 		return
 	}
 	fmt.Println("payload : ", payload)
 	data, err := c.service.PostCustomer(payload)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, "filed to create user")
+		ctx.Error(err)
 		return
 	}
 	ctx.JSON(http.StatusOK, data)
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+	"merchant-bank-api/util"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type disputeController struct {
+	service service.DisputeService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// openHandler handles POST requests to dispute a payment.
+func (c *disputeController) openHandler(ctx *gin.Context) {
+	var payload dto.DisputePayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.OpenDispute(callerFrom(ctx), ctx.Param("transaction_id"), payload, requestMeta(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// listHandler handles GET requests for the caller's disputes.
+func (c *disputeController) listHandler(ctx *gin.Context) {
+	var filter dto.DisputeFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetDisputes(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getHandler handles GET requests for one dispute.
+func (c *disputeController) getHandler(ctx *gin.Context) {
+	data, err := c.service.GetDispute(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// addEvidenceHandler handles POST requests that upload an evidence file as the multipart form
+// field "file" with an optional "description".
+func (c *disputeController) addEvidenceHandler(ctx *gin.Context) {
+	var upload dto.DisputeEvidenceUpload
+	if !handleBindError(ctx, ctx.ShouldBind(&upload)) {
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.Error(service.NewValidationError("request payload failed validation", []util.FieldError{{Field: "file", Rule: "required", Message: "is required"}}))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		ctx.Error(service.NewMalformedError("invalid evidence file", err))
+		return
+	}
+	defer file.Close()
+
+	data, err := c.service.AddEvidence(callerFrom(ctx), ctx.Param("id"), header.Filename, upload.Description, file)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// getEvidenceHandler handles GET requests that download an evidence file.
+func (c *disputeController) getEvidenceHandler(ctx *gin.Context) {
+	evidence, path, err := c.service.GetEvidenceFile(callerFrom(ctx), ctx.Param("id"), ctx.Param("evidence_id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Header("Content-Type", evidence.ContentType)
+	ctx.FileAttachment(path, evidence.FileName)
+}
+
+// submitHandler handles POST requests that submit the merchant's evidence for a decision.
+func (c *disputeController) submitHandler(ctx *gin.Context) {
+	var submission dto.DisputeSubmission
+	if !bindJSON(ctx, &submission) {
+		return
+	}
+	data, err := c.service.SubmitEvidence(callerFrom(ctx), ctx.Param("id"), submission)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// acceptHandler handles POST requests in which the merchant accepts a dispute.
+func (c *disputeController) acceptHandler(ctx *gin.Context) {
+	data, err := c.service.AcceptDispute(callerFrom(ctx), ctx.Param("id"), requestMeta(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// resolveHandler handles POST requests that decide a dispute as won or lost.
+func (c *disputeController) resolveHandler(ctx *gin.Context) {
+	var resolution dto.DisputeResolution
+	if !bindJSON(ctx, &resolution) {
+		return
+	}
+	data, err := c.service.ResolveDispute(callerFrom(ctx), ctx.Param("id"), resolution, requestMeta(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *disputeController) Route() {
+	merchant := c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin)
+	c.rg.POST("payments/:transaction_id/disputes", c.am.FilterAuth(models.RoleCustomer, models.RoleAdmin), c.openHandler)
+
+	disputes := c.rg.Group("disputes", c.am.FilterAuth(models.RoleCustomer, models.RoleMerchant, models.RoleAdmin))
+	disputes.GET("", c.listHandler)
+	disputes.GET("/:id", c.getHandler)
+	disputes.POST("/:id/evidence", merchant, c.addEvidenceHandler)
+	disputes.GET("/:id/evidence/:evidence_id", merchant, c.getEvidenceHandler)
+	disputes.POST("/:id/submit", merchant, c.submitHandler)
+	disputes.POST("/:id/accept", merchant, c.acceptHandler)
+	disputes.POST("/:id/resolve", c.am.FilterAuth(models.RoleAdmin), c.resolveHandler)
+}
+
+func NewDisputeController(ds service.DisputeService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *disputeController {
+	return &disputeController{service: ds, am: am, rg: rg}
+}
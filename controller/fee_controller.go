@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type feeController struct {
+	service service.FeeService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// listPlansHandler handles GET requests for the fee plans.
+func (c *feeController) listPlansHandler(ctx *gin.Context) {
+	data, err := c.service.GetPlans()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// createPlanHandler handles POST requests to create a fee plan.
+func (c *feeController) createPlanHandler(ctx *gin.Context) {
+	var payload dto.FeePlanPayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.CreatePlan(payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// assignPlanHandler handles PUT requests to put a merchant on a fee plan.
+func (c *feeController) assignPlanHandler(ctx *gin.Context) {
+	var payload dto.FeePlanAssignment
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.AssignPlan(ctx.Param("id"), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// platformAccountHandler handles GET requests for the platform account fee revenue is booked to.
+func (c *feeController) platformAccountHandler(ctx *gin.Context) {
+	data, err := c.service.GetPlatformAccount()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *feeController) Route() {
+	admin := c.am.FilterAuth(models.RoleAdmin)
+	c.rg.GET("fees/plans", admin, c.listPlansHandler)
+	c.rg.POST("fees/plans", admin, c.createPlanHandler)
+	c.rg.GET("fees/platform-account", admin, c.platformAccountHandler)
+	c.rg.PUT("merchants/:id/fee-plan", admin, c.assignPlanHandler)
+}
+
+func NewFeeController(fs service.FeeService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *feeController {
+	return &feeController{service: fs, am: am, rg: rg}
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"encoding/csv"
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type historyController struct {
+	service service.HistoryService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// exportRequest selects the format of a history export.
+type exportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json csv"`
+}
+
+// customerHistoryHandler handles GET requests for one customer's paginated activity history.
+func (c *historyController) customerHistoryHandler(ctx *gin.Context) {
+	var filter dto.HistoryFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	filter.CustomerID = ctx.Param("id")
+	c.respondPage(ctx, filter)
+}
+
+// customerExportHandler handles GET requests to export one customer's activity history.
+func (c *historyController) customerExportHandler(ctx *gin.Context) {
+	var filter dto.HistoryFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	filter.CustomerID = ctx.Param("id")
+	c.respondExport(ctx, filter)
+}
+
+// listHistoryHandler handles GET requests for the paginated activity history of all customers.
+func (c *historyController) listHistoryHandler(ctx *gin.Context) {
+	var filter dto.HistoryFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	c.respondPage(ctx, filter)
+}
+
+// exportHistoryHandler handles GET requests to export the activity history of all customers.
+func (c *historyController) exportHistoryHandler(ctx *gin.Context) {
+	var filter dto.HistoryFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	c.respondExport(ctx, filter)
+}
+
+// respondPage writes a page of history entries matching the filter.
+func (c *historyController) respondPage(ctx *gin.Context, filter dto.HistoryFilter) {
+	data, err := c.service.GetHistories(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// respondExport writes every history entry matching the filter as a JSON or CSV attachment.
+func (c *historyController) respondExport(ctx *gin.Context, filter dto.HistoryFilter) {
+	var req exportRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	data, err := c.service.ExportHistories(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if req.Format == "csv" {
+		ctx.Header("Content-Disposition", `attachment; filename="history.csv"`)
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Status(http.StatusOK)
+		writeHistoryCSV(ctx, data)
+		return
+	}
+
+	ctx.Header("Content-Disposition", `attachment; filename="history.json"`)
+	ctx.JSON(http.StatusOK, data)
+}
+
+// writeHistoryCSV writes history entries as CSV rows with a header line.
+func writeHistoryCSV(ctx *gin.Context, histories []models.History) {
+	w := csv.NewWriter(ctx.Writer)
+	w.Write([]string{"sequence", "customer_id", "action", "actor", "target", "metadata", "correlation_id", "timestamp", "prev_hash", "hash"})
+	for _, h := range histories {
+		w.Write([]string{
+			strconv.FormatUint(h.Sequence, 10), h.CustomerID, string(h.Action), formatParty(h.Actor), formatParty(h.Target),
+			string(h.Metadata), h.CorrelationID, h.Timestamp, h.PrevHash, h.Hash,
+		})
+	}
+	w.Flush()
+}
+
+// verifyHandler handles GET requests to verify the history hash chain.
+// It returns 200 with the report when the chain is intact and 409 with the first broken link otherwise.
+func (c *historyController) verifyHandler(ctx *gin.Context) {
+	report, err := c.service.VerifyChain()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	if !report.Valid {
+		ctx.JSON(http.StatusConflict, report)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+// formatParty renders an event party as "type:id" for CSV exports.
+func formatParty(party *models.EventParty) string {
+	if party == nil {
+		return ""
+	}
+	if party.ID == "" {
+		return party.Type
+	}
+	return party.Type + ":" + party.ID
+}
+
+func (c *historyController) Route() {
+	customers := c.rg.Group("customers/:id/history", c.am.FilterAuth(models.RoleCustomer, models.RoleAdmin))
+	customers.GET("", c.customerHistoryHandler)
+	customers.GET("/export", c.customerExportHandler)
+
+	history := c.rg.Group("history", c.am.FilterAuth(models.RoleAdmin))
+	history.GET("", c.listHistoryHandler)
+	history.GET("/export", c.exportHistoryHandler)
+	history.GET("/verify", c.verifyHandler)
+}
+
+func NewHistoryController(hs service.HistoryService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *historyController {
+	return &historyController{service: hs, am: am, rg: rg}
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type invoiceController struct {
+	service service.InvoiceService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// createHandler handles POST requests to create an invoice.
+func (c *invoiceController) createHandler(ctx *gin.Context) {
+	var payload dto.InvoicePayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.CreateInvoice(callerFrom(ctx), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// listHandler handles GET requests for the caller's invoices.
+func (c *invoiceController) listHandler(ctx *gin.Context) {
+	var filter dto.InvoiceFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetInvoices(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getHandler handles GET requests for one invoice.
+func (c *invoiceController) getHandler(ctx *gin.Context) {
+	data, err := c.service.GetInvoice(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// voidHandler handles POST requests to void an open invoice.
+func (c *invoiceController) voidHandler(ctx *gin.Context) {
+	data, err := c.service.VoidInvoice(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *invoiceController) Route() {
+	invoices := c.rg.Group("invoices", c.am.FilterAuth(models.RoleCustomer, models.RoleMerchant, models.RoleAdmin))
+	invoices.POST("", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin), c.createHandler)
+	invoices.GET("", c.listHandler)
+	invoices.GET("/:id", c.getHandler)
+	invoices.POST("/:id/void", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin), c.voidHandler)
+}
+
+func NewInvoiceController(is service.InvoiceService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *invoiceController {
+	return &invoiceController{service: is, am: am, rg: rg}
+}
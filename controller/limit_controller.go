@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type limitController struct {
+	service service.LimitService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// listLimitsHandler handles GET requests for every configured limit.
+func (c *limitController) listLimitsHandler(ctx *gin.Context) {
+	data, err := c.service.GetLimits()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// usageHandler returns a handler for GET requests for the limits of a scope and their current usage.
+func (c *limitController) usageHandler(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := c.service.GetUsage(scope, ctx.Param("id"))
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.JSON(http.StatusOK, data)
+	}
+}
+
+// setLimitsHandler returns a handler for PUT requests that replace the limits of a scope.
+func (c *limitController) setLimitsHandler(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var payload models.Limits
+		if !bindJSON(ctx, &payload) {
+			return
+		}
+		data, err := c.service.SetLimits(callerFrom(ctx), scope, ctx.Param("id"), payload)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.JSON(http.StatusOK, data)
+	}
+}
+
+// deleteOverrideHandler returns a handler for DELETE requests that remove a customer or merchant override.
+func (c *limitController) deleteOverrideHandler(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := c.service.DeleteOverride(callerFrom(ctx), scope, ctx.Param("id"))
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.JSON(http.StatusOK, data)
+	}
+}
+
+func (c *limitController) Route() {
+	limits := c.rg.Group("limits", c.am.FilterAuth(models.RoleAdmin))
+	limits.GET("", c.listLimitsHandler)
+	limits.GET("/global", c.usageHandler(models.LimitScopeGlobal))
+	limits.PUT("/global", c.setLimitsHandler(models.LimitScopeGlobal))
+	limits.GET("/customers/:id", c.usageHandler(models.LimitScopeCustomer))
+	limits.PUT("/customers/:id", c.setLimitsHandler(models.LimitScopeCustomer))
+	limits.DELETE("/customers/:id", c.deleteOverrideHandler(models.LimitScopeCustomer))
+	limits.GET("/merchants/:id", c.usageHandler(models.LimitScopeMerchant))
+	limits.PUT("/merchants/:id", c.setLimitsHandler(models.LimitScopeMerchant))
+	limits.DELETE("/merchants/:id", c.deleteOverrideHandler(models.LimitScopeMerchant))
+}
+
+func NewLimitController(ls service.LimitService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *limitController {
+	return &limitController{service: ls, am: am, rg: rg}
+}
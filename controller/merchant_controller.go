@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type merchantController struct {
+	service  service.MerchantService
+	webhooks service.WebhookService
+	am       middleware.AuthMiddleware
+	rg       *gin.RouterGroup
+}
+
+// postMerchantHandler handles POST requests to create a merchant after sanctions screening.
+func (c *merchantController) postMerchantHandler(ctx *gin.Context) {
+	var payload dto.MerchantPayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.PostMerchant(payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// registerWebhookHandler handles POST requests to register a webhook endpoint for a merchant.
+// The response is the only time the endpoint's signing secret is returned.
+func (c *merchantController) registerWebhookHandler(ctx *gin.Context) {
+	var payload dto.WebhookEndpointRequest
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.webhooks.RegisterEndpoint(callerFrom(ctx), ctx.Param("id"), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// listWebhooksHandler handles GET requests for a merchant's webhook endpoints.
+func (c *merchantController) listWebhooksHandler(ctx *gin.Context) {
+	data, err := c.webhooks.GetEndpoints(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// deleteWebhookHandler handles DELETE requests to deactivate a webhook endpoint.
+func (c *merchantController) deleteWebhookHandler(ctx *gin.Context) {
+	if err := c.webhooks.DeleteEndpoint(callerFrom(ctx), ctx.Param("id"), ctx.Param("endpoint_id")); err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// listDeliveriesHandler handles GET requests for a merchant's webhook delivery log.
+func (c *merchantController) listDeliveriesHandler(ctx *gin.Context) {
+	var filter dto.WebhookDeliveryFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.webhooks.GetDeliveries(callerFrom(ctx), ctx.Param("id"), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// payoutAccountHandler handles PUT requests to set the bank account a merchant is paid out to.
+func (c *merchantController) payoutAccountHandler(ctx *gin.Context) {
+	var payload dto.PayoutAccountPayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.SetPayoutAccount(ctx.Param("id"), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// redeliverHandler handles POST requests to send a webhook delivery again.
+func (c *merchantController) redeliverHandler(ctx *gin.Context) {
+	data, err := c.webhooks.Redeliver(callerFrom(ctx), ctx.Param("id"), ctx.Param("delivery_id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, data)
+}
+
+func (c *merchantController) Route() {
+	c.rg.POST("merchants", c.am.FilterAuth(models.RoleAdmin), c.postMerchantHandler)
+	c.rg.PUT("merchants/:id/payout-account", c.am.FilterAuth(models.RoleAdmin), c.payoutAccountHandler)
+
+	webhooks := c.rg.Group("merchants/:id/webhooks", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin))
+	webhooks.POST("", c.registerWebhookHandler)
+	webhooks.GET("", c.listWebhooksHandler)
+	webhooks.DELETE("/:endpoint_id", c.deleteWebhookHandler)
+	webhooks.GET("/deliveries", c.listDeliveriesHandler)
+	webhooks.POST("/deliveries/:delivery_id/redeliver", c.redeliverHandler)
+}
+
+func NewMerchantController(ms service.MerchantService, ws service.WebhookService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *merchantController {
+	return &merchantController{service: ms, webhooks: ws, am: am, rg: rg}
+}
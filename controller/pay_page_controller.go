@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+	"merchant-bank-api/templates"
+
+	"github.com/gin-gonic/gin"
+
+	"bytes"
+	"html/template"
+	"net/http"
+)
+
+// payPageTemplate renders the hosted payment page of an invoice.
+var payPageTemplate = template.Must(template.ParseFS(templates.FS, "pay.html"))
+
+type payPageController struct {
+	service service.InvoiceService
+	rg      *gin.RouterGroup
+}
+
+// payPageData is what the payment page template is rendered with.
+type payPageData struct {
+	Found bool
+	Page  dto.InvoicePage
+}
+
+// payPageHandler handles GET requests for the payment page of an invoice. The page is public:
+// its token is all it takes to see the invoice, and paying it asks the customer to log in.
+func (c *payPageController) payPageHandler(ctx *gin.Context) {
+	status := http.StatusOK
+	page, err := c.service.GetPaymentPage(ctx.Param("token"))
+	if err != nil {
+		de, ok := service.AsDomainError(err)
+		if !ok || de.Kind != service.KindNotFound {
+			ctx.Error(err)
+			return
+		}
+		status = http.StatusNotFound
+	}
+
+	var body bytes.Buffer
+	if err := payPageTemplate.Execute(&body, payPageData{Found: status == http.StatusOK, Page: page}); err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(status, "text/html; charset=utf-8", body.Bytes())
+}
+
+func (c *payPageController) Route() {
+	c.rg.GET("/pay/:token", c.payPageHandler)
+}
+
+func NewPayPageController(is service.InvoiceService, rg *gin.RouterGroup) *payPageController {
+	return &payPageController{service: is, rg: rg}
+}
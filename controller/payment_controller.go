@@ -3,6 +3,7 @@ package controller
 import (
 	"merchant-bank-api/middleware"
 	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
 	"merchant-bank-api/service"
 
 	"github.com/gin-gonic/gin"
@@ -11,30 +12,117 @@ import (
 )
 
 type paymentController struct {
-	service service.PaymentService
-	am      middleware.AuthMiddleware
-	rg      *gin.RouterGroup
+	service   service.PaymentService
+	scheduled service.ScheduledPaymentService
+	invoices  service.InvoiceService
+	am        middleware.AuthMiddleware
+	rg        *gin.RouterGroup
 }
 
+// postPaymentHandlers handles POST requests to pay a merchant now or, with an execution time,
+// to schedule the payment, which is answered with 202 Accepted. With an invoice token the
+// payment pays the invoice.
 func (c *paymentController) postPaymentHandlers(ctx *gin.Context) {
 	var payload models.PaymentRequest
-	err := ctx.ShouldBindJSON(&payload)
-	if err != nil {
-		ctx.JSON(http.StatusOK, gin.H{"error": "Invalid request payload", "details": err.Error()})
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	if payload.CustomerID != callerFrom(ctx).UserID {
+		ctx.Error(service.NewForbiddenError(service.CodeForbidden, "customers can only pay from their own account"))
+		return
+	}
+	payload.Meta = requestMeta(ctx)
+	if payload.InvoiceToken != "" {
+		data, err := c.invoices.PayInvoice(payload)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.JSON(http.StatusOK, data)
+		return
+	}
+	if payload.ExecuteAt != "" {
+		data, err := c.scheduled.Schedule(payload)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.JSON(http.StatusAccepted, data)
 		return
 	}
 	data, err := c.service.PostPayment(payload)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, "filed to create payment")
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// postSplitPaymentHandler handles POST requests to pay several merchants in one transaction.
+func (c *paymentController) postSplitPaymentHandler(ctx *gin.Context) {
+	var payload models.SplitPaymentRequest
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	if payload.CustomerID != callerFrom(ctx).UserID {
+		ctx.Error(service.NewForbiddenError(service.CodeForbidden, "customers can only pay from their own account"))
+		return
+	}
+	payload.Meta = requestMeta(ctx)
+	data, err := c.service.PostSplitPayment(payload)
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 	ctx.JSON(http.StatusOK, data)
 }
+
+// listPaymentsHandler handles GET requests to search payments.
+// Results are filtered by the query parameters, scoped to the caller and paginated with a cursor.
+func (c *paymentController) listPaymentsHandler(ctx *gin.Context) {
+	var filter dto.PaymentFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetPayments(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getPaymentHandler handles GET requests for a single payment by transaction ID.
+func (c *paymentController) getPaymentHandler(ctx *gin.Context) {
+	data, err := c.service.GetPayment(callerFrom(ctx), ctx.Param("transaction_id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// refundPaymentHandler handles POST requests to fully refund a payment.
+func (c *paymentController) refundPaymentHandler(ctx *gin.Context) {
+	data, err := c.service.RefundPayment(callerFrom(ctx), ctx.Param("transaction_id"), requestMeta(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
 func (c *paymentController) Route() {
 	router := c.rg.Group("payment-merchant")
-	router.POST("/", c.postPaymentHandlers)
+	router.POST("/", c.am.FilterAuth(models.RoleCustomer), c.postPaymentHandlers)
+	router.POST("/split", c.am.FilterAuth(models.RoleCustomer), c.postSplitPaymentHandler)
+
+	payments := c.rg.Group("payments", c.am.FilterAuth(models.RoleCustomer, models.RoleMerchant, models.RoleAdmin))
+	payments.GET("", c.listPaymentsHandler)
+	payments.GET("/:transaction_id", c.getPaymentHandler)
+	payments.POST("/:transaction_id/refund", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin), c.refundPaymentHandler)
 }
 
-func NewPaymentController(ps service.PaymentService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *paymentController {
-	return &paymentController{service: ps, am: am, rg: rg}
+func NewPaymentController(ps service.PaymentService, sps service.ScheduledPaymentService, is service.InvoiceService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *paymentController {
+	return &paymentController{service: ps, scheduled: sps, invoices: is, am: am, rg: rg}
 }
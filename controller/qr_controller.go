@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type qrController struct {
+	service service.QRService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// merchantQRHandler handles GET requests for a merchant's QR code, as its payload or, with
+// format=png, as an image.
+func (c *qrController) merchantQRHandler(ctx *gin.Context) {
+	var query dto.MerchantQRQuery
+	if !bindQuery(ctx, &query) {
+		return
+	}
+	data, err := c.service.GenerateMerchantQR(callerFrom(ctx), ctx.Param("id"), query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	if query.Format != "png" {
+		ctx.JSON(http.StatusOK, data)
+		return
+	}
+	image, err := c.service.RenderPNG(data.Payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Data(http.StatusOK, "image/png", image)
+}
+
+// payQRHandler handles POST requests in which a customer pays a scanned QR code.
+func (c *qrController) payQRHandler(ctx *gin.Context) {
+	var payload models.QRPaymentRequest
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	if payload.CustomerID != callerFrom(ctx).UserID {
+		ctx.Error(service.NewForbiddenError(service.CodeForbidden, "customers can only pay from their own account"))
+		return
+	}
+	payload.Meta = requestMeta(ctx)
+	data, err := c.service.PayQR(payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *qrController) Route() {
+	c.rg.GET("merchants/:id/qr", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin), c.merchantQRHandler)
+	c.rg.POST("payment-merchant/qr", c.am.FilterAuth(models.RoleCustomer), c.payQRHandler)
+}
+
+func NewQRController(qs service.QRService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *qrController {
+	return &qrController{service: qs, am: am, rg: rg}
+}
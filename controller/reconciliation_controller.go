@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"io"
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+	"merchant-bank-api/util"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type reconciliationController struct {
+	service service.ReconciliationService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// importHandler handles POST requests that upload an acquirer settlement file as the multipart
+// form field "file" and returns its reconciliation report.
+func (c *reconciliationController) importHandler(ctx *gin.Context) {
+	c.upload(ctx, c.service.Import)
+}
+
+// importStatementHandler handles POST requests that upload a camt.053 bank statement as the
+// multipart form field "file" and returns its reconciliation report.
+func (c *reconciliationController) importStatementHandler(ctx *gin.Context) {
+	c.upload(ctx, c.service.ImportStatement)
+}
+
+// upload passes the uploaded file to an import and responds with the report.
+func (c *reconciliationController) upload(ctx *gin.Context, importFile func(string, io.Reader, string) (models.Reconciliation, error)) {
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.Error(service.NewValidationError("request payload failed validation", []util.FieldError{{Field: "file", Rule: "required", Message: "is required"}}))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		ctx.Error(service.NewMalformedError("invalid settlement file", err))
+		return
+	}
+	defer file.Close()
+
+	data, err := importFile(header.Filename, file, callerFrom(ctx).UserID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// listHandler handles GET requests for the reconciliation report summaries.
+func (c *reconciliationController) listHandler(ctx *gin.Context) {
+	data, err := c.service.GetReconciliations()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getHandler handles GET requests for one reconciliation report with its items.
+func (c *reconciliationController) getHandler(ctx *gin.Context) {
+	var filter dto.ReconciliationItemFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetReconciliation(ctx.Param("id"), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *reconciliationController) Route() {
+	reconciliations := c.rg.Group("reconciliations", c.am.FilterAuth(models.RoleAdmin))
+	reconciliations.POST("", c.importHandler)
+	reconciliations.POST("/statements", c.importStatementHandler)
+	reconciliations.GET("", c.listHandler)
+	reconciliations.GET("/:id", c.getHandler)
+}
+
+func NewReconciliationController(rs service.ReconciliationService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *reconciliationController {
+	return &reconciliationController{service: rs, am: am, rg: rg}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type riskController struct {
+	service service.RiskService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// reviewQueueHandler handles GET requests for the payments held for risk review.
+func (c *riskController) reviewQueueHandler(ctx *gin.Context) {
+	var filter dto.ReviewQueueFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetReviewQueue(filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// reviewPaymentHandler handles POST requests to approve or reject a held payment.
+func (c *riskController) reviewPaymentHandler(ctx *gin.Context) {
+	var payload dto.ReviewRequest
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.ReviewPayment(callerFrom(ctx), ctx.Param("transaction_id"), payload, requestMeta(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *riskController) Route() {
+	reviews := c.rg.Group("risk/reviews", c.am.FilterAuth(models.RoleAdmin))
+	reviews.GET("", c.reviewQueueHandler)
+	reviews.POST("/:transaction_id", c.reviewPaymentHandler)
+}
+
+func NewRiskController(rs service.RiskService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *riskController {
+	return &riskController{service: rs, am: am, rg: rg}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type scheduledPaymentController struct {
+	service service.ScheduledPaymentService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// listHandler handles GET requests for the caller's scheduled payments.
+func (c *scheduledPaymentController) listHandler(ctx *gin.Context) {
+	var filter dto.ScheduledPaymentFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetScheduledPayments(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getHandler handles GET requests for one scheduled payment.
+func (c *scheduledPaymentController) getHandler(ctx *gin.Context) {
+	data, err := c.service.GetScheduledPayment(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// cancelHandler handles POST requests to cancel a scheduled payment before it is executed.
+func (c *scheduledPaymentController) cancelHandler(ctx *gin.Context) {
+	data, err := c.service.Cancel(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *scheduledPaymentController) Route() {
+	scheduled := c.rg.Group("scheduled-payments", c.am.FilterAuth(models.RoleCustomer, models.RoleMerchant, models.RoleAdmin))
+	scheduled.GET("", c.listHandler)
+	scheduled.GET("/:id", c.getHandler)
+	scheduled.POST("/:id/cancel", c.am.FilterAuth(models.RoleCustomer, models.RoleAdmin), c.cancelHandler)
+}
+
+func NewScheduledPaymentController(sps service.ScheduledPaymentService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *scheduledPaymentController {
+	return &scheduledPaymentController{service: sps, am: am, rg: rg}
+}
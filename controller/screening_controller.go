@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type screeningController struct {
+	service service.ScreeningService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// listHitsHandler handles GET requests for the recorded sanctions screening hits.
+func (c *screeningController) listHitsHandler(ctx *gin.Context) {
+	var filter dto.ScreeningHitFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetHits(filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// resolveHitHandler handles POST requests to clear or confirm a screening hit.
+func (c *screeningController) resolveHitHandler(ctx *gin.Context) {
+	var payload dto.HitResolution
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.ResolveHit(callerFrom(ctx), ctx.Param("id"), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *screeningController) Route() {
+	hits := c.rg.Group("screening/hits", c.am.FilterAuth(models.RoleAdmin))
+	hits.GET("", c.listHitsHandler)
+	hits.POST("/:id/resolve", c.resolveHitHandler)
+}
+
+func NewScreeningController(ss service.ScreeningService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *screeningController {
+	return &screeningController{service: ss, am: am, rg: rg}
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"fmt"
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type settlementController struct {
+	service service.SettlementService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// payoutsRequest selects the business day of the payout instructions.
+type payoutsRequest struct {
+	BusinessDate string `form:"business_date" json:"business_date" binding:"required,datetime=2006-01-02"`
+}
+
+// listBatchesHandler handles GET requests for settlement batches.
+func (c *settlementController) listBatchesHandler(ctx *gin.Context) {
+	var filter dto.SettlementFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetBatches(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getBatchHandler handles GET requests for one settlement batch with its items.
+func (c *settlementController) getBatchHandler(ctx *gin.Context) {
+	data, err := c.service.GetBatch(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// listPayoutsHandler handles GET requests for the pending payout instructions of a business day.
+func (c *settlementController) listPayoutsHandler(ctx *gin.Context) {
+	var request payoutsRequest
+	if !bindQuery(ctx, &request) {
+		return
+	}
+	data, err := c.service.GetPayouts(request.BusinessDate)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// exportPayoutsHandler handles POST requests to submit the pending payouts of a business day and
+// returns them as a pain.001 credit transfer message.
+func (c *settlementController) exportPayoutsHandler(ctx *gin.Context) {
+	var request payoutsRequest
+	if !bindJSON(ctx, &request) {
+		return
+	}
+	data, err := c.service.ExportPayouts(request.BusinessDate)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", data.MessageID+".xml"))
+	ctx.Data(http.StatusOK, "application/xml", data.Document)
+}
+
+// runHandler handles POST requests to settle a business day, by default the previous one.
+func (c *settlementController) runHandler(ctx *gin.Context) {
+	var request dto.SettlementRunRequest
+	if ctx.Request.ContentLength != 0 && !bindJSON(ctx, &request) {
+		return
+	}
+	if request.BusinessDate == "" {
+		request.BusinessDate = c.service.PreviousBusinessDate()
+	}
+	data, err := c.service.Settle(request.BusinessDate, callerFrom(ctx).UserID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *settlementController) Route() {
+	admin := c.am.FilterAuth(models.RoleAdmin)
+	settlements := c.rg.Group("settlements", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin))
+	settlements.GET("", c.listBatchesHandler)
+	settlements.GET("/payouts", admin, c.listPayoutsHandler)
+	settlements.POST("/payouts/export", admin, c.exportPayoutsHandler)
+	settlements.POST("/run", admin, c.runHandler)
+	settlements.GET("/:id", c.getBatchHandler)
+}
+
+func NewSettlementController(st service.SettlementService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *settlementController {
+	return &settlementController{service: st, am: am, rg: rg}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"net/http"
+)
+
+type streamController struct {
+	service   service.StreamService
+	am        middleware.AuthMiddleware
+	rg        *gin.RouterGroup
+	heartbeat time.Duration
+}
+
+// sseHandler handles GET requests for the caller's event stream as Server-Sent Events.
+// A reconnecting client resumes after the event named by the Last-Event-ID header.
+func (c *streamController) sseHandler(ctx *gin.Context) {
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Query("last_event_id")
+	}
+	sub, err := c.service.Subscribe(callerFrom(ctx), lastEventID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer sub.Close()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(c.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event := <-sub.Events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding stream event %s: %v", event.ID, err)
+				continue
+			}
+			fmt.Fprintf(ctx.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(ctx.Writer, ": heartbeat\n\n")
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+// webSocketHandler handles GET requests to upgrade to a WebSocket carrying the caller's event stream.
+// Each event is sent as a JSON text message; the last_event_id query parameter resumes after an event.
+func (c *streamController) webSocketHandler(ctx *gin.Context) {
+	sub, err := c.service.Subscribe(callerFrom(ctx), ctx.Query("last_event_id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer sub.Close()
+
+	server := websocket.Server{
+		// Clients authenticate with a bearer token rather than cookies, so the Origin is not checked.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			c.streamWebSocket(conn, sub)
+		},
+	}
+	server.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+// streamWebSocket writes the subscription's events to the connection until either side closes it.
+// Messages from the client are ignored; reading them is how a closed connection is noticed.
+func (c *streamController) streamWebSocket(conn *websocket.Conn, sub *service.Subscription) {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var message []byte
+		for websocket.Message.Receive(conn, &message) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(c.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case event := <-sub.Events:
+			err = websocket.JSON.Send(conn, event)
+		case <-heartbeat.C:
+			err = websocket.JSON.Send(conn, models.StreamEvent{Kind: models.StreamKindHeartbeat})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *streamController) Route() {
+	events := c.rg.Group("events", c.am.FilterQueryAuth(models.RoleCustomer, models.RoleMerchant, models.RoleAdmin))
+	events.GET("/stream", c.sseHandler)
+	events.GET("/ws", c.webSocketHandler)
+}
+
+func NewStreamController(ss service.StreamService, am middleware.AuthMiddleware, rg *gin.RouterGroup, heartbeat time.Duration) *streamController {
+	return &streamController{service: ss, am: am, rg: rg, heartbeat: heartbeat}
+}
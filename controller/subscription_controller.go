@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"merchant-bank-api/middleware"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+
+	"github.com/gin-gonic/gin"
+
+	"net/http"
+)
+
+type subscriptionController struct {
+	service service.SubscriptionService
+	am      middleware.AuthMiddleware
+	rg      *gin.RouterGroup
+}
+
+// createPlanHandler handles POST requests to create a subscription plan.
+func (c *subscriptionController) createPlanHandler(ctx *gin.Context) {
+	var payload dto.SubscriptionPlanPayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.CreatePlan(callerFrom(ctx), payload)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// listPlansHandler handles GET requests for subscription plans.
+func (c *subscriptionController) listPlansHandler(ctx *gin.Context) {
+	var filter dto.SubscriptionPlanFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetPlans(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getPlanHandler handles GET requests for one subscription plan.
+func (c *subscriptionController) getPlanHandler(ctx *gin.Context) {
+	data, err := c.service.GetPlan(ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// subscribeHandler handles POST requests in which a customer subscribes to a plan.
+func (c *subscriptionController) subscribeHandler(ctx *gin.Context) {
+	var payload dto.SubscriptionPayload
+	if !bindJSON(ctx, &payload) {
+		return
+	}
+	data, err := c.service.Subscribe(callerFrom(ctx), payload, requestMeta(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, data)
+}
+
+// listHandler handles GET requests for the caller's subscriptions.
+func (c *subscriptionController) listHandler(ctx *gin.Context) {
+	var filter dto.SubscriptionFilter
+	if !bindQuery(ctx, &filter) {
+		return
+	}
+	data, err := c.service.GetSubscriptions(callerFrom(ctx), filter)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// getHandler handles GET requests for one subscription with its charges.
+func (c *subscriptionController) getHandler(ctx *gin.Context) {
+	data, err := c.service.GetSubscription(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// pauseHandler handles POST requests to pause a subscription.
+func (c *subscriptionController) pauseHandler(ctx *gin.Context) {
+	data, err := c.service.Pause(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// resumeHandler handles POST requests to resume a paused subscription.
+func (c *subscriptionController) resumeHandler(ctx *gin.Context) {
+	data, err := c.service.Resume(callerFrom(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// cancelHandler handles POST requests to cancel a subscription. The body is optional.
+func (c *subscriptionController) cancelHandler(ctx *gin.Context) {
+	var cancellation dto.SubscriptionCancellation
+	if ctx.Request.ContentLength != 0 && !bindJSON(ctx, &cancellation) {
+		return
+	}
+	data, err := c.service.Cancel(callerFrom(ctx), ctx.Param("id"), cancellation)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+// runHandler handles POST requests to bill the due subscriptions now.
+func (c *subscriptionController) runHandler(ctx *gin.Context) {
+	data, err := c.service.BillDue()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (c *subscriptionController) Route() {
+	all := c.am.FilterAuth(models.RoleCustomer, models.RoleMerchant, models.RoleAdmin)
+	plans := c.rg.Group("subscription-plans", all)
+	plans.POST("", c.am.FilterAuth(models.RoleMerchant, models.RoleAdmin), c.createPlanHandler)
+	plans.GET("", c.listPlansHandler)
+	plans.GET("/:id", c.getPlanHandler)
+
+	subscriptions := c.rg.Group("subscriptions", all)
+	subscriptions.POST("", c.am.FilterAuth(models.RoleCustomer), c.subscribeHandler)
+	subscriptions.GET("", c.listHandler)
+	subscriptions.POST("/run", c.am.FilterAuth(models.RoleAdmin), c.runHandler)
+	subscriptions.GET("/:id", c.getHandler)
+	subscriptions.POST("/:id/pause", c.pauseHandler)
+	subscriptions.POST("/:id/resume", c.resumeHandler)
+	subscriptions.POST("/:id/cancel", c.cancelHandler)
+}
+
+func NewSubscriptionController(ss service.SubscriptionService, am middleware.AuthMiddleware, rg *gin.RouterGroup) *subscriptionController {
+	return &subscriptionController{service: ss, am: am, rg: rg}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"log"
 	"merchant-bank-api/config"
 	"merchant-bank-api/controller"
 	"merchant-bank-api/middleware"
 	"merchant-bank-api/service"
+	"merchant-bank-api/util"
+	"os"
+	_ "time/tzdata" // risk rules may name any timezone, even where the host has no zoneinfo
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,40 +18,119 @@ type Server struct {
 	ps     service.PaymentService
 	as     service.AuthService
 	cs     service.CustomerService
+	hs     service.HistoryService
+	ob     service.OutboxService
+	ws     service.WebhookService
+	ss     service.StreamService
+	rs     service.RiskService
+	ls     service.LimitService
+	ms     service.MerchantService
+	scr    service.ScreeningService
+	aml    service.AMLService
+	fs     service.FeeService
+	st     service.SettlementService
+	rc     service.ReconciliationService
+	ds     service.DisputeService
+	sub    service.SubscriptionService
+	sps    service.ScheduledPaymentService
+	is     service.InvoiceService
+	qs     service.QRService
+	sc     config.StreamConfig
+	vc     config.VerifierConfig
 	js     service.JwtService
 	engine *gin.Engine
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(NewServer(), os.Args[1:]))
+	}
 	NewServer().Start()
 }
 
 // initialRoute sets up the initial routing for the server.//+
 // It defines the endpoints and associates them with their respective handlers.//+
 func (s *Server) initialRoute() {
+	// The access token is taken out of the query string before the logger can record it.
+	s.engine.Use(middleware.StripAccessToken(), gin.Logger(), gin.Recovery(), middleware.RequestID(), middleware.ErrorHandler())
 	s.engine.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "pong",
 		})
 	})
+	controller.NewPayPageController(s.is, &s.engine.RouterGroup).Route() //hosted invoice payment pages
 	routerGroup := s.engine.Group("/api")
-	controller.NewCustomerController(s.cs, routerGroup).Route()      //get, post customer
-	controller.NewAuthController(s.as, routerGroup).Route()          //auth/login, logout
-	controller.NewPaymentController(s.ps, s.am, routerGroup).Route() //payment with middleware
+	controller.NewCustomerController(s.cs, routerGroup).Route()                             //get, post customer
+	controller.NewAuthController(s.as, routerGroup).Route()                                 //auth/login, logout
+	controller.NewPaymentController(s.ps, s.sps, s.is, s.am, routerGroup).Route()           //payment with middleware
+	controller.NewScheduledPaymentController(s.sps, s.am, routerGroup).Route()              //scheduled payments
+	controller.NewHistoryController(s.hs, s.am, routerGroup).Route()                        //customer and admin history
+	controller.NewMerchantController(s.ms, s.ws, s.am, routerGroup).Route()                 //merchant creation and webhooks
+	controller.NewRiskController(s.rs, s.am, routerGroup).Route()                           //risk review queue
+	controller.NewLimitController(s.ls, s.am, routerGroup).Route()                          //admin transaction limits
+	controller.NewScreeningController(s.scr, s.am, routerGroup).Route()                     //sanctions screening hits
+	controller.NewAMLController(s.aml, s.am, routerGroup).Route()                           //transaction monitoring and cases
+	controller.NewFeeController(s.fs, s.am, routerGroup).Route()                            //fee plans and platform account
+	controller.NewSettlementController(s.st, s.am, routerGroup).Route()                     //settlement batches and payouts
+	controller.NewReconciliationController(s.rc, s.am, routerGroup).Route()                 //acquirer file reconciliation
+	controller.NewDisputeController(s.ds, s.am, routerGroup).Route()                        //disputes and chargebacks
+	controller.NewSubscriptionController(s.sub, s.am, routerGroup).Route()                  //subscription plans and billing
+	controller.NewInvoiceController(s.is, s.am, routerGroup).Route()                        //invoices and payment links
+	controller.NewQRController(s.qs, s.am, routerGroup).Route()                             //merchant QR codes and QR payments
+	controller.NewStreamController(s.ss, s.am, routerGroup, s.sc.HeartbeatInterval).Route() //sse and websocket events
 }
 
 func (s *Server) Start() {
+	s.ob.Start()
+	s.ws.Start()
+	s.ss.Start()
+	s.st.Start()
+	s.ds.Start()
+	s.sub.Start()
+	s.sps.Start()
 	s.initialRoute()
 	s.engine.Run(":8080")
 }
 
 func NewServer() *Server {
 	c, _ := config.NewConfig()
-	cService := service.NewCustomerService()
+	if err := util.RegisterValidators(); err != nil {
+		log.Fatal(err)
+	}
+	scService, err := service.NewScreeningService(c.ScreeningConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cService := service.NewCustomerService(scService)
 	jwtService := service.NewJwtService(c.JwtConfig)
-	hService := service.NewHistoryService()
+	hService := service.NewHistoryService(c.AuditConfig)
 	aService := service.NewAuthService(jwtService, cService, hService)
-	pService := service.NewPaymentService(cService, hService)
+	mService := service.NewMerchantService(scService)
+	wService := service.NewWebhookService(c.WebhookConfig, mService)
+	oService := service.NewOutboxService(c.OutboxConfig)
+	oService.RegisterSink(service.NewHistorySink(hService))
+	oService.RegisterSink(service.NewWebhookSink(wService))
+	rates := service.NewFileRateProvider(c.FXConfig.RatesFile)
+	amlService, err := service.NewAMLService(c.AMLConfig, cService, mService, rates, c.FXConfig.ReportingCurrency)
+	if err != nil {
+		log.Fatal(err)
+	}
+	oService.RegisterSink(service.NewAMLSink(amlService))
+	fService := service.NewFeeService(mService)
+	oService.RegisterSink(service.NewFeeSink(fService))
+	lService := service.NewLimitService(rates, c.FXConfig.ReportingCurrency)
+	rService, err := service.NewRiskService(c.RiskConfig, oService, fService, rates, c.FXConfig.ReportingCurrency)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pService := service.NewPaymentService(cService, mService, oService, service.NewTransactionVerifier(c.VerifierConfig), rService, lService, scService, rates, fService)
+	iService := service.NewInvoiceService(c.InvoiceConfig, pService, cService, mService, service.NewSystemClock())
+	oService.RegisterSink(service.NewInvoiceSink(iService))
+	stService, err := service.NewSettlementService(c.SettlementConfig, mService)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sService := service.NewStreamService(c.StreamConfig)
 	authMidleware := middleware.NewAuthMiddleware(jwtService)
 
 	return &Server{
@@ -55,7 +138,26 @@ func NewServer() *Server {
 		ps:     pService,
 		as:     aService,
 		cs:     cService,
+		hs:     hService,
+		ob:     oService,
+		ws:     wService,
+		ss:     sService,
+		rs:     rService,
+		ls:     lService,
+		ms:     mService,
+		scr:    scService,
+		aml:    amlService,
+		fs:     fService,
+		st:     stService,
+		rc:     service.NewReconciliationService(c.SettlementConfig.Location, stService),
+		ds:     service.NewDisputeService(c.DisputeConfig, oService),
+		sub:    service.NewSubscriptionService(c.SubscriptionConfig, pService, mService, service.NewSystemClock()),
+		sps:    service.NewScheduledPaymentService(c.ScheduledPaymentConfig, pService, cService, mService, service.NewSystemClock()),
+		is:     iService,
+		qs:     service.NewQRService(c.QRConfig, pService, mService, service.NewSystemClock()),
+		sc:     c.StreamConfig,
+		vc:     c.VerifierConfig,
 		js:     jwtService,
-		engine: gin.Default(),
+		engine: gin.New(),
 	}
 }
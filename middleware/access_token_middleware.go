@@ -0,0 +1,25 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// AccessTokenParam is the query parameter browser EventSource and WebSocket clients, which cannot
+// set headers, pass their bearer token in.
+const AccessTokenParam = "access_token"
+
+// accessTokenKey is the gin context key holding the access token taken out of the query string.
+const accessTokenKey = "accessToken"
+
+// StripAccessToken removes the access_token query parameter from the request URL and keeps it in
+// the context for FilterQueryAuth, so the token never reaches the access log. It must run before
+// the logger.
+func StripAccessToken() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := ctx.Request.URL.Query()
+		if query.Has(AccessTokenParam) {
+			ctx.Set(accessTokenKey, query.Get(AccessTokenParam))
+			query.Del(AccessTokenParam)
+			ctx.Request.URL.RawQuery = query.Encode()
+		}
+		ctx.Next()
+	}
+}
@@ -1,15 +1,19 @@
 package middleware
 
 import (
+	"merchant-bank-api/models/dto"
 	"merchant-bank-api/service"
-	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthMiddleware interface {
 	FilterAuth(roles ...string) gin.HandlerFunc
+	// FilterQueryAuth is FilterAuth for endpoints that browser EventSource and WebSocket clients
+	// connect to: without an Authorization header it accepts the access_token query parameter.
+	FilterQueryAuth(roles ...string) gin.HandlerFunc
 }
 
 type authMiddleware struct {
@@ -17,27 +21,55 @@ type authMiddleware struct {
 }
 
 func (am *authMiddleware) FilterAuth(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.GetHeader("Authorization")
+		am.authorize(ctx, strings.Replace(header, "Bearer ", "", -1), roles)
+	}
+}
+
+// FilterQueryAuth authorizes the request like FilterAuth, taking the token from the query string
+// when there is no Authorization header. StripAccessToken has already moved it into the context.
+func (am *authMiddleware) FilterQueryAuth(roles ...string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		header := ctx.GetHeader("Authorization")
 		token := strings.Replace(header, "Bearer ", "", -1)
-		claims, err := am.jwtService.VerificationToken(token)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
-			return
-		}
-		var validRole bool
-		for _, r := range roles {
-			if r == claims["role"] {
-				validRole = true
-				break
-			}
+		if header == "" {
+			token = ctx.GetString(accessTokenKey)
 		}
-		if !validRole {
-			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "forbidden"})
-			return
+		am.authorize(ctx, token, roles)
+	}
+}
+
+// authorize verifies the token and that its role is one of roles, and stores the caller in the context.
+func (am *authMiddleware) authorize(ctx *gin.Context, token string, roles []string) {
+	claims, err := am.jwtService.VerificationToken(token)
+	if err != nil {
+		ctx.Error(service.NewUnauthorizedError(service.CodeInvalidToken, "missing or invalid bearer token"))
+		ctx.Abort()
+		return
+	}
+	var validRole bool
+	for _, r := range roles {
+		if r == claims["role"] {
+			validRole = true
+			break
 		}
-		ctx.Next()
 	}
+	if !validRole {
+		ctx.Error(service.NewForbiddenError(service.CodeForbidden, "role is not allowed to access this resource"))
+		ctx.Abort()
+		return
+	}
+	ctx.Set(dto.CallerContextKey, callerFromClaims(claims))
+	ctx.Next()
+}
+
+// callerFromClaims builds the authenticated caller from verified token claims.
+func callerFromClaims(claims jwt.MapClaims) dto.Caller {
+	userID, _ := claims["userId"].(string)
+	role, _ := claims["role"].(string)
+	merchantID, _ := claims["merchantId"].(string)
+	return dto.Caller{UserID: userID, Role: role, MerchantID: merchantID}
 }
 
 func NewAuthMiddleware(jwtService service.JwtService) AuthMiddleware {
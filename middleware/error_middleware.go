@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"log"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemContentType is the media type of RFC 7807 error responses.
+const problemContentType = "application/problem+json"
+
+// ErrorHandler renders the last error recorded on the context as a problem+json response.
+// Domain errors are mapped to their status code and stable error code; anything else becomes
+// a generic 500 so internal details are not leaked to clients.
+func ErrorHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+
+		problem := toProblem(ctx.Errors.Last().Err)
+		problem.Instance = ctx.Request.URL.Path
+		ctx.Header("Content-Type", problemContentType)
+		ctx.JSON(problem.Status, problem)
+	}
+}
+
+// toProblem converts an error into problem details.
+func toProblem(err error) dto.ProblemDetails {
+	de, ok := service.AsDomainError(err)
+	if !ok {
+		log.Printf("Unhandled error: %v", err)
+		return dto.ProblemDetails{
+			Type:   problemType("internal_error"),
+			Title:  http.StatusText(http.StatusInternalServerError),
+			Status: http.StatusInternalServerError,
+			Detail: "an unexpected error occurred",
+			Code:   "internal_error",
+		}
+	}
+
+	status := statusForKind(de.Kind)
+	return dto.ProblemDetails{
+		Type:   problemType(de.Code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: de.Error(),
+		Code:   de.Code,
+		Errors: de.Fields,
+	}
+}
+
+// statusForKind maps a domain error kind to its HTTP status code.
+func statusForKind(kind service.ErrorKind) int {
+	switch kind {
+	case service.KindMalformed:
+		return http.StatusBadRequest
+	case service.KindValidation, service.KindLimitExceeded:
+		return http.StatusUnprocessableEntity
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindUnauthorized:
+		return http.StatusUnauthorized
+	case service.KindForbidden:
+		return http.StatusForbidden
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindInsufficientFunds:
+		return http.StatusPaymentRequired
+	case service.KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// problemType builds the problem type URI for an error code.
+func problemType(code string) string {
+	return "/problems/" + code
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader is the header carrying the request correlation ID.
+const RequestIDHeader = "X-Request-ID"
+
+// CorrelationIDKey is the gin context key holding the request correlation ID.
+const CorrelationIDKey = "correlationId"
+
+// validRequestID limits client supplied correlation IDs to a safe, bounded format.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID assigns every request a correlation ID. A valid X-Request-ID sent by the client is
+// reused, otherwise a random one is generated. The ID is echoed in the response header.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		ctx.Set(CorrelationIDKey, id)
+		ctx.Header(RequestIDHeader, id)
+		ctx.Next()
+	}
+}
+
+// newRequestID returns a random 128-bit hex identifier.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
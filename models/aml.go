@@ -0,0 +1,88 @@
+package models
+
+// AML monitoring rule types.
+const (
+	AMLRuleStructuring = "structuring"
+	AMLRuleRapidInOut  = "rapid_in_out"
+	AMLRuleRoundAmount = "round_amount"
+)
+
+// AML case statuses.
+const (
+	AMLCaseOpen          = "open"
+	AMLCaseInvestigating = "investigating"
+	AMLCaseClosed        = "closed"
+)
+
+// AML case dispositions, recorded when a case is closed.
+const (
+	AMLDispositionSARFiled = "sar_filed"
+	AMLDispositionNoAction = "no_action"
+)
+
+// AMLRules is the content of the AML monitoring rules file.
+type AMLRules struct {
+	Rules []AMLRule `json:"rules" yaml:"rules"`
+}
+
+// AMLRule is one transaction monitoring rule. It looks at the payments of one customer or merchant
+// (Subject, default customer) within a sliding Window and raises an alert when at least MinCount
+// qualifying payments totalling at least MinTotal fall into it. Amounts are in the reporting currency,
+// except that round amounts are recognised in the payment currency. Which payments qualify depends on Type:
+//   - structuring: the amount is just below Threshold, at least Threshold*(1-Margin)
+//   - rapid_in_out: the payment was refunded within MaxHold of being made; the window covers the refunds
+//   - round_amount: the amount is a whole multiple of Multiple and at least MinAmount
+type AMLRule struct {
+	Name      string  `json:"name" yaml:"name"`
+	Type      string  `json:"type" yaml:"type"`
+	Subject   string  `json:"subject,omitempty" yaml:"subject"`
+	Window    string  `json:"window" yaml:"window"`
+	MinCount  int     `json:"min_count" yaml:"min_count"`
+	MinTotal  float64 `json:"min_total,omitempty" yaml:"min_total"`
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold"`
+	Margin    float64 `json:"margin,omitempty" yaml:"margin"`
+	MaxHold   string  `json:"max_hold,omitempty" yaml:"max_hold"`
+	Multiple  float64 `json:"multiple,omitempty" yaml:"multiple"`
+	MinAmount float64 `json:"min_amount,omitempty" yaml:"min_amount"`
+}
+
+// AMLAlert is a pattern detected by a monitoring rule. Later payments that extend the same pattern
+// are added to the alert while its case is not closed. Total is in Currency, the reporting currency.
+type AMLAlert struct {
+	ID             string     `json:"id"`
+	Rule           string     `json:"rule"`
+	Type           string     `json:"type"`
+	Subject        EventParty `json:"subject"`
+	TransactionIDs []string   `json:"transaction_ids"`
+	Count          int        `json:"count"`
+	Total          float64    `json:"total"`
+	Currency       string     `json:"currency"`
+	WindowStart    string     `json:"window_start"`
+	WindowEnd      string     `json:"window_end"`
+	Description    string     `json:"description"`
+	CaseID         string     `json:"case_id"`
+	CreatedAt      string     `json:"created_at"`
+	UpdatedAt      string     `json:"updated_at"`
+}
+
+// AMLCase groups the alerts of one customer or merchant for investigation.
+// New alerts join the subject's case until it is closed.
+type AMLCase struct {
+	ID          string        `json:"id"`
+	Subject     EventParty    `json:"subject"`
+	Status      string        `json:"status"`
+	AlertIDs    []string      `json:"alert_ids"`
+	AssignedTo  string        `json:"assigned_to,omitempty"`
+	Notes       []AMLCaseNote `json:"notes,omitempty"`
+	Disposition string        `json:"disposition,omitempty"`
+	CreatedAt   string        `json:"created_at"`
+	UpdatedAt   string        `json:"updated_at"`
+	ClosedAt    string        `json:"closed_at,omitempty"`
+}
+
+// AMLCaseNote is an investigator's note on a case.
+type AMLCaseNote struct {
+	Author    string `json:"author"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+}
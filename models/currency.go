@@ -0,0 +1,70 @@
+package models
+
+// DefaultCurrency is the currency of customers, merchants and payments stored without one.
+const DefaultCurrency = "IDR"
+
+// RoundingHalfEven rounds converted amounts to the nearest minor unit, ties to the even one.
+const RoundingHalfEven = "half_even"
+
+// currencyDecimals lists the ISO 4217 currencies whose minor unit is not two decimal places.
+var currencyDecimals = map[string]int{
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "UGX": 0, "VND": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyDecimals returns the number of decimal places of the currency's minor unit.
+func CurrencyDecimals(currency string) int {
+	if decimals, ok := currencyDecimals[currency]; ok {
+		return decimals
+	}
+	return 2
+}
+
+// currencyNumericCodes maps ISO 4217 alphabetic codes to the numeric codes QR payment payloads use.
+var currencyNumericCodes = map[string]string{
+	"AUD": "036", "CNY": "156", "EUR": "978", "GBP": "826", "HKD": "344", "IDR": "360", "INR": "356",
+	"JPY": "392", "KRW": "410", "MYR": "458", "PHP": "608", "SGD": "702", "THB": "764", "USD": "840",
+	"VND": "704",
+}
+
+// CurrencyNumericCode returns the ISO 4217 numeric code of the currency and whether it is known.
+func CurrencyNumericCode(currency string) (string, bool) {
+	code, ok := currencyNumericCodes[currency]
+	return code, ok
+}
+
+// CurrencyByNumericCode returns the currency with the ISO 4217 numeric code and whether it is known.
+func CurrencyByNumericCode(code string) (string, bool) {
+	for currency, numeric := range currencyNumericCodes {
+		if numeric == code {
+			return currency, true
+		}
+	}
+	return "", false
+}
+
+// RateTable is the content of the exchange rate file. Rates holds how many units of each
+// currency one unit of Base buys; rates between two other currencies are crossed through Base.
+type RateTable struct {
+	Base  string             `json:"base"`
+	AsOf  string             `json:"as_of"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// FXRate is the rate to convert one unit of From into To.
+type FXRate struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Rate     float64 `json:"rate"`
+	Provider string  `json:"provider"`
+	AsOf     string  `json:"as_of,omitempty"`
+}
+
+// FXConversion records how a payment amount was converted into the merchant's settlement currency.
+type FXConversion struct {
+	FXRate
+	UnroundedAmount float64 `json:"unrounded_amount"`
+	Rounding        string  `json:"rounding"`
+	Decimals        int     `json:"decimals"`
+	ConvertedAt     string  `json:"converted_at"`
+}
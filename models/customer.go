@@ -1,9 +1,45 @@
 // models/customer.go
 package models
 
+// Roles carried in the access token.
+const (
+	RoleCustomer = "customer"
+	RoleMerchant = "merchant"
+	RoleAdmin    = "admin"
+)
+
 type Customer struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	LoggedIn bool   `json:"logged_in"`
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	Name       string `json:"name,omitempty"`
+	Password   string `json:"password"`
+	LoggedIn   bool   `json:"logged_in"`
+	Role       string `json:"role,omitempty"`
+	MerchantID string `json:"merchant_id,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+}
+
+// GetRole returns the customer's role, defaulting to RoleCustomer for records without one.
+func (c Customer) GetRole() string {
+	if c.Role == "" {
+		return RoleCustomer
+	}
+	return c.Role
+}
+
+// GetCurrency returns the customer's currency, defaulting to DefaultCurrency for records without one.
+func (c Customer) GetCurrency() string {
+	if c.Currency == "" {
+		return DefaultCurrency
+	}
+	return c.Currency
+}
+
+// ScreeningName returns the name the customer is screened under: the full name, or the username
+// for records without one.
+func (c Customer) ScreeningName() string {
+	if c.Name == "" {
+		return c.Username
+	}
+	return c.Name
 }
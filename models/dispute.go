@@ -0,0 +1,79 @@
+package models
+
+// Dispute statuses. A dispute is opened against a payment, the merchant responds with evidence,
+// and it closes as won or lost; the merchant loses a dispute it accepts or leaves unanswered past
+// the evidence deadline.
+const (
+	DisputeOpened            = "opened"
+	DisputeEvidenceSubmitted = "evidence_submitted"
+	DisputeWon               = "won"
+	DisputeLost              = "lost"
+)
+
+// Dispute reason codes.
+const (
+	DisputeReasonFraudulent           = "fraudulent"
+	DisputeReasonProductNotReceived   = "product_not_received"
+	DisputeReasonProductUnacceptable  = "product_unacceptable"
+	DisputeReasonDuplicate            = "duplicate"
+	DisputeReasonCreditNotProcessed   = "credit_not_processed"
+	DisputeReasonSubscriptionCanceled = "subscription_canceled"
+	DisputeReasonGeneral              = "general"
+)
+
+// Ledger entry types of disputes. A chargeback takes the disputed amount back from the merchant
+// when the dispute opens, and a reversal returns it when the merchant wins.
+const (
+	LedgerEntryChargeback         = "chargeback"
+	LedgerEntryChargebackReversal = "chargeback_reversal"
+)
+
+// Dispute is a customer's dispute of a payment. Amount is in the payment currency and
+// SettlementAmount is its share of the payment's gross amount in the merchant's currency.
+type Dispute struct {
+	ID                 string            `json:"id"`
+	TransactionID      string            `json:"transaction_id"`
+	MerchantID         string            `json:"merchant_id"`
+	CustomerID         string            `json:"customer_id"`
+	Reason             string            `json:"reason"`
+	Description        string            `json:"description,omitempty"`
+	Amount             float64           `json:"amount"`
+	Currency           string            `json:"currency"`
+	SettlementAmount   float64           `json:"settlement_amount"`
+	SettlementCurrency string            `json:"settlement_currency"`
+	Status             string            `json:"status"`
+	EvidenceDueBy      string            `json:"evidence_due_by"`
+	Evidence           []DisputeEvidence `json:"evidence"`
+	Explanation        string            `json:"explanation,omitempty"`
+	ResolutionNote     string            `json:"resolution_note,omitempty"`
+	Ledger             []LedgerEntry     `json:"ledger"`
+	Timeline           []DisputeEvent    `json:"timeline"`
+	OpenedAt           string            `json:"opened_at"`
+	SubmittedAt        string            `json:"submitted_at,omitempty"`
+	ResolvedAt         string            `json:"resolved_at,omitempty"`
+}
+
+// Closed reports whether the dispute is won or lost.
+func (d Dispute) Closed() bool {
+	return d.Status == DisputeWon || d.Status == DisputeLost
+}
+
+// DisputeEvidence describes an uploaded evidence file. The file itself is stored on disk.
+type DisputeEvidence struct {
+	ID          string `json:"id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Description string `json:"description,omitempty"`
+	UploadedBy  string `json:"uploaded_by"`
+	UploadedAt  string `json:"uploaded_at"`
+}
+
+// DisputeEvent records a step of a dispute: the status it moved to, who took it and why.
+type DisputeEvent struct {
+	Status string     `json:"status"`
+	Actor  EventParty `json:"actor"`
+	Note   string     `json:"note,omitempty"`
+	At     string     `json:"at"`
+}
@@ -0,0 +1,68 @@
+package dto
+
+import "merchant-bank-api/models"
+
+// AMLAlertFilter holds the query parameters of the AML alert list endpoint.
+type AMLAlertFilter struct {
+	Rule        string `form:"rule" binding:"omitempty,max=64"`
+	SubjectType string `form:"subject_type" binding:"omitempty,oneof=customer merchant"`
+	SubjectID   string `form:"subject_id" binding:"omitempty,id"`
+	CaseID      string `form:"case_id" binding:"omitempty,max=64"`
+}
+
+// AMLCaseFilter holds the query parameters of the AML case list endpoint.
+type AMLCaseFilter struct {
+	Status      string `form:"status" binding:"omitempty,oneof=open investigating closed"`
+	SubjectType string `form:"subject_type" binding:"omitempty,oneof=customer merchant"`
+	SubjectID   string `form:"subject_id" binding:"omitempty,id"`
+}
+
+// AMLCaseDetail is a case together with its alerts.
+type AMLCaseDetail struct {
+	models.AMLCase
+	Alerts []models.AMLAlert `json:"alerts"`
+}
+
+// AMLCaseNoteRequest is the payload to add an investigator's note to a case.
+type AMLCaseNoteRequest struct {
+	Text string `json:"text" binding:"required,max=2000"`
+}
+
+// AMLCaseCloseRequest is the payload to close a case.
+type AMLCaseCloseRequest struct {
+	Disposition string `json:"disposition" binding:"required,oneof=sar_filed no_action"`
+	Note        string `json:"note" binding:"max=2000"`
+}
+
+// AMLScanResult reports what a full rescan of the payments found.
+type AMLScanResult struct {
+	AlertsCreated int `json:"alerts_created"`
+	AlertsUpdated int `json:"alerts_updated"`
+}
+
+// SARSubject identifies the customer or merchant a suspicious activity report is about.
+type SARSubject struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// SuspiciousActivityReport is the report exported for an AML case.
+type SuspiciousActivityReport struct {
+	ReportID      string               `json:"report_id"`
+	CaseID        string               `json:"case_id"`
+	CaseStatus    string               `json:"case_status"`
+	Disposition   string               `json:"disposition,omitempty"`
+	Subject       SARSubject           `json:"subject"`
+	ActivityStart string               `json:"activity_start"`
+	ActivityEnd   string               `json:"activity_end"`
+	TotalAmount   float64              `json:"total_amount"`
+	Currency      string               `json:"currency"`
+	Narrative     string               `json:"narrative"`
+	Alerts        []models.AMLAlert    `json:"alerts"`
+	Transactions  []models.Payment     `json:"transactions"`
+	Notes         []models.AMLCaseNote `json:"notes"`
+	GeneratedBy   string               `json:"generated_by"`
+	GeneratedAt   string               `json:"generated_at"`
+}
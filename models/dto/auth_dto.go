@@ -1,10 +1,15 @@
 package dto
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"merchant-bank-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string             `json:"username" binding:"required,max=32"`
+	Password string             `json:"password" binding:"required,max=72"`
+	Meta     models.RequestMeta `json:"-"`
 }
 
 type LoginResponse struct {
@@ -12,15 +17,30 @@ type LoginResponse struct {
 }
 
 type JwtCustomClaims struct {
-	UserId string `json:"userId"`
+	UserId     string `json:"userId"`
+	Role       string `json:"role"`
+	MerchantId string `json:"merchantId,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// CallerContextKey is the gin context key holding the authenticated Caller.
+const CallerContextKey = "caller"
+
+// Caller identifies the authenticated user making a request.
+type Caller struct {
+	UserID     string
+	Role       string
+	MerchantID string
+}
+
 type CustomerPayload struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" binding:"required,alphanum,min=3,max=32"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Name     string `json:"name" binding:"max=100"`
+	Currency string `json:"currency" binding:"omitempty,iso4217"`
 }
 
 type LogoutRequest struct {
-	CustomerID string `json:"customer_id"`
+	CustomerID string             `json:"customer_id" binding:"required,id"`
+	Meta       models.RequestMeta `json:"-"`
 }
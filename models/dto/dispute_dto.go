@@ -0,0 +1,30 @@
+package dto
+
+// DisputePayload is the payload to dispute a payment. The amount defaults to the whole payment.
+type DisputePayload struct {
+	Reason      string  `json:"reason" binding:"required,oneof=fraudulent product_not_received product_unacceptable duplicate credit_not_processed subscription_canceled general"`
+	Amount      float64 `json:"amount" binding:"omitempty,money"`
+	Description string  `json:"description" binding:"max=1000"`
+}
+
+// DisputeFilter holds the query parameters of the dispute list endpoint.
+type DisputeFilter struct {
+	Status     string `form:"status" binding:"omitempty,oneof=opened evidence_submitted won lost"`
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+}
+
+// DisputeEvidenceUpload is the multipart form of an evidence upload besides the file itself.
+type DisputeEvidenceUpload struct {
+	Description string `form:"description" binding:"max=500"`
+}
+
+// DisputeSubmission is the merchant's response to a dispute, sent once its evidence is uploaded.
+type DisputeSubmission struct {
+	Explanation string `json:"explanation" binding:"required,max=2000"`
+}
+
+// DisputeResolution is the payload to decide a dispute whose evidence was submitted.
+type DisputeResolution struct {
+	Outcome string `json:"outcome" binding:"required,oneof=won lost"`
+	Note    string `json:"note" binding:"max=1000"`
+}
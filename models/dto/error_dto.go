@@ -0,0 +1,15 @@
+package dto
+
+import "merchant-bank-api/util"
+
+// ProblemDetails is an RFC 7807 problem+json error body.
+// Code is a stable identifier clients can branch on.
+type ProblemDetails struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   []util.FieldError `json:"errors,omitempty"`
+}
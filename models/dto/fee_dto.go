@@ -0,0 +1,21 @@
+package dto
+
+import "merchant-bank-api/models"
+
+// FeePlanPayload is the payload to create a fee plan.
+type FeePlanPayload struct {
+	Name     string                    `json:"name" binding:"required,max=100"`
+	Type     string                    `json:"type" binding:"required,oneof=percentage fixed tiered mcc"`
+	Currency string                    `json:"currency" binding:"omitempty,iso4217"`
+	Rate     models.FeeRate            `json:"rate"`
+	Tiers    []models.FeeTier          `json:"tiers" binding:"max=20"`
+	MCCRates map[string]models.FeeRate `json:"mcc_rates" binding:"max=200"`
+	MinFee   float64                   `json:"min_fee" binding:"min=0"`
+	MaxFee   float64                   `json:"max_fee" binding:"min=0"`
+}
+
+// FeePlanAssignment is the payload to put a merchant on a fee plan. An empty PlanID removes the plan.
+type FeePlanAssignment struct {
+	PlanID string `json:"plan_id" binding:"omitempty,max=64"`
+	MCC    string `json:"mcc" binding:"omitempty,len=4,numeric"`
+}
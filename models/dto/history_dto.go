@@ -0,0 +1,34 @@
+package dto
+
+import (
+	"merchant-bank-api/models"
+	"time"
+)
+
+// HistoryFilter holds the query parameters accepted by the history endpoints.
+type HistoryFilter struct {
+	CustomerID string    `form:"customer_id" binding:"omitempty,id"`
+	Action     string    `form:"action" binding:"omitempty,max=32"`
+	From       time.Time `form:"from"`
+	To         time.Time `form:"to"`
+	Limit      int       `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor     string    `form:"cursor"`
+}
+
+// HistoryPage is a page of history entries with the cursor of the next page, if any.
+type HistoryPage struct {
+	Data       []models.History `json:"data"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// ChainVerification reports the result of verifying the history hash chain.
+// When the chain is broken, BrokenSequence, BrokenPosition (the 1-based index of the entry in
+// history.json) and Reason describe the first broken link.
+type ChainVerification struct {
+	Valid          bool   `json:"valid"`
+	Entries        int    `json:"entries"`
+	Checkpoints    int    `json:"checkpoints"`
+	BrokenSequence uint64 `json:"broken_sequence,omitempty"`
+	BrokenPosition int    `json:"broken_position,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
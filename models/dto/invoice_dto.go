@@ -0,0 +1,37 @@
+package dto
+
+import "merchant-bank-api/models"
+
+// InvoicePayload is the payload to create an invoice. Merchants invoice for themselves; admins
+// name the merchant. Without a customer the invoice can be paid by any customer with its link.
+type InvoicePayload struct {
+	MerchantID string               `json:"merchant_id" binding:"omitempty,id"`
+	CustomerID string               `json:"customer_id" binding:"omitempty,id"`
+	Currency   string               `json:"currency" binding:"omitempty,iso4217"`
+	DueDate    string               `json:"due_date" binding:"required,datetime=2006-01-02"`
+	Memo       string               `json:"memo" binding:"max=500"`
+	Items      []InvoiceItemPayload `json:"items" binding:"required,min=1,max=50,dive"`
+}
+
+// InvoiceItemPayload is a line of an invoice payload.
+type InvoiceItemPayload struct {
+	Description string  `json:"description" binding:"required,max=200"`
+	Quantity    int     `json:"quantity" binding:"required,min=1,max=10000"`
+	UnitPrice   float64 `json:"unit_price" binding:"required,money"`
+}
+
+// InvoiceFilter holds the query parameters of the invoice list endpoint.
+type InvoiceFilter struct {
+	Status     string `form:"status" binding:"omitempty,oneof=open processing paid void refunded"`
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+	CustomerID string `form:"customer_id" binding:"omitempty,id"`
+}
+
+// InvoicePage is what the hosted payment page of an invoice shows: the invoice, the merchant it
+// is paid to and whether it can still be paid.
+type InvoicePage struct {
+	Invoice      models.Invoice
+	MerchantName string
+	Payable      bool
+	Overdue      bool
+}
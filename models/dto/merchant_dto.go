@@ -0,0 +1,15 @@
+package dto
+
+// MerchantPayload is the payload to create a merchant.
+type MerchantPayload struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Currency string `json:"currency" binding:"omitempty,iso4217"`
+}
+
+// PayoutAccountPayload is the payload to set the bank account a merchant's payouts are credited to.
+// Either the IBAN or the account number is required.
+type PayoutAccountPayload struct {
+	IBAN   string `json:"iban" binding:"required_without=Number,omitempty,max=34"`
+	Number string `json:"number" binding:"omitempty,max=34"`
+	BIC    string `json:"bic" binding:"required,max=11"`
+}
@@ -0,0 +1,96 @@
+package dto
+
+import (
+	"merchant-bank-api/models"
+	"time"
+)
+
+// PaymentFilter holds the query parameters accepted by the payment search endpoint.
+type PaymentFilter struct {
+	CustomerID string    `form:"customer_id" binding:"omitempty,id"`
+	MerchantID string    `form:"merchant_id" binding:"omitempty,id"`
+	Status     string    `form:"status" binding:"omitempty,oneof=succeeded failed refunded pending_review"`
+	From       time.Time `form:"from"`
+	To         time.Time `form:"to"`
+	MinAmount  float64   `form:"min_amount" binding:"omitempty,min=0"`
+	MaxAmount  float64   `form:"max_amount" binding:"omitempty,min=0"`
+	SplitID    string    `form:"split_id" binding:"omitempty,id"`
+	Limit      int       `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor     string    `form:"cursor"`
+}
+
+// PaymentPage is a page of payments with the cursor of the next page, if any.
+type PaymentPage struct {
+	Data       []models.Payment `json:"data"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// SplitPayment is a split payment with the payments of its legs. Its status is the status all of
+// its legs share.
+type SplitPayment struct {
+	TransactionID string           `json:"transaction_id"`
+	CustomerID    string           `json:"customer_id"`
+	Amount        float64          `json:"amount"`
+	Currency      string           `json:"currency"`
+	Status        string           `json:"status"`
+	Legs          []models.Payment `json:"legs"`
+}
+
+// ReviewQueueFilter holds the query parameters of the risk review queue endpoint.
+type ReviewQueueFilter struct {
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor     string `form:"cursor"`
+}
+
+// ReviewRequest is the payload to approve or reject a payment held for risk review.
+type ReviewRequest struct {
+	Decision string `json:"decision" binding:"required,oneof=approve reject"`
+	Note     string `json:"note" binding:"max=500"`
+}
+
+// LimitUsage reports the limits that apply to a customer, a merchant or globally, and how much
+// of the daily and monthly limits the stored payments already use.
+type LimitUsage struct {
+	Scope       string        `json:"scope"`
+	ID          string        `json:"id,omitempty"`
+	Limits      models.Limits `json:"limits"`
+	Override    bool          `json:"override"`
+	Currency    string        `json:"currency"`
+	DailyUsed   float64       `json:"daily_used"`
+	MonthlyUsed float64       `json:"monthly_used"`
+}
+
+// SettlementFilter holds the query parameters of the settlement batch list endpoint.
+type SettlementFilter struct {
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+	From       string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To         string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// SettlementRunRequest is the payload to settle a business day. The default is the previous day.
+type SettlementRunRequest struct {
+	BusinessDate string `json:"business_date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// PayoutExport is a pain.001 credit transfer message with the payouts it submits.
+type PayoutExport struct {
+	MessageID string
+	Payouts   []models.PayoutInstruction
+	Document  []byte
+}
+
+// SettlementRun reports the batches a settlement run created and the merchants it skipped
+// because their batch for the day already existed.
+type SettlementRun struct {
+	BusinessDate string                   `json:"business_date"`
+	Batches      []models.SettlementBatch `json:"batches"`
+	Skipped      []string                 `json:"skipped"`
+}
+
+// ScheduledPaymentFilter holds the query parameters of the scheduled payment list endpoint.
+type ScheduledPaymentFilter struct {
+	Status     string `form:"status" binding:"omitempty,oneof=scheduled executed failed canceled"`
+	CustomerID string `form:"customer_id" binding:"omitempty,id"`
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+}
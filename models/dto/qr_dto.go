@@ -0,0 +1,21 @@
+package dto
+
+// MerchantQRQuery holds the query parameters of the merchant QR code endpoint. With an amount the
+// code is dynamic; Reference then identifies its payment and is generated when left out.
+type MerchantQRQuery struct {
+	Amount    float64 `form:"amount" binding:"omitempty,money"`
+	Currency  string  `form:"currency" binding:"omitempty,iso4217"`
+	Reference string  `form:"reference" binding:"omitempty,alphanum,max=25"`
+	Format    string  `form:"format" binding:"omitempty,oneof=json png"`
+}
+
+// MerchantQR is a merchant-presented EMV QR code payload and what it encodes.
+type MerchantQR struct {
+	MerchantID        string  `json:"merchant_id"`
+	PointOfInitiation string  `json:"point_of_initiation"`
+	Amount            float64 `json:"amount,omitempty"`
+	Currency          string  `json:"currency"`
+	Reference         string  `json:"reference,omitempty"`
+	ExpiresAt         string  `json:"expires_at,omitempty"`
+	Payload           string  `json:"payload"`
+}
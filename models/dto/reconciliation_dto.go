@@ -0,0 +1,6 @@
+package dto
+
+// ReconciliationItemFilter holds the query parameters of the reconciliation report endpoint.
+type ReconciliationItemFilter struct {
+	Status string `form:"status" binding:"omitempty,oneof=matched missing extra amount_mismatch"`
+}
@@ -0,0 +1,14 @@
+package dto
+
+// ScreeningHitFilter holds the query parameters of the screening hit list endpoint.
+type ScreeningHitFilter struct {
+	Status      string `form:"status" binding:"omitempty,oneof=open cleared confirmed"`
+	SubjectType string `form:"subject_type" binding:"omitempty,oneof=customer merchant"`
+	SubjectID   string `form:"subject_id" binding:"omitempty,id"`
+}
+
+// HitResolution is the payload to settle a screening hit after manual review.
+type HitResolution struct {
+	Status string `json:"status" binding:"required,oneof=cleared confirmed"`
+	Note   string `json:"note" binding:"max=500"`
+}
@@ -0,0 +1,44 @@
+package dto
+
+// SubscriptionPlanPayload is the payload to create a subscription plan. Merchants create plans
+// for themselves; admins name the merchant.
+type SubscriptionPlanPayload struct {
+	MerchantID    string  `json:"merchant_id" binding:"omitempty,id"`
+	Name          string  `json:"name" binding:"required,max=100"`
+	Amount        float64 `json:"amount" binding:"required,money"`
+	Currency      string  `json:"currency" binding:"omitempty,iso4217"`
+	Interval      string  `json:"interval" binding:"required,oneof=day week month year"`
+	IntervalCount int     `json:"interval_count" binding:"omitempty,min=1,max=365"`
+}
+
+// SubscriptionPlanFilter holds the query parameters of the subscription plan list endpoint.
+type SubscriptionPlanFilter struct {
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+}
+
+// SubscriptionPayload is the payload a customer subscribes to a plan with, accepting its
+// mandate. Billing starts on StartDate, by default right away.
+type SubscriptionPayload struct {
+	PlanID    string `json:"plan_id" binding:"required,max=64"`
+	StartDate string `json:"start_date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// SubscriptionFilter holds the query parameters of the subscription list endpoint.
+type SubscriptionFilter struct {
+	Status     string `form:"status" binding:"omitempty,oneof=active past_due paused canceled"`
+	MerchantID string `form:"merchant_id" binding:"omitempty,id"`
+	CustomerID string `form:"customer_id" binding:"omitempty,id"`
+}
+
+// SubscriptionCancellation is the payload to cancel a subscription.
+type SubscriptionCancellation struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// BillingRun reports the subscriptions a billing run charged.
+type BillingRun struct {
+	At        string   `json:"at"`
+	Succeeded []string `json:"succeeded"`
+	Failed    []string `json:"failed"`
+	Canceled  []string `json:"canceled"`
+}
@@ -0,0 +1,13 @@
+package dto
+
+// WebhookEndpointRequest is the payload to register a webhook endpoint.
+type WebhookEndpointRequest struct {
+	URL    string   `json:"url" binding:"required,http_url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=payment.succeeded payment.failed payment.refunded payment.disputed payment.dispute_closed"`
+}
+
+// WebhookDeliveryFilter holds the query parameters of the delivery log endpoint.
+type WebhookDeliveryFilter struct {
+	Status     string `form:"status" binding:"omitempty,oneof=pending succeeded dead"`
+	EndpointID string `form:"endpoint_id" binding:"omitempty,id"`
+}
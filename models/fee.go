@@ -0,0 +1,76 @@
+package models
+
+// Fee plan types.
+const (
+	FeePlanPercentage = "percentage"
+	FeePlanFixed      = "fixed"
+	FeePlanTiered     = "tiered"
+	FeePlanMCC        = "mcc"
+)
+
+// Ledger entry types of the platform account.
+const (
+	LedgerEntryFee = "fee"
+)
+
+// PlatformAccountID identifies the account fee revenue is booked to.
+const PlatformAccountID = "platform"
+
+// FeeRate is a fee of Percentage percent of the amount plus Fixed.
+type FeeRate struct {
+	Percentage float64 `json:"percentage,omitempty"`
+	Fixed      float64 `json:"fixed,omitempty"`
+}
+
+// FeeTier applies its rate to payments of at most UpTo. An UpTo of 0 has no upper bound.
+type FeeTier struct {
+	UpTo float64 `json:"up_to,omitempty"`
+	FeeRate
+}
+
+// FeePlan is a merchant pricing plan. Which rate applies depends on Type:
+//   - percentage and fixed: Rate
+//   - tiered: the rate of the first of Tiers the payment amount fits in
+//   - mcc: the rate MCCRates lists for the merchant's category code, or Rate for other codes
+//
+// Fees are charged on the settlement amount, and the result is kept between MinFee and MaxFee when
+// they are set. Fixed fees, MinFee, MaxFee and tier bounds are in Currency, so a plan can only be
+// assigned to merchants settling in that currency.
+type FeePlan struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Type      string             `json:"type"`
+	Currency  string             `json:"currency,omitempty"`
+	Rate      FeeRate            `json:"rate"`
+	Tiers     []FeeTier          `json:"tiers,omitempty"`
+	MCCRates  map[string]FeeRate `json:"mcc_rates,omitempty"`
+	MinFee    float64            `json:"min_fee,omitempty"`
+	MaxFee    float64            `json:"max_fee,omitempty"`
+	CreatedAt string             `json:"created_at"`
+}
+
+// GetCurrency returns the currency of the plan's amounts, defaulting to DefaultCurrency for records without one.
+func (p FeePlan) GetCurrency() string {
+	if p.Currency == "" {
+		return DefaultCurrency
+	}
+	return p.Currency
+}
+
+// LedgerEntry is a booking on the platform account.
+type LedgerEntry struct {
+	ID            string  `json:"id"`
+	Type          string  `json:"type"`
+	TransactionID string  `json:"transaction_id"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	BookedAt      string  `json:"booked_at"`
+}
+
+// PlatformAccount holds the platform's fee revenue per currency and the entries it was booked with.
+type PlatformAccount struct {
+	ID       string             `json:"id"`
+	Balances map[string]float64 `json:"balances"`
+	Entries  []LedgerEntry      `json:"entries"`
+}
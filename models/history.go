@@ -1,8 +1,88 @@
 // models/history.go
 package models
 
+import "encoding/json"
+
+// EventType is the enumerated type of a history event.
+type EventType string
+
+const (
+	EventAuthLogin       EventType = "auth.login"
+	EventAuthLoginFailed EventType = "auth.login_failed"
+	EventAuthLogout      EventType = "auth.logout"
+	EventPaymentCreated  EventType = "payment.created"
+	EventPaymentRefunded EventType = "payment.refunded"
+	EventPaymentReviewed EventType = "payment.reviewed"
+	// EventPaymentDisputed and EventPaymentDisputeClosed mark a payment's dispute opening and closing.
+	EventPaymentDisputed      EventType = "payment.disputed"
+	EventPaymentDisputeClosed EventType = "payment.dispute_closed"
+)
+
+// eventTypes lists every known event type.
+var eventTypes = map[EventType]bool{
+	EventAuthLogin:            true,
+	EventAuthLoginFailed:      true,
+	EventAuthLogout:           true,
+	EventPaymentCreated:       true,
+	EventPaymentRefunded:      true,
+	EventPaymentReviewed:      true,
+	EventPaymentDisputed:      true,
+	EventPaymentDisputeClosed: true,
+}
+
+// Valid reports whether t is a known event type.
+func (t EventType) Valid() bool {
+	return eventTypes[t]
+}
+
+// Party types used for event actors and targets.
+const (
+	PartyCustomer = "customer"
+	PartyMerchant = "merchant"
+	PartyPayment  = "payment"
+	PartyAdmin    = "admin"
+	PartySystem   = "system"
+)
+
+// EventParty identifies who performed an event or what it was performed on.
+type EventParty struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// History is an entry of the audit log. Entries form a SHA-256 hash chain:
+// Hash covers the entry content together with PrevHash, the Hash of the entry before it.
+// Fields added after the chain was introduced are omitted when empty so older entries keep their hash.
 type History struct {
-	CustomerID string `json:"customer_id"`
-	Action     string `json:"action"`
-	Timestamp  string `json:"timestamp"`
+	Sequence      uint64          `json:"sequence"`
+	CustomerID    string          `json:"customer_id"`
+	Action        EventType       `json:"action"`
+	Actor         *EventParty     `json:"actor,omitempty"`
+	Target        *EventParty     `json:"target,omitempty"`
+	Metadata      json.RawMessage `json:"metadata,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	EventID       string          `json:"event_id,omitempty"`
+	Timestamp     string          `json:"timestamp"`
+	PrevHash      string          `json:"prev_hash"`
+	Hash          string          `json:"hash"`
+}
+
+// HistoryEvent describes an event to be recorded in the history log.
+type HistoryEvent struct {
+	Type          EventType
+	CustomerID    string
+	Actor         EventParty
+	Target        EventParty
+	Metadata      map[string]any
+	CorrelationID string
+	// EventID identifies the source event; entries with an already recorded EventID are skipped.
+	EventID string
+}
+
+// HistoryCheckpoint is a signed snapshot of the head of the history hash chain.
+type HistoryCheckpoint struct {
+	Sequence  uint64 `json:"sequence"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
 }
@@ -0,0 +1,40 @@
+package models
+
+// Invoice statuses. An open invoice can be paid through its payment link until its due date; a
+// payment held for review makes it processing until the review decides whether it is paid.
+const (
+	InvoiceOpen       = "open"
+	InvoiceProcessing = "processing"
+	InvoicePaid       = "paid"
+	InvoiceVoid       = "void"
+	InvoiceRefunded   = "refunded"
+)
+
+// Invoice is a bill a merchant sends to a customer, who pays it through the payment link of its
+// Token. CustomerID is the customer it is addressed to or, for invoices addressed to anyone, the
+// customer who paid it. Amount is the total of its items in Currency.
+type Invoice struct {
+	ID            string        `json:"id"`
+	MerchantID    string        `json:"merchant_id"`
+	CustomerID    string        `json:"customer_id,omitempty"`
+	Currency      string        `json:"currency"`
+	Items         []InvoiceItem `json:"items"`
+	Amount        float64       `json:"amount"`
+	DueDate       string        `json:"due_date"`
+	Memo          string        `json:"memo,omitempty"`
+	Token         string        `json:"token"`
+	PaymentURL    string        `json:"payment_url"`
+	Status        string        `json:"status"`
+	TransactionID string        `json:"transaction_id,omitempty"`
+	CreatedAt     string        `json:"created_at"`
+	PaidAt        string        `json:"paid_at,omitempty"`
+	VoidedAt      string        `json:"voided_at,omitempty"`
+}
+
+// InvoiceItem is a line of an invoice. Amount is Quantity times UnitPrice.
+type InvoiceItem struct {
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
@@ -0,0 +1,41 @@
+package models
+
+// Transaction limit scopes.
+const (
+	LimitScopeGlobal   = "global"
+	LimitScopeCustomer = "customer"
+	LimitScopeMerchant = "merchant"
+)
+
+// Limits caps payment amounts. A zero field means no limit.
+// Daily and monthly limits apply to calendar days and months in the server's time zone.
+type Limits struct {
+	PerTransaction float64 `json:"per_transaction" binding:"omitempty,money"`
+	Daily          float64 `json:"daily" binding:"omitempty,money"`
+	Monthly        float64 `json:"monthly" binding:"omitempty,money"`
+}
+
+// LimitTier holds the limits of every customer or every merchant: Default applies to everyone
+// without an entry in Overrides, and an override replaces the default as a whole.
+type LimitTier struct {
+	Default   Limits            `json:"default"`
+	Overrides map[string]Limits `json:"overrides"`
+}
+
+// LimitConfig is the stored set of transaction limits.
+// Global limits cap every single payment and the total volume of all payments together.
+type LimitConfig struct {
+	Global    Limits    `json:"global"`
+	Customer  LimitTier `json:"customer"`
+	Merchant  LimitTier `json:"merchant"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt string    `json:"updated_at,omitempty"`
+}
+
+// For returns the limits that apply to the given ID.
+func (t LimitTier) For(id string) Limits {
+	if limits, ok := t.Overrides[id]; ok {
+		return limits
+	}
+	return t.Default
+}
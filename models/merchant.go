@@ -2,6 +2,29 @@
 package models
 
 type Merchant struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency,omitempty"`
+	// MCC is the merchant category code, four digits.
+	MCC string `json:"mcc,omitempty"`
+	// FeePlanID is the fee plan the merchant is charged on; without one it pays no fees.
+	FeePlanID string `json:"fee_plan_id,omitempty"`
+	// PayoutAccount is the bank account payouts are credited to.
+	PayoutAccount *BankAccount `json:"payout_account,omitempty"`
+}
+
+// BankAccount identifies an account by IBAN or, at banks without IBANs, by account number,
+// together with the BIC of the bank.
+type BankAccount struct {
+	IBAN   string `json:"iban,omitempty"`
+	Number string `json:"number,omitempty"`
+	BIC    string `json:"bic"`
+}
+
+// GetCurrency returns the currency the merchant settles in, defaulting to DefaultCurrency for records without one.
+func (m Merchant) GetCurrency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
 }
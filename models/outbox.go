@@ -0,0 +1,38 @@
+package models
+
+import "encoding/json"
+
+// Outbox event statuses.
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+	OutboxStatusDiscarded = "discarded"
+)
+
+// OutboxEvent is a payment event waiting to be published to the event sinks.
+// It is written together with the payment change it describes, and Version is the payment
+// version produced by that change.
+type OutboxEvent struct {
+	ID            uint64          `json:"id"`
+	Key           string          `json:"key"`
+	Type          EventType       `json:"type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Version       int             `json:"version"`
+	Actor         EventParty      `json:"actor"`
+	Payload       json.RawMessage `json:"payload"`
+	Metadata      map[string]any  `json:"metadata,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Status        string          `json:"status"`
+	DeliveredTo   []string        `json:"delivered_to,omitempty"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     string          `json:"created_at"`
+	DeliveredAt   string          `json:"delivered_at,omitempty"`
+}
+
+// Payment decodes the payment snapshot carried by the event.
+func (e OutboxEvent) Payment() (Payment, error) {
+	var payment Payment
+	err := json.Unmarshal(e.Payload, &payment)
+	return payment, err
+}
@@ -1,10 +1,72 @@
 package models
 
+import "fmt"
+
+// Payment statuses.
+const (
+	PaymentStatusSucceeded = "succeeded"
+	PaymentStatusFailed    = "failed"
+	PaymentStatusRefunded  = "refunded"
+	// PaymentStatusPendingReview marks a payment held by the risk engine until it is reviewed.
+	PaymentStatusPendingReview = "pending_review"
+)
+
 type PaymentRequest struct {
-	TransactionID string  `json:"transaction_id"`
-	CustomerID    string  `json:"customer_id"`
-	MerchantID    string  `json:"merchant_id"`
-	Amount        float64 `json:"amount"`
+	TransactionID string  `json:"transaction_id" binding:"required,id"`
+	CustomerID    string  `json:"customer_id" binding:"required,id"`
+	MerchantID    string  `json:"merchant_id" binding:"required_without=InvoiceToken,omitempty,id"`
+	Amount        float64 `json:"amount" binding:"required_without=InvoiceToken,omitempty,money"`
+	Currency      string  `json:"currency" binding:"omitempty,iso4217"`
+	// InvoiceToken pays the invoice with the token; the merchant, amount and currency default to the invoice's.
+	InvoiceToken string `json:"invoice_token" binding:"omitempty,max=64"`
+	// ExecuteAt schedules the payment for a later time instead of paying now.
+	ExecuteAt string      `json:"execute_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Meta      RequestMeta `json:"-"`
+	// SubscriptionID marks a charge the merchant makes under the customer's subscription mandate.
+	SubscriptionID string `json:"-"`
+	// ScheduledPaymentID marks the execution of a payment the customer scheduled.
+	ScheduledPaymentID string `json:"-"`
+	// SplitID marks a leg of a split payment.
+	SplitID string `json:"-"`
+	// InvoiceID marks the payment of an invoice.
+	InvoiceID string `json:"-"`
+}
+
+// Preauthorized reports whether the customer authorised the payment beforehand, under a
+// subscription mandate or by scheduling it, so that it does not need them to be logged in.
+func (r PaymentRequest) Preauthorized() bool {
+	return r.SubscriptionID != "" || r.ScheduledPaymentID != ""
+}
+
+// SplitPaymentRequest pays several merchants in one customer transaction. Every leg becomes a
+// payment of its own, and the legs either all succeed or all fail. The transaction ID leaves room
+// for the "-10" suffix of the last leg, so leg IDs stay within the 64 characters of an ID.
+type SplitPaymentRequest struct {
+	TransactionID string      `json:"transaction_id" binding:"required,id,max=61"`
+	CustomerID    string      `json:"customer_id" binding:"required,id"`
+	Currency      string      `json:"currency" binding:"omitempty,iso4217"`
+	Legs          []SplitLeg  `json:"legs" binding:"required,min=2,max=10,unique=MerchantID,dive"`
+	Meta          RequestMeta `json:"-"`
+}
+
+// SplitLeg is the part of a split payment that goes to one merchant.
+type SplitLeg struct {
+	MerchantID string  `json:"merchant_id" binding:"required,id"`
+	Amount     float64 `json:"amount" binding:"required,money"`
+}
+
+// LegRequest returns the payment request of the split's leg at index i. Legs are numbered from 1
+// after the split's transaction ID.
+func (r SplitPaymentRequest) LegRequest(i int) PaymentRequest {
+	return PaymentRequest{
+		TransactionID: fmt.Sprintf("%s-%d", r.TransactionID, i+1),
+		CustomerID:    r.CustomerID,
+		MerchantID:    r.Legs[i].MerchantID,
+		Amount:        r.Legs[i].Amount,
+		Currency:      r.Currency,
+		Meta:          r.Meta,
+		SplitID:       r.TransactionID,
+	}
 }
 
 type Payment struct {
@@ -12,5 +74,44 @@ type Payment struct {
 	CustomerID    string  `json:"customer_id"`
 	MerchantID    string  `json:"merchant_id"`
 	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency,omitempty"`
+	Status        string  `json:"status"`
+	Version       int     `json:"version"`
 	Timestamp     string  `json:"timestamp"`
+	RefundedAt    string  `json:"refunded_at,omitempty"`
+	// Verification is the transaction verification result the payment was accepted or failed on.
+	Verification *Verification `json:"verification,omitempty"`
+	// Risk is the risk engine's assessment of the payment and, once reviewed, the review outcome.
+	Risk *RiskAssessment `json:"risk,omitempty"`
+	// SettlementAmount is the amount credited to the merchant in SettlementCurrency, the merchant's currency.
+	SettlementAmount   float64 `json:"settlement_amount,omitempty"`
+	SettlementCurrency string  `json:"settlement_currency,omitempty"`
+	// FX records the conversion when the payment and settlement currencies differ.
+	FX *FXConversion `json:"fx,omitempty"`
+	// GrossAmount, FeeAmount and NetAmount split the settlement amount into the merchant's fee and
+	// the rest once the payment is captured, i.e. succeeds. They are in the settlement currency.
+	GrossAmount float64 `json:"gross_amount,omitempty"`
+	FeeAmount   float64 `json:"fee_amount,omitempty"`
+	NetAmount   float64 `json:"net_amount,omitempty"`
+	FeePlanID   string  `json:"fee_plan_id,omitempty"`
+	CapturedAt  string  `json:"captured_at,omitempty"`
+	// DisputeID and DisputeStatus follow the payment's dispute, if it has one.
+	DisputeID     string `json:"dispute_id,omitempty"`
+	DisputeStatus string `json:"dispute_status,omitempty"`
+	// SubscriptionID is the subscription the payment billed, if any.
+	SubscriptionID string `json:"subscription_id,omitempty"`
+	// ScheduledPaymentID is the scheduled payment the payment executed, if any.
+	ScheduledPaymentID string `json:"scheduled_payment_id,omitempty"`
+	// SplitID is the transaction ID of the split payment the payment is a leg of, if any.
+	SplitID string `json:"split_id,omitempty"`
+	// InvoiceID is the invoice the payment paid, if any.
+	InvoiceID string `json:"invoice_id,omitempty"`
+}
+
+// GetCurrency returns the payment's currency, defaulting to DefaultCurrency for records without one.
+func (p Payment) GetCurrency() string {
+	if p.Currency == "" {
+		return DefaultCurrency
+	}
+	return p.Currency
 }
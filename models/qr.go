@@ -0,0 +1,31 @@
+package models
+
+// Points of initiation of a merchant QR code. A static code is printed once and the customer
+// enters the amount; a dynamic code carries the amount and a reference for a single payment.
+const (
+	QRStatic  = "static"
+	QRDynamic = "dynamic"
+)
+
+// QRCode is an issued dynamic QR code. It pays its merchant Amount in Currency once, until
+// ExpiresAt; TransactionID and PaidAt are set when it is paid.
+type QRCode struct {
+	Reference     string  `json:"reference"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	ExpiresAt     string  `json:"expires_at"`
+	CreatedAt     string  `json:"created_at"`
+	TransactionID string  `json:"transaction_id,omitempty"`
+	PaidAt        string  `json:"paid_at,omitempty"`
+}
+
+// QRPaymentRequest pays the merchant of a scanned QR code payload. A static code needs the
+// customer's transaction ID and amount; a dynamic code brings its own.
+type QRPaymentRequest struct {
+	CustomerID    string      `json:"customer_id" binding:"required,id"`
+	Payload       string      `json:"payload" binding:"required,max=512"`
+	TransactionID string      `json:"transaction_id" binding:"omitempty,id"`
+	Amount        float64     `json:"amount" binding:"omitempty,money"`
+	Meta          RequestMeta `json:"-"`
+}
@@ -0,0 +1,62 @@
+package models
+
+// Reconciliation item statuses.
+const (
+	// ReconciliationMatched is a file line that agrees with a captured payment.
+	ReconciliationMatched = "matched"
+	// ReconciliationMissing is a captured payment of the file's period that the file does not list.
+	ReconciliationMissing = "missing"
+	// ReconciliationExtra is a file line without a captured payment.
+	ReconciliationExtra = "extra"
+	// ReconciliationAmountMismatch is a file line whose amount or currency differs from its payment.
+	ReconciliationAmountMismatch = "amount_mismatch"
+)
+
+// Reconciliation file formats.
+const (
+	// ReconciliationSourceCSV is an acquirer settlement CSV file.
+	ReconciliationSourceCSV = "csv"
+	// ReconciliationSourceCamt053 is a camt.053 bank statement.
+	ReconciliationSourceCamt053 = "camt.053"
+)
+
+// Reconciliation is the report of an acquirer settlement file or bank statement compared with the
+// stored payments and, for statements, the submitted payouts. The period runs from the earliest to
+// the latest transaction date of the file.
+type Reconciliation struct {
+	ID         string                `json:"id"`
+	Source     string                `json:"source"`
+	FileName   string                `json:"file_name"`
+	PeriodFrom string                `json:"period_from"`
+	PeriodTo   string                `json:"period_to"`
+	Summary    ReconciliationSummary `json:"summary"`
+	Items      []ReconciliationItem  `json:"items,omitempty"`
+	ImportedBy string                `json:"imported_by"`
+	ImportedAt string                `json:"imported_at"`
+}
+
+// ReconciliationSummary counts the lines of a file and the items of each status.
+type ReconciliationSummary struct {
+	Lines          int `json:"lines"`
+	Matched        int `json:"matched"`
+	Missing        int `json:"missing"`
+	Extra          int `json:"extra"`
+	AmountMismatch int `json:"amount_mismatch"`
+}
+
+// ReconciliationItem is a file line, a payment or payout, or both. Line is zero for missing items
+// and Difference is the file amount minus the payment amount when both are in the same currency.
+// Statement debits are reconciled with payouts and carry the PayoutID instead of a TransactionID.
+type ReconciliationItem struct {
+	Status          string  `json:"status"`
+	TransactionID   string  `json:"transaction_id,omitempty"`
+	PayoutID        string  `json:"payout_id,omitempty"`
+	Line            int     `json:"line,omitempty"`
+	FileAmount      float64 `json:"file_amount,omitempty"`
+	FileCurrency    string  `json:"file_currency,omitempty"`
+	FileDate        string  `json:"file_date,omitempty"`
+	PaymentAmount   float64 `json:"payment_amount,omitempty"`
+	PaymentCurrency string  `json:"payment_currency,omitempty"`
+	PaymentDate     string  `json:"payment_date,omitempty"`
+	Difference      float64 `json:"difference,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// RequestMeta carries information about the HTTP request that triggered an operation.
+// Operations started by the system itself leave it empty.
+type RequestMeta struct {
+	CorrelationID string
+	IP            string
+	UserAgent     string
+}
+
+// Metadata returns the request details worth recording on a history event.
+func (m RequestMeta) Metadata() map[string]any {
+	metadata := map[string]any{}
+	if m.IP != "" {
+		metadata["ip"] = m.IP
+	}
+	if m.UserAgent != "" {
+		metadata["user_agent"] = m.UserAgent
+	}
+	return metadata
+}
@@ -0,0 +1,69 @@
+package models
+
+// Risk decisions.
+const (
+	RiskDecisionAllow  = "allow"
+	RiskDecisionReview = "review"
+	RiskDecisionBlock  = "block"
+)
+
+// Risk rule types.
+const (
+	RiskRuleAmount   = "amount"
+	RiskRuleVelocity = "velocity"
+	RiskRuleNewParty = "new_party"
+	RiskRuleHours    = "hours"
+)
+
+// Manual review decisions.
+const (
+	ReviewApprove = "approve"
+	ReviewReject  = "reject"
+)
+
+// RiskRules is the content of the risk rules file.
+// A payment scoring at least ReviewScore is held for review and one scoring at least BlockScore is blocked.
+type RiskRules struct {
+	ReviewScore int        `json:"review_score" yaml:"review_score"`
+	BlockScore  int        `json:"block_score" yaml:"block_score"`
+	Rules       []RiskRule `json:"rules" yaml:"rules"`
+}
+
+// RiskRule is one rule of the risk engine. A triggered rule adds Score to the payment's risk score.
+// Which of the other fields apply depends on Type:
+//   - amount: the payment amount is at least MinAmount
+//   - velocity: the customer already made MaxCount payments, or more than MaxTotal in total, within Window
+//   - new_party: the customer and/or merchant selected by Customer and Merchant have at most MaxPayments prior payments
+//   - hours: the payment is made between Start and End ("15:04") in Timezone
+type RiskRule struct {
+	Name        string  `json:"name" yaml:"name"`
+	Type        string  `json:"type" yaml:"type"`
+	Score       int     `json:"score" yaml:"score"`
+	MinAmount   float64 `json:"min_amount,omitempty" yaml:"min_amount"`
+	Window      string  `json:"window,omitempty" yaml:"window"`
+	MaxCount    int     `json:"max_count,omitempty" yaml:"max_count"`
+	MaxTotal    float64 `json:"max_total,omitempty" yaml:"max_total"`
+	Customer    bool    `json:"customer,omitempty" yaml:"customer"`
+	Merchant    bool    `json:"merchant,omitempty" yaml:"merchant"`
+	MaxPayments int     `json:"max_payments,omitempty" yaml:"max_payments"`
+	Start       string  `json:"start,omitempty" yaml:"start"`
+	End         string  `json:"end,omitempty" yaml:"end"`
+	Timezone    string  `json:"timezone,omitempty" yaml:"timezone"`
+}
+
+// RiskAssessment is the risk engine's verdict on a payment.
+type RiskAssessment struct {
+	Score          int         `json:"score"`
+	Decision       string      `json:"decision"`
+	TriggeredRules []string    `json:"triggered_rules,omitempty"`
+	AssessedAt     string      `json:"assessed_at"`
+	Review         *RiskReview `json:"review,omitempty"`
+}
+
+// RiskReview is the outcome of the manual review of a payment held by the risk engine.
+type RiskReview struct {
+	Decision   string `json:"decision"`
+	Note       string `json:"note,omitempty"`
+	ReviewedBy string `json:"reviewed_by"`
+	ReviewedAt string `json:"reviewed_at"`
+}
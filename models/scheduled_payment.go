@@ -0,0 +1,28 @@
+package models
+
+// Scheduled payment statuses. A scheduled payment is executed once it is due, which creates its
+// payment whatever that payment's status; it fails when the payment is rejected outright.
+const (
+	ScheduledPaymentScheduled = "scheduled"
+	ScheduledPaymentExecuted  = "executed"
+	ScheduledPaymentFailed    = "failed"
+	ScheduledPaymentCanceled  = "canceled"
+)
+
+// ScheduledPayment is a payment a customer asked to make at ExecuteAt. It is checked like any
+// payment when it is executed; PaymentStatus is the status of the payment that created.
+type ScheduledPayment struct {
+	ID            string  `json:"id"`
+	TransactionID string  `json:"transaction_id"`
+	CustomerID    string  `json:"customer_id"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	ExecuteAt     string  `json:"execute_at"`
+	Status        string  `json:"status"`
+	PaymentStatus string  `json:"payment_status,omitempty"`
+	Error         string  `json:"error,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+	ExecutedAt    string  `json:"executed_at,omitempty"`
+	CanceledAt    string  `json:"canceled_at,omitempty"`
+}
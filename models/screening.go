@@ -0,0 +1,71 @@
+package models
+
+// Screening decisions.
+const (
+	ScreeningClear  = "clear"
+	ScreeningReview = "review"
+	ScreeningBlock  = "block"
+)
+
+// Screening contexts say when a name was screened.
+const (
+	ScreeningContextOnboarding = "onboarding"
+	ScreeningContextPayment    = "payment"
+)
+
+// Screening hit statuses. Open hits wait for manual review; cleared hits are false positives and
+// no longer match the subject, while confirmed hits block the subject from then on.
+const (
+	ScreeningHitOpen      = "open"
+	ScreeningHitCleared   = "cleared"
+	ScreeningHitConfirmed = "confirmed"
+)
+
+// SanctionsEntry is one entry of the sanctions list with its name and aliases.
+type SanctionsEntry struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type,omitempty"`
+	Program string   `json:"program,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// ScreeningSubject is the customer or merchant whose name is screened.
+// ID is empty for a subject that is screened before it is created, and stays empty in the hits of
+// applications that were rejected.
+type ScreeningSubject struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// ScreeningMatch is a sanctions list entry whose name or alias resembles the subject's name.
+// Score is the similarity of the names from 0 to 100.
+type ScreeningMatch struct {
+	EntryID     string  `json:"entry_id"`
+	EntryName   string  `json:"entry_name"`
+	MatchedName string  `json:"matched_name"`
+	Program     string  `json:"program,omitempty"`
+	Score       float64 `json:"score"`
+}
+
+// ScreeningResult is the outcome of screening a subject.
+type ScreeningResult struct {
+	Decision string           `json:"decision"`
+	Matches  []ScreeningMatch `json:"matches,omitempty"`
+}
+
+// ScreeningHit is a recorded sanctions match waiting for, or settled by, manual review.
+type ScreeningHit struct {
+	ID            string           `json:"id"`
+	Subject       ScreeningSubject `json:"subject"`
+	Context       string           `json:"context"`
+	TransactionID string           `json:"transaction_id,omitempty"`
+	Match         ScreeningMatch   `json:"match"`
+	Decision      string           `json:"decision"`
+	Status        string           `json:"status"`
+	Note          string           `json:"note,omitempty"`
+	ReviewedBy    string           `json:"reviewed_by,omitempty"`
+	ReviewedAt    string           `json:"reviewed_at,omitempty"`
+	CreatedAt     string           `json:"created_at"`
+}
@@ -0,0 +1,73 @@
+package models
+
+// Settlement item types.
+const (
+	SettlementItemCapture = "capture"
+	SettlementItemRefund  = "refund"
+	// SettlementItemChargeback and SettlementItemChargebackReversal come from a dispute's ledger.
+	SettlementItemChargeback         = "chargeback"
+	SettlementItemChargebackReversal = "chargeback_reversal"
+)
+
+// Payout statuses. A pending payout becomes submitted once it is exported in a pain.001 credit
+// transfer and paid once a camt.053 statement books it.
+const (
+	PayoutPending   = "pending"
+	PayoutSubmitted = "submitted"
+	PayoutPaid      = "paid"
+	PayoutNone      = "none"
+)
+
+// SettlementBatch settles a merchant's captured payments, refunds and chargebacks up to the end of
+// one business day. Net is gross minus fees, refunds and chargebacks plus chargeback reversals and
+// the amount carried in from the previous batch; a positive net is paid out and a negative one is
+// carried into the next batch.
+type SettlementBatch struct {
+	ID               string            `json:"id"`
+	MerchantID       string            `json:"merchant_id"`
+	BusinessDate     string            `json:"business_date"`
+	Currency         string            `json:"currency"`
+	PaymentCount     int               `json:"payment_count"`
+	RefundCount      int               `json:"refund_count"`
+	GrossAmount      float64           `json:"gross_amount"`
+	FeeAmount        float64           `json:"fee_amount"`
+	RefundAmount     float64           `json:"refund_amount"`
+	ChargebackAmount float64           `json:"chargeback_amount"`
+	ReversalAmount   float64           `json:"reversal_amount"`
+	CarriedIn        float64           `json:"carried_in"`
+	NetAmount        float64           `json:"net_amount"`
+	CarriedOut       float64           `json:"carried_out"`
+	Items            []SettlementItem  `json:"items"`
+	Payout           PayoutInstruction `json:"payout"`
+	CreatedBy        string            `json:"created_by"`
+	CreatedAt        string            `json:"created_at"`
+}
+
+// SettlementItem is a capture, refund, chargeback or chargeback reversal included in a batch.
+// Amounts are in the batch currency; a refund or chargeback takes back the gross amount while the
+// fee stays with the platform.
+type SettlementItem struct {
+	TransactionID string  `json:"transaction_id"`
+	Type          string  `json:"type"`
+	GrossAmount   float64 `json:"gross_amount"`
+	FeeAmount     float64 `json:"fee_amount"`
+	NetAmount     float64 `json:"net_amount"`
+	OccurredAt    string  `json:"occurred_at"`
+}
+
+// PayoutInstruction tells the bank to pay a batch's net amount to the merchant.
+// Batches without a positive net get a payout with status none and no amount.
+type PayoutInstruction struct {
+	ID          string  `json:"id,omitempty"`
+	BatchID     string  `json:"batch_id"`
+	MerchantID  string  `json:"merchant_id"`
+	Beneficiary string  `json:"beneficiary"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	Reference   string  `json:"reference"`
+	ValueDate   string  `json:"value_date"`
+	Status      string  `json:"status"`
+	MessageID   string  `json:"message_id,omitempty"`
+	SubmittedAt string  `json:"submitted_at,omitempty"`
+	PaidAt      string  `json:"paid_at,omitempty"`
+}
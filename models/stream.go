@@ -0,0 +1,19 @@
+package models
+
+// Stream event kinds.
+const (
+	StreamKindPayment   = "payment"
+	StreamKindHistory   = "history"
+	StreamKindHeartbeat = "heartbeat"
+)
+
+// StreamEvent is a payment or history event pushed to real-time stream subscribers.
+// ID is the resume cursor to send back as Last-Event-ID to continue after this event.
+// Data holds the payment snapshot for payment events and the history entry for history events.
+// Heartbeats only carry their kind.
+type StreamEvent struct {
+	ID   string    `json:"id,omitempty"`
+	Kind string    `json:"kind"`
+	Type EventType `json:"type,omitempty"`
+	Data any       `json:"data,omitempty"`
+}
@@ -0,0 +1,77 @@
+package models
+
+// Billing intervals of subscription plans.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// Subscription statuses. An active subscription whose charge failed is past_due until a retry
+// succeeds; it is canceled once the retries run out.
+const (
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionPaused   = "paused"
+	SubscriptionCanceled = "canceled"
+)
+
+// SubscriptionPlan is what a merchant charges subscribers: Amount in Currency every
+// IntervalCount intervals.
+type SubscriptionPlan struct {
+	ID            string  `json:"id"`
+	MerchantID    string  `json:"merchant_id"`
+	Name          string  `json:"name"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	Interval      string  `json:"interval"`
+	IntervalCount int     `json:"interval_count"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+// Mandate is the customer's authorisation for the merchant to charge the subscription without
+// the customer being present.
+type Mandate struct {
+	ID         string `json:"id"`
+	AcceptedAt string `json:"accepted_at"`
+	IP         string `json:"ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+// Subscription charges a customer on a plan's schedule under a mandate. The plan's terms are
+// copied so that later plan changes do not alter it. Billing period n starts at StartedAt plus n
+// intervals; Cycle counts the periods billed so far and NextBillingAt is when the next one is due.
+type Subscription struct {
+	ID             string               `json:"id"`
+	PlanID         string               `json:"plan_id"`
+	MerchantID     string               `json:"merchant_id"`
+	CustomerID     string               `json:"customer_id"`
+	Amount         float64              `json:"amount"`
+	Currency       string               `json:"currency"`
+	Interval       string               `json:"interval"`
+	IntervalCount  int                  `json:"interval_count"`
+	Status         string               `json:"status"`
+	Mandate        Mandate              `json:"mandate"`
+	StartedAt      string               `json:"started_at"`
+	Cycle          int                  `json:"cycle"`
+	NextBillingAt  string               `json:"next_billing_at,omitempty"`
+	FailedAttempts int                  `json:"failed_attempts"`
+	NextRetryAt    string               `json:"next_retry_at,omitempty"`
+	Charges        []SubscriptionCharge `json:"charges"`
+	PausedAt       string               `json:"paused_at,omitempty"`
+	CanceledAt     string               `json:"canceled_at,omitempty"`
+	CancelReason   string               `json:"cancel_reason,omitempty"`
+	CreatedAt      string               `json:"created_at"`
+}
+
+// SubscriptionCharge is one attempt to bill a period. A failed attempt has no payment when the
+// payment was rejected outright, and records why in Error.
+type SubscriptionCharge struct {
+	Cycle         int    `json:"cycle"`
+	Attempt       int    `json:"attempt"`
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	At            string `json:"at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// Transaction verification statuses.
+const (
+	VerificationApproved = "approved"
+	VerificationDeclined = "declined"
+)
+
+// VerificationRequest is the transaction sent to the verification provider.
+type VerificationRequest struct {
+	TransactionID string  `json:"transaction_id"`
+	CustomerID    string  `json:"customer_id"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+}
+
+// Verification is the verification provider's answer for a transaction.
+// Attempts counts the calls it took to get the answer, including retries.
+type Verification struct {
+	Provider   string `json:"provider"`
+	Status     string `json:"status"`
+	Reference  string `json:"reference,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Attempts   int    `json:"attempts"`
+	VerifiedAt string `json:"verified_at"`
+}
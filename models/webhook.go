@@ -0,0 +1,63 @@
+package models
+
+// Webhook event types sent to merchants.
+const (
+	WebhookPaymentSucceeded = "payment.succeeded"
+	WebhookPaymentFailed    = "payment.failed"
+	WebhookPaymentRefunded  = "payment.refunded"
+	WebhookPaymentDisputed  = "payment.disputed"
+	// WebhookDisputeClosed tells the merchant a dispute was won or lost.
+	WebhookDisputeClosed = "payment.dispute_closed"
+)
+
+// Webhook delivery statuses. Dead deliveries form the dead-letter queue.
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusDead      = "dead"
+)
+
+// WebhookEndpoint is a URL registered by a merchant to receive payment notifications.
+type WebhookEndpoint struct {
+	ID         string   `json:"id"`
+	MerchantID string   `json:"merchant_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	Events     []string `json:"events"`
+	Active     bool     `json:"active"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// Subscribed reports whether the endpoint wants to receive the given webhook event type.
+func (e WebhookEndpoint) Subscribed(eventType string) bool {
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookAttempt is the log of a single delivery attempt.
+type WebhookAttempt struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// WebhookDelivery is a webhook message for one endpoint together with its delivery log.
+type WebhookDelivery struct {
+	ID            string           `json:"id"`
+	EndpointID    string           `json:"endpoint_id"`
+	MerchantID    string           `json:"merchant_id"`
+	EventID       string           `json:"event_id"`
+	EventType     string           `json:"event_type"`
+	Payload       string           `json:"payload"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt string           `json:"next_attempt_at,omitempty"`
+	Log           []WebhookAttempt `json:"log"`
+	CreatedAt     string           `json:"created_at"`
+	UpdatedAt     string           `json:"updated_at"`
+}
@@ -0,0 +1,721 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// Files storing AML alerts and cases.
+const (
+	amlAlertsFile = "database/aml_alerts.json"
+	amlCasesFile  = "database/aml_cases.json"
+)
+
+// AMLService defines the interface of transaction monitoring and AML case management.
+type AMLService interface {
+	// Monitor evaluates the rules for the windows ending at the payment's latest activity and
+	// raises new alerts or extends the open ones.
+	Monitor(payment models.Payment) error
+	// Scan evaluates the rules over every stored payment, e.g. after the rules changed.
+	// Payments already covered by an alert of the same rule are not alerted on again.
+	Scan() (dto.AMLScanResult, error)
+	// GetAlerts returns the alerts matching the filter, newest first.
+	GetAlerts(filter dto.AMLAlertFilter) ([]models.AMLAlert, error)
+	// GetCases returns the cases matching the filter, newest first.
+	GetCases(filter dto.AMLCaseFilter) ([]models.AMLCase, error)
+	// GetCase returns a case together with its alerts.
+	GetCase(id string) (dto.AMLCaseDetail, error)
+	// AddNote adds an investigator's note to an open case and assigns the case to them if nobody has it yet.
+	AddNote(caller dto.Caller, id string, note dto.AMLCaseNoteRequest) (models.AMLCase, error)
+	// CloseCase closes a case with a disposition.
+	CloseCase(caller dto.Caller, id string, request dto.AMLCaseCloseRequest) (models.AMLCase, error)
+	// ExportSAR builds the suspicious activity report of a case.
+	ExportSAR(caller dto.Caller, id string) (dto.SuspiciousActivityReport, error)
+}
+
+// amlService is a concrete implementation of the AMLService interface.
+// Rule amounts and alert totals are in the reporting currency, and payment amounts are converted
+// into it with the RateProvider. The mutex serialises updates of the alert and case files.
+type amlService struct {
+	checks   []amlCheck
+	cs       CustomerService
+	ms       MerchantService
+	rates    RateProvider
+	currency string
+	mu       sync.Mutex
+}
+
+// amlCheck is a validated monitoring rule ready to be evaluated.
+type amlCheck struct {
+	models.AMLRule
+	window  time.Duration
+	maxHold time.Duration
+}
+
+// amlAmounts maps transaction IDs to payment amounts in the reporting currency.
+type amlAmounts map[string]float64
+
+// amlDetection is a set of qualifying payments of one subject that triggered a rule within one window.
+type amlDetection struct {
+	subject     models.EventParty
+	windowStart time.Time
+	payments    []models.Payment
+}
+
+// amlStore holds the alerts and cases while they are being updated.
+type amlStore struct {
+	alerts []models.AMLAlert
+	cases  []models.AMLCase
+}
+
+// Monitor evaluates every rule for the payment's subject at the time of the payment's activity.
+func (s *amlService) Monitor(payment models.Payment) error {
+	if len(s.checks) == 0 {
+		return nil
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return fmt.Errorf("failed to load payments: %v", err)
+	}
+	amounts, err := s.reportingAmounts(payments)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, err := s.readStore()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, check := range s.checks {
+		at, ok := check.anchor(payment)
+		if !ok {
+			continue
+		}
+		if detection, ok := check.detect(payments, amounts, check.subject(payment), at); ok {
+			created, updated := store.raise(check, detection, amounts, s.currency)
+			changed = changed || created || updated
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.writeStore(store)
+}
+
+// Scan evaluates every rule at the activity time of every stored payment.
+func (s *amlService) Scan() (dto.AMLScanResult, error) {
+	var result dto.AMLScanResult
+	payments, err := loadPayments()
+	if err != nil {
+		return result, fmt.Errorf("failed to load payments: %v", err)
+	}
+	amounts, err := s.reportingAmounts(payments)
+	if err != nil {
+		return result, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, err := s.readStore()
+	if err != nil {
+		return result, err
+	}
+	for _, check := range s.checks {
+		for _, payment := range payments {
+			at, ok := check.anchor(payment)
+			if !ok {
+				continue
+			}
+			detection, ok := check.detect(payments, amounts, check.subject(payment), at)
+			if !ok {
+				continue
+			}
+			created, updated := store.raise(check, detection, amounts, s.currency)
+			if created {
+				result.AlertsCreated++
+			} else if updated {
+				result.AlertsUpdated++
+			}
+		}
+	}
+	if result.AlertsCreated == 0 && result.AlertsUpdated == 0 {
+		return result, nil
+	}
+	return result, s.writeStore(store)
+}
+
+// GetAlerts returns the alerts matching the filter, newest first.
+func (s *amlService) GetAlerts(filter dto.AMLAlertFilter) ([]models.AMLAlert, error) {
+	store, err := s.readStore()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.AMLAlert{}
+	for i := len(store.alerts) - 1; i >= 0; i-- {
+		alert := store.alerts[i]
+		if filter.Rule != "" && alert.Rule != filter.Rule {
+			continue
+		}
+		if filter.SubjectType != "" && alert.Subject.Type != filter.SubjectType {
+			continue
+		}
+		if filter.SubjectID != "" && alert.Subject.ID != filter.SubjectID {
+			continue
+		}
+		if filter.CaseID != "" && alert.CaseID != filter.CaseID {
+			continue
+		}
+		result = append(result, alert)
+	}
+	return result, nil
+}
+
+// GetCases returns the cases matching the filter, newest first.
+func (s *amlService) GetCases(filter dto.AMLCaseFilter) ([]models.AMLCase, error) {
+	store, err := s.readStore()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.AMLCase{}
+	for i := len(store.cases) - 1; i >= 0; i-- {
+		c := store.cases[i]
+		if filter.Status != "" && c.Status != filter.Status {
+			continue
+		}
+		if filter.SubjectType != "" && c.Subject.Type != filter.SubjectType {
+			continue
+		}
+		if filter.SubjectID != "" && c.Subject.ID != filter.SubjectID {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// GetCase returns the case with its alerts in the order they were raised.
+func (s *amlService) GetCase(id string) (dto.AMLCaseDetail, error) {
+	store, err := s.readStore()
+	if err != nil {
+		return dto.AMLCaseDetail{}, err
+	}
+	i := store.findCase(id)
+	if i < 0 {
+		return dto.AMLCaseDetail{}, NewNotFoundError(CodeAMLCaseNotFound, "AML case not found")
+	}
+	return dto.AMLCaseDetail{AMLCase: store.cases[i], Alerts: store.caseAlerts(id)}, nil
+}
+
+// AddNote appends the note and moves an open case into investigation.
+func (s *amlService) AddNote(caller dto.Caller, id string, note dto.AMLCaseNoteRequest) (models.AMLCase, error) {
+	return s.updateCase(id, func(c *models.AMLCase, now string) {
+		c.Notes = append(c.Notes, models.AMLCaseNote{Author: caller.UserID, Text: note.Text, CreatedAt: now})
+		if c.AssignedTo == "" {
+			c.AssignedTo = caller.UserID
+		}
+		c.Status = models.AMLCaseInvestigating
+	})
+}
+
+// CloseCase records the disposition and an optional closing note. Later alerts of the subject open a new case.
+func (s *amlService) CloseCase(caller dto.Caller, id string, request dto.AMLCaseCloseRequest) (models.AMLCase, error) {
+	return s.updateCase(id, func(c *models.AMLCase, now string) {
+		if request.Note != "" {
+			c.Notes = append(c.Notes, models.AMLCaseNote{Author: caller.UserID, Text: request.Note, CreatedAt: now})
+		}
+		if c.AssignedTo == "" {
+			c.AssignedTo = caller.UserID
+		}
+		c.Status = models.AMLCaseClosed
+		c.Disposition = request.Disposition
+		c.ClosedAt = now
+	})
+}
+
+// ExportSAR gathers the case, its alerts, the payments they cover and the subject's details into a
+// report. The total amount is in the reporting currency.
+func (s *amlService) ExportSAR(caller dto.Caller, id string) (dto.SuspiciousActivityReport, error) {
+	detail, err := s.GetCase(id)
+	if err != nil {
+		return dto.SuspiciousActivityReport{}, err
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return dto.SuspiciousActivityReport{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+	subject, err := s.sarSubject(detail.Subject)
+	if err != nil {
+		return dto.SuspiciousActivityReport{}, err
+	}
+
+	report := dto.SuspiciousActivityReport{
+		ReportID:     "SAR-" + strings.TrimPrefix(detail.ID, "case_"),
+		CaseID:       detail.ID,
+		CaseStatus:   detail.Status,
+		Disposition:  detail.Disposition,
+		Subject:      subject,
+		Currency:     s.currency,
+		Alerts:       detail.Alerts,
+		Transactions: []models.Payment{},
+		Notes:        detail.Notes,
+		GeneratedBy:  caller.UserID,
+		GeneratedAt:  time.Now().Format(time.RFC3339),
+	}
+	if report.Notes == nil {
+		report.Notes = []models.AMLCaseNote{}
+	}
+
+	covered := map[string]bool{}
+	for _, alert := range detail.Alerts {
+		for _, transactionID := range alert.TransactionIDs {
+			covered[transactionID] = true
+		}
+		if report.ActivityStart == "" || alert.WindowStart < report.ActivityStart {
+			report.ActivityStart = alert.WindowStart
+		}
+		if alert.WindowEnd > report.ActivityEnd {
+			report.ActivityEnd = alert.WindowEnd
+		}
+	}
+	converter := newReportingConverter(s.rates, s.currency)
+	for _, payment := range payments {
+		if covered[payment.TransactionID] {
+			amount, err := converter.paymentAmount(payment)
+			if err != nil {
+				return dto.SuspiciousActivityReport{}, err
+			}
+			report.Transactions = append(report.Transactions, payment)
+			report.TotalAmount += amount
+		}
+	}
+	report.TotalAmount = roundToCurrency(report.TotalAmount, s.currency)
+	report.Narrative = sarNarrative(report)
+	return report, nil
+}
+
+// NewAMLService creates a new instance of amlService with the rules loaded from the configured
+// rules file. Without a rules file nothing is monitored. Rule amounts are in the reporting currency,
+// and payment amounts are converted with the RateProvider.
+func NewAMLService(conf config.AMLConfig, cs CustomerService, ms MerchantService, rates RateProvider, reportingCurrency string) (AMLService, error) {
+	rules := models.AMLRules{}
+	if conf.RulesFile != "" {
+		if err := decodeRulesFile(conf.RulesFile, &rules); err != nil {
+			return nil, fmt.Errorf("failed to load AML rules: %v", err)
+		}
+	}
+	checks, err := compileAMLRules(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AML rules in %s: %v", conf.RulesFile, err)
+	}
+	return &amlService{checks: checks, cs: cs, ms: ms, rates: rates, currency: reportingCurrency}, nil
+}
+
+// reportingAmounts converts the amount of every payment into the reporting currency.
+func (s *amlService) reportingAmounts(payments []models.Payment) (amlAmounts, error) {
+	converter := newReportingConverter(s.rates, s.currency)
+	amounts := make(amlAmounts, len(payments))
+	for _, payment := range payments {
+		amount, err := converter.paymentAmount(payment)
+		if err != nil {
+			return nil, err
+		}
+		amounts[payment.TransactionID] = amount
+	}
+	return amounts, nil
+}
+
+// compileAMLRules validates the rules and prepares them for evaluation.
+func compileAMLRules(rules models.AMLRules) ([]amlCheck, error) {
+	checks := make([]amlCheck, 0, len(rules.Rules))
+	names := map[string]bool{}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Subject == "" {
+			rule.Subject = models.PartyCustomer
+		}
+		if rule.Subject != models.PartyCustomer && rule.Subject != models.PartyMerchant {
+			return nil, fmt.Errorf("rule %q: subject must be customer or merchant", rule.Name)
+		}
+		window, err := time.ParseDuration(rule.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("rule %q: window must be a positive duration such as 24h", rule.Name)
+		}
+		if rule.MinCount <= 0 {
+			return nil, fmt.Errorf("rule %q: min_count must be positive", rule.Name)
+		}
+		if rule.MinTotal < 0 {
+			return nil, fmt.Errorf("rule %q: min_total must not be negative", rule.Name)
+		}
+
+		check := amlCheck{AMLRule: rule, window: window}
+		switch rule.Type {
+		case models.AMLRuleStructuring:
+			if rule.Threshold <= 0 {
+				return nil, fmt.Errorf("rule %q: threshold must be positive", rule.Name)
+			}
+			if rule.Margin <= 0 || rule.Margin >= 1 {
+				return nil, fmt.Errorf("rule %q: margin must be between 0 and 1", rule.Name)
+			}
+		case models.AMLRuleRapidInOut:
+			maxHold, err := time.ParseDuration(rule.MaxHold)
+			if err != nil || maxHold <= 0 {
+				return nil, fmt.Errorf("rule %q: max_hold must be a positive duration such as 1h", rule.Name)
+			}
+			check.maxHold = maxHold
+		case models.AMLRuleRoundAmount:
+			if rule.Multiple <= 0 {
+				return nil, fmt.Errorf("rule %q: multiple must be positive", rule.Name)
+			}
+			if rule.MinAmount < 0 {
+				return nil, fmt.Errorf("rule %q: min_amount must not be negative", rule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %q: unknown type %q", rule.Name, rule.Type)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// subject returns the customer or merchant of the payment the rule watches.
+func (c amlCheck) subject(payment models.Payment) models.EventParty {
+	if c.Subject == models.PartyMerchant {
+		return models.EventParty{Type: models.PartyMerchant, ID: payment.MerchantID}
+	}
+	return models.EventParty{Type: models.PartyCustomer, ID: payment.CustomerID}
+}
+
+// anchor returns the time a payment is placed at within the rule's windows: the refund for
+// rapid in-and-out rules and the payment itself for the others.
+func (c amlCheck) anchor(payment models.Payment) (time.Time, bool) {
+	value := payment.Timestamp
+	if c.Type == models.AMLRuleRapidInOut {
+		value = payment.RefundedAt
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	return at, err == nil
+}
+
+// qualifies reports whether the payment is of the kind the rule counts. amount is the payment's
+// amount in the reporting currency; round amounts are recognised in the payment currency.
+func (c amlCheck) qualifies(payment models.Payment, amount float64) bool {
+	if payment.Status == models.PaymentStatusFailed {
+		return false
+	}
+	switch c.Type {
+	case models.AMLRuleStructuring:
+		return amount < c.Threshold && amount >= c.Threshold*(1-c.Margin)
+	case models.AMLRuleRapidInOut:
+		if payment.Status != models.PaymentStatusRefunded {
+			return false
+		}
+		made, err := time.Parse(time.RFC3339, payment.Timestamp)
+		if err != nil {
+			return false
+		}
+		refunded, err := time.Parse(time.RFC3339, payment.RefundedAt)
+		return err == nil && refunded.Sub(made) <= c.maxHold
+	case models.AMLRuleRoundAmount:
+		return amount >= c.MinAmount && math.Abs(math.Remainder(payment.Amount, c.Multiple)) < 0.005
+	default:
+		return false
+	}
+}
+
+// detect collects the subject's qualifying payments in the window ending at end and reports
+// whether they are enough to trigger the rule.
+func (c amlCheck) detect(payments []models.Payment, amounts amlAmounts, subject models.EventParty, end time.Time) (amlDetection, bool) {
+	detection := amlDetection{subject: subject, windowStart: end.Add(-c.window)}
+	total := 0.0
+	for _, payment := range payments {
+		if c.subject(payment) != subject || !c.qualifies(payment, amounts[payment.TransactionID]) {
+			continue
+		}
+		at, ok := c.anchor(payment)
+		if !ok || !at.After(detection.windowStart) || at.After(end) {
+			continue
+		}
+		detection.payments = append(detection.payments, payment)
+		total += amounts[payment.TransactionID]
+	}
+	return detection, len(detection.payments) >= c.MinCount && total >= c.MinTotal
+}
+
+// describe summarises an alert's payments in words.
+func (c amlCheck) describe(alert models.AMLAlert) string {
+	summary := fmt.Sprintf("%d payments totalling %.2f %s", alert.Count, alert.Total, alert.Currency)
+	switch c.Type {
+	case models.AMLRuleStructuring:
+		summary += fmt.Sprintf(" just below the %.2f threshold", c.Threshold)
+	case models.AMLRuleRapidInOut:
+		summary += fmt.Sprintf(" refunded within %s of being made", c.MaxHold)
+	case models.AMLRuleRoundAmount:
+		summary += fmt.Sprintf(" in round multiples of %.2f", c.Multiple)
+	}
+	return fmt.Sprintf("%s in a %s window from %s to %s", summary, c.Window, alert.WindowStart, alert.WindowEnd)
+}
+
+// raise records a detection. Payments an alert of the same rule and subject already covers are
+// ignored; the rest extend that rule's latest alert if its case is still open and its activity
+// reaches into the detection window, and otherwise start a new alert in the subject's open case.
+func (st *amlStore) raise(c amlCheck, detection amlDetection, amounts amlAmounts, currency string) (created, updated bool) {
+	known := map[string]bool{}
+	extend := -1
+	for i, alert := range st.alerts {
+		if alert.Rule != c.Name || alert.Subject != detection.subject {
+			continue
+		}
+		for _, transactionID := range alert.TransactionIDs {
+			known[transactionID] = true
+		}
+		end, err := time.Parse(time.RFC3339, alert.WindowEnd)
+		if err == nil && !end.Before(detection.windowStart) && st.caseOpen(alert.CaseID) {
+			extend = i
+		}
+	}
+
+	var fresh []models.Payment
+	for _, payment := range detection.payments {
+		if !known[payment.TransactionID] {
+			fresh = append(fresh, payment)
+		}
+	}
+	if len(fresh) == 0 {
+		return false, false
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	if extend >= 0 {
+		alert := &st.alerts[extend]
+		c.add(alert, fresh, amounts)
+		alert.UpdatedAt = now
+		return false, true
+	}
+
+	alert := models.AMLAlert{
+		ID:             util.NewID("alert_"),
+		Rule:           c.Name,
+		Type:           c.Type,
+		Subject:        detection.subject,
+		Currency:       currency,
+		TransactionIDs: []string{},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	c.add(&alert, fresh, amounts)
+	alert.CaseID = st.openCase(detection.subject, alert.ID, now)
+	st.alerts = append(st.alerts, alert)
+	return true, false
+}
+
+// add adds payments to an alert and updates its totals, activity span and description.
+func (c amlCheck) add(alert *models.AMLAlert, payments []models.Payment, amounts amlAmounts) {
+	for _, payment := range payments {
+		alert.TransactionIDs = append(alert.TransactionIDs, payment.TransactionID)
+		alert.Count++
+		alert.Total = roundToCurrency(alert.Total+amounts[payment.TransactionID], alert.Currency)
+		at, _ := c.anchor(payment)
+		stamp := at.Format(time.RFC3339)
+		if alert.WindowStart == "" || stamp < alert.WindowStart {
+			alert.WindowStart = stamp
+		}
+		if stamp > alert.WindowEnd {
+			alert.WindowEnd = stamp
+		}
+	}
+	alert.Description = c.describe(*alert)
+}
+
+// openCase adds the alert to the subject's case that is not closed yet, opening a new case if
+// there is none, and returns the case ID.
+func (st *amlStore) openCase(subject models.EventParty, alertID, now string) string {
+	for i := range st.cases {
+		c := &st.cases[i]
+		if c.Subject == subject && c.Status != models.AMLCaseClosed {
+			c.AlertIDs = append(c.AlertIDs, alertID)
+			c.UpdatedAt = now
+			return c.ID
+		}
+	}
+	c := models.AMLCase{
+		ID:        util.NewID("case_"),
+		Subject:   subject,
+		Status:    models.AMLCaseOpen,
+		AlertIDs:  []string{alertID},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	st.cases = append(st.cases, c)
+	return c.ID
+}
+
+// caseOpen reports whether the case exists and is not closed.
+func (st *amlStore) caseOpen(id string) bool {
+	i := st.findCase(id)
+	return i >= 0 && st.cases[i].Status != models.AMLCaseClosed
+}
+
+// findCase returns the index of the case with the ID, or -1.
+func (st *amlStore) findCase(id string) int {
+	for i := range st.cases {
+		if st.cases[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// caseAlerts returns the alerts of a case in the order they were raised.
+func (st *amlStore) caseAlerts(id string) []models.AMLAlert {
+	alerts := []models.AMLAlert{}
+	for _, alert := range st.alerts {
+		if alert.CaseID == id {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// updateCase applies a change to a case that is not closed yet and saves it.
+func (s *amlService) updateCase(id string, change func(c *models.AMLCase, now string)) (models.AMLCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, err := s.readStore()
+	if err != nil {
+		return models.AMLCase{}, err
+	}
+	i := store.findCase(id)
+	if i < 0 {
+		return models.AMLCase{}, NewNotFoundError(CodeAMLCaseNotFound, "AML case not found")
+	}
+	if store.cases[i].Status == models.AMLCaseClosed {
+		return models.AMLCase{}, NewConflictError(CodeAMLCaseClosed, "AML case is closed")
+	}
+	now := time.Now().Format(time.RFC3339)
+	change(&store.cases[i], now)
+	store.cases[i].UpdatedAt = now
+	if err := util.WriteJSONFile(amlCasesFile, store.cases); err != nil {
+		return models.AMLCase{}, fmt.Errorf("failed to save AML cases: %v", err)
+	}
+	return store.cases[i], nil
+}
+
+// sarSubject looks up the name of the customer or merchant a case is about.
+func (s *amlService) sarSubject(party models.EventParty) (dto.SARSubject, error) {
+	subject := dto.SARSubject{Type: party.Type, ID: party.ID}
+	if party.Type == models.PartyMerchant {
+		merchant, err := s.ms.GetMerchant(party.ID)
+		if err != nil {
+			return subject, err
+		}
+		subject.Name = merchant.Name
+		return subject, nil
+	}
+
+	customers, err := s.cs.GetAllCustomer()
+	if err != nil {
+		return subject, err
+	}
+	for _, customer := range customers {
+		if customer.ID == party.ID {
+			subject.Name = customer.Name
+			subject.Username = customer.Username
+			break
+		}
+	}
+	return subject, nil
+}
+
+// sarNarrative describes the reported activity in prose.
+func sarNarrative(report dto.SuspiciousActivityReport) string {
+	name := report.Subject.Name
+	if name == "" {
+		name = report.Subject.Username
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Between %s and %s, %s %s (ID %s) was involved in %d payments totalling %.2f %s that triggered %d transaction monitoring alerts.",
+		report.ActivityStart, report.ActivityEnd, report.Subject.Type, name, report.Subject.ID, len(report.Transactions), report.TotalAmount, report.Currency, len(report.Alerts))
+	for _, alert := range report.Alerts {
+		fmt.Fprintf(&b, " Rule %s: %s.", alert.Rule, alert.Description)
+	}
+	switch report.Disposition {
+	case models.AMLDispositionSARFiled:
+		b.WriteString(" The investigation concluded that the activity is suspicious and this report is filed.")
+	case models.AMLDispositionNoAction:
+		b.WriteString(" The investigation concluded that no further action is required.")
+	default:
+		b.WriteString(" The investigation is ongoing.")
+	}
+	return b.String()
+}
+
+// readStore reads the alert and case files.
+func (s *amlService) readStore() (amlStore, error) {
+	store := amlStore{alerts: []models.AMLAlert{}, cases: []models.AMLCase{}}
+	if err := util.ReadJSONFile(amlAlertsFile, &store.alerts); err != nil {
+		return store, fmt.Errorf("failed to read AML alerts: %v", err)
+	}
+	if err := util.ReadJSONFile(amlCasesFile, &store.cases); err != nil {
+		return store, fmt.Errorf("failed to read AML cases: %v", err)
+	}
+	return store, nil
+}
+
+// writeStore saves the alert and case files. Cases are written first so an alert never refers
+// to a case that was not saved.
+func (s *amlService) writeStore(store amlStore) error {
+	if err := util.WriteJSONFile(amlCasesFile, store.cases); err != nil {
+		return fmt.Errorf("failed to save AML cases: %v", err)
+	}
+	if err := util.WriteJSONFile(amlAlertsFile, store.alerts); err != nil {
+		return fmt.Errorf("failed to save AML alerts: %v", err)
+	}
+	return nil
+}
+
+// amlSink is an EventSink that runs transaction monitoring on payment events.
+type amlSink struct {
+	aml AMLService
+}
+
+// Name identifies the AML sink.
+func (s *amlSink) Name() string {
+	return "aml"
+}
+
+// Publish monitors the payment carried by the event.
+func (s *amlSink) Publish(event models.OutboxEvent) error {
+	payment, err := event.Payment()
+	if err != nil {
+		return fmt.Errorf("failed to decode payment: %v", err)
+	}
+	return s.aml.Monitor(payment)
+}
+
+// NewAMLSink creates an EventSink that feeds payment events to transaction monitoring.
+func NewAMLSink(aml AMLService) EventSink {
+	return &amlSink{aml: aml}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+)
+
+// amlStart is when the first test payment is made.
+var amlStart = time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+
+// newDefaultAMLService returns an AML service with the shipped rules, totalling in IDR, over a
+// temporary database.
+func newDefaultAMLService(t *testing.T) AMLService {
+	t.Helper()
+	rulesFile, err := filepath.Abs("../config/aml_rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratesFile, err := filepath.Abs("../database/fx_rates.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useTempDatabase(t)
+	s, err := NewAMLService(config.AMLConfig{RulesFile: rulesFile}, nil, nil, NewFileRateProvider(ratesFile), "IDR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// customerPayments returns succeeded IDR payments of customer 1 with the amounts, a day apart
+// from start, with transaction IDs numbered from first.
+func customerPayments(start time.Time, first int, amounts ...float64) []models.Payment {
+	payments := []models.Payment{}
+	for i, amount := range amounts {
+		payments = append(payments, models.Payment{
+			TransactionID: fmt.Sprintf("tx%d", first+i),
+			CustomerID:    "1",
+			MerchantID:    "1",
+			Amount:        amount,
+			Currency:      "IDR",
+			Status:        models.PaymentStatusSucceeded,
+			Timestamp:     start.Add(time.Duration(i) * 24 * time.Hour).Format(time.RFC3339),
+		})
+	}
+	return payments
+}
+
+// scanAlerts stores the payments, scans them and returns every alert.
+func scanAlerts(t *testing.T, s AMLService, payments []models.Payment) []models.AMLAlert {
+	t.Helper()
+	writeTestFile(t, paymentsFile, payments)
+	if _, err := s.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := s.GetAlerts(dto.AMLAlertFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alerts
+}
+
+func TestDefaultAMLRulesIgnoreOrdinaryPayments(t *testing.T) {
+	s := newDefaultAMLService(t)
+
+	payments := customerPayments(amlStart, 1, 1400000, 1500000, 2000000, 5000000, 750000, 3000000, 1000000)
+	if alerts := scanAlerts(t, s, payments); len(alerts) != 0 {
+		t.Fatalf("ordinary payments raised alerts %+v", alerts)
+	}
+}
+
+func TestDefaultAMLRulesFlagLargeRoundAmounts(t *testing.T) {
+	s := newDefaultAMLService(t)
+
+	alerts := scanAlerts(t, s, customerPayments(amlStart, 1, 100000000, 100000000, 250000000, 100000000))
+	if len(alerts) != 1 || alerts[0].Rule != "round_amounts" || alerts[0].Count != 4 || alerts[0].Total != 550000000 || alerts[0].Currency != "IDR" {
+		t.Fatalf("alerts %+v", alerts)
+	}
+}
+
+func TestAMLAlertsAfterClosedCaseCoverOnlyNewPayments(t *testing.T) {
+	s := newDefaultAMLService(t)
+
+	payments := customerPayments(amlStart, 1, 100000000, 100000000, 100000000, 100000000)
+	alerts := scanAlerts(t, s, payments)
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if _, err := s.CloseCase(dto.Caller{Role: models.RoleAdmin, UserID: "admin"}, alerts[0].CaseID, dto.AMLCaseCloseRequest{Disposition: models.AMLDispositionNoAction}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Four more round payments in the same week trigger the rule again; the new alert, in a new
+	// case, reports only them.
+	more := customerPayments(amlStart.Add(4*24*time.Hour), 5, 100000000, 100000000, 100000000, 100000000)
+	alerts = scanAlerts(t, s, append(payments, more...))
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2", len(alerts))
+	}
+	latest := alerts[0]
+	if fmt.Sprint(latest.TransactionIDs) != "[tx5 tx6 tx7 tx8]" || latest.Count != 4 || latest.Total != 400000000 || latest.CaseID == alerts[1].CaseID {
+		t.Fatalf("new alert %+v", latest)
+	}
+}
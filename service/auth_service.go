@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"log"
 	"merchant-bank-api/models"
 	"merchant-bank-api/models/dto"
 	"merchant-bank-api/util"
@@ -26,7 +27,8 @@ type authService struct {
 
 // Logout processes a logout request for a customer.
 // It checks if the customer is logged in and updates their status.
-// Returns a success message or an error if the operation fails.
+// Returns a success message, a not found error for an unknown customer,
+// or an unauthorized error if the customer is not logged in.
 func (s *authService) Logout(payload dto.LogoutRequest) (string, error) {
 	customers, err := s.cs.GetAllCustomer()
 	if err != nil {
@@ -34,11 +36,15 @@ func (s *authService) Logout(payload dto.LogoutRequest) (string, error) {
 	}
 
 	for i, customer := range customers {
-		if customer.ID == payload.CustomerID && customer.LoggedIn {
-			return s.processLogout(&customers[i])
+		if customer.ID != payload.CustomerID {
+			continue
+		}
+		if !customer.LoggedIn {
+			return "", NewUnauthorizedError(CodeCustomerNotLoggedIn, "customer is not logged in")
 		}
+		return s.processLogout(&customers[i], payload.Meta)
 	}
-	return "Unauthorized or invalid customer", nil
+	return "", NewNotFoundError(CodeCustomerNotFound, "customer not found")
 }
 
 // PostLogin processes a login request for a customer.
@@ -51,18 +57,23 @@ func (s *authService) PostLogin(payload dto.LoginRequest) (dto.LoginResponse, er
 	}
 
 	for i, customer := range customers {
-		if s.isPasswordValid(payload.Password, customer.Password) && (payload.Username == customer.Username) {
-			customers[i].LoggedIn = true
-			_ = s.hs.LogHistory(customer.ID, "loggin")
-			err := s.cs.UpdateCustomerLoggedInStatus(customer.Username, true)
-			if err != nil {
-				return dto.LoginResponse{}, err
-			}
-			return s.createLoginResponse(customer)
+		if payload.Username != customer.Username {
+			continue
+		}
+		if !s.isPasswordValid(payload.Password, customer.Password) {
+			s.logAuthEvent(models.EventAuthLoginFailed, customer.ID, payload.Meta)
+			break
 		}
+		customers[i].LoggedIn = true
+		s.logAuthEvent(models.EventAuthLogin, customer.ID, payload.Meta)
+		err := s.cs.UpdateCustomerLoggedInStatus(customer.Username, true)
+		if err != nil {
+			return dto.LoginResponse{}, err
+		}
+		return s.createLoginResponse(customer)
 	}
 
-	return dto.LoginResponse{}, errors.New("invalid credentials")
+	return dto.LoginResponse{}, NewUnauthorizedError(CodeInvalidCredentials, "invalid username or password")
 }
 
 // NewAuthService creates a new instance of authService with the provided dependencies.
@@ -89,9 +100,9 @@ func (s *authService) createLoginResponse(customer models.Customer) (dto.LoginRe
 
 // processLogout updates the customer's logged-in status and logs the logout action.
 // Returns a success message or an error if the operation fails.
-func (s *authService) processLogout(customer *models.Customer) (string, error) {
+func (s *authService) processLogout(customer *models.Customer, meta models.RequestMeta) (string, error) {
 	customer.LoggedIn = false
-	if err := s.hs.LogHistory(customer.ID, "logout"); err != nil {
+	if err := s.hs.LogHistory(authEvent(models.EventAuthLogout, customer.ID, meta)); err != nil {
 		return "", err
 	}
 	if err := s.cs.UpdateCustomerLoggedInStatus(customer.Username, false); err != nil {
@@ -99,3 +110,23 @@ func (s *authService) processLogout(customer *models.Customer) (string, error) {
 	}
 	return "Logout successful", nil
 }
+
+// logAuthEvent records an authentication event for a customer.
+// Failures are logged and do not block the authentication flow.
+func (s *authService) logAuthEvent(eventType models.EventType, customerID string, meta models.RequestMeta) {
+	if err := s.hs.LogHistory(authEvent(eventType, customerID, meta)); err != nil {
+		log.Printf("Error logging %s event: %v", eventType, err)
+	}
+}
+
+// authEvent builds the history event of a customer authenticating or signing out.
+func authEvent(eventType models.EventType, customerID string, meta models.RequestMeta) models.HistoryEvent {
+	return models.HistoryEvent{
+		Type:          eventType,
+		CustomerID:    customerID,
+		Actor:         customerParty(customerID),
+		Target:        customerParty(customerID),
+		Metadata:      meta.Metadata(),
+		CorrelationID: meta.CorrelationID,
+	}
+}
@@ -0,0 +1,21 @@
+package service
+
+import "time"
+
+// Clock tells the current time to services that act on a schedule.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of the host.
+type systemClock struct{}
+
+// Now returns the host's current time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewSystemClock creates a Clock that follows the host's time.
+func NewSystemClock() Clock {
+	return systemClock{}
+}
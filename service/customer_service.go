@@ -23,7 +23,10 @@ type CustomerService interface {
 }
 
 // customerService is a concrete implementation of the CustomerService interface.
-type customerService struct{}
+// New customers are screened against the sanctions list before they are created.
+type customerService struct {
+	screening ScreeningService
+}
 
 // GetAllCustomer retrieves all customers from the "customer.json" file.
 func (s *customerService) GetAllCustomer() ([]models.Customer, error) {
@@ -56,6 +59,29 @@ func (s *customerService) PostCustomer(payload dto.CustomerPayload) (models.Cust
 	var customers []models.Customer
 	json.NewDecoder(file).Decode(&customers)
 
+	// Reject duplicate usernames
+	for _, customer := range customers {
+		if customer.Username == payload.Username {
+			return models.Customer{}, NewConflictError(CodeUsernameTaken, "username is already taken")
+		}
+	}
+
+	// Screen the customer's name against the sanctions list
+	subject := models.ScreeningSubject{Type: models.PartyCustomer, Name: payload.Name}
+	if subject.Name == "" {
+		subject.Name = payload.Username
+	}
+	screening, err := s.screening.Screen(subject)
+	if err != nil {
+		return models.Customer{}, err
+	}
+	if screening.Decision == models.ScreeningBlock {
+		if err := s.screening.RecordHits(subject, models.ScreeningContextOnboarding, "", screening); err != nil {
+			return models.Customer{}, err
+		}
+		return models.Customer{}, NewForbiddenError(CodeSanctionsMatch, "customer cannot be onboarded, the application is held for compliance review")
+	}
+
 	// Hash the password
 	hashedPassword, err := util.Encrypt(payload.Password)
 	if err != nil {
@@ -66,6 +92,8 @@ func (s *customerService) PostCustomer(payload dto.CustomerPayload) (models.Cust
 	newCustomer := models.Customer{
 		ID:       fmt.Sprintf("%d", len(customers)+1),
 		Username: payload.Username,
+		Name:     payload.Name,
+		Currency: payload.Currency,
 		Password: hashedPassword,
 		LoggedIn: false,
 	}
@@ -84,6 +112,14 @@ func (s *customerService) PostCustomer(payload dto.CustomerPayload) (models.Cust
 		return models.Customer{}, err
 	}
 
+	// Record possible matches for review now that the customer has an ID
+	if screening.Decision == models.ScreeningReview {
+		subject.ID = newCustomer.ID
+		if err := s.screening.RecordHits(subject, models.ScreeningContextOnboarding, "", screening); err != nil {
+			return models.Customer{}, err
+		}
+	}
+
 	return newCustomer, nil
 }
 
@@ -106,7 +142,7 @@ func (s *customerService) UpdateCustomerLoggedInStatus(username string, status b
 	}
 
 	if !updated {
-		return errors.New("customer not found")
+		return NewNotFoundError(CodeCustomerNotFound, "customer not found")
 	}
 
 	if err := s.saveCustomers(customers); err != nil {
@@ -116,9 +152,9 @@ func (s *customerService) UpdateCustomerLoggedInStatus(username string, status b
 	return nil
 }
 
-// NewCustomerService creates a new instance of customerService.
-func NewCustomerService() CustomerService {
-	return &customerService{}
+// NewCustomerService creates a new instance of customerService that screens new customers with the ScreeningService.
+func NewCustomerService(screening ScreeningService) CustomerService {
+	return &customerService{screening: screening}
 }
 
 // saveCustomers writes the updated list of customers back to the "customer.json" file.
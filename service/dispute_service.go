@@ -0,0 +1,551 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// disputesFile stores the disputes; their evidence files are stored under the evidence directory.
+const disputesFile = "database/disputes.json"
+
+// maxEvidenceFiles caps the evidence files of a dispute.
+const maxEvidenceFiles = 20
+
+// evidenceTypes lists the content types accepted as dispute evidence, detected from the file's content.
+var evidenceTypes = map[string]bool{
+	"application/pdf": true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"text/plain":      true,
+}
+
+// DisputeService defines the interface of customer disputes of payments and the merchant's response.
+type DisputeService interface {
+	// OpenDispute disputes a succeeded payment and charges the disputed amount back from the merchant.
+	OpenDispute(caller dto.Caller, transactionID string, payload dto.DisputePayload, meta models.RequestMeta) (models.Dispute, error)
+	// GetDisputes returns the disputes the caller may see, newest first.
+	GetDisputes(caller dto.Caller, filter dto.DisputeFilter) ([]models.Dispute, error)
+	// GetDispute returns one dispute.
+	GetDispute(caller dto.Caller, id string) (models.Dispute, error)
+	// AddEvidence stores an evidence file for an open dispute.
+	AddEvidence(caller dto.Caller, id, fileName, description string, file io.Reader) (models.DisputeEvidence, error)
+	// GetEvidenceFile returns an evidence file's description and the path it is stored at.
+	GetEvidenceFile(caller dto.Caller, id, evidenceID string) (models.DisputeEvidence, string, error)
+	// SubmitEvidence sends the merchant's response with the uploaded evidence for a decision.
+	SubmitEvidence(caller dto.Caller, id string, submission dto.DisputeSubmission) (models.Dispute, error)
+	// AcceptDispute lets the merchant concede an open dispute, which closes it as lost.
+	AcceptDispute(caller dto.Caller, id string, meta models.RequestMeta) (models.Dispute, error)
+	// ResolveDispute decides a dispute whose evidence was submitted.
+	ResolveDispute(caller dto.Caller, id string, resolution dto.DisputeResolution, meta models.RequestMeta) (models.Dispute, error)
+	// ExpireOverdue closes the open disputes past their evidence deadline as lost.
+	ExpireOverdue() error
+	// Start checks for overdue disputes in the background.
+	Start()
+	// Stop ends the background check.
+	Stop()
+}
+
+// disputeService is a concrete implementation of the DisputeService interface. Disputes that
+// change their payment are saved inside the payment change, so the outbox lock is always taken
+// before the mutex, which serialises updates of the disputes file.
+type disputeService struct {
+	conf   config.DisputeConfig
+	outbox OutboxService
+	mu     sync.Mutex
+	stop   chan struct{}
+}
+
+// OpenDispute records the dispute together with its payment.disputed event. Customers can only
+// dispute their own payments; admins open disputes on behalf of the card issuer. The dispute is
+// saved inside the payment change and removed again if the change is not committed.
+func (s *disputeService) OpenDispute(caller dto.Caller, transactionID string, payload dto.DisputePayload, meta models.RequestMeta) (models.Dispute, error) {
+	if caller.Role != models.RoleCustomer && caller.Role != models.RoleAdmin {
+		return models.Dispute{}, NewForbiddenError(CodeForbidden, "only customers and admins can dispute payments")
+	}
+
+	event := models.OutboxEvent{
+		Type:          models.EventPaymentDisputed,
+		Actor:         callerParty(caller),
+		Metadata:      meta.Metadata(),
+		CorrelationID: meta.CorrelationID,
+	}
+	var dispute models.Dispute
+	saved := false
+	_, err := s.outbox.CommitPaymentChange(event, func(payments []models.Payment) ([]models.Payment, models.Payment, error) {
+		i := findPayment(payments, transactionID)
+		if i < 0 || !canViewPayment(caller, payments[i]) {
+			return nil, models.Payment{}, NewNotFoundError(CodePaymentNotFound, "payment not found")
+		}
+		payment := payments[i]
+		if payment.DisputeID != "" {
+			return nil, models.Payment{}, NewConflictError(CodePaymentNotDisputable, "the payment is already disputed")
+		}
+		if payment.Status != models.PaymentStatusSucceeded {
+			return nil, models.Payment{}, NewConflictError(CodePaymentNotDisputable, "only succeeded payments can be disputed")
+		}
+
+		amount := payload.Amount
+		if amount == 0 {
+			amount = payment.Amount
+		}
+		if amount > payment.Amount {
+			return nil, models.Payment{}, NewValidationError("invalid dispute", []util.FieldError{{Field: "amount", Rule: "lte", Message: "must not exceed the payment amount"}})
+		}
+		if err := checkCurrencyPrecision(amount, payment.GetCurrency()); err != nil {
+			return nil, models.Payment{}, err
+		}
+
+		_, gross := capturedGross(payment)
+		settlementCurrency := payment.SettlementCurrency
+		if settlementCurrency == "" {
+			settlementCurrency = payment.GetCurrency()
+		}
+		now := time.Now()
+		dispute = models.Dispute{
+			ID:                 util.NewID("dp_"),
+			TransactionID:      payment.TransactionID,
+			MerchantID:         payment.MerchantID,
+			CustomerID:         payment.CustomerID,
+			Reason:             payload.Reason,
+			Description:        payload.Description,
+			Amount:             amount,
+			Currency:           payment.GetCurrency(),
+			SettlementAmount:   roundToCurrency(gross*amount/payment.Amount, settlementCurrency),
+			SettlementCurrency: settlementCurrency,
+			Status:             models.DisputeOpened,
+			EvidenceDueBy:      now.Add(s.conf.ResponseWindow).Format(time.RFC3339),
+			Evidence:           []models.DisputeEvidence{},
+			Timeline:           []models.DisputeEvent{{Status: models.DisputeOpened, Actor: event.Actor, Note: payload.Description, At: now.Format(time.RFC3339)}},
+			OpenedAt:           now.Format(time.RFC3339),
+		}
+		dispute.Ledger = []models.LedgerEntry{disputeLedgerEntry(dispute, models.LedgerEntryChargeback, now)}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		disputes, err := loadDisputes()
+		if err != nil {
+			return nil, models.Payment{}, err
+		}
+		if err := saveDisputes(append(disputes, dispute)); err != nil {
+			return nil, models.Payment{}, err
+		}
+		saved = true
+
+		payments[i].DisputeID = dispute.ID
+		payments[i].DisputeStatus = models.DisputeOpened
+		payments[i].Version++
+		return payments, payments[i], nil
+	})
+	if err != nil {
+		if saved {
+			s.removeDispute(dispute.ID)
+		}
+		return models.Dispute{}, err
+	}
+	return dispute, nil
+}
+
+// removeDispute deletes a dispute whose payment change failed, so no dispute is left that its
+// payment does not reference. A dispute that cannot be removed is superseded by the next dispute
+// of the payment, see loadDisputes.
+func (s *disputeService) removeDispute(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	disputes, err := loadDisputes()
+	if err != nil {
+		log.Printf("Failed to remove dispute %s: %v", id, err)
+		return
+	}
+	if i := findDispute(disputes, id); i >= 0 {
+		if err := saveDisputes(append(disputes[:i], disputes[i+1:]...)); err != nil {
+			log.Printf("Failed to remove dispute %s: %v", id, err)
+		}
+	}
+}
+
+// GetDisputes returns the caller's disputes: a customer's own, a merchant's own or, for admins,
+// every dispute, filtered by status and merchant.
+func (s *disputeService) GetDisputes(caller dto.Caller, filter dto.DisputeFilter) ([]models.Dispute, error) {
+	disputes, err := loadDisputes()
+	if err != nil {
+		return nil, err
+	}
+	result := []models.Dispute{}
+	for _, dispute := range disputes {
+		if !canViewDispute(caller, dispute) {
+			continue
+		}
+		if (filter.Status != "" && dispute.Status != filter.Status) || (filter.MerchantID != "" && dispute.MerchantID != filter.MerchantID) {
+			continue
+		}
+		result = append(result, dispute)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].OpenedAt > result[j].OpenedAt
+	})
+	return result, nil
+}
+
+// GetDispute returns the dispute with the ID if the caller may see it, or a not found error.
+func (s *disputeService) GetDispute(caller dto.Caller, id string) (models.Dispute, error) {
+	disputes, err := loadDisputes()
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	i := findDispute(disputes, id)
+	if i < 0 || !canViewDispute(caller, disputes[i]) {
+		return models.Dispute{}, NewNotFoundError(CodeDisputeNotFound, "dispute not found")
+	}
+	return disputes[i], nil
+}
+
+// AddEvidence stores the file under the evidence directory and adds it to the dispute. Only PDF,
+// PNG, JPEG and plain text files up to the configured size are accepted, and only until the
+// evidence is submitted or the deadline passes.
+func (s *disputeService) AddEvidence(caller dto.Caller, id, fileName, description string, file io.Reader) (models.DisputeEvidence, error) {
+	content, err := io.ReadAll(io.LimitReader(file, s.conf.MaxEvidenceBytes+1))
+	if err != nil {
+		return models.DisputeEvidence{}, NewMalformedError("failed to read evidence file", err)
+	}
+	var fields []util.FieldError
+	if len(content) == 0 {
+		fields = append(fields, util.FieldError{Field: "file", Rule: "required", Message: "must not be empty"})
+	}
+	if int64(len(content)) > s.conf.MaxEvidenceBytes {
+		fields = append(fields, util.FieldError{Field: "file", Rule: "max", Message: fmt.Sprintf("must be at most %d bytes", s.conf.MaxEvidenceBytes)})
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	if len(content) > 0 && !evidenceTypes[contentType] {
+		fields = append(fields, util.FieldError{Field: "file", Rule: "content_type", Message: "must be a PDF, PNG, JPEG or plain text file"})
+	}
+	if len(fields) > 0 {
+		return models.DisputeEvidence{}, NewValidationError("invalid evidence", fields)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	disputes, err := loadDisputes()
+	if err != nil {
+		return models.DisputeEvidence{}, err
+	}
+	i, err := s.findRespondable(caller, disputes, id)
+	if err != nil {
+		return models.DisputeEvidence{}, err
+	}
+	if len(disputes[i].Evidence) >= maxEvidenceFiles {
+		return models.DisputeEvidence{}, NewValidationError("invalid evidence", []util.FieldError{{Field: "file", Rule: "max", Message: fmt.Sprintf("a dispute takes at most %d evidence files", maxEvidenceFiles)}})
+	}
+
+	sum := sha256.Sum256(content)
+	evidence := models.DisputeEvidence{
+		ID:          util.NewID("ev_"),
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Description: description,
+		UploadedBy:  caller.UserID,
+		UploadedAt:  time.Now().Format(time.RFC3339),
+	}
+	path := s.evidencePath(id, evidence.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return models.DisputeEvidence{}, fmt.Errorf("failed to create evidence directory: %v", err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return models.DisputeEvidence{}, fmt.Errorf("failed to store evidence: %v", err)
+	}
+
+	disputes[i].Evidence = append(disputes[i].Evidence, evidence)
+	if err := saveDisputes(disputes); err != nil {
+		os.Remove(path)
+		return models.DisputeEvidence{}, err
+	}
+	return evidence, nil
+}
+
+// GetEvidenceFile finds the evidence of a dispute of the merchant, or of any dispute for admins.
+func (s *disputeService) GetEvidenceFile(caller dto.Caller, id, evidenceID string) (models.DisputeEvidence, string, error) {
+	dispute, err := s.GetDispute(caller, id)
+	if err != nil {
+		return models.DisputeEvidence{}, "", err
+	}
+	if err := canManageMerchant(caller, dispute.MerchantID); err != nil {
+		return models.DisputeEvidence{}, "", err
+	}
+	for _, evidence := range dispute.Evidence {
+		if evidence.ID == evidenceID {
+			return evidence, s.evidencePath(id, evidence.ID), nil
+		}
+	}
+	return models.DisputeEvidence{}, "", NewNotFoundError(CodeEvidenceNotFound, "evidence not found")
+}
+
+// SubmitEvidence moves an open dispute with at least one evidence file to evidence_submitted.
+func (s *disputeService) SubmitEvidence(caller dto.Caller, id string, submission dto.DisputeSubmission) (models.Dispute, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	disputes, err := loadDisputes()
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	i, err := s.findRespondable(caller, disputes, id)
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	if len(disputes[i].Evidence) == 0 {
+		return models.Dispute{}, NewValidationError("invalid submission", []util.FieldError{{Field: "evidence", Rule: "required", Message: "upload at least one evidence file first"}})
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	disputes[i].Status = models.DisputeEvidenceSubmitted
+	disputes[i].Explanation = submission.Explanation
+	disputes[i].SubmittedAt = now
+	disputes[i].Timeline = append(disputes[i].Timeline, models.DisputeEvent{Status: models.DisputeEvidenceSubmitted, Actor: callerParty(caller), Note: submission.Explanation, At: now})
+	if err := saveDisputes(disputes); err != nil {
+		return models.Dispute{}, err
+	}
+	return disputes[i], nil
+}
+
+// AcceptDispute closes an open dispute as lost on the merchant's behalf.
+func (s *disputeService) AcceptDispute(caller dto.Caller, id string, meta models.RequestMeta) (models.Dispute, error) {
+	return s.close(callerParty(caller), id, models.DisputeLost, "accepted by the merchant", meta, func(dispute models.Dispute) error {
+		if !canViewDispute(caller, dispute) {
+			return NewNotFoundError(CodeDisputeNotFound, "dispute not found")
+		}
+		if err := canManageMerchant(caller, dispute.MerchantID); err != nil {
+			return err
+		}
+		if dispute.Status != models.DisputeOpened {
+			return NewConflictError(CodeDisputeClosed, "only open disputes can be accepted")
+		}
+		return nil
+	})
+}
+
+// ResolveDispute closes a dispute whose evidence was submitted with the admin's decision.
+func (s *disputeService) ResolveDispute(caller dto.Caller, id string, resolution dto.DisputeResolution, meta models.RequestMeta) (models.Dispute, error) {
+	return s.close(callerParty(caller), id, resolution.Outcome, resolution.Note, meta, func(dispute models.Dispute) error {
+		if dispute.Status != models.DisputeEvidenceSubmitted {
+			return NewConflictError(CodeDisputeClosed, "only disputes with submitted evidence can be resolved")
+		}
+		return nil
+	})
+}
+
+// ExpireOverdue closes every open dispute whose evidence deadline has passed as lost.
+func (s *disputeService) ExpireOverdue() error {
+	disputes, err := loadDisputes()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	system := models.EventParty{Type: models.PartySystem, ID: "disputes"}
+	for _, dispute := range disputes {
+		if dispute.Status != models.DisputeOpened || !overdue(dispute, now) {
+			continue
+		}
+		_, err := s.close(system, dispute.ID, models.DisputeLost, "no evidence submitted before the deadline", models.RequestMeta{}, func(current models.Dispute) error {
+			if current.Status != models.DisputeOpened {
+				return NewConflictError(CodeDisputeClosed, "the dispute is no longer open")
+			}
+			return nil
+		})
+		if de, ok := AsDomainError(err); err != nil && !(ok && de.Code == CodeDisputeClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start closes overdue disputes every sweep interval.
+func (s *disputeService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.conf.SweepInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.ExpireOverdue(); err != nil {
+				log.Printf("Error expiring disputes: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the background check.
+func (s *disputeService) Stop() {
+	close(s.stop)
+}
+
+// NewDisputeService creates a new instance of disputeService that commits dispute changes to
+// payments through the OutboxService.
+func NewDisputeService(conf config.DisputeConfig, outbox OutboxService) DisputeService {
+	return &disputeService{conf: conf, outbox: outbox, stop: make(chan struct{})}
+}
+
+// close moves a dispute to won or lost together with its payment and a payment.dispute_closed
+// event once check allows it. A won dispute reverses the chargeback.
+func (s *disputeService) close(actor models.EventParty, id, status, note string, meta models.RequestMeta, check func(models.Dispute) error) (models.Dispute, error) {
+	disputes, err := loadDisputes()
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	i := findDispute(disputes, id)
+	if i < 0 {
+		return models.Dispute{}, NewNotFoundError(CodeDisputeNotFound, "dispute not found")
+	}
+
+	event := models.OutboxEvent{
+		Type:          models.EventPaymentDisputeClosed,
+		Actor:         actor,
+		Metadata:      meta.Metadata(),
+		CorrelationID: meta.CorrelationID,
+	}
+	var dispute models.Dispute
+	_, err = s.outbox.CommitPaymentChange(event, func(payments []models.Payment) ([]models.Payment, models.Payment, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		disputes, err := loadDisputes()
+		if err != nil {
+			return nil, models.Payment{}, err
+		}
+		i := findDispute(disputes, id)
+		if err := check(disputes[i]); err != nil {
+			return nil, models.Payment{}, err
+		}
+		j := findPayment(payments, disputes[i].TransactionID)
+		if j < 0 {
+			return nil, models.Payment{}, NewNotFoundError(CodePaymentNotFound, "payment not found")
+		}
+
+		now := time.Now()
+		disputes[i].Status = status
+		disputes[i].ResolutionNote = note
+		disputes[i].ResolvedAt = now.Format(time.RFC3339)
+		disputes[i].Timeline = append(disputes[i].Timeline, models.DisputeEvent{Status: status, Actor: actor, Note: note, At: now.Format(time.RFC3339)})
+		if status == models.DisputeWon {
+			disputes[i].Ledger = append(disputes[i].Ledger, disputeLedgerEntry(disputes[i], models.LedgerEntryChargebackReversal, now))
+		}
+		if err := saveDisputes(disputes); err != nil {
+			return nil, models.Payment{}, err
+		}
+		dispute = disputes[i]
+
+		payments[j].DisputeStatus = status
+		payments[j].Version++
+		return payments, payments[j], nil
+	})
+	if err != nil {
+		return models.Dispute{}, err
+	}
+	return dispute, nil
+}
+
+// findRespondable returns the index of an open dispute the caller may respond to before its deadline.
+func (s *disputeService) findRespondable(caller dto.Caller, disputes []models.Dispute, id string) (int, error) {
+	i := findDispute(disputes, id)
+	if i < 0 || !canViewDispute(caller, disputes[i]) {
+		return -1, NewNotFoundError(CodeDisputeNotFound, "dispute not found")
+	}
+	if err := canManageMerchant(caller, disputes[i].MerchantID); err != nil {
+		return -1, err
+	}
+	if disputes[i].Status != models.DisputeOpened {
+		return -1, NewConflictError(CodeDisputeClosed, "the dispute no longer takes evidence")
+	}
+	if overdue(disputes[i], time.Now()) {
+		return -1, NewConflictError(CodeDisputeDeadlinePassed, "the evidence deadline has passed")
+	}
+	return i, nil
+}
+
+// evidencePath returns where an evidence file is stored.
+func (s *disputeService) evidencePath(disputeID, evidenceID string) string {
+	return filepath.Join(s.conf.EvidenceDir, disputeID, evidenceID)
+}
+
+// disputeLedgerEntry books a dispute's settlement amount to its merchant.
+func disputeLedgerEntry(dispute models.Dispute, entryType string, at time.Time) models.LedgerEntry {
+	return models.LedgerEntry{
+		ID:            util.NewID("le_"),
+		Type:          entryType,
+		TransactionID: dispute.TransactionID,
+		MerchantID:    dispute.MerchantID,
+		Amount:        dispute.SettlementAmount,
+		Currency:      dispute.SettlementCurrency,
+		BookedAt:      at.Format(time.RFC3339),
+	}
+}
+
+// canViewDispute reports whether the caller may see a dispute: the customer who opened it, its
+// merchant and admins.
+func canViewDispute(caller dto.Caller, dispute models.Dispute) bool {
+	return canViewPayment(caller, models.Payment{CustomerID: dispute.CustomerID, MerchantID: dispute.MerchantID})
+}
+
+// overdue reports whether a dispute's evidence deadline has passed.
+func overdue(dispute models.Dispute, now time.Time) bool {
+	due, err := time.Parse(time.RFC3339, dispute.EvidenceDueBy)
+	return err == nil && now.After(due)
+}
+
+// findDispute returns the index of the dispute with the ID, or -1.
+func findDispute(disputes []models.Dispute, id string) int {
+	for i, dispute := range disputes {
+		if dispute.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadDisputes reads the disputes file with one dispute per transaction. A payment can only be
+// disputed once, so an earlier dispute of the same transaction was left behind by a payment change
+// that failed; only the last one, which the payment references, is kept.
+func loadDisputes() ([]models.Dispute, error) {
+	stored := []models.Dispute{}
+	if err := util.ReadJSONFile(disputesFile, &stored); err != nil {
+		return nil, fmt.Errorf("failed to read disputes: %v", err)
+	}
+	latest := make(map[string]int, len(stored))
+	for i, dispute := range stored {
+		latest[dispute.TransactionID] = i
+	}
+	disputes := make([]models.Dispute, 0, len(latest))
+	for i, dispute := range stored {
+		if latest[dispute.TransactionID] == i {
+			disputes = append(disputes, dispute)
+		}
+	}
+	return disputes, nil
+}
+
+// saveDisputes writes the disputes file.
+func saveDisputes(disputes []models.Dispute) error {
+	if err := util.WriteJSONFile(disputesFile, disputes); err != nil {
+		return fmt.Errorf("failed to save disputes: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+
+	"merchant-bank-api/util"
+)
+
+// ErrorKind classifies a domain error so the transport layer can pick a status code.
+type ErrorKind string
+
+const (
+	KindMalformed         ErrorKind = "malformed"
+	KindValidation        ErrorKind = "validation"
+	KindNotFound          ErrorKind = "not_found"
+	KindUnauthorized      ErrorKind = "unauthorized"
+	KindForbidden         ErrorKind = "forbidden"
+	KindConflict          ErrorKind = "conflict"
+	KindInsufficientFunds ErrorKind = "insufficient_funds"
+	KindUnavailable       ErrorKind = "unavailable"
+	KindLimitExceeded     ErrorKind = "limit_exceeded"
+)
+
+// Stable error codes returned to clients. Clients branch on these, so existing values must not change.
+const (
+	CodeMalformedRequest         = "malformed_request"
+	CodeValidationFailed         = "validation_failed"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeInvalidToken             = "invalid_token"
+	CodeForbidden                = "forbidden"
+	CodeCustomerNotFound         = "customer_not_found"
+	CodeCustomerNotLoggedIn      = "customer_not_logged_in"
+	CodeUsernameTaken            = "username_taken"
+	CodeDuplicateTransaction     = "duplicate_transaction"
+	CodePaymentNotFound          = "payment_not_found"
+	CodePaymentNotRefundable     = "payment_not_refundable"
+	CodePaymentNotPendingReview  = "payment_not_pending_review"
+	CodeMerchantNotFound         = "merchant_not_found"
+	CodeWebhookNotFound          = "webhook_not_found"
+	CodeDeliveryNotFound         = "webhook_delivery_not_found"
+	CodeInsufficientFunds        = "insufficient_funds"
+	CodeVerificationUnavailable  = "verification_unavailable"
+	CodeLimitExceeded            = "limit_exceeded"
+	CodeLimitNotFound            = "limit_not_found"
+	CodeSanctionsMatch           = "sanctions_match"
+	CodeScreeningHitNotFound     = "screening_hit_not_found"
+	CodeScreeningHitResolved     = "screening_hit_resolved"
+	CodeAMLCaseNotFound          = "aml_case_not_found"
+	CodeAMLCaseClosed            = "aml_case_closed"
+	CodeUnsupportedCurrency      = "unsupported_currency"
+	CodeFeePlanNotFound          = "fee_plan_not_found"
+	CodeSettlementNotFound       = "settlement_batch_not_found"
+	CodeReconciliationNotFound   = "reconciliation_not_found"
+	CodePayoutNotFound           = "payout_not_found"
+	CodeNoPendingPayouts         = "no_pending_payouts"
+	CodePayoutsNotConfigured     = "payouts_not_configured"
+	CodeDisputeNotFound          = "dispute_not_found"
+	CodeEvidenceNotFound         = "dispute_evidence_not_found"
+	CodePaymentNotDisputable     = "payment_not_disputable"
+	CodeDisputeClosed            = "dispute_closed"
+	CodeDisputeDeadlinePassed    = "dispute_deadline_passed"
+	CodeSubscriptionPlanNotFound = "subscription_plan_not_found"
+	CodeSubscriptionNotFound     = "subscription_not_found"
+	CodeSubscriptionNotActive    = "subscription_not_active"
+	CodeSubscriptionNotPaused    = "subscription_not_paused"
+	CodeSubscriptionCanceled     = "subscription_canceled"
+	CodeScheduledPaymentNotFound = "scheduled_payment_not_found"
+	CodeScheduleNotCancelable    = "scheduled_payment_not_cancelable"
+	CodeInvoiceNotFound          = "invoice_not_found"
+	CodeInvoiceNotPayable        = "invoice_not_payable"
+	CodeInvoiceNotOpen           = "invoice_not_open"
+	CodeInvalidQRPayload         = "invalid_qr_payload"
+	CodeQRCodeUsed               = "qr_code_used"
+)
+
+// DomainError is an error raised by the service layer that carries its kind and a stable code.
+type DomainError struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []util.FieldError
+	Err     error
+}
+
+// Error returns the human readable message of the error.
+func (e *DomainError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying cause, if any.
+func (e *DomainError) Unwrap() error {
+	return e.Err
+}
+
+// AsDomainError reports whether err is or wraps a DomainError and returns it.
+func AsDomainError(err error) (*DomainError, bool) {
+	var de *DomainError
+	if errors.As(err, &de) {
+		return de, true
+	}
+	return nil, false
+}
+
+// NewMalformedError creates an error for a request body that cannot be decoded.
+func NewMalformedError(message string, cause error) error {
+	return &DomainError{Kind: KindMalformed, Code: CodeMalformedRequest, Message: message, Err: cause}
+}
+
+// NewValidationError creates an error for a payload that failed validation on the given fields.
+func NewValidationError(message string, fields []util.FieldError) error {
+	return &DomainError{Kind: KindValidation, Code: CodeValidationFailed, Message: message, Fields: fields}
+}
+
+// NewNotFoundError creates an error for a resource that does not exist.
+func NewNotFoundError(code, message string) error {
+	return &DomainError{Kind: KindNotFound, Code: code, Message: message}
+}
+
+// NewUnauthorizedError creates an error for a caller that could not be authenticated.
+func NewUnauthorizedError(code, message string) error {
+	return &DomainError{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+// NewForbiddenError creates an error for an authenticated caller that is not allowed to act.
+func NewForbiddenError(code, message string) error {
+	return &DomainError{Kind: KindForbidden, Code: code, Message: message}
+}
+
+// NewConflictError creates an error for a request that conflicts with the stored state.
+func NewConflictError(code, message string) error {
+	return &DomainError{Kind: KindConflict, Code: code, Message: message}
+}
+
+// NewInsufficientFundsError creates an error for a debit that exceeds the available balance.
+func NewInsufficientFundsError(message string) error {
+	return &DomainError{Kind: KindInsufficientFunds, Code: CodeInsufficientFunds, Message: message}
+}
+
+// NewUnavailableError creates an error for a request that cannot be served because a dependency is down.
+func NewUnavailableError(code, message string) error {
+	return &DomainError{Kind: KindUnavailable, Code: code, Message: message}
+}
+
+// NewLimitExceededError creates an error for a payment that would exceed a transaction limit.
+func NewLimitExceededError(message string, fields []util.FieldError) error {
+	return &DomainError{Kind: KindLimitExceeded, Code: CodeLimitExceeded, Message: message, Fields: fields}
+}
+
+// NewUnsupportedCurrencyError creates a validation error for a currency without an exchange rate.
+func NewUnsupportedCurrencyError(currency string) error {
+	message := "no exchange rate for " + currency
+	fields := []util.FieldError{{Field: "currency", Rule: "supported_currency", Message: message}}
+	return &DomainError{Kind: KindValidation, Code: CodeUnsupportedCurrency, Message: message, Fields: fields}
+}
+
+// NewInvalidQRError creates a validation error for a scanned QR code payload that cannot be paid.
+func NewInvalidQRError(message string) error {
+	fields := []util.FieldError{{Field: "payload", Rule: "emv_qr", Message: message}}
+	return &DomainError{Kind: KindValidation, Code: CodeInvalidQRPayload, Message: "invalid QR code payload", Fields: fields}
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// Files storing the fee plans and the platform account.
+const (
+	feePlansFile        = "database/fee_plans.json"
+	platformAccountFile = "database/platform_account.json"
+)
+
+// mccPattern matches a four digit merchant category code.
+var mccPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// FeeService defines the interface of merchant fee plans and the platform account fees are booked to.
+type FeeService interface {
+	// GetPlans returns every fee plan.
+	GetPlans() ([]models.FeePlan, error)
+	// CreatePlan validates and stores a new fee plan.
+	CreatePlan(payload dto.FeePlanPayload) (models.FeePlan, error)
+	// AssignPlan puts a merchant on a fee plan, or on none when the plan ID is empty.
+	AssignPlan(merchantID string, assignment dto.FeePlanAssignment) (models.Merchant, error)
+	// Capture records a succeeded payment as captured and charges the merchant's fee on it,
+	// filling in the gross, fee and net amounts.
+	Capture(payment *models.Payment) error
+	// GetPlatformAccount returns the platform account with its balances and entries.
+	GetPlatformAccount() (models.PlatformAccount, error)
+	// BookFee books a captured payment's fee to the platform account. A fee is booked only once
+	// and is not refunded.
+	BookFee(payment models.Payment) error
+}
+
+// feeService is a concrete implementation of the FeeService interface.
+// The mutex serialises updates of the fee plan and platform account files.
+type feeService struct {
+	ms MerchantService
+	mu sync.Mutex
+}
+
+// GetPlans reads the fee plans file.
+func (s *feeService) GetPlans() ([]models.FeePlan, error) {
+	plans := []models.FeePlan{}
+	if err := util.ReadJSONFile(feePlansFile, &plans); err != nil {
+		return nil, fmt.Errorf("failed to read fee plans: %v", err)
+	}
+	return plans, nil
+}
+
+// CreatePlan adds a fee plan after checking that it has what its type needs.
+func (s *feeService) CreatePlan(payload dto.FeePlanPayload) (models.FeePlan, error) {
+	if err := validateFeePlan(payload); err != nil {
+		return models.FeePlan{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plans, err := s.GetPlans()
+	if err != nil {
+		return models.FeePlan{}, err
+	}
+	plan := models.FeePlan{
+		ID:        util.NewID("fp_"),
+		Name:      payload.Name,
+		Type:      payload.Type,
+		Currency:  payload.Currency,
+		Rate:      payload.Rate,
+		Tiers:     payload.Tiers,
+		MCCRates:  payload.MCCRates,
+		MinFee:    payload.MinFee,
+		MaxFee:    payload.MaxFee,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	if err := util.WriteJSONFile(feePlansFile, append(plans, plan)); err != nil {
+		return models.FeePlan{}, fmt.Errorf("failed to save fee plans: %v", err)
+	}
+	return plan, nil
+}
+
+// AssignPlan checks that the plan exists and is in the currency the merchant settles in, and
+// stores it on the merchant.
+func (s *feeService) AssignPlan(merchantID string, assignment dto.FeePlanAssignment) (models.Merchant, error) {
+	if assignment.PlanID != "" {
+		merchant, err := s.ms.GetMerchant(merchantID)
+		if err != nil {
+			return models.Merchant{}, err
+		}
+		plan, err := s.findPlan(assignment.PlanID)
+		if err != nil {
+			return models.Merchant{}, err
+		}
+		if plan.GetCurrency() != merchant.GetCurrency() {
+			return models.Merchant{}, NewValidationError("fee plan currency does not match the merchant", []util.FieldError{{
+				Field:   "plan_id",
+				Rule:    "currency",
+				Message: fmt.Sprintf("the plan is in %s but the merchant settles in %s", plan.GetCurrency(), merchant.GetCurrency()),
+			}})
+		}
+	}
+	return s.ms.SetFeePlan(merchantID, assignment.PlanID, assignment.MCC)
+}
+
+// Capture charges the fee of the merchant's current plan on the payment's settlement amount.
+// Merchants without a plan pay no fee.
+func (s *feeService) Capture(payment *models.Payment) error {
+	merchant, err := s.ms.GetMerchant(payment.MerchantID)
+	if err != nil {
+		return err
+	}
+
+	gross, currency := payment.SettlementAmount, payment.SettlementCurrency
+	if currency == "" {
+		// Payments from before settlement currencies settle in their own currency.
+		gross, currency = payment.Amount, payment.GetCurrency()
+	}
+	fee := 0.0
+	if merchant.FeePlanID != "" {
+		plan, err := s.findPlan(merchant.FeePlanID)
+		if err != nil {
+			return err
+		}
+		if plan.GetCurrency() != currency {
+			return fmt.Errorf("fee plan %s is in %s but payment %s settles in %s", plan.ID, plan.GetCurrency(), payment.TransactionID, currency)
+		}
+		fee = planFee(plan, merchant.MCC, gross, currency)
+	}
+
+	payment.GrossAmount = gross
+	payment.FeeAmount = fee
+	payment.NetAmount = roundToCurrency(gross-fee, currency)
+	payment.FeePlanID = merchant.FeePlanID
+	payment.CapturedAt = time.Now().Format(time.RFC3339)
+	return nil
+}
+
+// GetPlatformAccount reads the platform account file.
+func (s *feeService) GetPlatformAccount() (models.PlatformAccount, error) {
+	account := models.PlatformAccount{ID: models.PlatformAccountID, Balances: map[string]float64{}, Entries: []models.LedgerEntry{}}
+	if err := util.ReadJSONFile(platformAccountFile, &account); err != nil {
+		return account, fmt.Errorf("failed to read platform account: %v", err)
+	}
+	return account, nil
+}
+
+// BookFee credits the payment's fee to the platform account in the settlement currency.
+// Payments without a fee, and fees already booked, are skipped. Fees are not refunded: a refund
+// or chargeback takes back the gross amount from the merchant and books no reversal here.
+func (s *feeService) BookFee(payment models.Payment) error {
+	if payment.CapturedAt == "" || payment.FeeAmount <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.GetPlatformAccount()
+	if err != nil {
+		return err
+	}
+	for _, entry := range account.Entries {
+		if entry.Type == models.LedgerEntryFee && entry.TransactionID == payment.TransactionID {
+			return nil
+		}
+	}
+
+	currency := payment.SettlementCurrency
+	if currency == "" {
+		currency = payment.GetCurrency()
+	}
+	account.Entries = append(account.Entries, models.LedgerEntry{
+		ID:            util.NewID("le_"),
+		Type:          models.LedgerEntryFee,
+		TransactionID: payment.TransactionID,
+		MerchantID:    payment.MerchantID,
+		Amount:        payment.FeeAmount,
+		Currency:      currency,
+		BookedAt:      time.Now().Format(time.RFC3339),
+	})
+	account.Balances[currency] = roundToCurrency(account.Balances[currency]+payment.FeeAmount, currency)
+	if err := util.WriteJSONFile(platformAccountFile, account); err != nil {
+		return fmt.Errorf("failed to save platform account: %v", err)
+	}
+	return nil
+}
+
+// NewFeeService creates a new instance of feeService that looks merchants up with the MerchantService.
+func NewFeeService(ms MerchantService) FeeService {
+	return &feeService{ms: ms}
+}
+
+// findPlan returns the fee plan with the ID, or a not found error.
+func (s *feeService) findPlan(id string) (models.FeePlan, error) {
+	plans, err := s.GetPlans()
+	if err != nil {
+		return models.FeePlan{}, err
+	}
+	for _, plan := range plans {
+		if plan.ID == id {
+			return plan, nil
+		}
+	}
+	return models.FeePlan{}, NewNotFoundError(CodeFeePlanNotFound, "fee plan not found")
+}
+
+// planFee calculates the plan's fee on an amount in the plan's currency. The fee is kept between the
+// plan's minimum and maximum, never exceeds the amount and is rounded half to even to the currency's minor unit.
+func planFee(plan models.FeePlan, mcc string, amount float64, currency string) float64 {
+	rate := plan.Rate
+	switch plan.Type {
+	case models.FeePlanTiered:
+		for _, tier := range plan.Tiers {
+			if tier.UpTo == 0 || amount <= tier.UpTo {
+				rate = tier.FeeRate
+				break
+			}
+		}
+	case models.FeePlanMCC:
+		if mccRate, ok := plan.MCCRates[mcc]; ok {
+			rate = mccRate
+		}
+	}
+
+	fee := amount*rate.Percentage/100 + rate.Fixed
+	if plan.MinFee > 0 {
+		fee = max(fee, plan.MinFee)
+	}
+	if plan.MaxFee > 0 {
+		fee = min(fee, plan.MaxFee)
+	}
+	return roundToCurrency(min(fee, amount), currency)
+}
+
+// validateFeePlan checks the rates of a fee plan payload against its type.
+func validateFeePlan(payload dto.FeePlanPayload) error {
+	var fields []util.FieldError
+	checkRate := func(field string, rate models.FeeRate) {
+		if rate.Percentage < 0 || rate.Percentage > 100 {
+			fields = append(fields, util.FieldError{Field: field + ".percentage", Rule: "range", Message: "must be between 0 and 100"})
+		}
+		if rate.Fixed < 0 {
+			fields = append(fields, util.FieldError{Field: field + ".fixed", Rule: "min", Message: "must be at least 0"})
+		}
+	}
+
+	checkRate("rate", payload.Rate)
+	switch payload.Type {
+	case models.FeePlanPercentage:
+		if payload.Rate.Percentage == 0 {
+			fields = append(fields, util.FieldError{Field: "rate.percentage", Rule: "required", Message: "is required"})
+		}
+	case models.FeePlanFixed:
+		if payload.Rate.Fixed == 0 {
+			fields = append(fields, util.FieldError{Field: "rate.fixed", Rule: "required", Message: "is required"})
+		}
+	case models.FeePlanTiered:
+		if len(payload.Tiers) == 0 {
+			fields = append(fields, util.FieldError{Field: "tiers", Rule: "required", Message: "is required"})
+		}
+		last := 0.0
+		for i, tier := range payload.Tiers {
+			field := fmt.Sprintf("tiers[%d]", i)
+			checkRate(field, tier.FeeRate)
+			switch {
+			case tier.UpTo < 0:
+				fields = append(fields, util.FieldError{Field: field + ".up_to", Rule: "min", Message: "must be at least 0"})
+			case tier.UpTo == 0 && i != len(payload.Tiers)-1:
+				fields = append(fields, util.FieldError{Field: field + ".up_to", Rule: "required", Message: "only the last tier may be unbounded"})
+			case tier.UpTo != 0 && tier.UpTo <= last:
+				fields = append(fields, util.FieldError{Field: field + ".up_to", Rule: "gt", Message: "must be above the previous tier"})
+			}
+			last = tier.UpTo
+		}
+	case models.FeePlanMCC:
+		if len(payload.MCCRates) == 0 {
+			fields = append(fields, util.FieldError{Field: "mcc_rates", Rule: "required", Message: "is required"})
+		}
+		codes := make([]string, 0, len(payload.MCCRates))
+		for code := range payload.MCCRates {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			if !mccPattern.MatchString(code) {
+				fields = append(fields, util.FieldError{Field: "mcc_rates." + code, Rule: "mcc", Message: "must be keyed by a four digit merchant category code"})
+			}
+			checkRate("mcc_rates."+code, payload.MCCRates[code])
+		}
+	}
+	if payload.MaxFee > 0 && payload.MinFee > payload.MaxFee {
+		fields = append(fields, util.FieldError{Field: "max_fee", Rule: "gtefield", Message: "must not be lower than min_fee"})
+	}
+
+	if len(fields) > 0 {
+		return NewValidationError("invalid fee plan", fields)
+	}
+	return nil
+}
+
+// feeSink is an EventSink that books the fees of captured payments to the platform account.
+type feeSink struct {
+	fees FeeService
+}
+
+// Name identifies the fee sink.
+func (s *feeSink) Name() string {
+	return "fees"
+}
+
+// Publish books the fee of the payment carried by the event.
+func (s *feeSink) Publish(event models.OutboxEvent) error {
+	payment, err := event.Payment()
+	if err != nil {
+		return fmt.Errorf("failed to decode payment: %v", err)
+	}
+	return s.fees.BookFee(payment)
+}
+
+// NewFeeSink creates an EventSink that books payment fees to the platform account.
+func NewFeeSink(fees FeeService) EventSink {
+	return &feeSink{fees: fees}
+}
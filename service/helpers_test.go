@@ -0,0 +1,35 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"merchant-bank-api/util"
+)
+
+// useTempDatabase runs the test in a temporary directory with an empty database folder, since the
+// services keep their files under database/ relative to the working directory.
+func useTempDatabase(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "database"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// writeTestFile stores v as the JSON document at path, failing the test if it cannot.
+func writeTestFile(t *testing.T, path string, v any) {
+	t.Helper()
+	if err := util.WriteJSONFile(path, v); err != nil {
+		t.Fatal(err)
+	}
+}
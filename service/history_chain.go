@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// genesisHash is the previous hash of the first entry in the history chain.
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// historyCheckpointsFile stores the signed checkpoints of the history chain.
+const historyCheckpointsFile = "database/history_checkpoints.json"
+
+// chainHistory links a new entry to the end of the chain by setting its sequence, previous hash and hash.
+func chainHistory(histories []models.History, history models.History) models.History {
+	history.Sequence = 1
+	history.PrevHash = genesisHash
+	if len(histories) > 0 {
+		last := histories[len(histories)-1]
+		history.Sequence = last.Sequence + 1
+		history.PrevHash = last.Hash
+	}
+	history.Hash = hashHistory(history)
+	return history
+}
+
+// sealLegacyHistories chains entries written before the log was hash-chained and reports whether
+// it did. It only runs when no entry has been sealed yet, so it can never re-seal an edited chain.
+func sealLegacyHistories(histories []models.History) ([]models.History, bool) {
+	if len(histories) == 0 {
+		return histories, false
+	}
+	for _, history := range histories {
+		if history.Hash != "" {
+			return histories, false
+		}
+	}
+
+	sealed := make([]models.History, 0, len(histories))
+	for _, history := range histories {
+		sealed = append(sealed, chainHistory(sealed, history))
+	}
+	return sealed, true
+}
+
+// hashHistory returns the hex SHA-256 digest of an entry's content, including its previous hash.
+func hashHistory(history models.History) string {
+	history.Hash = ""
+	data, _ := json.Marshal(history)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signCheckpoint returns the hex HMAC-SHA256 signature of a checkpoint.
+func signCheckpoint(key string, checkpoint models.HistoryCheckpoint) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%d:%s:%s", checkpoint.Sequence, checkpoint.Hash, checkpoint.Timestamp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newCheckpoint creates a signed checkpoint of the given entry.
+func newCheckpoint(key string, history models.History) models.HistoryCheckpoint {
+	checkpoint := models.HistoryCheckpoint{
+		Sequence:  history.Sequence,
+		Hash:      history.Hash,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	checkpoint.Signature = signCheckpoint(key, checkpoint)
+	return checkpoint
+}
+
+// readCheckpoints reads the signed checkpoints of the history chain and reports whether the
+// checkpoints file exists.
+func readCheckpoints() ([]models.HistoryCheckpoint, bool, error) {
+	if _, err := os.Stat(historyCheckpointsFile); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	var checkpoints []models.HistoryCheckpoint
+	if err := util.ReadJSONFile(historyCheckpointsFile, &checkpoints); err != nil {
+		return nil, true, err
+	}
+	return checkpoints, true, nil
+}
+
+// verifyHistoryChain checks every link of the chain and that there is a validly signed checkpoint
+// at every multiple of the interval, so the chain cannot be rehashed and the checkpoints dropped.
+// It stops at and reports the first broken link. Entries after the last checkpoint are only
+// protected by the hash chain: they can be dropped or rewritten and rehashed without detection.
+func verifyHistoryChain(key string, interval int, histories []models.History, checkpoints []models.HistoryCheckpoint, checkpointsExist bool) dto.ChainVerification {
+	result := dto.ChainVerification{Entries: len(histories), Checkpoints: len(checkpoints)}
+
+	broken := func(position int, sequence uint64, reason string) dto.ChainVerification {
+		result.BrokenPosition = position + 1
+		result.BrokenSequence = sequence
+		result.Reason = reason
+		return result
+	}
+
+	if !checkpointsExist && len(histories) > 0 {
+		result.Reason = "history checkpoints file is missing"
+		return result
+	}
+
+	prevHash := genesisHash
+	for i, history := range histories {
+		switch {
+		case history.Sequence != uint64(i+1):
+			return broken(i, history.Sequence, fmt.Sprintf("expected sequence %d, found %d", i+1, history.Sequence))
+		case history.PrevHash != prevHash:
+			return broken(i, history.Sequence, "previous hash does not match the preceding entry")
+		case history.Hash != hashHistory(history):
+			return broken(i, history.Sequence, "entry hash does not match its content")
+		}
+		prevHash = history.Hash
+	}
+
+	for i, checkpoint := range checkpoints {
+		expected := uint64((i + 1) * interval)
+		if checkpoint.Sequence != expected {
+			return broken(int(expected)-1, expected, fmt.Sprintf("expected a checkpoint of entry %d, found one of entry %d", expected, checkpoint.Sequence))
+		}
+		if !hmac.Equal([]byte(checkpoint.Signature), []byte(signCheckpoint(key, checkpoint))) {
+			return broken(int(checkpoint.Sequence)-1, checkpoint.Sequence, "checkpoint signature is invalid")
+		}
+		if checkpoint.Sequence > uint64(len(histories)) {
+			return broken(int(checkpoint.Sequence)-1, checkpoint.Sequence, "checkpoint refers to a missing entry")
+		}
+		if histories[checkpoint.Sequence-1].Hash != checkpoint.Hash {
+			return broken(int(checkpoint.Sequence)-1, checkpoint.Sequence, "entry hash does not match the signed checkpoint")
+		}
+	}
+	if expected := len(histories) / interval; len(checkpoints) < expected {
+		missing := uint64((len(checkpoints) + 1) * interval)
+		return broken(int(missing)-1, missing, fmt.Sprintf("expected %d checkpoints, found %d", expected, len(checkpoints)))
+	}
+
+	result.Valid = true
+	return result
+}
@@ -2,53 +2,230 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"merchant-bank-api/config"
 	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
 )
 
-// HistoryService defines the interface for logging customer history actions.
+// historyFile stores the history log.
+const historyFile = "database/history.json"
+
+// HistoryService defines the interface for logging and querying customer history actions.
 type HistoryService interface {
-	// LogHistory logs a customer's action by creating a history entry and saving it to a file.
-	LogHistory(customerID string, action string) error
+	// LogHistory records a typed event by creating a history entry and saving it to a file.
+	LogHistory(event models.HistoryEvent) error
+	// GetHistories returns a page of history entries visible to the caller that match the filter.
+	GetHistories(caller dto.Caller, filter dto.HistoryFilter) (dto.HistoryPage, error)
+	// ExportHistories returns every history entry visible to the caller that matches the filter.
+	ExportHistories(caller dto.Caller, filter dto.HistoryFilter) ([]models.History, error)
+	// VerifyChain checks the history hash chain and its signed checkpoints and reports the first broken link.
+	VerifyChain() (dto.ChainVerification, error)
 }
 
 // historyService is a concrete implementation of the HistoryService interface.
-type historyService struct{}
+// The mutex serialises appends so concurrent requests cannot fork the hash chain.
+type historyService struct {
+	conf config.AuditConfig
+	mu   sync.Mutex
+}
+
+// LogHistory records an event by creating a history entry, chaining it to the previous
+// entry and appending it to the history file. Every CheckpointInterval entries a signed
+// checkpoint of the chain head is recorded before the entry itself.
+func (s *historyService) LogHistory(event models.HistoryEvent) error {
+	if !event.Type.Valid() {
+		return fmt.Errorf("unknown history event type %q", event.Type)
+	}
+
+	// Create a new history entry for the event.
+	history, err := s.createHistoryEntry(event)
+	if err != nil {
+		return err
+	}
 
-// LogHistory logs a customer's action by creating a history entry and appending it to the history file.
-func (s *historyService) LogHistory(customerID string, action string) error {
-	// Create a new history entry for the given customer ID and action.
-	history := s.createHistoryEntry(customerID, action)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Read existing history entries from the file.
-	histories, err := s.readHistoriesFromFile("database/history.json")
+	histories, err := s.readHistoriesFromFile(historyFile)
 	if err != nil {
-		log.Printf("Error reading histories: %v", err)
-		return nil
+		return fmt.Errorf("failed to read histories: %v", err)
 	}
 
-	// Append the new history entry to the list of histories.
+	// Skip events that have already been recorded.
+	if history.EventID != "" {
+		for _, existing := range histories {
+			if existing.EventID == history.EventID {
+				return nil
+			}
+		}
+	}
+
+	checkpoints, checkpointsExist, err := readCheckpoints()
+	if err != nil {
+		return fmt.Errorf("failed to read history checkpoints: %v", err)
+	}
+
+	// Link the new entry to the end of the hash chain and append it.
+	histories, sealed := sealLegacyHistories(histories)
+	history = chainHistory(histories, history)
 	histories = append(histories, history)
 
-	// Write the updated list of histories back to the file.
-	if err := s.writeHistoriesToFile("database/history.json", histories); err != nil {
-		log.Printf("Error writing histories: %v", err)
+	// Sign the entries that complete an interval. Sealing a legacy log signs each of its intervals,
+	// and a new chain creates the checkpoints file, whose absence verification then reports.
+	updated := checkpoints
+	if sealed {
+		updated = nil
+		for _, sealedHistory := range histories {
+			if sealedHistory.Sequence%uint64(s.conf.CheckpointInterval) == 0 {
+				updated = append(updated, newCheckpoint(s.conf.SigningKey, sealedHistory))
+			}
+		}
+	} else if history.Sequence%uint64(s.conf.CheckpointInterval) == 0 {
+		updated = append(updated, newCheckpoint(s.conf.SigningKey, history))
+	}
+	writeCheckpoints := sealed || history.Sequence == 1 || len(updated) != len(checkpoints)
+	if writeCheckpoints {
+		if updated == nil {
+			updated = []models.HistoryCheckpoint{}
+		}
+		if err := util.WriteJSONFile(historyCheckpointsFile, updated); err != nil {
+			return fmt.Errorf("failed to write history checkpoints: %v", err)
+		}
+	}
+
+	// Write the updated list of histories back to the file, and take back the checkpoint if that fails.
+	if err := util.WriteJSONFile(historyFile, histories); err != nil {
+		if writeCheckpoints {
+			if checkpointsExist {
+				err = errors.Join(err, util.WriteJSONFile(historyCheckpointsFile, checkpoints))
+			} else {
+				os.Remove(historyCheckpointsFile)
+			}
+		}
+		return fmt.Errorf("failed to write histories: %v", err)
 	}
 
 	return nil
 }
 
-// createHistoryEntry creates a new history entry with the current timestamp.
-func (s *historyService) createHistoryEntry(customerID, action string) models.History {
-	return models.History{
-		CustomerID: customerID,
-		Action:     action,
-		Timestamp:  time.Now().Format(time.RFC3339),
+// VerifyChain reads the history file and its checkpoints and verifies the hash chain.
+func (s *historyService) VerifyChain() (dto.ChainVerification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	histories, err := s.readHistoriesFromFile(historyFile)
+	if err != nil {
+		return dto.ChainVerification{}, err
+	}
+	checkpoints, checkpointsExist, err := readCheckpoints()
+	if err != nil {
+		return dto.ChainVerification{}, err
+	}
+	return verifyHistoryChain(s.conf.SigningKey, s.conf.CheckpointInterval, histories, checkpoints, checkpointsExist), nil
+}
+
+// GetHistories returns history entries matching the filter, newest first, scoped to the caller.
+func (s *historyService) GetHistories(caller dto.Caller, filter dto.HistoryFilter) (dto.HistoryPage, error) {
+	filter, err := scopeHistoryFilter(caller, filter)
+	if err != nil {
+		return dto.HistoryPage{}, err
+	}
+
+	histories, err := s.readHistoriesFromFile(historyFile)
+	if err != nil {
+		return dto.HistoryPage{}, err
+	}
+
+	// Entries are append-only, so the position in the log is a stable cursor key.
+	start := len(histories) - 1
+	if filter.Cursor != "" {
+		parts, err := util.DecodeCursor(filter.Cursor, 1)
+		if err != nil {
+			return dto.HistoryPage{}, invalidCursorError()
+		}
+		position, err := strconv.Atoi(parts[0])
+		if err != nil || position < 0 || position > len(histories) {
+			return dto.HistoryPage{}, invalidCursorError()
+		}
+		start = position - 1
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	page := dto.HistoryPage{Data: []models.History{}}
+	for i := start; i >= 0; i-- {
+		if !matchesHistoryFilter(histories[i], filter) {
+			continue
+		}
+		if len(page.Data) == limit {
+			page.NextCursor = util.EncodeCursor(strconv.Itoa(i + 1))
+			break
+		}
+		page.Data = append(page.Data, histories[i])
+	}
+
+	return page, nil
+}
+
+// ExportHistories returns every history entry matching the filter, oldest first, scoped to the caller.
+func (s *historyService) ExportHistories(caller dto.Caller, filter dto.HistoryFilter) ([]models.History, error) {
+	filter, err := scopeHistoryFilter(caller, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	histories, err := s.readHistoriesFromFile(historyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.History{}
+	for _, history := range histories {
+		if matchesHistoryFilter(history, filter) {
+			result = append(result, history)
+		}
+	}
+	return result, nil
+}
+
+// createHistoryEntry creates a new history entry for an event with the current timestamp.
+func (s *historyService) createHistoryEntry(event models.HistoryEvent) (models.History, error) {
+	history := models.History{
+		CustomerID:    event.CustomerID,
+		Action:        event.Type,
+		CorrelationID: event.CorrelationID,
+		EventID:       event.EventID,
+		Timestamp:     time.Now().Format(time.RFC3339),
 	}
+	if event.Actor.Type != "" {
+		actor := event.Actor
+		history.Actor = &actor
+	}
+	if event.Target.Type != "" {
+		target := event.Target
+		history.Target = &target
+	}
+	if len(event.Metadata) > 0 {
+		metadata, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return models.History{}, fmt.Errorf("failed to encode history metadata: %v", err)
+		}
+		history.Metadata = metadata
+	}
+	return history, nil
 }
 
 // readHistoriesFromFile reads history entries from a specified JSON file.
@@ -70,25 +247,56 @@ func (s *historyService) readHistoriesFromFile(filePath string) ([]models.Histor
 	return histories, nil
 }
 
-// writeHistoriesToFile writes a slice of history entries to a specified JSON file.
-func (s *historyService) writeHistoriesToFile(filePath string, histories []models.History) error {
-	// Open the file for writing, creating it if it doesn't exist, and truncating it if it does.
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
+// NewHistoryService creates a new instance of historyService and returns it as a HistoryService.
+func NewHistoryService(conf config.AuditConfig) HistoryService {
+	return &historyService{conf: conf}
+}
+
+// scopeHistoryFilter restricts a history filter to what the caller is allowed to see.
+// Admins can read every entry, customers only their own and merchants none.
+func scopeHistoryFilter(caller dto.Caller, filter dto.HistoryFilter) (dto.HistoryFilter, error) {
+	switch caller.Role {
+	case models.RoleAdmin:
+		return filter, nil
+	case models.RoleCustomer:
+		if filter.CustomerID != caller.UserID {
+			return filter, NewForbiddenError(CodeForbidden, "customers can only view their own history")
+		}
+		return filter, nil
+	default:
+		return filter, NewForbiddenError(CodeForbidden, "role is not allowed to view history")
 	}
-	defer file.Close()
+}
 
-	// Encode the slice of History objects into JSON and write it to the file.
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(histories); err != nil {
-		return err
+// matchesHistoryFilter reports whether a history entry satisfies every criterion set on the filter.
+func matchesHistoryFilter(history models.History, filter dto.HistoryFilter) bool {
+	if filter.CustomerID != "" && history.CustomerID != filter.CustomerID {
+		return false
+	}
+	if filter.Action != "" && string(history.Action) != filter.Action {
+		return false
 	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timestamp, err := time.Parse(time.RFC3339, history.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !filter.From.IsZero() && timestamp.Before(filter.From) {
+			return false
+		}
+		if !filter.To.IsZero() && timestamp.After(filter.To) {
+			return false
+		}
+	}
+	return true
+}
 
-	return nil
+// invalidCursorError reports a pagination cursor that cannot be decoded.
+func invalidCursorError() error {
+	return NewValidationError("invalid cursor", []util.FieldError{{Field: "cursor", Rule: "cursor", Message: "is not a valid cursor"}})
 }
 
-// NewHistoryService creates a new instance of historyService and returns it as a HistoryService.
-func NewHistoryService() HistoryService {
-	return &historyService{}
+// customerParty returns the event party for a customer.
+func customerParty(customerID string) models.EventParty {
+	return models.EventParty{Type: models.PartyCustomer, ID: customerID}
 }
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+
+	"merchant-bank-api/models"
+)
+
+// historySink is an EventSink that records payment events in the history log.
+type historySink struct {
+	hs HistoryService
+}
+
+// Name identifies the history sink.
+func (s *historySink) Name() string {
+	return "history"
+}
+
+// Publish records the event in the history log. The outbox event ID is stored as the entry's
+// event ID, so a redelivered event is not recorded twice.
+func (s *historySink) Publish(event models.OutboxEvent) error {
+	payment, err := event.Payment()
+	if err != nil {
+		return fmt.Errorf("failed to decode payment: %v", err)
+	}
+
+	metadata := map[string]any{
+		"transaction_id": payment.TransactionID,
+		"merchant_id":    payment.MerchantID,
+		"amount":         payment.Amount,
+		"status":         payment.Status,
+	}
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+
+	return s.hs.LogHistory(models.HistoryEvent{
+		Type:          event.Type,
+		CustomerID:    payment.CustomerID,
+		Actor:         event.Actor,
+		Target:        models.EventParty{Type: models.PartyPayment, ID: payment.TransactionID},
+		Metadata:      metadata,
+		CorrelationID: event.CorrelationID,
+		EventID:       fmt.Sprintf("outbox:%d", event.ID),
+	})
+}
+
+// NewHistorySink creates an EventSink that writes payment events to the history log.
+func NewHistorySink(hs HistoryService) EventSink {
+	return &historySink{hs: hs}
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// invoicesFile stores the invoices.
+const invoicesFile = "database/invoices.json"
+
+// InvoiceService defines the interface of merchant invoices and their payment links.
+type InvoiceService interface {
+	// CreateInvoice creates an invoice with a payment link for the merchant.
+	CreateInvoice(caller dto.Caller, payload dto.InvoicePayload) (models.Invoice, error)
+	// GetInvoices returns the invoices the caller may see, newest first.
+	GetInvoices(caller dto.Caller, filter dto.InvoiceFilter) ([]models.Invoice, error)
+	// GetInvoice returns one invoice.
+	GetInvoice(caller dto.Caller, id string) (models.Invoice, error)
+	// VoidInvoice voids an open invoice so that it can no longer be paid.
+	VoidInvoice(caller dto.Caller, id string) (models.Invoice, error)
+	// GetPaymentPage returns what the payment page of the invoice with the token shows.
+	GetPaymentPage(token string) (dto.InvoicePage, error)
+	// PayInvoice pays the invoice named by the request's invoice token through the PaymentService.
+	PayInvoice(paymentRequest models.PaymentRequest) (models.Payment, error)
+	// ApplyPayment updates the invoice a payment paid to follow the payment's status.
+	ApplyPayment(payment models.Payment) error
+}
+
+// invoiceService is a concrete implementation of the InvoiceService interface.
+// It pays invoices through the PaymentService and reads the time from its Clock. The mutex
+// serialises updates of the invoices file, including whole payments, so an invoice cannot be
+// paid twice.
+type invoiceService struct {
+	conf  config.InvoiceConfig
+	ps    PaymentService
+	cs    CustomerService
+	ms    MerchantService
+	clock Clock
+	mu    sync.Mutex
+}
+
+// CreateInvoice checks the merchant, the customer if the invoice is addressed to one, the due
+// date and the amounts in the invoice currency, which defaults to the merchant's, and stores the
+// invoice with a new payment token.
+func (s *invoiceService) CreateInvoice(caller dto.Caller, payload dto.InvoicePayload) (models.Invoice, error) {
+	merchantID := payload.MerchantID
+	if caller.Role == models.RoleMerchant && merchantID == "" {
+		merchantID = caller.MerchantID
+	}
+	if merchantID == "" {
+		return models.Invoice{}, NewValidationError("invalid invoice", []util.FieldError{{Field: "merchant_id", Rule: "required", Message: "is required"}})
+	}
+	if err := canManageMerchant(caller, merchantID); err != nil {
+		return models.Invoice{}, err
+	}
+	merchant, err := s.ms.GetMerchant(merchantID)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if payload.CustomerID != "" {
+		if err := s.checkCustomer(payload.CustomerID); err != nil {
+			return models.Invoice{}, err
+		}
+	}
+
+	now := s.clock.Now()
+	due, err := time.ParseInLocation("2006-01-02", payload.DueDate, now.Location())
+	if err != nil || due.Before(truncateToDay(now)) {
+		return models.Invoice{}, NewValidationError("invalid invoice", []util.FieldError{{Field: "due_date", Rule: "future", Message: "must be today or a later date"}})
+	}
+
+	currency := payload.Currency
+	if currency == "" {
+		currency = merchant.GetCurrency()
+	}
+	items := make([]models.InvoiceItem, 0, len(payload.Items))
+	total := 0.0
+	for _, item := range payload.Items {
+		if err := checkCurrencyPrecision(item.UnitPrice, currency); err != nil {
+			return models.Invoice{}, err
+		}
+		amount := roundToCurrency(float64(item.Quantity)*item.UnitPrice, currency)
+		items = append(items, models.InvoiceItem{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Amount:      amount,
+		})
+		total += amount
+	}
+
+	token := util.RandomHex(24)
+	invoice := models.Invoice{
+		ID:         util.NewID("inv_"),
+		MerchantID: merchant.ID,
+		CustomerID: payload.CustomerID,
+		Currency:   currency,
+		Items:      items,
+		Amount:     roundToCurrency(total, currency),
+		DueDate:    payload.DueDate,
+		Memo:       payload.Memo,
+		Token:      token,
+		PaymentURL: s.conf.BaseURL + "/pay/" + token,
+		Status:     models.InvoiceOpen,
+		CreatedAt:  now.Format(time.RFC3339),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invoices, err := loadInvoices()
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if err := saveInvoices(append(invoices, invoice)); err != nil {
+		return models.Invoice{}, err
+	}
+	return invoice, nil
+}
+
+// GetInvoices returns a merchant's own invoices, a customer's invoices, or every one for admins,
+// filtered by status, merchant and customer.
+func (s *invoiceService) GetInvoices(caller dto.Caller, filter dto.InvoiceFilter) ([]models.Invoice, error) {
+	invoices, err := loadInvoices()
+	if err != nil {
+		return nil, err
+	}
+	result := []models.Invoice{}
+	for _, invoice := range invoices {
+		if !canViewInvoice(caller, invoice) {
+			continue
+		}
+		if filter.Status != "" && invoice.Status != filter.Status {
+			continue
+		}
+		if (filter.MerchantID != "" && invoice.MerchantID != filter.MerchantID) || (filter.CustomerID != "" && invoice.CustomerID != filter.CustomerID) {
+			continue
+		}
+		result = append(result, invoice)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt > result[j].CreatedAt
+	})
+	return result, nil
+}
+
+// GetInvoice returns the invoice with the ID if the caller may see it, or a not found error.
+func (s *invoiceService) GetInvoice(caller dto.Caller, id string) (models.Invoice, error) {
+	invoices, err := loadInvoices()
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	i := findInvoice(invoices, func(invoice models.Invoice) bool { return invoice.ID == id })
+	if i < 0 || !canViewInvoice(caller, invoices[i]) {
+		return models.Invoice{}, NewNotFoundError(CodeInvoiceNotFound, "invoice not found")
+	}
+	return invoices[i], nil
+}
+
+// VoidInvoice voids an open invoice. Only its merchant and admins may void it.
+func (s *invoiceService) VoidInvoice(caller dto.Caller, id string) (models.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoices, err := loadInvoices()
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	i := findInvoice(invoices, func(invoice models.Invoice) bool { return invoice.ID == id })
+	if i < 0 || !canViewInvoice(caller, invoices[i]) {
+		return models.Invoice{}, NewNotFoundError(CodeInvoiceNotFound, "invoice not found")
+	}
+	if err := canManageMerchant(caller, invoices[i].MerchantID); err != nil {
+		return models.Invoice{}, err
+	}
+	if invoices[i].Status != models.InvoiceOpen {
+		return models.Invoice{}, NewConflictError(CodeInvoiceNotOpen, "only open invoices can be voided")
+	}
+
+	invoices[i].Status = models.InvoiceVoid
+	invoices[i].VoidedAt = s.clock.Now().Format(time.RFC3339)
+	if err := saveInvoices(invoices); err != nil {
+		return models.Invoice{}, err
+	}
+	return invoices[i], nil
+}
+
+// GetPaymentPage returns the invoice with the token together with its merchant's name and
+// whether it can be paid. The token is the only credential the page needs.
+func (s *invoiceService) GetPaymentPage(token string) (dto.InvoicePage, error) {
+	invoices, err := loadInvoices()
+	if err != nil {
+		return dto.InvoicePage{}, err
+	}
+	i := findInvoice(invoices, func(invoice models.Invoice) bool { return invoice.Token == token })
+	if token == "" || i < 0 {
+		return dto.InvoicePage{}, NewNotFoundError(CodeInvoiceNotFound, "invoice not found")
+	}
+	merchant, err := s.ms.GetMerchant(invoices[i].MerchantID)
+	if err != nil {
+		return dto.InvoicePage{}, err
+	}
+	overdue := s.overdue(invoices[i])
+	return dto.InvoicePage{
+		Invoice:      invoices[i],
+		MerchantName: merchant.Name,
+		Payable:      invoices[i].Status == models.InvoiceOpen && !overdue,
+		Overdue:      invoices[i].Status == models.InvoiceOpen && overdue,
+	}, nil
+}
+
+// PayInvoice fills in the merchant, amount and currency of the invoice with the request's token,
+// rejecting a request that names different ones, and posts the payment through the payment flow.
+// The invoice must be open and not past its due date, and an invoice addressed to a customer can
+// only be paid by them. The invoice follows the status of the payment: paid when it succeeds and
+// processing while it is held for review. A payment that fails leaves the invoice open.
+func (s *invoiceService) PayInvoice(paymentRequest models.PaymentRequest) (models.Payment, error) {
+	if paymentRequest.ExecuteAt != "" {
+		return models.Payment{}, NewValidationError("invalid payment", []util.FieldError{{Field: "execute_at", Rule: "excluded_with", Message: "invoices are paid right away"}})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoices, err := loadInvoices()
+	if err != nil {
+		return models.Payment{}, err
+	}
+	i := findInvoice(invoices, func(invoice models.Invoice) bool { return invoice.Token == paymentRequest.InvoiceToken })
+	if i < 0 {
+		return models.Payment{}, NewNotFoundError(CodeInvoiceNotFound, "invoice not found")
+	}
+	invoice := &invoices[i]
+	if invoice.CustomerID != "" && invoice.CustomerID != paymentRequest.CustomerID {
+		return models.Payment{}, NewForbiddenError(CodeForbidden, "the invoice is addressed to another customer")
+	}
+	if invoice.Status != models.InvoiceOpen {
+		return models.Payment{}, NewConflictError(CodeInvoiceNotPayable, fmt.Sprintf("the invoice is %s", invoice.Status))
+	}
+	if s.overdue(*invoice) {
+		return models.Payment{}, NewConflictError(CodeInvoiceNotPayable, "the invoice is past its due date")
+	}
+
+	var fields []util.FieldError
+	if paymentRequest.MerchantID != "" && paymentRequest.MerchantID != invoice.MerchantID {
+		fields = append(fields, util.FieldError{Field: "merchant_id", Rule: "invoice", Message: "must match the invoice"})
+	}
+	if paymentRequest.Amount != 0 && paymentRequest.Amount != invoice.Amount {
+		fields = append(fields, util.FieldError{Field: "amount", Rule: "invoice", Message: "must match the invoice"})
+	}
+	if paymentRequest.Currency != "" && paymentRequest.Currency != invoice.Currency {
+		fields = append(fields, util.FieldError{Field: "currency", Rule: "invoice", Message: "must match the invoice"})
+	}
+	if len(fields) > 0 {
+		return models.Payment{}, NewValidationError("payment does not match the invoice", fields)
+	}
+	paymentRequest.MerchantID = invoice.MerchantID
+	paymentRequest.Amount = invoice.Amount
+	paymentRequest.Currency = invoice.Currency
+	paymentRequest.InvoiceID = invoice.ID
+
+	payment, err := s.ps.PostPayment(paymentRequest)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	if applyInvoicePayment(invoice, payment) {
+		if err := saveInvoices(invoices); err != nil {
+			return models.Payment{}, err
+		}
+	}
+	return payment, nil
+}
+
+// NewInvoiceService creates a new instance of invoiceService that pays invoices through the
+// PaymentService, checks customers and merchants with the CustomerService and MerchantService
+// and tells the time with the Clock.
+func NewInvoiceService(conf config.InvoiceConfig, ps PaymentService, cs CustomerService, ms MerchantService, clock Clock) InvoiceService {
+	return &invoiceService{conf: conf, ps: ps, cs: cs, ms: ms, clock: clock}
+}
+
+// checkCustomer returns a not found error if the customer does not exist.
+func (s *invoiceService) checkCustomer(customerID string) error {
+	customers, err := s.cs.GetAllCustomer()
+	if err != nil {
+		return err
+	}
+	for _, customer := range customers {
+		if customer.ID == customerID {
+			return nil
+		}
+	}
+	return NewNotFoundError(CodeCustomerNotFound, "customer not found")
+}
+
+// overdue reports whether the invoice's due date has passed. An invoice can be paid until the
+// end of its due date.
+func (s *invoiceService) overdue(invoice models.Invoice) bool {
+	now := s.clock.Now()
+	due, err := time.ParseInLocation("2006-01-02", invoice.DueDate, now.Location())
+	return err == nil && !now.Before(due.AddDate(0, 0, 1))
+}
+
+// ApplyPayment updates the invoice of a payment, if it paid one, from a published payment event.
+func (s *invoiceService) ApplyPayment(payment models.Payment) error {
+	if payment.InvoiceID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoices, err := loadInvoices()
+	if err != nil {
+		return err
+	}
+	i := findInvoice(invoices, func(invoice models.Invoice) bool { return invoice.ID == payment.InvoiceID })
+	if i < 0 || !applyInvoicePayment(&invoices[i], payment) {
+		return nil
+	}
+	return saveInvoices(invoices)
+}
+
+// applyInvoicePayment makes the invoice follow the status of its payment and reports whether
+// it changed. A payment other than the invoice's own is only taken while the invoice is open.
+func applyInvoicePayment(invoice *models.Invoice, payment models.Payment) bool {
+	if invoice.TransactionID != payment.TransactionID && (invoice.TransactionID != "" || invoice.Status != models.InvoiceOpen) {
+		return false
+	}
+
+	before := *invoice
+	switch payment.Status {
+	case models.PaymentStatusSucceeded:
+		invoice.Status = models.InvoicePaid
+		invoice.PaidAt = payment.Timestamp
+		if payment.Risk != nil && payment.Risk.Review != nil {
+			invoice.PaidAt = payment.Risk.Review.ReviewedAt
+		}
+	case models.PaymentStatusPendingReview:
+		invoice.Status = models.InvoiceProcessing
+	case models.PaymentStatusRefunded:
+		invoice.Status = models.InvoiceRefunded
+	case models.PaymentStatusFailed:
+		invoice.Status = models.InvoiceOpen
+		invoice.TransactionID = ""
+		return invoice.Status != before.Status || before.TransactionID != ""
+	}
+	invoice.TransactionID = payment.TransactionID
+	if invoice.CustomerID == "" {
+		invoice.CustomerID = payment.CustomerID
+	}
+	return invoice.Status != before.Status || invoice.TransactionID != before.TransactionID || invoice.CustomerID != before.CustomerID || invoice.PaidAt != before.PaidAt
+}
+
+// canViewInvoice reports whether the caller may see an invoice: its merchant, its customer and admins.
+func canViewInvoice(caller dto.Caller, invoice models.Invoice) bool {
+	return canViewPayment(caller, models.Payment{CustomerID: invoice.CustomerID, MerchantID: invoice.MerchantID})
+}
+
+// findInvoice returns the index of the first invoice matching the predicate, or -1.
+func findInvoice(invoices []models.Invoice, match func(models.Invoice) bool) int {
+	for i, invoice := range invoices {
+		if match(invoice) {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadInvoices reads the invoices file.
+func loadInvoices() ([]models.Invoice, error) {
+	invoices := []models.Invoice{}
+	if err := util.ReadJSONFile(invoicesFile, &invoices); err != nil {
+		return nil, fmt.Errorf("failed to read invoices: %v", err)
+	}
+	return invoices, nil
+}
+
+// saveInvoices writes the invoices file.
+func saveInvoices(invoices []models.Invoice) error {
+	if err := util.WriteJSONFile(invoicesFile, invoices); err != nil {
+		return fmt.Errorf("failed to save invoices: %v", err)
+	}
+	return nil
+}
+
+// invoiceSink is an EventSink that keeps invoices in step with their payments after they are
+// reviewed or refunded.
+type invoiceSink struct {
+	invoices InvoiceService
+}
+
+// Name identifies the invoice sink.
+func (s *invoiceSink) Name() string {
+	return "invoices"
+}
+
+// Publish updates the invoice of the payment carried by the event, if it paid one.
+func (s *invoiceSink) Publish(event models.OutboxEvent) error {
+	payment, err := event.Payment()
+	if err != nil {
+		return fmt.Errorf("failed to decode payment: %v", err)
+	}
+	return s.invoices.ApplyPayment(payment)
+}
+
+// NewInvoiceSink creates an EventSink that updates invoices from their payments' events.
+func NewInvoiceSink(invoices InvoiceService) EventSink {
+	return &invoiceSink{invoices: invoices}
+}
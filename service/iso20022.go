@@ -0,0 +1,555 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/util"
+)
+
+// Namespaces of the ISO 20022 messages exchanged with the bank.
+const (
+	pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+	camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001."
+)
+
+// Patterns of the ISO 20022 simple types.
+var (
+	ibanPattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[a-zA-Z0-9]{1,30}$`)
+	bicPattern  = regexp.MustCompile(`^[A-Z]{6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3})?$`)
+)
+
+// pain001Document is a pain.001.001.03 customer credit transfer initiation.
+type pain001Document struct {
+	XMLName    xml.Name          `xml:"Document"`
+	Namespace  string            `xml:"xmlns,attr"`
+	Initiation pain001Initiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type pain001Initiation struct {
+	GroupHeader pain001GroupHeader   `xml:"GrpHdr"`
+	Payments    []pain001PaymentInfo `xml:"PmtInf"`
+}
+
+type pain001GroupHeader struct {
+	MessageID       string   `xml:"MsgId"`
+	CreatedAt       string   `xml:"CreDtTm"`
+	NumberOfTxs     string   `xml:"NbOfTxs"`
+	ControlSum      string   `xml:"CtrlSum"`
+	InitiatingParty isoParty `xml:"InitgPty"`
+}
+
+type pain001PaymentInfo struct {
+	ID            string            `xml:"PmtInfId"`
+	Method        string            `xml:"PmtMtd"`
+	BatchBooking  bool              `xml:"BtchBookg"`
+	NumberOfTxs   string            `xml:"NbOfTxs"`
+	ControlSum    string            `xml:"CtrlSum"`
+	ExecutionDate string            `xml:"ReqdExctnDt"`
+	Debtor        isoParty          `xml:"Dbtr"`
+	DebtorAccount isoAccount        `xml:"DbtrAcct"`
+	DebtorAgent   isoAgent          `xml:"DbtrAgt"`
+	ChargeBearer  string            `xml:"ChrgBr"`
+	Transfers     []pain001Transfer `xml:"CdtTrfTxInf"`
+}
+
+type pain001Transfer struct {
+	PaymentID       isoPaymentID  `xml:"PmtId"`
+	Amount          isoAmounts    `xml:"Amt"`
+	CreditorAgent   isoAgent      `xml:"CdtrAgt"`
+	Creditor        isoParty      `xml:"Cdtr"`
+	CreditorAccount isoAccount    `xml:"CdtrAcct"`
+	Remittance      isoRemittance `xml:"RmtInf"`
+}
+
+type isoParty struct {
+	Name string `xml:"Nm"`
+}
+
+type isoAccount struct {
+	ID       isoAccountID `xml:"Id"`
+	Currency string       `xml:"Ccy,omitempty"`
+}
+
+type isoAccountID struct {
+	IBAN  string      `xml:"IBAN,omitempty"`
+	Other *isoOtherID `xml:"Othr,omitempty"`
+}
+
+type isoOtherID struct {
+	ID string `xml:"Id"`
+}
+
+type isoAgent struct {
+	BIC string `xml:"FinInstnId>BIC"`
+}
+
+type isoPaymentID struct {
+	InstructionID string `xml:"InstrId,omitempty"`
+	EndToEndID    string `xml:"EndToEndId"`
+}
+
+type isoAmounts struct {
+	Instructed isoAmount `xml:"InstdAmt"`
+}
+
+type isoAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type isoRemittance struct {
+	Unstructured []string `xml:"Ustrd"`
+}
+
+// buildPain001 creates a pain.001 message that pays the payouts from the settlement account, with
+// one payment information block per currency and value date. Every payout's merchant must have a
+// payout account.
+func buildPain001(debtor config.SettlementConfig, messageID string, payouts []models.PayoutInstruction, accounts map[string]models.BankAccount, now time.Time) ([]byte, error) {
+	doc := pain001Document{
+		Namespace: pain001Namespace,
+		Initiation: pain001Initiation{GroupHeader: pain001GroupHeader{
+			MessageID:       messageID,
+			CreatedAt:       now.Format("2006-01-02T15:04:05"),
+			NumberOfTxs:     strconv.Itoa(len(payouts)),
+			InitiatingParty: isoParty{Name: debtor.DebtorName},
+		}},
+	}
+
+	total := 0.0
+	blocks := map[string]int{}
+	for _, payout := range payouts {
+		key := payout.Currency + "/" + payout.ValueDate
+		i, ok := blocks[key]
+		if !ok {
+			i = len(doc.Initiation.Payments)
+			blocks[key] = i
+			doc.Initiation.Payments = append(doc.Initiation.Payments, pain001PaymentInfo{
+				ID:            fmt.Sprintf("%s-%d", messageID, i+1),
+				Method:        "TRF",
+				BatchBooking:  false,
+				ExecutionDate: payout.ValueDate,
+				Debtor:        isoParty{Name: debtor.DebtorName},
+				DebtorAccount: isoAccount{ID: accountID(models.BankAccount{IBAN: debtor.DebtorIBAN, Number: debtor.DebtorAccount}), Currency: payout.Currency},
+				DebtorAgent:   isoAgent{BIC: debtor.DebtorBIC},
+				ChargeBearer:  "SLEV",
+			})
+		}
+		account := accounts[payout.MerchantID]
+		block := &doc.Initiation.Payments[i]
+		block.Transfers = append(block.Transfers, pain001Transfer{
+			PaymentID:       isoPaymentID{InstructionID: payout.BatchID, EndToEndID: payout.ID},
+			Amount:          isoAmounts{Instructed: isoAmount{Currency: payout.Currency, Value: formatISOAmount(payout.Amount, payout.Currency)}},
+			CreditorAgent:   isoAgent{BIC: account.BIC},
+			Creditor:        isoParty{Name: payout.Beneficiary},
+			CreditorAccount: isoAccount{ID: accountID(account)},
+			Remittance:      isoRemittance{Unstructured: []string{payout.Reference}},
+		})
+		total += payout.Amount
+	}
+	for i := range doc.Initiation.Payments {
+		block := &doc.Initiation.Payments[i]
+		sum := 0.0
+		for _, transfer := range block.Transfers {
+			amount, _ := strconv.ParseFloat(transfer.Amount.Instructed.Value, 64)
+			sum += amount
+		}
+		block.NumberOfTxs = strconv.Itoa(len(block.Transfers))
+		block.ControlSum = formatControlSum(sum)
+	}
+	doc.Initiation.GroupHeader.ControlSum = formatControlSum(total)
+
+	if err := validatePain001(doc); err != nil {
+		return nil, err
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pain.001: %v", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// accountID identifies an account by IBAN, or else by its account number.
+func accountID(account models.BankAccount) isoAccountID {
+	if account.IBAN != "" {
+		return isoAccountID{IBAN: account.IBAN}
+	}
+	return isoAccountID{Other: &isoOtherID{ID: account.Number}}
+}
+
+// formatISOAmount writes an amount with the currency's number of decimals.
+func formatISOAmount(amount float64, currency string) string {
+	return strconv.FormatFloat(amount, 'f', models.CurrencyDecimals(currency), 64)
+}
+
+// formatControlSum writes a control sum without the float noise of adding amounts up.
+func formatControlSum(sum float64) string {
+	return strconv.FormatFloat(math.Round(sum*1e5)/1e5, 'f', -1, 64)
+}
+
+// validatePain001 checks a pain.001 message against the structure and simple type facets of the
+// pain.001.001.03 schema, so the bank never receives a message it would reject.
+func validatePain001(doc pain001Document) error {
+	v := &isoValidator{}
+	header := doc.Initiation.GroupHeader
+	v.text("GrpHdr/MsgId", header.MessageID, 35)
+	v.required("GrpHdr/CreDtTm", header.CreatedAt)
+	v.count("GrpHdr/NbOfTxs", header.NumberOfTxs)
+	v.decimal("GrpHdr/CtrlSum", header.ControlSum)
+	v.text("GrpHdr/InitgPty/Nm", header.InitiatingParty.Name, 140)
+	if len(doc.Initiation.Payments) == 0 {
+		v.fail("PmtInf", "at least one payment information block is required")
+	}
+	for i, block := range doc.Initiation.Payments {
+		path := fmt.Sprintf("PmtInf[%d]", i+1)
+		v.text(path+"/PmtInfId", block.ID, 35)
+		v.oneOf(path+"/PmtMtd", block.Method, "TRF", "CHK", "TRA")
+		v.count(path+"/NbOfTxs", block.NumberOfTxs)
+		v.decimal(path+"/CtrlSum", block.ControlSum)
+		if _, err := time.Parse(businessDateLayout, block.ExecutionDate); err != nil {
+			v.fail(path+"/ReqdExctnDt", "must be an ISO date")
+		}
+		v.text(path+"/Dbtr/Nm", block.Debtor.Name, 140)
+		v.account(path+"/DbtrAcct", block.DebtorAccount)
+		v.bic(path+"/DbtrAgt", block.DebtorAgent.BIC)
+		v.oneOf(path+"/ChrgBr", block.ChargeBearer, "DEBT", "CRED", "SHAR", "SLEV")
+		if len(block.Transfers) == 0 {
+			v.fail(path+"/CdtTrfTxInf", "at least one credit transfer is required")
+		}
+		for j, transfer := range block.Transfers {
+			path := fmt.Sprintf("%s/CdtTrfTxInf[%d]", path, j+1)
+			v.text(path+"/PmtId/EndToEndId", transfer.PaymentID.EndToEndID, 35)
+			if transfer.PaymentID.InstructionID != "" {
+				v.text(path+"/PmtId/InstrId", transfer.PaymentID.InstructionID, 35)
+			}
+			v.amount(path+"/Amt/InstdAmt", transfer.Amount.Instructed)
+			v.bic(path+"/CdtrAgt", transfer.CreditorAgent.BIC)
+			v.text(path+"/Cdtr/Nm", transfer.Creditor.Name, 140)
+			v.account(path+"/CdtrAcct", transfer.CreditorAccount)
+			for _, line := range transfer.Remittance.Unstructured {
+				v.text(path+"/RmtInf/Ustrd", line, 140)
+			}
+		}
+	}
+	return v.err("pain.001")
+}
+
+// camt053Document is a camt.053 bank to customer statement. The fields read are common to
+// versions 001.02 to 001.08.
+type camt053Document struct {
+	XMLName    xml.Name           `xml:"Document"`
+	Statements []camt053Statement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camt053Statement struct {
+	ID      string         `xml:"Id"`
+	Account isoAccount     `xml:"Acct"`
+	Entries []camt053Entry `xml:"Ntry"`
+}
+
+type camt053Entry struct {
+	Amount       isoAmount         `xml:"Amt"`
+	CreditDebit  string            `xml:"CdtDbtInd"`
+	Status       camt053Status     `xml:"Sts"`
+	BookingDate  camt053Date       `xml:"BookgDt"`
+	ServicerRef  string            `xml:"AcctSvcrRef"`
+	Transactions []camt053TxDetail `xml:"NtryDtls>TxDtls"`
+}
+
+// camt053Status is the entry status, a plain code up to version 001.06 and a Cd element after it.
+type camt053Status struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+type camt053Date struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camt053TxDetail struct {
+	Refs         camt053Refs   `xml:"Refs"`
+	Amount       *isoAmount    `xml:"Amt"`
+	DetailAmount *isoAmount    `xml:"AmtDtls>TxAmt>Amt"`
+	Remittance   isoRemittance `xml:"RmtInf"`
+}
+
+type camt053Refs struct {
+	EndToEndID    string `xml:"EndToEndId"`
+	InstructionID string `xml:"InstrId"`
+	ServicerRef   string `xml:"AcctSvcrRef"`
+}
+
+// statementEntry is a booked transaction of a camt.053 statement.
+type statementEntry struct {
+	number    int
+	credit    bool
+	reference string
+	amount    float64
+	currency  string
+	date      string
+}
+
+// parseCamt053 reads the booked transactions of a camt.053 statement, one per transaction detail
+// of batched entries. A transaction is identified by its end to end ID, falling back to the
+// unstructured remittance information and the bank's reference. Pending entries are skipped.
+func parseCamt053(file io.Reader, location *time.Location) ([]statementEntry, error) {
+	var doc camt053Document
+	if err := xml.NewDecoder(file).Decode(&doc); err != nil {
+		return nil, NewMalformedError("statement is not valid XML", err)
+	}
+	if !strings.HasPrefix(doc.XMLName.Space, camt053Namespace) {
+		return nil, NewValidationError("invalid statement", []util.FieldError{{Field: "Document", Rule: "namespace", Message: "must be a camt.053 document"}})
+	}
+
+	v := &isoValidator{}
+	if len(doc.Statements) == 0 {
+		v.fail("BkToCstmrStmt/Stmt", "at least one statement is required")
+	}
+	var entries []statementEntry
+	number := 0
+	for i, statement := range doc.Statements {
+		path := fmt.Sprintf("Stmt[%d]", i+1)
+		v.text(path+"/Id", statement.ID, 35)
+		for j, entry := range statement.Entries {
+			number++
+			path := fmt.Sprintf("%s/Ntry[%d]", path, j+1)
+			v.amount(path+"/Amt", entry.Amount)
+			v.oneOf(path+"/CdtDbtInd", entry.CreditDebit, "CRDT", "DBIT")
+			status := strings.TrimSpace(entry.Status.Code + entry.Status.Value)
+			v.oneOf(path+"/Sts", status, "BOOK", "PDNG", "INFO", "FUTR")
+			date, err := statementDate(entry.BookingDate, location)
+			if err != nil {
+				v.fail(path+"/BookgDt", "must have an ISO date or date time")
+			}
+			if status != "BOOK" {
+				continue
+			}
+
+			details := entry.Transactions
+			if len(details) == 0 {
+				details = []camt053TxDetail{{}}
+			}
+			for _, detail := range details {
+				amount, amountPath := entry.Amount, path+"/Amt"
+				if detail.Amount != nil {
+					amount, amountPath = *detail.Amount, path+"/NtryDtls/TxDtls/Amt"
+				} else if detail.DetailAmount != nil {
+					amount, amountPath = *detail.DetailAmount, path+"/NtryDtls/TxDtls/AmtDtls/TxAmt/Amt"
+				}
+				if amountPath != path+"/Amt" {
+					v.amount(amountPath, amount)
+				} else if len(details) > 1 {
+					v.fail(path+"/NtryDtls/TxDtls/Amt", "is required for each transaction of a batched entry")
+				}
+				value, err := strconv.ParseFloat(strings.TrimSpace(amount.Value), 64)
+				if err != nil {
+					v.fail(amountPath, "must be a decimal amount")
+					continue
+				}
+				entries = append(entries, statementEntry{
+					number:    number,
+					credit:    entry.CreditDebit == "CRDT",
+					reference: statementReference(entry, detail),
+					amount:    value,
+					currency:  amount.Currency,
+					date:      date,
+				})
+			}
+		}
+	}
+	if err := v.err("camt.053"); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, NewValidationError("invalid statement", []util.FieldError{{Field: "Ntry", Rule: "required", Message: "statement has no booked entries"}})
+	}
+	return entries, nil
+}
+
+// statementReference returns the reference that identifies a statement transaction.
+func statementReference(entry camt053Entry, detail camt053TxDetail) string {
+	if ref := strings.TrimSpace(detail.Refs.EndToEndID); ref != "" && ref != "NOTPROVIDED" {
+		return ref
+	}
+	for _, line := range detail.Remittance.Unstructured {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	if ref := strings.TrimSpace(detail.Refs.ServicerRef); ref != "" {
+		return ref
+	}
+	return strings.TrimSpace(entry.ServicerRef)
+}
+
+// statementDate returns the business date of a booking date or date time.
+func statementDate(date camt053Date, location *time.Location) (string, error) {
+	if date.DateTime != "" {
+		at, err := time.Parse(time.RFC3339, date.DateTime)
+		if err != nil {
+			at, err = time.ParseInLocation("2006-01-02T15:04:05", date.DateTime, location)
+		}
+		if err != nil {
+			return "", err
+		}
+		return at.In(location).Format(businessDateLayout), nil
+	}
+	day, err := time.Parse(businessDateLayout, date.Date)
+	if err != nil {
+		return "", err
+	}
+	return day.Format(businessDateLayout), nil
+}
+
+// isoValidator collects the violations of ISO 20022 schema facets, addressed by element path.
+type isoValidator struct {
+	fields []util.FieldError
+}
+
+func (v *isoValidator) fail(path, message string) {
+	v.fields = append(v.fields, util.FieldError{Field: path, Rule: "schema", Message: message})
+}
+
+func (v *isoValidator) required(path, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.fail(path, "is required")
+	}
+}
+
+// text checks a MaxNText element.
+func (v *isoValidator) text(path, value string, maxLength int) {
+	v.required(path, value)
+	if len([]rune(value)) > maxLength {
+		v.fail(path, fmt.Sprintf("must be at most %d characters long", maxLength))
+	}
+}
+
+// count checks a Max15NumericText element.
+func (v *isoValidator) count(path, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || len(value) > 15 {
+		v.fail(path, "must be a positive count of at most 15 digits")
+	}
+}
+
+// decimal checks a DecimalNumber element: at most 18 digits, 17 of them fractional.
+func (v *isoValidator) decimal(path, value string) {
+	if !validISODecimal(value, 17) {
+		v.fail(path, "must be a decimal number of at most 18 digits")
+	}
+}
+
+// amount checks an ActiveOrHistoricCurrencyAndAmount element: a positive amount of at most 18
+// digits, 5 of them fractional, and a three letter currency.
+func (v *isoValidator) amount(path string, amount isoAmount) {
+	value := strings.TrimSpace(amount.Value)
+	if !validISODecimal(value, 5) {
+		v.fail(path, "must be a decimal amount of at most 18 digits and 5 decimals")
+	} else if n, _ := strconv.ParseFloat(value, 64); n <= 0 {
+		v.fail(path, "must be positive")
+	}
+	if !currencyPattern.MatchString(amount.Currency) {
+		v.fail(path+"/@Ccy", "must be a three letter currency code")
+	}
+}
+
+func (v *isoValidator) account(path string, account isoAccount) {
+	switch {
+	case account.ID.IBAN != "":
+		if !validIBAN(account.ID.IBAN) {
+			v.fail(path+"/Id/IBAN", "must be an IBAN with a valid check digit")
+		}
+	case account.ID.Other != nil:
+		v.text(path+"/Id/Othr/Id", account.ID.Other.ID, 34)
+	default:
+		v.fail(path+"/Id", "an IBAN or other account ID is required")
+	}
+	if account.Currency != "" && !currencyPattern.MatchString(account.Currency) {
+		v.fail(path+"/Ccy", "must be a three letter currency code")
+	}
+}
+
+func (v *isoValidator) bic(path, value string) {
+	if !bicPattern.MatchString(value) {
+		v.fail(path+"/FinInstnId/BIC", "must be a BIC")
+	}
+}
+
+func (v *isoValidator) oneOf(path, value string, codes ...string) {
+	for _, code := range codes {
+		if value == code {
+			return
+		}
+	}
+	v.fail(path, "must be one of "+strings.Join(codes, ", "))
+}
+
+// err returns the collected violations as a validation error.
+func (v *isoValidator) err(message string) error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return NewValidationError(message+" does not conform to the schema", v.fields)
+}
+
+// validISODecimal reports whether a value is a decimal with at most 18 digits and the given
+// number of fraction digits.
+func validISODecimal(value string, fractionDigits int) bool {
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > fractionDigits || len(whole)+len(fraction) > 18 {
+		return false
+	}
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validIBAN reports whether a value has the shape of an IBAN and passes the ISO 13616 mod-97
+// check: with the first four characters moved to the end and letters replaced by 10 to 35, the
+// number must leave a remainder of 1 when divided by 97.
+func validIBAN(iban string) bool {
+	if !ibanPattern.MatchString(iban) {
+		return false
+	}
+	remainder := 0
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		case r >= 'a' && r <= 'z':
+			remainder = (remainder*100 + int(r-'a') + 10) % 97
+		}
+	}
+	return remainder == 1
+}
+
+// validateBankAccount checks a payout account's IBAN or account number and its BIC.
+func validateBankAccount(account models.BankAccount) error {
+	var fields []util.FieldError
+	switch {
+	case account.IBAN != "" && !validIBAN(account.IBAN):
+		fields = append(fields, util.FieldError{Field: "iban", Rule: "iban", Message: "must be an IBAN with valid check digits such as DE89370400440532013000"})
+	case account.IBAN == "" && strings.TrimSpace(account.Number) == "":
+		fields = append(fields, util.FieldError{Field: "number", Rule: "required", Message: "is required when iban is not given"})
+	}
+	if !bicPattern.MatchString(account.BIC) {
+		fields = append(fields, util.FieldError{Field: "bic", Rule: "bic", Message: "must be a BIC such as DEUTDEFF"})
+	}
+	if len(fields) > 0 {
+		return NewValidationError("invalid payout account", fields)
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+)
+
+// xmlNode is an element of a decoded XML document.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xmlNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+// attr returns the value of the attribute with the local name.
+func (n xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// schemaElement describes an element of the pain.001.001.03 schema: how often it occurs in its
+// parent's sequence, its children in schema order, or the facets of its simple type. Elements the
+// export never writes are left out, so they are reported as unexpected.
+type schemaElement struct {
+	name     string
+	min, max int // max -1 is unbounded
+	choice   bool
+	children []schemaElement
+	value    func(string) error
+	attrs    map[string]func(string) error
+}
+
+// el returns an element occurring between min and max times.
+func el(name string, min, max int, children ...schemaElement) schemaElement {
+	return schemaElement{name: name, min: min, max: max, children: children}
+}
+
+// leaf returns a simple type element occurring between min and max times.
+func leaf(name string, min, max int, value func(string) error) schemaElement {
+	return schemaElement{name: name, min: min, max: max, value: value}
+}
+
+// choice returns an element whose content is exactly one of the alternatives.
+func choice(name string, min, max int, alternatives ...schemaElement) schemaElement {
+	return schemaElement{name: name, min: min, max: max, choice: true, children: alternatives}
+}
+
+// maxText is a MaxNText simple type.
+func maxText(length int) func(string) error {
+	return func(v string) error {
+		if n := len([]rune(v)); n < 1 || n > length {
+			return fmt.Errorf("length %d is not between 1 and %d", n, length)
+		}
+		return nil
+	}
+}
+
+// pattern is a simple type restricted by a pattern facet.
+func pattern(expr string) func(string) error {
+	re := regexp.MustCompile("^(?:" + expr + ")$")
+	return func(v string) error {
+		if !re.MatchString(v) {
+			return fmt.Errorf("%q does not match %s", v, expr)
+		}
+		return nil
+	}
+}
+
+// layout is a date or date time simple type.
+func layout(format string) func(string) error {
+	return func(v string) error {
+		_, err := time.Parse(format, v)
+		return err
+	}
+}
+
+// enum is a code simple type.
+func enum(codes ...string) func(string) error {
+	return func(v string) error {
+		for _, code := range codes {
+			if v == code {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %v", v, codes)
+	}
+}
+
+// decimal is a decimal simple type with totalDigits and fractionDigits facets and a minimum of zero.
+func decimal(totalDigits, fractionDigits int) func(string) error {
+	return func(v string) error {
+		whole, fraction, _ := strings.Cut(v, ".")
+		if _, err := strconv.ParseFloat(v, 64); err != nil || strings.ContainsAny(v, "+-eE") {
+			return fmt.Errorf("%q is not a decimal", v)
+		}
+		if len(fraction) > fractionDigits || len(strings.TrimLeft(whole, "0"))+len(fraction) > totalDigits {
+			return fmt.Errorf("%q has more than %d digits or %d decimals", v, totalDigits, fractionDigits)
+		}
+		return nil
+	}
+}
+
+// pain001Schema is the part of the pain.001.001.03 schema the payout export uses, with the
+// element order, occurrences and simple type facets of the published XSD.
+var pain001Schema = func() schemaElement {
+	max35, max140 := maxText(35), maxText(140)
+	party := func(name string, min int) schemaElement {
+		return el(name, min, 1, leaf("Nm", 0, 1, max140))
+	}
+	account := func(name string, min int) schemaElement {
+		return el(name, min, 1,
+			choice("Id", 1, 1,
+				leaf("IBAN", 1, 1, pattern(`[A-Z]{2,2}[0-9]{2,2}[a-zA-Z0-9]{1,30}`)),
+				el("Othr", 1, 1, leaf("Id", 1, 1, maxText(34))),
+			),
+			leaf("Ccy", 0, 1, pattern(`[A-Z]{3,3}`)),
+		)
+	}
+	agent := func(name string, min int) schemaElement {
+		return el(name, min, 1, el("FinInstnId", 1, 1, leaf("BIC", 0, 1, pattern(`[A-Z]{6,6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3,3}){0,1}`))))
+	}
+	instructed := leaf("InstdAmt", 1, 1, decimal(18, 5))
+	instructed.attrs = map[string]func(string) error{"Ccy": pattern(`[A-Z]{3,3}`)}
+
+	return el("Document", 1, 1,
+		el("CstmrCdtTrfInitn", 1, 1,
+			el("GrpHdr", 1, 1,
+				leaf("MsgId", 1, 1, max35),
+				leaf("CreDtTm", 1, 1, layout("2006-01-02T15:04:05")),
+				leaf("NbOfTxs", 1, 1, pattern(`[0-9]{1,15}`)),
+				leaf("CtrlSum", 0, 1, decimal(18, 17)),
+				party("InitgPty", 1),
+			),
+			el("PmtInf", 1, -1,
+				leaf("PmtInfId", 1, 1, max35),
+				leaf("PmtMtd", 1, 1, enum("CHK", "TRF", "TRA")),
+				leaf("BtchBookg", 0, 1, enum("true", "false", "1", "0")),
+				leaf("NbOfTxs", 0, 1, pattern(`[0-9]{1,15}`)),
+				leaf("CtrlSum", 0, 1, decimal(18, 17)),
+				leaf("ReqdExctnDt", 1, 1, layout("2006-01-02")),
+				party("Dbtr", 1),
+				account("DbtrAcct", 1),
+				agent("DbtrAgt", 1),
+				leaf("ChrgBr", 0, 1, enum("DEBT", "CRED", "SHAR", "SLEV")),
+				el("CdtTrfTxInf", 1, -1,
+					el("PmtId", 1, 1, leaf("InstrId", 0, 1, max35), leaf("EndToEndId", 1, 1, max35)),
+					choice("Amt", 1, 1, instructed),
+					agent("CdtrAgt", 0),
+					party("Cdtr", 0),
+					account("CdtrAcct", 0),
+					el("RmtInf", 0, 1, leaf("Ustrd", 0, -1, max140)),
+				),
+			),
+		),
+	)
+}()
+
+// validateAgainstSchema checks an element and its descendants against the schema and returns the violations.
+func validateAgainstSchema(path string, node xmlNode, schema schemaElement) []string {
+	path += "/" + node.XMLName.Local
+	var violations []string
+	for name, check := range schema.attrs {
+		value, ok := node.attr(name)
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s: attribute %s is required", path, name))
+		} else if err := check(value); err != nil {
+			violations = append(violations, fmt.Sprintf("%s/@%s: %v", path, name, err))
+		}
+	}
+	if schema.value != nil {
+		if len(node.Children) > 0 {
+			return append(violations, fmt.Sprintf("%s: simple content expected", path))
+		}
+		if err := schema.value(node.Text); err != nil {
+			violations = append(violations, fmt.Sprintf("%s: %v", path, err))
+		}
+		return violations
+	}
+	if strings.TrimSpace(node.Text) != "" {
+		violations = append(violations, fmt.Sprintf("%s: unexpected text %q", path, node.Text))
+	}
+
+	if schema.choice {
+		if len(node.Children) != 1 {
+			return append(violations, fmt.Sprintf("%s: exactly one alternative expected, found %d elements", path, len(node.Children)))
+		}
+		for _, alternative := range schema.children {
+			if alternative.name == node.Children[0].XMLName.Local {
+				return append(violations, validateAgainstSchema(path, node.Children[0], alternative)...)
+			}
+		}
+		return append(violations, fmt.Sprintf("%s: unexpected element %s", path, node.Children[0].XMLName.Local))
+	}
+
+	i := 0
+	for _, child := range schema.children {
+		count := 0
+		for i < len(node.Children) && node.Children[i].XMLName.Local == child.name {
+			violations = append(violations, validateAgainstSchema(path, node.Children[i], child)...)
+			count++
+			i++
+		}
+		if count < child.min || (child.max >= 0 && count > child.max) {
+			violations = append(violations, fmt.Sprintf("%s/%s: occurs %d times", path, child.name, count))
+		}
+	}
+	if i < len(node.Children) {
+		violations = append(violations, fmt.Sprintf("%s: unexpected element %s", path, node.Children[i].XMLName.Local))
+	}
+	return violations
+}
+
+// testDebtor is a settlement account configuration with valid identifiers.
+var testDebtor = config.SettlementConfig{DebtorName: "Merchant Bank API", DebtorIBAN: "DE89370400440532013000", DebtorBIC: "DEUTDEFF"}
+
+// testPayouts returns payouts of two merchants in two currencies and the merchants' payout accounts.
+func testPayouts() ([]models.PayoutInstruction, map[string]models.BankAccount) {
+	payouts := []models.PayoutInstruction{
+		{ID: "po_1", BatchID: "stl_1", MerchantID: "1", Beneficiary: "Merchant A", Amount: 150000, Currency: "IDR", Reference: "Settlement 2026-10-18", ValueDate: "2026-10-19"},
+		{ID: "po_2", BatchID: "stl_2", MerchantID: "2", Beneficiary: "Merchant B", Amount: 0.1, Currency: "SGD", Reference: "Settlement 2026-10-18", ValueDate: "2026-10-19"},
+		{ID: "po_3", BatchID: "stl_3", MerchantID: "2", Beneficiary: "Merchant B", Amount: 0.2, Currency: "SGD", Reference: "Settlement 2026-10-18", ValueDate: "2026-10-19"},
+	}
+	accounts := map[string]models.BankAccount{
+		"1": {IBAN: "GB82WEST12345698765432", BIC: "NWBKGB2L"},
+		"2": {Number: "0123456789", BIC: "DBSSSGSG"},
+	}
+	return payouts, accounts
+}
+
+func TestPain001ConformsToSchema(t *testing.T) {
+	payouts, accounts := testPayouts()
+	out, err := buildPain001(testDebtor, "MSG-20261019-1", payouts, accounts, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc xmlNode
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.XMLName.Space != pain001Namespace {
+		t.Fatalf("namespace = %q, want %q", doc.XMLName.Space, pain001Namespace)
+	}
+	if violations := validateAgainstSchema("", doc, pain001Schema); len(violations) > 0 {
+		t.Fatalf("pain.001 does not conform to the schema:\n%s\n%s", strings.Join(violations, "\n"), out)
+	}
+
+	// The counts and control sums must add up, which the schema cannot express.
+	var parsed pain001Document
+	if err := xml.Unmarshal(out, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	header := parsed.Initiation.GroupHeader
+	if header.NumberOfTxs != "3" || header.ControlSum != "150000.3" {
+		t.Errorf("group header counts %s payments totalling %s", header.NumberOfTxs, header.ControlSum)
+	}
+	if len(parsed.Initiation.Payments) != 2 {
+		t.Fatalf("got %d payment information blocks, want one per currency", len(parsed.Initiation.Payments))
+	}
+	for _, block := range parsed.Initiation.Payments {
+		sum := 0.0
+		for _, transfer := range block.Transfers {
+			amount, _ := strconv.ParseFloat(transfer.Amount.Instructed.Value, 64)
+			sum += amount
+		}
+		controlSum, _ := strconv.ParseFloat(block.ControlSum, 64)
+		if block.NumberOfTxs != strconv.Itoa(len(block.Transfers)) || math.Abs(controlSum-sum) > 1e-9 {
+			t.Errorf("block %s counts %s payments totalling %s, has %d totalling %v", block.ID, block.NumberOfTxs, block.ControlSum, len(block.Transfers), sum)
+		}
+	}
+}
+
+func TestPain001RejectsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(debtor *config.SettlementConfig, payouts []models.PayoutInstruction, accounts map[string]models.BankAccount)
+		field  string
+	}{
+		{"bad IBAN check digits", func(_ *config.SettlementConfig, _ []models.PayoutInstruction, accounts map[string]models.BankAccount) {
+			accounts["1"] = models.BankAccount{IBAN: "GB83WEST12345698765432", BIC: "NWBKGB2L"}
+		}, "PmtInf[1]/CdtTrfTxInf[1]/CdtrAcct/Id/IBAN"},
+		{"bad debtor BIC", func(debtor *config.SettlementConfig, _ []models.PayoutInstruction, _ map[string]models.BankAccount) {
+			debtor.DebtorBIC = "DEUT"
+		}, "PmtInf[1]/DbtrAgt/FinInstnId/BIC"},
+		{"long end to end ID", func(_ *config.SettlementConfig, payouts []models.PayoutInstruction, _ map[string]models.BankAccount) {
+			payouts[0].ID = strings.Repeat("x", 36)
+		}, "PmtInf[1]/CdtTrfTxInf[1]/PmtId/EndToEndId"},
+		{"missing beneficiary", func(_ *config.SettlementConfig, payouts []models.PayoutInstruction, _ map[string]models.BankAccount) {
+			payouts[1].Beneficiary = ""
+		}, "PmtInf[2]/CdtTrfTxInf[1]/Cdtr/Nm"},
+		{"missing debtor account", func(debtor *config.SettlementConfig, _ []models.PayoutInstruction, _ map[string]models.BankAccount) {
+			debtor.DebtorIBAN = ""
+		}, "PmtInf[1]/DbtrAcct/Id/Othr/Id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			debtor := testDebtor
+			payouts, accounts := testPayouts()
+			tt.change(&debtor, payouts, accounts)
+			_, err := buildPain001(debtor, "MSG-20261019-1", payouts, accounts, time.Now())
+			assertFieldError(t, err, KindValidation, tt.field)
+		})
+	}
+}
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		iban  string
+		valid bool
+	}{
+		{"DE89370400440532013000", true},
+		{"GB82WEST12345698765432", true},
+		{"NL91ABNA0417164300", true},
+		{"gb82west12345698765432", false},
+		{"DE89370400440532013001", false},
+		{"GB28WEST12345698765432", false},
+		{"DE8937040044053201300", false},
+		{"DE89 3704 0044 0532 0130 00", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validIBAN(tt.iban); got != tt.valid {
+			t.Errorf("validIBAN(%q) = %v, want %v", tt.iban, got, tt.valid)
+		}
+	}
+}
+
+// parseTestStatement parses a camt.053 file from testdata in the Asia/Jakarta time zone.
+func parseTestStatement(t *testing.T, name string) ([]statementEntry, error) {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	location, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	return parseCamt053(file, location)
+}
+
+func TestParseCamt053(t *testing.T) {
+	tests := []struct {
+		file    string
+		entries []statementEntry
+	}{
+		{"camt053_v02.xml", []statementEntry{
+			{number: 1, credit: true, reference: "tx-1", amount: 150000, currency: "IDR", date: "2026-10-18"},
+			// Booked at 23:30 UTC, which is the next business day in Jakarta.
+			{number: 2, credit: true, reference: "tx-2", amount: 100000, currency: "IDR", date: "2026-10-19"},
+			{number: 2, credit: true, reference: "BANKREF-2-2", amount: 200000, currency: "IDR", date: "2026-10-19"},
+		}},
+		{"camt053_v08.xml", []statementEntry{
+			{number: 1, credit: false, reference: "po_1", amount: 12.5, currency: "SGD", date: "2026-10-18"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			entries, err := parseTestStatement(t, tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.entries) {
+				t.Fatalf("got %d entries %+v, want %d", len(entries), entries, len(tt.entries))
+			}
+			for i := range entries {
+				if entries[i] != tt.entries[i] {
+					t.Errorf("entry %d = %+v, want %+v", i+1, entries[i], tt.entries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCamt053RejectsInvalidStatements(t *testing.T) {
+	tests := []struct {
+		file   string
+		kind   ErrorKind
+		fields []string
+	}{
+		{"camt053_invalid_amount.xml", KindValidation, []string{"Stmt[1]/Ntry[1]/NtryDtls/TxDtls/Amt"}},
+		{"camt053_invalid_entry.xml", KindValidation, []string{"Stmt[1]/Ntry[1]/Amt", "Stmt[1]/Ntry[1]/Amt/@Ccy", "Stmt[1]/Ntry[1]/CdtDbtInd", "Stmt[1]/Ntry[1]/BookgDt"}},
+		{"camt053_batch_without_amounts.xml", KindValidation, []string{"Stmt[1]/Ntry[1]/NtryDtls/TxDtls/Amt"}},
+		{"camt053_pending_only.xml", KindValidation, []string{"Ntry"}},
+		{"camt053_wrong_namespace.xml", KindValidation, []string{"Document"}},
+		{"camt053_truncated.xml", KindMalformed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, err := parseTestStatement(t, tt.file)
+			assertFieldError(t, err, tt.kind, tt.fields...)
+		})
+	}
+}
+
+// assertFieldError fails the test unless err is a domain error of the kind naming every field.
+func assertFieldError(t *testing.T, err error, kind ErrorKind, fields ...string) {
+	t.Helper()
+	domainErr, ok := AsDomainError(err)
+	if !ok || domainErr.Kind != kind {
+		t.Fatalf("error = %v, want a %s error", err, kind)
+	}
+	for _, field := range fields {
+		found := false
+		for _, f := range domainErr.Fields {
+			found = found || f.Field == field
+		}
+		if !found {
+			t.Errorf("error fields %+v do not name %s", domainErr.Fields, field)
+		}
+	}
+}
@@ -31,7 +31,9 @@ type jwtService struct {
 func (js *jwtService) GenerateToken(payload models.Customer) (dto.LoginResponse, error) {
 	fmt.Println("Generate token :", payload)
 	claims := dto.JwtCustomClaims{
-		UserId: payload.ID,
+		UserId:     payload.ID,
+		Role:       payload.GetRole(),
+		MerchantId: payload.MerchantID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    js.conf.Issuer,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// limitsFile stores the transaction limits.
+const limitsFile = "database/limits.json"
+
+// defaultLimitID names the default limits of a tier in the limit endpoints.
+const defaultLimitID = "default"
+
+// LimitService defines the interface for per-transaction, daily and monthly payment limits.
+type LimitService interface {
+	// GetLimits returns every configured limit.
+	GetLimits() (models.LimitConfig, error)
+	// GetUsage returns the limits that apply to a scope and how much of them is already used.
+	// The ID is ignored for the global scope.
+	GetUsage(scope, id string) (dto.LimitUsage, error)
+	// SetLimits replaces the global limits, a tier's default limits (ID "default") or the override of one customer or merchant.
+	SetLimits(caller dto.Caller, scope, id string, limits models.Limits) (models.LimitConfig, error)
+	// DeleteOverride removes the override of one customer or merchant, so the tier default applies again.
+	DeleteOverride(caller dto.Caller, scope, id string) (models.LimitConfig, error)
+	// CheckPayment checks a new payment against every limit given the stored payments.
+	CheckPayment(payments []models.Payment, payment models.Payment) error
+}
+
+// limitService is a concrete implementation of the LimitService interface.
+// Limits are expressed in the reporting currency, and payment amounts are converted into it with
+// the RateProvider. The mutex serialises updates of the limits file.
+type limitService struct {
+	rates    RateProvider
+	currency string
+	mu       sync.Mutex
+}
+
+// GetLimits reads the limits file.
+func (s *limitService) GetLimits() (models.LimitConfig, error) {
+	var config models.LimitConfig
+	if err := util.ReadJSONFile(limitsFile, &config); err != nil {
+		return config, fmt.Errorf("failed to read limits: %v", err)
+	}
+	return config, nil
+}
+
+// GetUsage returns the effective limits of the scope with today's and this month's volume.
+func (s *limitService) GetUsage(scope, id string) (dto.LimitUsage, error) {
+	config, err := s.GetLimits()
+	if err != nil {
+		return dto.LimitUsage{}, err
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return dto.LimitUsage{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+
+	usage := dto.LimitUsage{Scope: scope, ID: id, Currency: s.currency}
+	var match func(models.Payment) bool
+	switch scope {
+	case models.LimitScopeGlobal:
+		usage.ID = ""
+		usage.Limits = config.Global
+		match = func(models.Payment) bool { return true }
+	case models.LimitScopeCustomer:
+		_, usage.Override = config.Customer.Overrides[id]
+		usage.Limits = config.Customer.For(id)
+		match = func(p models.Payment) bool { return p.CustomerID == id }
+	case models.LimitScopeMerchant:
+		_, usage.Override = config.Merchant.Overrides[id]
+		usage.Limits = config.Merchant.For(id)
+		match = func(p models.Payment) bool { return p.MerchantID == id }
+	default:
+		return dto.LimitUsage{}, fmt.Errorf("unknown limit scope %q", scope)
+	}
+	usage.DailyUsed, usage.MonthlyUsed, err = limitUsage(payments, match, newReportingConverter(s.rates, s.currency), time.Now())
+	if err != nil {
+		return dto.LimitUsage{}, err
+	}
+	usage.DailyUsed = roundToCurrency(usage.DailyUsed, s.currency)
+	usage.MonthlyUsed = roundToCurrency(usage.MonthlyUsed, s.currency)
+	return usage, nil
+}
+
+// SetLimits validates and stores the limits of a scope.
+func (s *limitService) SetLimits(caller dto.Caller, scope, id string, limits models.Limits) (models.LimitConfig, error) {
+	if err := validateLimits(limits); err != nil {
+		return models.LimitConfig{}, err
+	}
+	return s.update(caller, func(config *models.LimitConfig) error {
+		var tier *models.LimitTier
+		switch scope {
+		case models.LimitScopeGlobal:
+			config.Global = limits
+			return nil
+		case models.LimitScopeCustomer:
+			tier = &config.Customer
+		case models.LimitScopeMerchant:
+			tier = &config.Merchant
+		default:
+			return fmt.Errorf("unknown limit scope %q", scope)
+		}
+		if id == defaultLimitID {
+			tier.Default = limits
+			return nil
+		}
+		if tier.Overrides == nil {
+			tier.Overrides = map[string]models.Limits{}
+		}
+		tier.Overrides[id] = limits
+		return nil
+	})
+}
+
+// DeleteOverride removes a customer or merchant override.
+func (s *limitService) DeleteOverride(caller dto.Caller, scope, id string) (models.LimitConfig, error) {
+	return s.update(caller, func(config *models.LimitConfig) error {
+		var tier *models.LimitTier
+		switch scope {
+		case models.LimitScopeCustomer:
+			tier = &config.Customer
+		case models.LimitScopeMerchant:
+			tier = &config.Merchant
+		default:
+			return fmt.Errorf("unknown limit scope %q", scope)
+		}
+		if _, ok := tier.Overrides[id]; !ok {
+			return NewNotFoundError(CodeLimitNotFound, "no limit override for "+scope+" "+id)
+		}
+		delete(tier.Overrides, id)
+		return nil
+	})
+}
+
+// CheckPayment checks the payment against the global, customer and merchant limits in turn.
+// Payments that succeeded or are held for review count towards the daily and monthly limits.
+// Every amount is compared in the reporting currency.
+func (s *limitService) CheckPayment(payments []models.Payment, payment models.Payment) error {
+	config, err := s.GetLimits()
+	if err != nil {
+		return err
+	}
+	converter := newReportingConverter(s.rates, s.currency)
+	amount, err := converter.paymentAmount(payment)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	levels := []struct {
+		scope  string
+		limits models.Limits
+		match  func(models.Payment) bool
+	}{
+		{models.LimitScopeGlobal, config.Global, func(models.Payment) bool { return true }},
+		{models.LimitScopeCustomer, config.Customer.For(payment.CustomerID), func(p models.Payment) bool { return p.CustomerID == payment.CustomerID }},
+		{models.LimitScopeMerchant, config.Merchant.For(payment.MerchantID), func(p models.Payment) bool { return p.MerchantID == payment.MerchantID }},
+	}
+	for _, level := range levels {
+		limits := level.limits
+		if limits.PerTransaction > 0 && amount > limits.PerTransaction {
+			return s.limitExceededError(level.scope, "per_transaction", limits.PerTransaction, 0, amount)
+		}
+		if limits.Daily == 0 && limits.Monthly == 0 {
+			continue
+		}
+		daily, monthly, err := limitUsage(payments, level.match, converter, now)
+		if err != nil {
+			return err
+		}
+		if limits.Daily > 0 && daily+amount > limits.Daily {
+			return s.limitExceededError(level.scope, "daily", limits.Daily, daily, amount)
+		}
+		if limits.Monthly > 0 && monthly+amount > limits.Monthly {
+			return s.limitExceededError(level.scope, "monthly", limits.Monthly, monthly, amount)
+		}
+	}
+	return nil
+}
+
+// NewLimitService creates a new instance of limitService whose limits are in the reporting
+// currency, converting payment amounts with the RateProvider.
+func NewLimitService(rates RateProvider, reportingCurrency string) LimitService {
+	return &limitService{rates: rates, currency: reportingCurrency}
+}
+
+// update applies a change to the stored limits and records who made it.
+func (s *limitService) update(caller dto.Caller, change func(config *models.LimitConfig) error) (models.LimitConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, err := s.GetLimits()
+	if err != nil {
+		return models.LimitConfig{}, err
+	}
+	if err := change(&config); err != nil {
+		return models.LimitConfig{}, err
+	}
+	config.UpdatedBy = caller.UserID
+	config.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := util.WriteJSONFile(limitsFile, config); err != nil {
+		return models.LimitConfig{}, fmt.Errorf("failed to save limits: %v", err)
+	}
+	return config, nil
+}
+
+// validateLimits checks that limits over longer periods are not below those over shorter ones.
+func validateLimits(limits models.Limits) error {
+	var fields []util.FieldError
+	if limits.Daily > 0 && limits.PerTransaction > limits.Daily {
+		fields = append(fields, util.FieldError{Field: "daily", Rule: "gtefield", Message: "must not be lower than per_transaction"})
+	}
+	if limits.Monthly > 0 && (limits.Daily > limits.Monthly || limits.PerTransaction > limits.Monthly) {
+		fields = append(fields, util.FieldError{Field: "monthly", Rule: "gtefield", Message: "must not be lower than daily or per_transaction"})
+	}
+	if len(fields) > 0 {
+		return NewValidationError("inconsistent limits", fields)
+	}
+	return nil
+}
+
+// limitUsage sums the amounts of matching payments made today and this month in the reporting currency.
+// Only succeeded payments and payments held for review use up a limit.
+func limitUsage(payments []models.Payment, match func(models.Payment) bool, converter *reportingConverter, now time.Time) (daily, monthly float64, err error) {
+	year, month, day := now.Date()
+	for _, payment := range payments {
+		if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusPendingReview {
+			continue
+		}
+		if !match(payment) {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, payment.Timestamp)
+		if err != nil {
+			continue
+		}
+		y, m, d := timestamp.In(now.Location()).Date()
+		if y != year || m != month {
+			continue
+		}
+		amount, err := converter.paymentAmount(payment)
+		if err != nil {
+			return 0, 0, err
+		}
+		monthly += amount
+		if d == day {
+			daily += amount
+		}
+	}
+	return daily, monthly, nil
+}
+
+// limitExceededError describes which limit a payment would exceed, with amounts in the reporting currency.
+func (s *limitService) limitExceededError(scope, period string, limit, used, amount float64) error {
+	message := fmt.Sprintf("payment of %.2f %s exceeds the %s %s limit of %.2f", amount, s.currency, scope, period, limit)
+	if period != "per_transaction" {
+		message = fmt.Sprintf("%s (%.2f already used, %.2f remaining)", message, used, max(limit-used, 0))
+	}
+	return NewLimitExceededError(message, []util.FieldError{{Field: "amount", Rule: scope + "_" + period + "_limit", Message: message}})
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// merchantsFile stores every merchant record.
+const merchantsFile = "database/merchant.json"
+
+// MerchantService defines the interface for merchant-related operations.
+type MerchantService interface {
+	// GetAllMerchant retrieves all merchants from the database.
+	GetAllMerchant() ([]models.Merchant, error)
+	// GetMerchant retrieves a merchant by ID, or a not found error.
+	GetMerchant(id string) (models.Merchant, error)
+	// PostMerchant screens and adds a new merchant.
+	PostMerchant(payload dto.MerchantPayload) (models.Merchant, error)
+	// SetFeePlan puts a merchant on a fee plan and, if mcc is not empty, sets its category code.
+	SetFeePlan(id, planID, mcc string) (models.Merchant, error)
+	// SetPayoutAccount validates and sets the bank account the merchant's payouts are credited to.
+	SetPayoutAccount(id string, payload dto.PayoutAccountPayload) (models.Merchant, error)
+}
+
+// merchantService is a concrete implementation of the MerchantService interface.
+// New merchants are screened against the sanctions list before they are created; the mutex
+// serialises their creation.
+type merchantService struct {
+	screening ScreeningService
+	mu        sync.Mutex
+}
+
+// GetAllMerchant retrieves all merchants from the "merchant.json" file.
+func (s *merchantService) GetAllMerchant() ([]models.Merchant, error) {
+	merchants := []models.Merchant{}
+	if err := util.ReadJSONFile(merchantsFile, &merchants); err != nil {
+		return nil, err
+	}
+	return merchants, nil
+}
+
+// GetMerchant retrieves a merchant by ID from the "merchant.json" file.
+func (s *merchantService) GetMerchant(id string) (models.Merchant, error) {
+	merchants, err := s.GetAllMerchant()
+	if err != nil {
+		return models.Merchant{}, err
+	}
+	for _, merchant := range merchants {
+		if merchant.ID == id {
+			return merchant, nil
+		}
+	}
+	return models.Merchant{}, NewNotFoundError(CodeMerchantNotFound, "merchant not found")
+}
+
+// PostMerchant adds a new merchant to the "merchant.json" file. A merchant whose name matches
+// the sanctions list is rejected, and possible matches are recorded for review.
+func (s *merchantService) PostMerchant(payload dto.MerchantPayload) (models.Merchant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merchants, err := s.GetAllMerchant()
+	if err != nil {
+		return models.Merchant{}, err
+	}
+
+	subject := models.ScreeningSubject{Type: models.PartyMerchant, Name: payload.Name}
+	screening, err := s.screening.Screen(subject)
+	if err != nil {
+		return models.Merchant{}, err
+	}
+	if screening.Decision == models.ScreeningBlock {
+		if err := s.screening.RecordHits(subject, models.ScreeningContextOnboarding, "", screening); err != nil {
+			return models.Merchant{}, err
+		}
+		return models.Merchant{}, NewForbiddenError(CodeSanctionsMatch, "merchant cannot be onboarded, the application is held for compliance review")
+	}
+
+	merchant := models.Merchant{ID: nextMerchantID(merchants), Name: payload.Name, Currency: payload.Currency}
+	if err := util.WriteJSONFile(merchantsFile, append(merchants, merchant)); err != nil {
+		return models.Merchant{}, fmt.Errorf("failed to save merchants: %v", err)
+	}
+
+	if screening.Decision == models.ScreeningReview {
+		subject.ID = merchant.ID
+		if err := s.screening.RecordHits(subject, models.ScreeningContextOnboarding, "", screening); err != nil {
+			return models.Merchant{}, err
+		}
+	}
+	return merchant, nil
+}
+
+// SetFeePlan updates the merchant's fee plan and category code in the "merchant.json" file.
+func (s *merchantService) SetFeePlan(id, planID, mcc string) (models.Merchant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merchants, err := s.GetAllMerchant()
+	if err != nil {
+		return models.Merchant{}, err
+	}
+	for i := range merchants {
+		if merchants[i].ID != id {
+			continue
+		}
+		merchants[i].FeePlanID = planID
+		if mcc != "" {
+			merchants[i].MCC = mcc
+		}
+		if err := util.WriteJSONFile(merchantsFile, merchants); err != nil {
+			return models.Merchant{}, fmt.Errorf("failed to save merchants: %v", err)
+		}
+		return merchants[i], nil
+	}
+	return models.Merchant{}, NewNotFoundError(CodeMerchantNotFound, "merchant not found")
+}
+
+// SetPayoutAccount updates the merchant's payout account in the "merchant.json" file.
+func (s *merchantService) SetPayoutAccount(id string, payload dto.PayoutAccountPayload) (models.Merchant, error) {
+	account := models.BankAccount{IBAN: strings.ToUpper(strings.ReplaceAll(payload.IBAN, " ", "")), Number: payload.Number, BIC: strings.ToUpper(payload.BIC)}
+	if err := validateBankAccount(account); err != nil {
+		return models.Merchant{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merchants, err := s.GetAllMerchant()
+	if err != nil {
+		return models.Merchant{}, err
+	}
+	for i := range merchants {
+		if merchants[i].ID != id {
+			continue
+		}
+		merchants[i].PayoutAccount = &account
+		if err := util.WriteJSONFile(merchantsFile, merchants); err != nil {
+			return models.Merchant{}, fmt.Errorf("failed to save merchants: %v", err)
+		}
+		return merchants[i], nil
+	}
+	return models.Merchant{}, NewNotFoundError(CodeMerchantNotFound, "merchant not found")
+}
+
+// NewMerchantService creates a new instance of merchantService that screens new merchants with the ScreeningService.
+func NewMerchantService(screening ScreeningService) MerchantService {
+	return &merchantService{screening: screening}
+}
+
+// nextMerchantID returns the ID after the highest numeric merchant ID.
+func nextMerchantID(merchants []models.Merchant) string {
+	highest := 0
+	for _, merchant := range merchants {
+		if id, err := strconv.Atoi(merchant.ID); err == nil && id > highest {
+			highest = id
+		}
+	}
+	return strconv.Itoa(highest + 1)
+}
+
+// canManageMerchant checks that the caller is the merchant itself or an admin.
+func canManageMerchant(caller dto.Caller, merchantID string) error {
+	if caller.Role == models.RoleAdmin || (caller.Role == models.RoleMerchant && caller.MerchantID == merchantID) {
+		return nil
+	}
+	return NewForbiddenError(CodeForbidden, "only the merchant and admins can manage this merchant")
+}
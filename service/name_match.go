@@ -0,0 +1,113 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeName prepares a name for matching: sanctions list names written as "LAST, First" are
+// turned around, accents are dropped, everything is lower-cased and punctuation becomes spaces.
+// It returns the name's tokens.
+func normalizeName(name string) []string {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		name = first + " " + last
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks left over from decomposing accented letters.
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// nameSimilarity scores how alike two tokenised names are, from 0 to 1. Every token of either name
+// is paired with its most similar token in the other name and the Jaro-Winkler similarities of all
+// pairs are averaged, so word order does not matter while missing or extra words lower the score.
+func nameSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, token := range a {
+		total += bestTokenSimilarity(token, b)
+	}
+	for _, token := range b {
+		total += bestTokenSimilarity(token, a)
+	}
+	return total / float64(len(a)+len(b))
+}
+
+// bestTokenSimilarity returns the highest similarity between token and any of the candidates.
+func bestTokenSimilarity(token string, candidates []string) float64 {
+	best := 0.0
+	for _, candidate := range candidates {
+		if s := jaroWinkler(token, candidate); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings, from 0 to 1.
+func jaroWinkler(a, b string) float64 {
+	s1, s2 := []rune(a), []rune(b)
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	window := max(len(s1), len(s2))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matched1 := make([]bool, len(s1))
+	matched2 := make([]bool, len(s2))
+	matches := 0
+	for i := range s1 {
+		lo, hi := max(0, i-window), min(len(s2), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matched2[j] && s1[i] == s2[j] {
+				matched1[i], matched2[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range s1 {
+		if !matched1[i] {
+			continue
+		}
+		for !matched2[j] {
+			j++
+		}
+		if s1[i] != s2[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(s1), len(s2)) && s1[prefix] == s2[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/util"
+)
+
+// outboxFile stores the payment events waiting to be published.
+const outboxFile = "database/outbox.json"
+
+// EventSink receives published outbox events.
+// Delivery is at-least-once, so Publish must tolerate receiving the same event more than once.
+type EventSink interface {
+	// Name identifies the sink in the delivery bookkeeping of each event. It must be stable across restarts.
+	Name() string
+	// Publish delivers a single event. Returning an error makes the dispatcher retry it later.
+	Publish(event models.OutboxEvent) error
+}
+
+// PaymentChange applies a change to the stored payments and returns the updated list and the changed payment.
+type PaymentChange func(payments []models.Payment) ([]models.Payment, models.Payment, error)
+
+// PaymentsChange applies a change to several stored payments and returns the updated list and the changed payments.
+type PaymentsChange func(payments []models.Payment) ([]models.Payment, []models.Payment, error)
+
+// OutboxService defines the interface of the transactional payment outbox.
+type OutboxService interface {
+	// RegisterSink adds a sink to publish events to. Sinks must be registered before Start.
+	RegisterSink(sink EventSink)
+	// CommitPaymentChange applies a payment change and records its event as a single unit.
+	// The event is only ever published if the payment change was stored.
+	CommitPaymentChange(event models.OutboxEvent, change PaymentChange) (models.Payment, error)
+	// CommitPaymentChanges applies a change to several payments and records an event for each changed
+	// payment as a single unit: either every payment and event is stored or none is.
+	CommitPaymentChanges(event models.OutboxEvent, change PaymentsChange) ([]models.Payment, error)
+	// Dispatch publishes every pending event to the sinks that have not received it yet.
+	Dispatch() error
+	// Start runs Dispatch in the background, right away and then every dispatch interval.
+	Start()
+	// Stop ends the background dispatcher.
+	Stop()
+}
+
+// outboxService is a concrete implementation of the OutboxService interface.
+// mu guards the outbox and payment files; dispatchMu allows a single dispatch pass at a time.
+type outboxService struct {
+	conf       config.OutboxConfig
+	sinks      []EventSink
+	mu         sync.Mutex
+	dispatchMu sync.Mutex
+	wake       chan struct{}
+	stop       chan struct{}
+}
+
+// RegisterSink adds a sink to publish events to.
+func (s *outboxService) RegisterSink(sink EventSink) {
+	s.sinks = append(s.sinks, sink)
+}
+
+// CommitPaymentChange applies the change to a single payment and writes its event to the outbox.
+func (s *outboxService) CommitPaymentChange(event models.OutboxEvent, change PaymentChange) (models.Payment, error) {
+	changed, err := s.CommitPaymentChanges(event, func(payments []models.Payment) ([]models.Payment, []models.Payment, error) {
+		payments, payment, err := change(payments)
+		if err != nil {
+			return nil, nil, err
+		}
+		return payments, []models.Payment{payment}, nil
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return changed[0], nil
+}
+
+// CommitPaymentChanges applies the change to the payments and writes an event per changed payment to the outbox.
+// The events are written first; if the payments cannot be saved the events are removed again, and
+// events left behind by a crash between the two writes are discarded by the dispatcher because the
+// payments never reached the events' versions.
+func (s *outboxService) CommitPaymentChanges(event models.OutboxEvent, change PaymentsChange) ([]models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payments, err := loadPayments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payments: %v", err)
+	}
+	payments, changed, err := change(payments)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := readOutboxEvents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %v", err)
+	}
+	previous := events
+	for _, payment := range changed {
+		e, err := s.newEvent(events, event, payment)
+		if err != nil {
+			return nil, err
+		}
+		events = appendEvent(events, e)
+	}
+	if err := util.WriteJSONFile(outboxFile, events); err != nil {
+		return nil, fmt.Errorf("failed to save outbox: %v", err)
+	}
+
+	if err := savePayments(payments); err != nil {
+		if rerr := util.WriteJSONFile(outboxFile, previous); rerr != nil {
+			log.Printf("Error removing outbox events: %v", rerr)
+		}
+		return nil, fmt.Errorf("failed to save payment: %v", err)
+	}
+
+	s.notify()
+	return changed, nil
+}
+
+// Dispatch publishes pending events to the registered sinks.
+// Events of the same payment are delivered in order: a later event waits until the earlier one
+// has reached every sink.
+func (s *outboxService) Dispatch() error {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	pending, err := s.claimPending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	for i := range pending {
+		s.publish(&pending[i])
+	}
+
+	return s.recordResults(pending)
+}
+
+// Start runs the dispatcher in the background.
+func (s *outboxService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.conf.DispatchInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.Dispatch(); err != nil {
+				log.Printf("Error dispatching outbox events: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Stop ends the background dispatcher.
+func (s *outboxService) Stop() {
+	close(s.stop)
+}
+
+// NewOutboxService creates a new instance of outboxService.
+func NewOutboxService(conf config.OutboxConfig) OutboxService {
+	return &outboxService{
+		conf: conf,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// notify wakes the dispatcher without blocking.
+func (s *outboxService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// newEvent completes an event with its ID, key, payment snapshot and bookkeeping fields.
+func (s *outboxService) newEvent(events []models.OutboxEvent, event models.OutboxEvent, payment models.Payment) (models.OutboxEvent, error) {
+	payload, err := json.Marshal(payment)
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("failed to encode outbox payload: %v", err)
+	}
+
+	var lastID uint64
+	for _, e := range events {
+		if e.ID > lastID {
+			lastID = e.ID
+		}
+	}
+
+	event.ID = lastID + 1
+	event.AggregateID = payment.TransactionID
+	event.Version = payment.Version
+	event.Key = fmt.Sprintf("%s:%d", payment.TransactionID, payment.Version)
+	event.Payload = payload
+	event.Status = models.OutboxStatusPending
+	event.CreatedAt = time.Now().Format(time.RFC3339Nano)
+	return event, nil
+}
+
+// appendEvent adds an event to the outbox. A pending event with the same key can only be left over
+// from a change that was never stored, so it is replaced.
+func appendEvent(events []models.OutboxEvent, event models.OutboxEvent) []models.OutboxEvent {
+	result := make([]models.OutboxEvent, 0, len(events)+1)
+	for _, e := range events {
+		if e.Key == event.Key && e.Status == models.OutboxStatusPending {
+			continue
+		}
+		result = append(result, e)
+	}
+	return append(result, event)
+}
+
+// claimPending discards events whose payment change was never stored and returns the events to deliver.
+func (s *outboxService) claimPending() ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, err := readOutboxEvents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %v", err)
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payments: %v", err)
+	}
+
+	versions := make(map[string]int, len(payments))
+	for _, payment := range payments {
+		versions[payment.TransactionID] = payment.Version
+	}
+
+	discarded := false
+	blocked := map[string]bool{}
+	var pending []models.OutboxEvent
+	for i, event := range events {
+		if event.Status != models.OutboxStatusPending {
+			continue
+		}
+		if versions[event.AggregateID] < event.Version {
+			events[i].Status = models.OutboxStatusDiscarded
+			events[i].LastError = "payment change was not stored"
+			discarded = true
+			continue
+		}
+		if blocked[event.AggregateID] {
+			continue
+		}
+		blocked[event.AggregateID] = true
+		pending = append(pending, event)
+	}
+
+	if discarded {
+		if err := util.WriteJSONFile(outboxFile, events); err != nil {
+			return nil, fmt.Errorf("failed to save outbox: %v", err)
+		}
+	}
+	return pending, nil
+}
+
+// publish delivers an event to every sink that has not received it yet and updates its bookkeeping.
+func (s *outboxService) publish(event *models.OutboxEvent) {
+	delivered := map[string]bool{}
+	for _, name := range event.DeliveredTo {
+		delivered[name] = true
+	}
+
+	event.Attempts++
+	event.LastError = ""
+	for _, sink := range s.sinks {
+		if delivered[sink.Name()] {
+			continue
+		}
+		if err := sink.Publish(*event); err != nil {
+			event.LastError = fmt.Sprintf("%s: %v", sink.Name(), err)
+			continue
+		}
+		event.DeliveredTo = append(event.DeliveredTo, sink.Name())
+	}
+
+	if event.LastError == "" {
+		event.Status = models.OutboxStatusDelivered
+		event.DeliveredAt = time.Now().Format(time.RFC3339Nano)
+	}
+}
+
+// recordResults stores the delivery bookkeeping of dispatched events and compacts the outbox.
+func (s *outboxService) recordResults(dispatched []models.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, err := readOutboxEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load outbox: %v", err)
+	}
+
+	byID := make(map[uint64]models.OutboxEvent, len(dispatched))
+	for _, event := range dispatched {
+		byID[event.ID] = event
+	}
+	for i, event := range events {
+		if updated, ok := byID[event.ID]; ok {
+			events[i] = updated
+		}
+	}
+
+	return util.WriteJSONFile(outboxFile, compactEvents(events, time.Now().Add(-s.conf.Retention)))
+}
+
+// compactEvents drops delivered and discarded events that finished before the cutoff. The event with
+// the highest ID is always kept so that new events keep getting higher IDs than the removed ones.
+func compactEvents(events []models.OutboxEvent, cutoff time.Time) []models.OutboxEvent {
+	result := make([]models.OutboxEvent, 0, len(events))
+	for i, event := range events {
+		finished := event.DeliveredAt
+		if event.Status == models.OutboxStatusDiscarded {
+			finished = event.CreatedAt
+		}
+		at, err := time.Parse(time.RFC3339Nano, finished)
+		if event.Status != models.OutboxStatusPending && i < len(events)-1 && err == nil && at.Before(cutoff) {
+			continue
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+// readOutboxEvents reads the outbox ordered by event ID.
+func readOutboxEvents() ([]models.OutboxEvent, error) {
+	events := []models.OutboxEvent{}
+	if err := util.ReadJSONFile(outboxFile, &events); err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
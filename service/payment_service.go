@@ -1,145 +1,518 @@
 package service
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"merchant-bank-api/models"
-	"os"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+	"sort"
 	"time"
 )
 
 // PaymentService defines the interface for payment operations.
-// It includes a method to process payment requests.
+// It includes methods to process payment requests and to search stored payments.
 type PaymentService interface {
 	PostPayment(models.PaymentRequest) (models.Payment, error)
+	// GetPayments returns a page of payments visible to the caller that match the filter.
+	GetPayments(caller dto.Caller, filter dto.PaymentFilter) (dto.PaymentPage, error)
+	// GetPayment returns a single payment visible to the caller by its transaction ID.
+	GetPayment(caller dto.Caller, transactionID string) (models.Payment, error)
+	// PostSplitPayment pays several merchants in one transaction whose legs all succeed or all fail.
+	PostSplitPayment(request models.SplitPaymentRequest) (dto.SplitPayment, error)
+	// RefundPayment fully refunds a succeeded payment on behalf of its merchant or an admin.
+	RefundPayment(caller dto.Caller, transactionID string, meta models.RequestMeta) (models.Payment, error)
 }
 
+// Payment page sizes used when the caller does not ask for a specific limit.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 // paymentService is a concrete implementation of PaymentService.
-// It handles payment processing and interacts with customer and history services.
+// It handles payment processing and records payment changes through the outbox.
 type paymentService struct {
-	cs CustomerService
-	hs HistoryService
+	cs        CustomerService
+	ms        MerchantService
+	outbox    OutboxService
+	verifier  TransactionVerifier
+	risk      RiskService
+	limits    LimitService
+	screening ScreeningService
+	rates     RateProvider
+	fees      FeeService
+}
+
+// paymentSettlement is what a payment credits to the merchant in the merchant's currency.
+type paymentSettlement struct {
+	amount   float64
+	currency string
+	fx       *models.FXConversion
 }
 
 // PostPayment processes a payment request.
-// It retrieves the logged-in customer, verifies the transaction, creates a payment record,
-// and logs the payment history. Returns the created payment or an error.
+// It retrieves the customer, who must be logged in unless the payment is preauthorized, checks the
+// payment with checkPayment and creates a payment record together with its payment.created event.
+// Returns the created payment or an error.
 func (s *paymentService) PostPayment(paymentRequest models.PaymentRequest) (models.Payment, error) {
-	customer, err := s.getLoggedInCustomer(paymentRequest.CustomerID)
+	customer, err := s.getPayingCustomer(paymentRequest)
 	if err != nil {
-		fmt.Println("getLoggedInCustomer error: ", err)
 		return models.Payment{}, err
 	}
 
-	if err := s.verifyTransaction(paymentRequest.TransactionID); err != nil {
-		fmt.Println("verifyTransaction error: ", err)
-		return models.Payment{}, err
+	if paymentRequest.Currency == "" {
+		paymentRequest.Currency = customer.GetCurrency()
 	}
-
-	payment, err := s.createPaymentRecord(customer, paymentRequest)
+	payment, err := s.checkPayment(customer, paymentRequest, nil)
 	if err != nil {
-		fmt.Println("createPaymentRecord error: ", err)
 		return models.Payment{}, err
 	}
 
-	if err := s.hs.LogHistory(customer.ID, "payment"); err != nil {
-		fmt.Println("LogHistory error: ", err)
+	payment, err = s.createPaymentRecord(payment, paymentRequest.Meta)
+	if err != nil {
 		return models.Payment{}, err
 	}
 
 	return payment, nil
 }
 
+// PostSplitPayment processes a split payment request.
+// Every leg is checked like a payment of its own, with the merchant's settlement currency, risk
+// assessment, screening, verification and fee. The legs then share the worst outcome: if one leg
+// fails they all fail, and if one is held for review they all are. A leg blocked by screening
+// rejects the whole split, as does a leg that would break a limit. The legs are stored together
+// with their payment.created events as a single unit.
+func (s *paymentService) PostSplitPayment(request models.SplitPaymentRequest) (dto.SplitPayment, error) {
+	customer, err := s.getPayingCustomer(models.PaymentRequest{CustomerID: request.CustomerID})
+	if err != nil {
+		return dto.SplitPayment{}, err
+	}
+
+	if request.Currency == "" {
+		request.Currency = customer.GetCurrency()
+	}
+	status := models.PaymentStatusSucceeded
+	legs := make([]models.Payment, 0, len(request.Legs))
+	for i := range request.Legs {
+		// The risk rules see the legs before this one, so a split cannot stay under their velocity limits.
+		leg, err := s.checkPayment(customer, request.LegRequest(i), legs)
+		if err != nil {
+			return dto.SplitPayment{}, err
+		}
+		status = worsePaymentStatus(status, leg.Status)
+		legs = append(legs, leg)
+	}
+
+	total := 0.0
+	for i := range legs {
+		legs[i].Status = status
+		total += legs[i].Amount
+	}
+
+	legs, err = s.createPaymentRecords(legs, request.Meta)
+	if err != nil {
+		return dto.SplitPayment{}, err
+	}
+
+	return dto.SplitPayment{
+		TransactionID: request.TransactionID,
+		CustomerID:    customer.ID,
+		Amount:        roundToCurrency(total, request.Currency),
+		Currency:      request.Currency,
+		Status:        status,
+		Legs:          legs,
+	}, nil
+}
+
+// GetPayments returns payments matching the filter, newest first, scoped to the caller.
+// Customers only see their own payments and merchants only the payments made to them.
+func (s *paymentService) GetPayments(caller dto.Caller, filter dto.PaymentFilter) (dto.PaymentPage, error) {
+	filter, err := scopePaymentFilter(caller, filter)
+	if err != nil {
+		return dto.PaymentPage{}, err
+	}
+
+	payments, err := loadPayments()
+	if err != nil {
+		return dto.PaymentPage{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		return paymentSortKeyLess(payments[j], payments[i])
+	})
+
+	var after *models.Payment
+	if filter.Cursor != "" {
+		parts, err := util.DecodeCursor(filter.Cursor, 2)
+		if err != nil {
+			return dto.PaymentPage{}, invalidCursorError()
+		}
+		after = &models.Payment{Timestamp: parts[0], TransactionID: parts[1]}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	page := dto.PaymentPage{Data: []models.Payment{}}
+	for _, payment := range payments {
+		if after != nil && !paymentSortKeyLess(payment, *after) {
+			continue
+		}
+		if !matchesPaymentFilter(payment, filter) {
+			continue
+		}
+		if len(page.Data) == limit {
+			last := page.Data[len(page.Data)-1]
+			page.NextCursor = util.EncodeCursor(last.Timestamp, last.TransactionID)
+			break
+		}
+		page.Data = append(page.Data, payment)
+	}
+
+	return page, nil
+}
+
+// GetPayment returns the payment with the given transaction ID if the caller may see it.
+// Payments outside the caller's scope are reported as not found.
+func (s *paymentService) GetPayment(caller dto.Caller, transactionID string) (models.Payment, error) {
+	payments, err := loadPayments()
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+
+	for _, payment := range payments {
+		if payment.TransactionID == transactionID && canViewPayment(caller, payment) {
+			return payment, nil
+		}
+	}
+	return models.Payment{}, NewNotFoundError(CodePaymentNotFound, "payment not found")
+}
+
+// RefundPayment marks a succeeded payment as refunded and records its payment.refunded event.
+// Only the payment's merchant and admins may refund; other callers get not found.
+func (s *paymentService) RefundPayment(caller dto.Caller, transactionID string, meta models.RequestMeta) (models.Payment, error) {
+	if caller.Role != models.RoleMerchant && caller.Role != models.RoleAdmin {
+		return models.Payment{}, NewForbiddenError(CodeForbidden, "only merchants and admins can refund payments")
+	}
+
+	event := models.OutboxEvent{
+		Type:          models.EventPaymentRefunded,
+		Actor:         callerParty(caller),
+		Metadata:      meta.Metadata(),
+		CorrelationID: meta.CorrelationID,
+	}
+	return s.outbox.CommitPaymentChange(event, func(payments []models.Payment) ([]models.Payment, models.Payment, error) {
+		i := findPayment(payments, transactionID)
+		if i < 0 || !canViewPayment(caller, payments[i]) {
+			return nil, models.Payment{}, NewNotFoundError(CodePaymentNotFound, "payment not found")
+		}
+		if payments[i].Status != models.PaymentStatusSucceeded {
+			return nil, models.Payment{}, NewConflictError(CodePaymentNotRefundable, "only succeeded payments can be refunded")
+		}
+		if payments[i].DisputeID != "" && payments[i].DisputeStatus != models.DisputeWon {
+			return nil, models.Payment{}, NewConflictError(CodePaymentNotRefundable, "disputed payments cannot be refunded")
+		}
+		payments[i].Status = models.PaymentStatusRefunded
+		payments[i].RefundedAt = time.Now().Format(time.RFC3339)
+		payments[i].Version++
+		return payments, payments[i], nil
+	})
+}
+
 // NewPaymentService creates a new instance of paymentService.
-// It requires a CustomerService and a HistoryService to function.
-func NewPaymentService(cs CustomerService, hs HistoryService) PaymentService {
-	return &paymentService{cs, hs}
+// It requires a CustomerService and MerchantService, the OutboxService payment changes are committed
+// through, the TransactionVerifier, RiskService, LimitService and ScreeningService new payments
+// are checked with, the RateProvider they are converted with and the FeeService that charges
+// the merchant's fee on captured payments.
+func NewPaymentService(cs CustomerService, ms MerchantService, outbox OutboxService, verifier TransactionVerifier, risk RiskService, limits LimitService, screening ScreeningService, rates RateProvider, fees FeeService) PaymentService {
+	return &paymentService{cs, ms, outbox, verifier, risk, limits, screening, rates, fees}
 }
 
-// getLoggedInCustomer retrieves a logged-in customer by ID.
-// It returns the customer if found and logged in, otherwise returns an error.
-func (s *paymentService) getLoggedInCustomer(customerID string) (*models.Customer, error) {
+// getPayingCustomer retrieves the customer paying a request by ID.
+// The customer must be logged in unless they authorised the payment beforehand.
+func (s *paymentService) getPayingCustomer(paymentRequest models.PaymentRequest) (*models.Customer, error) {
 	customers, err := s.cs.GetAllCustomer()
 	if err != nil {
 		return nil, err
 	}
 
 	for _, customer := range customers {
-		if customer.ID == customerID && customer.LoggedIn {
+		if customer.ID == paymentRequest.CustomerID && (customer.LoggedIn || paymentRequest.Preauthorized()) {
 			return &customer, nil
 		}
 	}
-	return nil, errors.New("unauthorized or invalid customer")
+	return nil, NewUnauthorizedError(CodeCustomerNotLoggedIn, "customer is not logged in or does not exist")
 }
 
-// verifyTransaction verifies the transaction ID.
-// This function should implement logic to verify the transaction with a third-party service.
-func (s *paymentService) verifyTransaction(transactionID string) error {
-	// Implement logic to verify the transaction ID with the third-party service
-	log.Printf("Verifying transaction ID: %s", transactionID)
-	return nil
+// settle checks the amount against the payment currency's minor unit and converts it into the
+// merchant's currency.
+func (s *paymentService) settle(paymentRequest models.PaymentRequest, merchant models.Merchant) (paymentSettlement, error) {
+	if err := checkCurrencyPrecision(paymentRequest.Amount, paymentRequest.Currency); err != nil {
+		return paymentSettlement{}, err
+	}
+	currency := merchant.GetCurrency()
+	amount, fx, err := convertAmount(s.rates, paymentRequest.Amount, paymentRequest.Currency, currency)
+	if err != nil {
+		return paymentSettlement{}, err
+	}
+	return paymentSettlement{amount: amount, currency: currency, fx: fx}, nil
 }
 
-// createPaymentRecord creates and saves a new payment record.
-// It returns the created payment or an error if the operation fails.
-func (s *paymentService) createPaymentRecord(customer *models.Customer, paymentRequest models.PaymentRequest) (models.Payment, error) {
-	payment := models.Payment{
-		CustomerID:    customer.ID,
+// verifyTransaction verifies the transaction with the third-party verification provider.
+// It returns the provider's decision, or an error if no decision could be obtained.
+func (s *paymentService) verifyTransaction(paymentRequest models.PaymentRequest) (models.Verification, error) {
+	log.Printf("Verifying transaction ID: %s", paymentRequest.TransactionID)
+	return s.verifier.Verify(models.VerificationRequest{
+		TransactionID: paymentRequest.TransactionID,
+		CustomerID:    paymentRequest.CustomerID,
 		MerchantID:    paymentRequest.MerchantID,
 		Amount:        paymentRequest.Amount,
-		TransactionID: paymentRequest.TransactionID,
-		Timestamp:     time.Now().Format(time.RFC3339),
+		Currency:      paymentRequest.Currency,
+	})
+}
+
+// checkPayment retrieves the merchant of a payment request, converts the amount from the payment
+// currency into the merchant's settlement currency, assesses the payment's risk, screens both
+// parties against the sanctions list and verifies the transaction. It returns the payment record
+// the checks result in: a payment blocked by the risk engine or declined by the verifier is failed,
+// and one flagged by the risk engine or screening is held as pending_review. A payment blocked by
+// screening is rejected with an error. pending are checked payments of the same checkout that are
+// not stored yet, which the risk assessment counts like stored ones.
+func (s *paymentService) checkPayment(customer *models.Customer, paymentRequest models.PaymentRequest, pending []models.Payment) (models.Payment, error) {
+	merchant, err := s.ms.GetMerchant(paymentRequest.MerchantID)
+	if err != nil {
+		return models.Payment{}, err
 	}
 
-	payments, err := s.loadPayments()
+	settlement, err := s.settle(paymentRequest, merchant)
 	if err != nil {
-		return models.Payment{}, fmt.Errorf("failed to load payments: %v", err)
+		return models.Payment{}, err
 	}
 
-	payments = append(payments, payment)
+	risk, err := s.risk.Assess(paymentRequest, pending)
+	if err != nil {
+		return models.Payment{}, err
+	}
 
-	if err := s.savePayments(payments); err != nil {
-		return models.Payment{}, fmt.Errorf("failed to save payment: %v", err)
+	// A sanctions match blocks the payment outright or holds it for review with the risky ones.
+	screening, err := s.screening.ScreenPayment(*customer, merchant, paymentRequest.TransactionID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	switch screening.Decision {
+	case models.ScreeningBlock:
+		return models.Payment{}, NewForbiddenError(CodeSanctionsMatch, "payment is blocked by sanctions screening")
+	case models.ScreeningReview:
+		risk.TriggeredRules = append(risk.TriggeredRules, "sanctions_screening")
+		if risk.Decision == models.RiskDecisionAllow {
+			risk.Decision = models.RiskDecisionReview
+		}
 	}
 
-	return payment, nil
+	// Blocked payments fail without asking the verification provider.
+	var verification *models.Verification
+	if risk.Decision != models.RiskDecisionBlock {
+		result, err := s.verifyTransaction(paymentRequest)
+		if err != nil {
+			log.Printf("Error verifying transaction %s: %v", paymentRequest.TransactionID, err)
+			return models.Payment{}, NewUnavailableError(CodeVerificationUnavailable, "transaction verification is unavailable, try again later")
+		}
+		verification = &result
+	}
+
+	status := models.PaymentStatusSucceeded
+	switch {
+	case risk.Decision == models.RiskDecisionBlock:
+		status = models.PaymentStatusFailed
+	case verification != nil && verification.Status == models.VerificationDeclined:
+		status = models.PaymentStatusFailed
+	case risk.Decision == models.RiskDecisionReview:
+		status = models.PaymentStatusPendingReview
+	}
+	return models.Payment{
+		CustomerID:         customer.ID,
+		MerchantID:         paymentRequest.MerchantID,
+		Amount:             paymentRequest.Amount,
+		Currency:           paymentRequest.Currency,
+		TransactionID:      paymentRequest.TransactionID,
+		Status:             status,
+		Version:            1,
+		Timestamp:          time.Now().Format(time.RFC3339),
+		Verification:       verification,
+		Risk:               &risk,
+		SettlementAmount:   settlement.amount,
+		SettlementCurrency: settlement.currency,
+		FX:                 settlement.fx,
+		SubscriptionID:     paymentRequest.SubscriptionID,
+		ScheduledPaymentID: paymentRequest.ScheduledPaymentID,
+		SplitID:            paymentRequest.SplitID,
+		InvoiceID:          paymentRequest.InvoiceID,
+	}, nil
 }
 
-// loadPayments loads payment data from a JSON file.
-// It returns a slice of payments or an error if the operation fails.
-func (s *paymentService) loadPayments() ([]models.Payment, error) {
-	file, err := os.Open("database/payment.json")
+// createPaymentRecord saves a checked payment together with its payment.created event.
+// It returns the created payment or an error if the operation fails.
+func (s *paymentService) createPaymentRecord(payment models.Payment, meta models.RequestMeta) (models.Payment, error) {
+	created, err := s.createPaymentRecords([]models.Payment{payment}, meta)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []models.Payment{}, nil
+		return models.Payment{}, err
+	}
+	return created[0], nil
+}
+
+// createPaymentRecords saves checked payments of one customer together with their payment.created
+// events as a single unit. Succeeded payments are captured with their merchant's fee first. The
+// transaction IDs and split IDs of the payments must not be used by a payment or split yet.
+// It returns the created payments or an error if the operation fails.
+func (s *paymentService) createPaymentRecords(records []models.Payment, meta models.RequestMeta) ([]models.Payment, error) {
+	// Succeeded payments are captured right away; held ones once their review approves them.
+	for i := range records {
+		if records[i].Status == models.PaymentStatusSucceeded {
+			if err := s.fees.Capture(&records[i]); err != nil {
+				return nil, err
+			}
 		}
-		return nil, err
 	}
-	defer file.Close()
 
-	var payments []models.Payment
-	if err := json.NewDecoder(file).Decode(&payments); err != nil {
-		return nil, err
+	event := models.OutboxEvent{
+		Type:          models.EventPaymentCreated,
+		Actor:         customerParty(records[0].CustomerID),
+		Metadata:      meta.Metadata(),
+		CorrelationID: meta.CorrelationID,
 	}
+	return s.outbox.CommitPaymentChanges(event, func(payments []models.Payment) ([]models.Payment, []models.Payment, error) {
+		for _, record := range records {
+			for _, id := range []string{record.TransactionID, record.SplitID} {
+				if id != "" && (findPayment(payments, id) >= 0 || findSplit(payments, id) >= 0) {
+					return nil, nil, NewConflictError(CodeDuplicateTransaction, "transaction ID has already been used")
+				}
+			}
+		}
+		// Limits are checked against the payments loaded under the outbox lock, so concurrent
+		// payments cannot both slip under the same limit. Each payment is checked with the ones
+		// before it already counted. Failed payments move no money.
+		for _, record := range records {
+			if record.Status != models.PaymentStatusFailed {
+				if err := s.limits.CheckPayment(payments, record); err != nil {
+					return nil, nil, err
+				}
+			}
+			payments = append(payments, record)
+		}
+		return payments, records, nil
+	})
+}
 
-	return payments, nil
+// worsePaymentStatus returns the worse of two new payment statuses: failed over pending_review
+// over succeeded.
+func worsePaymentStatus(a, b string) string {
+	rank := map[string]int{
+		models.PaymentStatusSucceeded:     0,
+		models.PaymentStatusPendingReview: 1,
+		models.PaymentStatusFailed:        2,
+	}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
 }
 
-// savePayments saves payment data to a JSON file.
-// It returns an error if the operation fails.
-func (s *paymentService) savePayments(payments []models.Payment) error {
-	file, err := os.OpenFile("database/payment.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
+// scopePaymentFilter restricts a payment filter to what the caller is allowed to see.
+// Customers and merchants asking for someone else's payments get a forbidden error.
+func scopePaymentFilter(caller dto.Caller, filter dto.PaymentFilter) (dto.PaymentFilter, error) {
+	switch caller.Role {
+	case models.RoleAdmin:
+		return filter, nil
+	case models.RoleCustomer:
+		if filter.CustomerID != "" && filter.CustomerID != caller.UserID {
+			return filter, NewForbiddenError(CodeForbidden, "customers can only view their own payments")
+		}
+		filter.CustomerID = caller.UserID
+		return filter, nil
+	case models.RoleMerchant:
+		if filter.MerchantID != "" && filter.MerchantID != caller.MerchantID {
+			return filter, NewForbiddenError(CodeForbidden, "merchants can only view their own payments")
+		}
+		filter.MerchantID = caller.MerchantID
+		return filter, nil
+	default:
+		return filter, NewForbiddenError(CodeForbidden, "role is not allowed to view payments")
 	}
-	defer file.Close()
+}
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(payments); err != nil {
-		return err
+// canViewPayment reports whether the caller may see the payment.
+func canViewPayment(caller dto.Caller, payment models.Payment) bool {
+	switch caller.Role {
+	case models.RoleAdmin:
+		return true
+	case models.RoleCustomer:
+		return payment.CustomerID == caller.UserID
+	case models.RoleMerchant:
+		return caller.MerchantID != "" && payment.MerchantID == caller.MerchantID
+	default:
+		return false
 	}
+}
 
-	return nil
+// matchesPaymentFilter reports whether a payment satisfies every criterion set on the filter.
+func matchesPaymentFilter(payment models.Payment, filter dto.PaymentFilter) bool {
+	if filter.CustomerID != "" && payment.CustomerID != filter.CustomerID {
+		return false
+	}
+	if filter.MerchantID != "" && payment.MerchantID != filter.MerchantID {
+		return false
+	}
+	if filter.SplitID != "" && payment.SplitID != filter.SplitID {
+		return false
+	}
+	if filter.Status != "" && payment.Status != filter.Status {
+		return false
+	}
+	if filter.MinAmount > 0 && payment.Amount < filter.MinAmount {
+		return false
+	}
+	if filter.MaxAmount > 0 && payment.Amount > filter.MaxAmount {
+		return false
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timestamp, err := time.Parse(time.RFC3339, payment.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !filter.From.IsZero() && timestamp.Before(filter.From) {
+			return false
+		}
+		if !filter.To.IsZero() && timestamp.After(filter.To) {
+			return false
+		}
+	}
+	return true
+}
+
+// paymentSortKeyLess orders payments by timestamp, then by transaction ID.
+func paymentSortKeyLess(a, b models.Payment) bool {
+	ta, _ := time.Parse(time.RFC3339, a.Timestamp)
+	tb, _ := time.Parse(time.RFC3339, b.Timestamp)
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return a.TransactionID < b.TransactionID
+}
+
+// callerParty returns the event party acting on behalf of the caller.
+func callerParty(caller dto.Caller) models.EventParty {
+	switch caller.Role {
+	case models.RoleMerchant:
+		return models.EventParty{Type: models.PartyMerchant, ID: caller.MerchantID}
+	case models.RoleAdmin:
+		return models.EventParty{Type: models.PartyAdmin, ID: caller.UserID}
+	default:
+		return customerParty(caller.UserID)
+	}
 }
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"merchant-bank-api/models"
+	"merchant-bank-api/util"
+)
+
+// paymentsFile stores every payment record.
+const paymentsFile = "database/payment.json"
+
+// loadPayments loads payment data from the payments JSON file.
+// Records written before statuses and versions were introduced are normalised.
+func loadPayments() ([]models.Payment, error) {
+	payments := []models.Payment{}
+	if err := util.ReadJSONFile(paymentsFile, &payments); err != nil {
+		return nil, err
+	}
+
+	for i := range payments {
+		// Payments recorded before statuses were introduced all succeeded.
+		if payments[i].Status == "" {
+			payments[i].Status = models.PaymentStatusSucceeded
+		}
+		if payments[i].Version == 0 {
+			payments[i].Version = 1
+		}
+	}
+
+	return payments, nil
+}
+
+// savePayments atomically replaces the payments JSON file.
+func savePayments(payments []models.Payment) error {
+	return util.WriteJSONFile(paymentsFile, payments)
+}
+
+// findPayment returns the index of the payment with the given transaction ID, or -1.
+func findPayment(payments []models.Payment, transactionID string) int {
+	for i, payment := range payments {
+		if payment.TransactionID == transactionID {
+			return i
+		}
+	}
+	return -1
+}
+
+// findSplit returns the index of the first leg of the split payment with the given ID, or -1.
+func findSplit(payments []models.Payment, splitID string) int {
+	for i, payment := range payments {
+		if payment.SplitID == splitID {
+			return i
+		}
+	}
+	return -1
+}
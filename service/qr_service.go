@@ -0,0 +1,376 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// IDs of the EMV merchant-presented QR code data objects this service writes and reads.
+const (
+	emvPayloadFormat     = "00"
+	emvPointOfInitiation = "01"
+	emvAccountFirst      = 26
+	emvAccountLast       = 51
+	emvMCC               = "52"
+	emvCurrency          = "53"
+	emvAmount            = "54"
+	emvCountryCode       = "58"
+	emvMerchantName      = "59"
+	emvMerchantCity      = "60"
+	emvAdditionalData    = "62"
+
+	// Data objects of the merchant account information and additional data templates.
+	emvGloballyUniqueID = "00"
+	emvMerchantID       = "01"
+	emvReferenceLabel   = "05"
+)
+
+// EMV point of initiation values.
+const (
+	emvStatic  = "11"
+	emvDynamic = "12"
+)
+
+// qrPNGScale is the size in pixels of a module of rendered QR codes.
+const qrPNGScale = 8
+
+// qrCodesFile stores the issued dynamic QR codes.
+const qrCodesFile = "database/qr_codes.json"
+
+// QRService defines the interface of EMV merchant-presented QR codes.
+type QRService interface {
+	// GenerateMerchantQR returns the QR code payload of a merchant, dynamic if the query has an amount.
+	GenerateMerchantQR(caller dto.Caller, merchantID string, query dto.MerchantQRQuery) (dto.MerchantQR, error)
+	// RenderPNG renders a QR code payload as a PNG image.
+	RenderPNG(payload string) ([]byte, error)
+	// PayQR parses a scanned QR code payload and pays its merchant through the PaymentService.
+	PayQR(request models.QRPaymentRequest) (models.Payment, error)
+}
+
+// qrService is a concrete implementation of the QRService interface. The mutex serialises
+// updates of the issued codes file.
+type qrService struct {
+	conf  config.QRConfig
+	ps    PaymentService
+	ms    MerchantService
+	clock Clock
+	mu    sync.Mutex
+}
+
+// GenerateMerchantQR builds the EMVCo merchant-presented payload of a merchant. Merchants get
+// their own codes and admins any merchant's. A static code carries the merchant and currency,
+// which defaults to the merchant's; a dynamic one also the amount and a reference label that
+// makes it pay only once. Dynamic codes are stored so that payments can be checked against them.
+func (s *qrService) GenerateMerchantQR(caller dto.Caller, merchantID string, query dto.MerchantQRQuery) (dto.MerchantQR, error) {
+	if err := canManageMerchant(caller, merchantID); err != nil {
+		return dto.MerchantQR{}, err
+	}
+	merchant, err := s.ms.GetMerchant(merchantID)
+	if err != nil {
+		return dto.MerchantQR{}, err
+	}
+
+	currency := query.Currency
+	if currency == "" {
+		currency = merchant.GetCurrency()
+	}
+	numeric, ok := models.CurrencyNumericCode(currency)
+	if !ok {
+		return dto.MerchantQR{}, NewValidationError("invalid QR code", []util.FieldError{{Field: "currency", Rule: "qr_currency", Message: currency + " cannot be used in QR codes"}})
+	}
+	if query.Reference != "" && query.Amount == 0 {
+		return dto.MerchantQR{}, NewValidationError("invalid QR code", []util.FieldError{{Field: "reference", Rule: "required_with", Message: "needs an amount"}})
+	}
+
+	qr := dto.MerchantQR{MerchantID: merchant.ID, PointOfInitiation: models.QRStatic, Currency: currency}
+	initiation := emvStatic
+	if query.Amount > 0 {
+		if err := checkCurrencyPrecision(query.Amount, currency); err != nil {
+			return dto.MerchantQR{}, err
+		}
+		initiation = emvDynamic
+		qr.PointOfInitiation = models.QRDynamic
+		qr.Amount = query.Amount
+		qr.Reference = query.Reference
+		if qr.Reference == "" {
+			qr.Reference = util.RandomHex(8)
+		}
+		now := s.clock.Now()
+		qr.ExpiresAt = now.Add(s.conf.DynamicTTL).Format(time.RFC3339)
+		if err := s.issue(models.QRCode{
+			Reference:  qr.Reference,
+			MerchantID: merchant.ID,
+			Amount:     qr.Amount,
+			Currency:   currency,
+			ExpiresAt:  qr.ExpiresAt,
+			CreatedAt:  now.Format(time.RFC3339),
+		}); err != nil {
+			return dto.MerchantQR{}, err
+		}
+	}
+
+	account := util.EncodeEMV([]util.EMVField{
+		{ID: emvGloballyUniqueID, Value: s.conf.GlobalUniqueID},
+		{ID: emvMerchantID, Value: merchant.ID},
+	})
+	mcc := merchant.MCC
+	if mcc == "" {
+		mcc = "0000"
+	}
+	fields := []util.EMVField{
+		{ID: emvPayloadFormat, Value: "01"},
+		{ID: emvPointOfInitiation, Value: initiation},
+		{ID: strconv.Itoa(emvAccountFirst), Value: account},
+		{ID: emvMCC, Value: mcc},
+		{ID: emvCurrency, Value: numeric},
+	}
+	if qr.Amount > 0 {
+		fields = append(fields, util.EMVField{ID: emvAmount, Value: strconv.FormatFloat(qr.Amount, 'f', -1, 64)})
+	}
+	fields = append(fields,
+		util.EMVField{ID: emvCountryCode, Value: s.conf.CountryCode},
+		util.EMVField{ID: emvMerchantName, Value: emvText(merchant.Name, 25)},
+		util.EMVField{ID: emvMerchantCity, Value: emvText(s.conf.MerchantCity, 15)},
+	)
+	if qr.Reference != "" {
+		fields = append(fields, util.EMVField{ID: emvAdditionalData, Value: util.EncodeEMV([]util.EMVField{{ID: emvReferenceLabel, Value: qr.Reference}})})
+	}
+	qr.Payload = util.EncodeEMVWithCRC(fields)
+	return qr, nil
+}
+
+// RenderPNG renders the payload as a QR code PNG.
+func (s *qrService) RenderPNG(payload string) ([]byte, error) {
+	return util.QRCodePNG([]byte(payload), qrPNGScale)
+}
+
+// PayQR checks the payload's CRC, finds the merchant in the merchant account information
+// published under this bank's globally unique ID and posts the payment through the payment flow
+// in the code's currency. A static code is paid with the customer's transaction ID and amount.
+// A dynamic code must have been issued by GenerateMerchantQR with the same merchant, amount and
+// currency, must not have expired and is paid once, with its own amount and the merchant ID and
+// reference label as transaction ID; a transaction ID or amount in the request must match them.
+func (s *qrService) PayQR(request models.QRPaymentRequest) (models.Payment, error) {
+	fields, err := util.ParseEMVWithCRC(strings.TrimSpace(request.Payload))
+	if err != nil {
+		return models.Payment{}, NewInvalidQRError(err.Error())
+	}
+	if format, _ := util.FindEMV(fields, emvPayloadFormat); format != "01" {
+		return models.Payment{}, NewInvalidQRError("is not an EMV merchant-presented QR code")
+	}
+
+	merchantID := s.findMerchantAccount(fields)
+	if merchantID == "" {
+		return models.Payment{}, NewInvalidQRError("is not the QR code of a merchant of this bank")
+	}
+	numeric, _ := util.FindEMV(fields, emvCurrency)
+	currency, ok := models.CurrencyByNumericCode(numeric)
+	if !ok {
+		return models.Payment{}, NewInvalidQRError("has an unsupported currency")
+	}
+
+	paymentRequest := models.PaymentRequest{
+		TransactionID: request.TransactionID,
+		CustomerID:    request.CustomerID,
+		MerchantID:    merchantID,
+		Amount:        request.Amount,
+		Currency:      currency,
+		Meta:          request.Meta,
+	}
+	initiation, _ := util.FindEMV(fields, emvPointOfInitiation)
+	reference := ""
+	if initiation == emvDynamic {
+		value, _ := util.FindEMV(fields, emvAmount)
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil || amount <= 0 {
+			return models.Payment{}, NewInvalidQRError("is a dynamic QR code without a valid amount")
+		}
+		if data, ok := util.FindEMV(fields, emvAdditionalData); ok {
+			if additional, err := util.ParseEMV(data); err == nil {
+				reference, _ = util.FindEMV(additional, emvReferenceLabel)
+			}
+		}
+		if reference == "" {
+			return models.Payment{}, NewInvalidQRError("is a dynamic QR code without a reference label")
+		}
+
+		transactionID := merchantID + "-" + reference
+		var mismatches []util.FieldError
+		if request.TransactionID != "" && request.TransactionID != transactionID {
+			mismatches = append(mismatches, util.FieldError{Field: "transaction_id", Rule: "qr", Message: "must match the QR code or be left out"})
+		}
+		if request.Amount != 0 && request.Amount != amount {
+			mismatches = append(mismatches, util.FieldError{Field: "amount", Rule: "qr", Message: "must match the QR code or be left out"})
+		}
+		if len(mismatches) > 0 {
+			return models.Payment{}, NewValidationError("payment does not match the QR code", mismatches)
+		}
+		paymentRequest.TransactionID = transactionID
+		paymentRequest.Amount = amount
+	} else {
+		var missing []util.FieldError
+		if request.TransactionID == "" {
+			missing = append(missing, util.FieldError{Field: "transaction_id", Rule: "required", Message: "is required for static QR codes"})
+		}
+		if request.Amount == 0 {
+			missing = append(missing, util.FieldError{Field: "amount", Rule: "required", Message: "is required for static QR codes"})
+		}
+		if len(missing) > 0 {
+			return models.Payment{}, NewValidationError("invalid payment", missing)
+		}
+		return s.ps.PostPayment(paymentRequest)
+	}
+
+	if err := s.claim(merchantID, reference, paymentRequest.Amount, currency, paymentRequest.TransactionID); err != nil {
+		return models.Payment{}, err
+	}
+	payment, err := s.ps.PostPayment(paymentRequest)
+	if err != nil {
+		// No payment was stored, so the code can be paid again.
+		s.release(merchantID, reference)
+		return models.Payment{}, err
+	}
+	return payment, nil
+}
+
+// NewQRService creates a new instance of qrService that looks merchants up with the
+// MerchantService, pays scanned codes through the PaymentService and tells the time with the Clock.
+func NewQRService(conf config.QRConfig, ps PaymentService, ms MerchantService, clock Clock) QRService {
+	return &qrService{conf: conf, ps: ps, ms: ms, clock: clock}
+}
+
+// issue stores a dynamic code. A merchant's references must be unique, since the reference
+// makes up the transaction ID the code is paid with.
+func (s *qrService) issue(code models.QRCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes, err := loadQRCodes()
+	if err != nil {
+		return err
+	}
+	if findQRCode(codes, code.MerchantID, code.Reference) >= 0 {
+		return NewValidationError("invalid QR code", []util.FieldError{{Field: "reference", Rule: "unique", Message: "is already used by another QR code of the merchant"}})
+	}
+	return saveQRCodes(append(codes, code))
+}
+
+// claim marks the issued code with the reference as paid with the transaction ID after checking
+// that the payload matches it, that it has not expired and that it has not been paid yet.
+func (s *qrService) claim(merchantID, reference string, amount float64, currency, transactionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes, err := loadQRCodes()
+	if err != nil {
+		return err
+	}
+	i := findQRCode(codes, merchantID, reference)
+	if i < 0 {
+		return NewInvalidQRError("is not a dynamic QR code issued by this bank")
+	}
+	code := &codes[i]
+	if code.Amount != amount || code.Currency != currency {
+		return NewInvalidQRError("does not match the amount and currency of the issued QR code")
+	}
+	if code.PaidAt != "" {
+		return NewConflictError(CodeQRCodeUsed, "the QR code has already been paid")
+	}
+	now := s.clock.Now()
+	if expiresAt, err := time.Parse(time.RFC3339, code.ExpiresAt); err != nil || !now.Before(expiresAt) {
+		return NewInvalidQRError("has expired")
+	}
+	code.TransactionID = transactionID
+	code.PaidAt = now.Format(time.RFC3339)
+	return saveQRCodes(codes)
+}
+
+// release makes a claimed code payable again after its payment was rejected without being stored.
+func (s *qrService) release(merchantID, reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes, err := loadQRCodes()
+	if err == nil {
+		if i := findQRCode(codes, merchantID, reference); i >= 0 {
+			codes[i].TransactionID = ""
+			codes[i].PaidAt = ""
+			err = saveQRCodes(codes)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to release QR code %s of merchant %s: %v", reference, merchantID, err)
+	}
+}
+
+// findMerchantAccount returns the merchant ID of the first merchant account information
+// template published under this bank's globally unique ID, or "" if there is none.
+func (s *qrService) findMerchantAccount(fields []util.EMVField) string {
+	for _, field := range fields {
+		id, err := strconv.Atoi(field.ID)
+		if err != nil || id < emvAccountFirst || id > emvAccountLast {
+			continue
+		}
+		account, err := util.ParseEMV(field.Value)
+		if err != nil {
+			continue
+		}
+		if guid, _ := util.FindEMV(account, emvGloballyUniqueID); !strings.EqualFold(guid, s.conf.GlobalUniqueID) {
+			continue
+		}
+		if merchantID, _ := util.FindEMV(account, emvMerchantID); merchantID != "" {
+			return merchantID
+		}
+	}
+	return ""
+}
+
+// findQRCode returns the index of the merchant's code with the reference, or -1.
+func findQRCode(codes []models.QRCode, merchantID, reference string) int {
+	for i, code := range codes {
+		if code.MerchantID == merchantID && code.Reference == reference {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadQRCodes reads the issued QR codes file.
+func loadQRCodes() ([]models.QRCode, error) {
+	codes := []models.QRCode{}
+	if err := util.ReadJSONFile(qrCodesFile, &codes); err != nil {
+		return nil, fmt.Errorf("failed to read QR codes: %v", err)
+	}
+	return codes, nil
+}
+
+// saveQRCodes writes the issued QR codes file.
+func saveQRCodes(codes []models.QRCode) error {
+	if err := util.WriteJSONFile(qrCodesFile, codes); err != nil {
+		return fmt.Errorf("failed to save QR codes: %v", err)
+	}
+	return nil
+}
+
+// emvText keeps the printable ASCII characters of s, which EMV text fields allow, up to n of them.
+func emvText(s string, n int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if b.Len() == n {
+			break
+		}
+		if r >= 0x20 && r < 0x7f {
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// stubMerchants is a MerchantService that knows a single merchant.
+type stubMerchants struct {
+	MerchantService
+	merchant models.Merchant
+}
+
+// GetMerchant returns the merchant if the ID is its own.
+func (m stubMerchants) GetMerchant(id string) (models.Merchant, error) {
+	if id != m.merchant.ID {
+		return models.Merchant{}, NewNotFoundError(CodeMerchantNotFound, "merchant not found")
+	}
+	return m.merchant, nil
+}
+
+// qrStart is when the test QR codes are issued.
+var qrStart = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// merchantCaller is merchant 1 managing its own QR codes.
+var merchantCaller = dto.Caller{Role: models.RoleMerchant, UserID: "m1", MerchantID: "1"}
+
+// newTestQRService returns a QR service for merchant 1 whose dynamic codes live 15 minutes and
+// whose payments succeed, with its clock and payments.
+func newTestQRService(t *testing.T) (*qrService, *FakeClock, *stubPayments) {
+	t.Helper()
+	useTempDatabase(t)
+	clock := NewFakeClock(qrStart)
+	payments := &stubPayments{statuses: []string{models.PaymentStatusSucceeded}}
+	conf := config.QRConfig{GlobalUniqueID: "ID.CO.TESTBANK", CountryCode: "ID", MerchantCity: "Jakarta", DynamicTTL: 15 * time.Minute}
+	merchants := stubMerchants{merchant: models.Merchant{ID: "1", Name: "Coffee Shop", Currency: "IDR", MCC: "5814"}}
+	return NewQRService(conf, payments, merchants, clock).(*qrService), clock, payments
+}
+
+// dynamicQR issues a dynamic code of merchant 1 for the amount, failing the test if it cannot.
+func dynamicQR(t *testing.T, s *qrService, amount float64, reference string) dto.MerchantQR {
+	t.Helper()
+	qr, err := s.GenerateMerchantQR(merchantCaller, "1", dto.MerchantQRQuery{Amount: amount, Reference: reference})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return qr
+}
+
+// payQR pays the payload as customer 2.
+func payQR(s *qrService, payload string) (models.Payment, error) {
+	return s.PayQR(models.QRPaymentRequest{CustomerID: "2", Payload: payload})
+}
+
+// assertErrorCode fails the test unless err is a domain error with the code.
+func assertErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	if domainErr, ok := AsDomainError(err); !ok || domainErr.Code != code {
+		t.Fatalf("error = %v, want %s", err, code)
+	}
+}
+
+// withField returns the payload with the value of the data object replaced and a new CRC.
+func withField(t *testing.T, payload, id, value string) string {
+	t.Helper()
+	fields, err := util.ParseEMVWithCRC(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range fields {
+		if fields[i].ID == id {
+			fields[i].Value = value
+		}
+	}
+	return util.EncodeEMVWithCRC(fields)
+}
+
+func TestQRDynamicCodeIsStoredAndPaidOnce(t *testing.T) {
+	s, clock, payments := newTestQRService(t)
+	qr := dynamicQR(t, s, 25000, "order42")
+	if qr.ExpiresAt != "2026-03-01T09:15:00Z" {
+		t.Fatalf("expires at %s", qr.ExpiresAt)
+	}
+	codes, err := loadQRCodes()
+	if err != nil || len(codes) != 1 || codes[0].Reference != "order42" || codes[0].MerchantID != "1" || codes[0].Amount != 25000 || codes[0].Currency != "IDR" {
+		t.Fatalf("stored codes %+v, %v", codes, err)
+	}
+
+	clock.Advance(5 * time.Minute)
+	payment, err := payQR(s, qr.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.TransactionID != "1-order42" {
+		t.Fatalf("paid with transaction ID %s", payment.TransactionID)
+	}
+	request := payments.requests[0]
+	if request.MerchantID != "1" || request.Amount != 25000 || request.Currency != "IDR" || request.CustomerID != "2" {
+		t.Fatalf("unexpected payment request %+v", request)
+	}
+	if codes, _ := loadQRCodes(); codes[0].TransactionID != "1-order42" || codes[0].PaidAt != "2026-03-01T09:05:00Z" {
+		t.Fatalf("paid code %+v", codes[0])
+	}
+
+	_, err = payQR(s, qr.Payload)
+	assertErrorCode(t, err, CodeQRCodeUsed)
+	if len(payments.requests) != 1 {
+		t.Fatalf("reused code posted %d payments", len(payments.requests))
+	}
+}
+
+func TestQRDynamicCodeExpires(t *testing.T) {
+	s, clock, payments := newTestQRService(t)
+	qr := dynamicQR(t, s, 25000, "")
+
+	clock.Advance(15 * time.Minute)
+	_, err := payQR(s, qr.Payload)
+	assertErrorCode(t, err, CodeInvalidQRPayload)
+	if len(payments.requests) != 0 {
+		t.Fatalf("expired code posted %d payments", len(payments.requests))
+	}
+}
+
+func TestQRRejectsCodesThatWereNotIssued(t *testing.T) {
+	s, _, payments := newTestQRService(t)
+	qr := dynamicQR(t, s, 25000, "order42")
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"changed amount", withField(t, qr.Payload, emvAmount, "1000")},
+		{"changed currency", withField(t, qr.Payload, emvCurrency, "840")},
+		{"unknown reference", withField(t, qr.Payload, emvAdditionalData, util.EncodeEMV([]util.EMVField{{ID: emvReferenceLabel, Value: "order43"}}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := payQR(s, tt.payload)
+			assertErrorCode(t, err, CodeInvalidQRPayload)
+		})
+	}
+	if len(payments.requests) != 0 {
+		t.Fatalf("posted %d payments for codes that were not issued", len(payments.requests))
+	}
+
+	// The genuine code can still be paid.
+	if _, err := payQR(s, qr.Payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQRRequestMustMatchDynamicCode(t *testing.T) {
+	s, _, _ := newTestQRService(t)
+	qr := dynamicQR(t, s, 25000, "order42")
+
+	_, err := s.PayQR(models.QRPaymentRequest{CustomerID: "2", Payload: qr.Payload, Amount: 1000, TransactionID: "other"})
+	assertFieldError(t, err, KindValidation, "amount", "transaction_id")
+	if _, err := s.PayQR(models.QRPaymentRequest{CustomerID: "2", Payload: qr.Payload, Amount: 25000, TransactionID: "1-order42"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQRReferenceIsUniquePerMerchant(t *testing.T) {
+	s, _, _ := newTestQRService(t)
+	dynamicQR(t, s, 25000, "order42")
+
+	_, err := s.GenerateMerchantQR(merchantCaller, "1", dto.MerchantQRQuery{Amount: 30000, Reference: "order42"})
+	assertFieldError(t, err, KindValidation, "reference")
+}
+
+func TestQRRejectedPaymentReleasesCode(t *testing.T) {
+	s, _, payments := newTestQRService(t)
+	qr := dynamicQR(t, s, 25000, "order42")
+
+	payments.err = errors.New("customer not logged in")
+	if _, err := payQR(s, qr.Payload); err == nil {
+		t.Fatal("payment error was swallowed")
+	}
+	payments.err = nil
+	if _, err := payQR(s, qr.Payload); err != nil {
+		t.Fatalf("code was not released: %v", err)
+	}
+}
+
+func TestQRStaticCodeNeedsNoIssuing(t *testing.T) {
+	s, _, payments := newTestQRService(t)
+	qr, err := s.GenerateMerchantQR(merchantCaller, "1", dto.MerchantQRQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qr.ExpiresAt != "" {
+		t.Fatalf("static code expires at %s", qr.ExpiresAt)
+	}
+	for _, id := range []string{"tx1", "tx2"} {
+		if _, err := s.PayQR(models.QRPaymentRequest{CustomerID: "2", Payload: qr.Payload, TransactionID: id, Amount: 1000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(payments.requests) != 2 {
+		t.Fatalf("posted %d payments, want 2", len(payments.requests))
+	}
+}
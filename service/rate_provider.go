@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"merchant-bank-api/models"
+	"merchant-bank-api/util"
+)
+
+// RateProvider supplies the exchange rates payments are converted at.
+type RateProvider interface {
+	// Rate returns the rate to convert one unit of from into to, or a validation error if either
+	// currency is not supported.
+	Rate(from, to string) (models.FXRate, error)
+}
+
+// fileRateProvider is a RateProvider reading a rate table from a JSON file.
+// The file is read on every call, so updated rates apply without a restart.
+type fileRateProvider struct {
+	path string
+}
+
+// Rate looks both currencies up in the rate table and crosses their rates through the table's base currency.
+func (p *fileRateProvider) Rate(from, to string) (models.FXRate, error) {
+	var table models.RateTable
+	if p.path != "" {
+		if err := util.ReadJSONFile(p.path, &table); err != nil {
+			return models.FXRate{}, fmt.Errorf("failed to read exchange rates: %v", err)
+		}
+	}
+
+	fromRate, err := tableRate(table, from)
+	if err != nil {
+		return models.FXRate{}, err
+	}
+	toRate, err := tableRate(table, to)
+	if err != nil {
+		return models.FXRate{}, err
+	}
+	return models.FXRate{From: from, To: to, Rate: toRate / fromRate, Provider: "file", AsOf: table.AsOf}, nil
+}
+
+// tableRate returns how many units of the currency one unit of the table's base currency buys.
+func tableRate(table models.RateTable, currency string) (float64, error) {
+	if currency == table.Base {
+		return 1, nil
+	}
+	rate, ok := table.Rates[currency]
+	if !ok || rate <= 0 {
+		return 0, NewUnsupportedCurrencyError(currency)
+	}
+	return rate, nil
+}
+
+// NewFileRateProvider creates a RateProvider backed by the rate table at path.
+// Without a path no currency can be converted.
+func NewFileRateProvider(path string) RateProvider {
+	return &fileRateProvider{path: path}
+}
+
+// convertAmount converts an amount from one currency into another at the provider's current
+// rate and rounds the result half to even to the minor unit of the target currency.
+// Amounts in the same currency are returned unchanged without a conversion record.
+func convertAmount(rates RateProvider, amount float64, from, to string) (float64, *models.FXConversion, error) {
+	if from == to {
+		return amount, nil, nil
+	}
+	rate, err := rates.Rate(from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	unrounded := amount * rate.Rate
+	return roundToCurrency(unrounded, to), &models.FXConversion{
+		FXRate:          rate,
+		UnroundedAmount: unrounded,
+		Rounding:        models.RoundingHalfEven,
+		Decimals:        models.CurrencyDecimals(to),
+		ConvertedAt:     time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// reportingConverter converts payment amounts into the reporting currency limits, risk rules and
+// AML thresholds are expressed in, so that payments in different currencies can be compared and
+// added up. Each rate is looked up once, so a converter serves a single check or report.
+type reportingConverter struct {
+	rates    RateProvider
+	currency string
+	factors  map[string]float64
+}
+
+// newReportingConverter creates a converter into the reporting currency at the provider's current rates.
+func newReportingConverter(rates RateProvider, currency string) *reportingConverter {
+	return &reportingConverter{rates: rates, currency: currency, factors: map[string]float64{}}
+}
+
+// convert returns the amount in the reporting currency, unrounded. An empty currency is DefaultCurrency.
+func (c *reportingConverter) convert(amount float64, currency string) (float64, error) {
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	if currency == c.currency {
+		return amount, nil
+	}
+	factor, ok := c.factors[currency]
+	if !ok {
+		rate, err := c.rates.Rate(currency, c.currency)
+		if err != nil {
+			return 0, err
+		}
+		factor = rate.Rate
+		c.factors[currency] = factor
+	}
+	return amount * factor, nil
+}
+
+// paymentAmount returns the payment's amount in the reporting currency.
+func (c *reportingConverter) paymentAmount(payment models.Payment) (float64, error) {
+	return c.convert(payment.Amount, payment.GetCurrency())
+}
+
+// roundToCurrency rounds an amount half to even to the minor unit of the currency.
+func roundToCurrency(amount float64, currency string) float64 {
+	scale := math.Pow10(models.CurrencyDecimals(currency))
+	return math.RoundToEven(amount*scale) / scale
+}
+
+// checkCurrencyPrecision rejects amounts with more decimal places than the currency's minor unit.
+func checkCurrencyPrecision(amount float64, currency string) error {
+	scaled := amount * math.Pow10(models.CurrencyDecimals(currency))
+	if math.Abs(scaled-math.Round(scaled)) < 1e-6 {
+		return nil
+	}
+	message := fmt.Sprintf("must have at most %d decimal places in %s", models.CurrencyDecimals(currency), currency)
+	if models.CurrencyDecimals(currency) == 0 {
+		message = "must be a whole amount in " + currency
+	}
+	return NewValidationError("invalid amount", []util.FieldError{{Field: "amount", Rule: "currency_precision", Message: message}})
+}
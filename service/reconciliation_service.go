@@ -0,0 +1,485 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// reconciliationsFile stores the reconciliation reports.
+const reconciliationsFile = "database/reconciliations.json"
+
+// settlementFileColumns maps the accepted header names of an acquirer settlement file to its columns.
+var settlementFileColumns = map[string]string{
+	"transaction_id":   "transaction_id",
+	"amount":           "amount",
+	"currency":         "currency",
+	"date":             "date",
+	"transaction_date": "date",
+}
+
+// currencyPattern matches a three letter currency code.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ReconciliationService defines the interface of reconciling acquirer settlement files with the payments.
+type ReconciliationService interface {
+	// Import parses a settlement file, reconciles it with the captured payments and stores the report.
+	Import(fileName string, file io.Reader, importedBy string) (models.Reconciliation, error)
+	// ImportStatement parses a camt.053 bank statement, reconciles it with the captured payments
+	// and submitted payouts and stores the report.
+	ImportStatement(fileName string, file io.Reader, importedBy string) (models.Reconciliation, error)
+	// GetReconciliations returns the summaries of every report, newest first.
+	GetReconciliations() ([]models.Reconciliation, error)
+	// GetReconciliation returns a report with its items, optionally only those of one status.
+	GetReconciliation(id string, filter dto.ReconciliationItemFilter) (models.Reconciliation, error)
+}
+
+// reconciliationService is a concrete implementation of the ReconciliationService interface.
+// Dates are compared in the settlement time zone; the mutex serialises updates of the reports file.
+type reconciliationService struct {
+	settlements SettlementService
+	location    *time.Location
+	mu          sync.Mutex
+}
+
+// settlementLine is a parsed line of a settlement file.
+type settlementLine struct {
+	line          int
+	transactionID string
+	amount        float64
+	currency      string
+	date          string
+}
+
+// capturedPayment is a payment that can appear in a settlement file, with its capture date.
+type capturedPayment struct {
+	payment models.Payment
+	date    string
+}
+
+// Import reconciles the file's lines with the payments captured in the file's period.
+func (s *reconciliationService) Import(fileName string, file io.Reader, importedBy string) (models.Reconciliation, error) {
+	lines, err := parseSettlementFile(file, s.location)
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	report := newReconciliation(models.ReconciliationSourceCSV, fileName, importedBy, lines)
+	if err := s.reconcilePayments(&report, lines); err != nil {
+		return models.Reconciliation{}, err
+	}
+	return s.save(report)
+}
+
+// ImportStatement reconciles a camt.053 statement. Credits are reconciled with the captured
+// payments like the lines of a settlement file; debits are reconciled with the submitted payouts
+// by end to end ID, and the payouts they match are marked paid.
+func (s *reconciliationService) ImportStatement(fileName string, file io.Reader, importedBy string) (models.Reconciliation, error) {
+	entries, err := parseCamt053(file, s.location)
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	var all, credits, debits []settlementLine
+	for _, entry := range entries {
+		line := settlementLine{line: entry.number, transactionID: entry.reference, amount: entry.amount, currency: entry.currency, date: entry.date}
+		all = append(all, line)
+		if entry.credit {
+			credits = append(credits, line)
+		} else {
+			debits = append(debits, line)
+		}
+	}
+
+	report := newReconciliation(models.ReconciliationSourceCamt053, fileName, importedBy, all)
+	if err := s.reconcilePayments(&report, credits); err != nil {
+		return models.Reconciliation{}, err
+	}
+	if err := s.reconcilePayouts(&report, debits); err != nil {
+		return models.Reconciliation{}, err
+	}
+	return s.save(report)
+}
+
+// GetReconciliations returns the reports without their items.
+func (s *reconciliationService) GetReconciliations() ([]models.Reconciliation, error) {
+	reports, err := s.loadReports()
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		reports[i].Items = nil
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].ImportedAt > reports[j].ImportedAt
+	})
+	return reports, nil
+}
+
+// GetReconciliation returns the report with the ID, or a not found error.
+func (s *reconciliationService) GetReconciliation(id string, filter dto.ReconciliationItemFilter) (models.Reconciliation, error) {
+	reports, err := s.loadReports()
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	for _, report := range reports {
+		if report.ID != id {
+			continue
+		}
+		if filter.Status != "" {
+			items := []models.ReconciliationItem{}
+			for _, item := range report.Items {
+				if item.Status == filter.Status {
+					items = append(items, item)
+				}
+			}
+			report.Items = items
+		}
+		return report, nil
+	}
+	return models.Reconciliation{}, NewNotFoundError(CodeReconciliationNotFound, "reconciliation not found")
+}
+
+// NewReconciliationService creates a new instance of reconciliationService that dates payments
+// in the given time zone and confirms payouts with the SettlementService.
+func NewReconciliationService(location *time.Location, settlements SettlementService) ReconciliationService {
+	if location == nil {
+		location = time.Local
+	}
+	return &reconciliationService{settlements: settlements, location: location}
+}
+
+// newReconciliation starts the report of a file, with a period spanning the dates of its lines.
+func newReconciliation(source, fileName, importedBy string, lines []settlementLine) models.Reconciliation {
+	report := models.Reconciliation{
+		ID:         util.NewID("rc_"),
+		Source:     source,
+		FileName:   fileName,
+		PeriodFrom: lines[0].date,
+		PeriodTo:   lines[0].date,
+		Items:      []models.ReconciliationItem{},
+		ImportedBy: importedBy,
+		ImportedAt: time.Now().Format(time.RFC3339),
+	}
+	report.Summary.Lines = len(lines)
+	for _, line := range lines {
+		report.PeriodFrom = min(report.PeriodFrom, line.date)
+		report.PeriodTo = max(report.PeriodTo, line.date)
+	}
+	return report
+}
+
+// reconcilePayments adds the items of lines reconciled with the captured payments. Lines are
+// matched by transaction ID; lines whose ID is unknown fall back to a payment of the same amount
+// and date. Captured payments of the report's period that no line matched are missing.
+func (s *reconciliationService) reconcilePayments(report *models.Reconciliation, lines []settlementLine) error {
+	payments, err := loadPayments()
+	if err != nil {
+		return fmt.Errorf("failed to read payments: %v", err)
+	}
+
+	captured := map[string]capturedPayment{}
+	var inPeriod []capturedPayment
+	for _, payment := range payments {
+		if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusRefunded {
+			continue
+		}
+		capturedAt, _ := capturedGross(payment)
+		at, err := time.Parse(time.RFC3339, capturedAt)
+		if err != nil {
+			continue
+		}
+		entry := capturedPayment{payment: payment, date: at.In(s.location).Format(businessDateLayout)}
+		captured[payment.TransactionID] = entry
+		if entry.date >= report.PeriodFrom && entry.date <= report.PeriodTo {
+			inPeriod = append(inPeriod, entry)
+		}
+	}
+
+	used := map[string]bool{}
+	items := make([]models.ReconciliationItem, len(lines))
+	var unresolved []int
+	for i, line := range lines {
+		entry, ok := captured[line.transactionID]
+		if !ok || used[line.transactionID] {
+			unresolved = append(unresolved, i)
+			continue
+		}
+		used[line.transactionID] = true
+		items[i] = reconcileLine(line, entry)
+	}
+	for _, i := range unresolved {
+		line := lines[i]
+		items[i] = extraItem(line)
+		for _, entry := range inPeriod {
+			if used[entry.payment.TransactionID] || entry.date != line.date {
+				continue
+			}
+			if item := reconcileLine(line, entry); item.Status == models.ReconciliationMatched {
+				used[entry.payment.TransactionID] = true
+				items[i] = item
+				break
+			}
+		}
+	}
+	for _, entry := range inPeriod {
+		if !used[entry.payment.TransactionID] {
+			items = append(items, models.ReconciliationItem{
+				Status:          models.ReconciliationMissing,
+				TransactionID:   entry.payment.TransactionID,
+				PaymentAmount:   entry.payment.Amount,
+				PaymentCurrency: entry.payment.GetCurrency(),
+				PaymentDate:     entry.date,
+			})
+		}
+	}
+	report.Items = append(report.Items, items...)
+	return nil
+}
+
+// reconcilePayouts adds the items of statement debits reconciled with the submitted payouts. A
+// debit matching its payout's amount marks the payout paid; payouts submitted for a value date in
+// the report's period that no debit matched are missing.
+func (s *reconciliationService) reconcilePayouts(report *models.Reconciliation, debits []settlementLine) error {
+	used := map[string]bool{}
+	for _, line := range debits {
+		payout, err := s.settlements.GetPayout(line.transactionID)
+		if err != nil {
+			if de, ok := AsDomainError(err); !ok || de.Kind != KindNotFound {
+				return err
+			}
+		}
+		if err != nil || payout.Status == models.PayoutPending || used[payout.ID] {
+			report.Items = append(report.Items, extraItem(line))
+			continue
+		}
+
+		used[payout.ID] = true
+		item := models.ReconciliationItem{
+			Status:          models.ReconciliationMatched,
+			PayoutID:        payout.ID,
+			Line:            line.line,
+			FileAmount:      line.amount,
+			FileCurrency:    line.currency,
+			FileDate:        line.date,
+			PaymentAmount:   payout.Amount,
+			PaymentCurrency: payout.Currency,
+			PaymentDate:     payout.ValueDate,
+		}
+		if !sameAmount(&item) {
+			item.Status = models.ReconciliationAmountMismatch
+		} else if _, err := s.settlements.ConfirmPayout(payout.ID, line.date); err != nil {
+			return err
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	for date := report.PeriodFrom; date <= report.PeriodTo; date = nextBusinessDate(date) {
+		payouts, err := s.settlements.GetPayouts(previousBusinessDate(date))
+		if err != nil {
+			return err
+		}
+		for _, payout := range payouts {
+			if payout.Status == models.PayoutSubmitted && !used[payout.ID] && payout.ValueDate == date {
+				report.Items = append(report.Items, models.ReconciliationItem{
+					Status:          models.ReconciliationMissing,
+					PayoutID:        payout.ID,
+					PaymentAmount:   payout.Amount,
+					PaymentCurrency: payout.Currency,
+					PaymentDate:     payout.ValueDate,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// save counts the report's items by status and stores the report.
+func (s *reconciliationService) save(report models.Reconciliation) (models.Reconciliation, error) {
+	for _, item := range report.Items {
+		switch item.Status {
+		case models.ReconciliationMatched:
+			report.Summary.Matched++
+		case models.ReconciliationMissing:
+			report.Summary.Missing++
+		case models.ReconciliationExtra:
+			report.Summary.Extra++
+		case models.ReconciliationAmountMismatch:
+			report.Summary.AmountMismatch++
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports, err := s.loadReports()
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	if err := util.WriteJSONFile(reconciliationsFile, append(reports, report)); err != nil {
+		return models.Reconciliation{}, fmt.Errorf("failed to save reconciliations: %v", err)
+	}
+	return report, nil
+}
+
+// loadReports reads the reconciliations file.
+func (s *reconciliationService) loadReports() ([]models.Reconciliation, error) {
+	reports := []models.Reconciliation{}
+	if err := util.ReadJSONFile(reconciliationsFile, &reports); err != nil {
+		return nil, fmt.Errorf("failed to read reconciliations: %v", err)
+	}
+	return reports, nil
+}
+
+// reconcileLine compares a line with its payment.
+func reconcileLine(line settlementLine, entry capturedPayment) models.ReconciliationItem {
+	item := models.ReconciliationItem{
+		Status:          models.ReconciliationMatched,
+		TransactionID:   entry.payment.TransactionID,
+		Line:            line.line,
+		FileAmount:      line.amount,
+		FileCurrency:    line.currency,
+		FileDate:        line.date,
+		PaymentAmount:   entry.payment.Amount,
+		PaymentCurrency: entry.payment.GetCurrency(),
+		PaymentDate:     entry.date,
+	}
+	if !sameAmount(&item) {
+		item.Status = models.ReconciliationAmountMismatch
+	}
+	return item
+}
+
+// sameAmount reports whether an item's file and payment amounts agree: they are in the same
+// currency and differ by less than half the currency's minor unit. A line without a currency is
+// taken to be in the payment's currency. The difference is filled in when the currencies agree.
+func sameAmount(item *models.ReconciliationItem) bool {
+	if item.FileCurrency == "" {
+		item.FileCurrency = item.PaymentCurrency
+	}
+	if item.FileCurrency != item.PaymentCurrency {
+		return false
+	}
+	item.Difference = roundToCurrency(item.FileAmount-item.PaymentAmount, item.PaymentCurrency)
+	return math.Abs(item.FileAmount-item.PaymentAmount) < 0.5*math.Pow10(-models.CurrencyDecimals(item.PaymentCurrency))
+}
+
+// extraItem reports a line that matches nothing.
+func extraItem(line settlementLine) models.ReconciliationItem {
+	return models.ReconciliationItem{
+		Status:        models.ReconciliationExtra,
+		TransactionID: line.transactionID,
+		Line:          line.line,
+		FileAmount:    line.amount,
+		FileCurrency:  line.currency,
+		FileDate:      line.date,
+	}
+}
+
+// nextBusinessDate and previousBusinessDate step a business date by one day.
+func nextBusinessDate(date string) string {
+	day, _ := time.Parse(businessDateLayout, date)
+	return day.AddDate(0, 0, 1).Format(businessDateLayout)
+}
+
+func previousBusinessDate(date string) string {
+	day, _ := time.Parse(businessDateLayout, date)
+	return day.AddDate(0, 0, -1).Format(businessDateLayout)
+}
+
+// parseSettlementFile reads the lines of a settlement CSV file. The header names the columns:
+// transaction_id, amount and date (or transaction_date) are required and currency is optional.
+// Dates are either YYYY-MM-DD or RFC 3339 timestamps, which are dated in the location.
+func parseSettlementFile(file io.Reader, location *time.Location) ([]settlementLine, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, NewValidationError("invalid settlement file", []util.FieldError{{Field: "file", Rule: "required", Message: "is empty"}})
+	}
+	if err != nil {
+		return nil, NewMalformedError("settlement file is not valid CSV", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if column, ok := settlementFileColumns[name]; ok {
+			columns[column] = i
+		}
+	}
+	var fields []util.FieldError
+	for _, column := range []string{"transaction_id", "amount", "date"} {
+		if _, ok := columns[column]; !ok {
+			fields = append(fields, util.FieldError{Field: "header." + column, Rule: "required", Message: "column is required"})
+		}
+	}
+	if len(fields) > 0 {
+		return nil, NewValidationError("invalid settlement file", fields)
+	}
+
+	value := func(row []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	var lines []settlementLine
+	for number := 2; ; number++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, NewMalformedError("settlement file is not valid CSV", err)
+		}
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+
+		field := fmt.Sprintf("lines[%d]", number)
+		line := settlementLine{line: number, transactionID: value(row, "transaction_id"), currency: strings.ToUpper(value(row, "currency"))}
+		amount, err := strconv.ParseFloat(value(row, "amount"), 64)
+		if err != nil || amount <= 0 {
+			fields = append(fields, util.FieldError{Field: field + ".amount", Rule: "money", Message: "must be a positive amount"})
+		}
+		line.amount = amount
+		if line.currency != "" && !currencyPattern.MatchString(line.currency) {
+			fields = append(fields, util.FieldError{Field: field + ".currency", Rule: "iso4217", Message: "must be a three letter currency code"})
+		}
+		if line.date, err = settlementFileDate(value(row, "date"), location); err != nil {
+			fields = append(fields, util.FieldError{Field: field + ".date", Rule: "datetime", Message: "must be a date in the format 2006-01-02"})
+		}
+		lines = append(lines, line)
+	}
+	if len(fields) > 0 {
+		return nil, NewValidationError("invalid settlement file", fields)
+	}
+	if len(lines) == 0 {
+		return nil, NewValidationError("invalid settlement file", []util.FieldError{{Field: "file", Rule: "required", Message: "has no lines"}})
+	}
+	return lines, nil
+}
+
+// settlementFileDate returns the business date of a settlement file date or timestamp.
+func settlementFileDate(value string, location *time.Location) (string, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at.In(location).Format(businessDateLayout), nil
+	}
+	day, err := time.Parse(businessDateLayout, value)
+	if err != nil {
+		return "", err
+	}
+	return day.Format(businessDateLayout), nil
+}
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRiskScore caps the sum of the triggered rule scores.
+const maxRiskScore = 100
+
+// RiskService defines the interface of the payment risk engine and its manual review queue.
+type RiskService interface {
+	// Assess scores a payment request against the risk rules and decides whether to allow, review or block it.
+	// pending are checked payments of the same checkout that are not stored yet, such as the earlier
+	// legs of a split payment; velocity rules count them like stored payments.
+	Assess(request models.PaymentRequest, pending []models.Payment) (models.RiskAssessment, error)
+	// GetReviewQueue returns a page of the payments held for review, oldest first.
+	GetReviewQueue(filter dto.ReviewQueueFilter) (dto.PaymentPage, error)
+	// ReviewPayment approves or rejects a payment held for review.
+	ReviewPayment(caller dto.Caller, transactionID string, review dto.ReviewRequest, meta models.RequestMeta) (models.Payment, error)
+}
+
+// riskService is a concrete implementation of the RiskService interface.
+// Rule amounts are in the reporting currency, and payment amounts are converted into it with the RateProvider.
+type riskService struct {
+	rules    models.RiskRules
+	checks   []riskCheck
+	outbox   OutboxService
+	fees     FeeService
+	rates    RateProvider
+	currency string
+}
+
+// riskCheck is a validated risk rule ready to be evaluated.
+type riskCheck struct {
+	models.RiskRule
+	window   time.Duration
+	start    int
+	end      int
+	location *time.Location
+}
+
+// Assess evaluates every rule against the request and the stored payments, adding the pending
+// ones for the velocity rules. The score is the sum of the triggered rules' scores, capped at 100.
+func (s *riskService) Assess(request models.PaymentRequest, pending []models.Payment) (models.RiskAssessment, error) {
+	payments, err := loadPayments()
+	if err != nil {
+		return models.RiskAssessment{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+	recent := append(append([]models.Payment{}, payments...), pending...)
+
+	converter := newReportingConverter(s.rates, s.currency)
+	amount, err := converter.convert(request.Amount, request.Currency)
+	if err != nil {
+		return models.RiskAssessment{}, err
+	}
+
+	now := time.Now()
+	assessment := models.RiskAssessment{Decision: models.RiskDecisionAllow, AssessedAt: now.Format(time.RFC3339)}
+	for _, check := range s.checks {
+		counted := payments
+		if check.Type == models.RiskRuleVelocity {
+			counted = recent
+		}
+		triggered, err := check.triggered(request, amount, counted, converter, now)
+		if err != nil {
+			return models.RiskAssessment{}, err
+		}
+		if triggered {
+			assessment.Score += check.Score
+			assessment.TriggeredRules = append(assessment.TriggeredRules, check.Name)
+		}
+	}
+	if assessment.Score > maxRiskScore {
+		assessment.Score = maxRiskScore
+	}
+
+	switch {
+	case assessment.Score >= s.rules.BlockScore:
+		assessment.Decision = models.RiskDecisionBlock
+	case assessment.Score >= s.rules.ReviewScore:
+		assessment.Decision = models.RiskDecisionReview
+	}
+	return assessment, nil
+}
+
+// GetReviewQueue returns the payments waiting for review, oldest first, so they are reviewed in arrival order.
+func (s *riskService) GetReviewQueue(filter dto.ReviewQueueFilter) (dto.PaymentPage, error) {
+	payments, err := loadPayments()
+	if err != nil {
+		return dto.PaymentPage{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		return paymentSortKeyLess(payments[i], payments[j])
+	})
+
+	var after *models.Payment
+	if filter.Cursor != "" {
+		parts, err := util.DecodeCursor(filter.Cursor, 2)
+		if err != nil {
+			return dto.PaymentPage{}, invalidCursorError()
+		}
+		after = &models.Payment{Timestamp: parts[0], TransactionID: parts[1]}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	page := dto.PaymentPage{Data: []models.Payment{}}
+	for _, payment := range payments {
+		if after != nil && !paymentSortKeyLess(*after, payment) {
+			continue
+		}
+		if payment.Status != models.PaymentStatusPendingReview {
+			continue
+		}
+		if filter.MerchantID != "" && payment.MerchantID != filter.MerchantID {
+			continue
+		}
+		if len(page.Data) == limit {
+			last := page.Data[len(page.Data)-1]
+			page.NextCursor = util.EncodeCursor(last.Timestamp, last.TransactionID)
+			break
+		}
+		page.Data = append(page.Data, payment)
+	}
+
+	return page, nil
+}
+
+// ReviewPayment records the review outcome on a held payment and records its payment.reviewed event.
+// Approved payments succeed and are captured with the merchant's fee; rejected payments fail.
+// Reviewing a leg of a split payment reviews every leg of the split, so the legs keep sharing
+// their status, and the reviewed leg is returned.
+func (s *riskService) ReviewPayment(caller dto.Caller, transactionID string, review dto.ReviewRequest, meta models.RequestMeta) (models.Payment, error) {
+	metadata := meta.Metadata()
+	metadata["review_decision"] = review.Decision
+	event := models.OutboxEvent{
+		Type:          models.EventPaymentReviewed,
+		Actor:         callerParty(caller),
+		Metadata:      metadata,
+		CorrelationID: meta.CorrelationID,
+	}
+	changed, err := s.outbox.CommitPaymentChanges(event, func(payments []models.Payment) ([]models.Payment, []models.Payment, error) {
+		i := findPayment(payments, transactionID)
+		if i < 0 {
+			return nil, nil, NewNotFoundError(CodePaymentNotFound, "payment not found")
+		}
+		if payments[i].Status != models.PaymentStatusPendingReview {
+			return nil, nil, NewConflictError(CodePaymentNotPendingReview, "payment is not waiting for review")
+		}
+
+		reviewed := []int{i}
+		if splitID := payments[i].SplitID; splitID != "" {
+			reviewed = reviewed[:0]
+			for j := range payments {
+				if payments[j].SplitID == splitID && payments[j].Status == models.PaymentStatusPendingReview {
+					reviewed = append(reviewed, j)
+				}
+			}
+		}
+
+		var changed []models.Payment
+		for _, j := range reviewed {
+			if err := s.review(&payments[j], caller, review); err != nil {
+				return nil, nil, err
+			}
+			changed = append(changed, payments[j])
+		}
+		return payments, changed, nil
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+	for _, payment := range changed {
+		if payment.TransactionID == transactionID {
+			return payment, nil
+		}
+	}
+	return models.Payment{}, NewNotFoundError(CodePaymentNotFound, "payment not found")
+}
+
+// review applies a review decision to a held payment.
+func (s *riskService) review(payment *models.Payment, caller dto.Caller, review dto.ReviewRequest) error {
+	payment.Status = models.PaymentStatusSucceeded
+	if review.Decision == models.ReviewReject {
+		payment.Status = models.PaymentStatusFailed
+	} else if err := s.fees.Capture(payment); err != nil {
+		return err
+	}
+	if payment.Risk == nil {
+		payment.Risk = &models.RiskAssessment{}
+	}
+	payment.Risk.Review = &models.RiskReview{
+		Decision:   review.Decision,
+		Note:       review.Note,
+		ReviewedBy: caller.UserID,
+		ReviewedAt: time.Now().Format(time.RFC3339),
+	}
+	payment.Version++
+	return nil
+}
+
+// NewRiskService creates a new instance of riskService with the rules loaded from the configured
+// rules file. Without a rules file every payment is allowed. Approved payments are captured with the FeeService.
+// Rule amounts are in the reporting currency, and payment amounts are converted with the RateProvider.
+func NewRiskService(conf config.RiskConfig, outbox OutboxService, fees FeeService, rates RateProvider, reportingCurrency string) (RiskService, error) {
+	rules := models.RiskRules{}
+	if conf.RulesFile != "" {
+		loaded, err := LoadRiskRules(conf.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = loaded
+	}
+	checks, err := compileRiskRules(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid risk rules in %s: %v", conf.RulesFile, err)
+	}
+	if rules.ReviewScore <= 0 {
+		rules.ReviewScore = maxRiskScore + 1
+	}
+	if rules.BlockScore <= 0 {
+		rules.BlockScore = maxRiskScore + 1
+	}
+	return &riskService{rules: rules, checks: checks, outbox: outbox, fees: fees, rates: rates, currency: reportingCurrency}, nil
+}
+
+// LoadRiskRules reads a risk rules file. Files ending in .json are read as JSON and anything else
+// as YAML. Unknown fields are rejected so a misspelt setting does not silently disable a rule.
+func LoadRiskRules(path string) (models.RiskRules, error) {
+	var rules models.RiskRules
+	if err := decodeRulesFile(path, &rules); err != nil {
+		return rules, fmt.Errorf("failed to load risk rules: %v", err)
+	}
+	return rules, nil
+}
+
+// decodeRulesFile decodes a JSON (.json) or YAML rules file into v, rejecting unknown fields.
+func decodeRulesFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Ext(path) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(v)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// compileRiskRules validates the rules and prepares them for evaluation.
+func compileRiskRules(rules models.RiskRules) ([]riskCheck, error) {
+	if rules.ReviewScore < 0 || rules.BlockScore < 0 {
+		return nil, fmt.Errorf("scores must not be negative")
+	}
+	if rules.ReviewScore > 0 && rules.BlockScore > 0 && rules.BlockScore < rules.ReviewScore {
+		return nil, fmt.Errorf("block_score must not be lower than review_score")
+	}
+
+	checks := make([]riskCheck, 0, len(rules.Rules))
+	names := map[string]bool{}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Score <= 0 {
+			return nil, fmt.Errorf("rule %q: score must be positive", rule.Name)
+		}
+
+		check := riskCheck{RiskRule: rule}
+		switch rule.Type {
+		case models.RiskRuleAmount:
+			if rule.MinAmount <= 0 {
+				return nil, fmt.Errorf("rule %q: min_amount must be positive", rule.Name)
+			}
+		case models.RiskRuleVelocity:
+			window, err := time.ParseDuration(rule.Window)
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("rule %q: window must be a positive duration such as 10m", rule.Name)
+			}
+			if rule.MaxCount <= 0 && rule.MaxTotal <= 0 {
+				return nil, fmt.Errorf("rule %q: max_count or max_total is required", rule.Name)
+			}
+			check.window = window
+		case models.RiskRuleNewParty:
+			if !rule.Customer && !rule.Merchant {
+				return nil, fmt.Errorf("rule %q: customer or merchant must be set", rule.Name)
+			}
+			if rule.MaxPayments < 0 {
+				return nil, fmt.Errorf("rule %q: max_payments must not be negative", rule.Name)
+			}
+		case models.RiskRuleHours:
+			start, err := parseClock(rule.Start)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: start %v", rule.Name, err)
+			}
+			end, err := parseClock(rule.End)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: end %v", rule.Name, err)
+			}
+			location, err := time.LoadLocation(rule.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: unknown timezone %q", rule.Name, rule.Timezone)
+			}
+			check.start, check.end, check.location = start, end, location
+		default:
+			return nil, fmt.Errorf("rule %q: unknown type %q", rule.Name, rule.Type)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// parseClock parses a "15:04" time of day into minutes since midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("must be a time of day such as 22:30")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// triggered reports whether the rule fires for the request given the stored payments. amount is
+// the request's amount in the reporting currency, and the converter converts stored payments into it.
+func (c riskCheck) triggered(request models.PaymentRequest, amount float64, payments []models.Payment, converter *reportingConverter, now time.Time) (bool, error) {
+	switch c.Type {
+	case models.RiskRuleAmount:
+		return amount >= c.MinAmount, nil
+	case models.RiskRuleVelocity:
+		count, total := 0, 0.0
+		since := now.Add(-c.window)
+		for _, payment := range payments {
+			if payment.CustomerID != request.CustomerID {
+				continue
+			}
+			timestamp, err := time.Parse(time.RFC3339, payment.Timestamp)
+			if err != nil || timestamp.Before(since) {
+				continue
+			}
+			converted, err := converter.paymentAmount(payment)
+			if err != nil {
+				return false, err
+			}
+			count++
+			total += converted
+		}
+		return (c.MaxCount > 0 && count >= c.MaxCount) || (c.MaxTotal > 0 && total+amount > c.MaxTotal), nil
+	case models.RiskRuleNewParty:
+		customerPayments, merchantPayments := 0, 0
+		for _, payment := range payments {
+			if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusRefunded {
+				continue
+			}
+			if payment.CustomerID == request.CustomerID {
+				customerPayments++
+			}
+			if payment.MerchantID == request.MerchantID {
+				merchantPayments++
+			}
+		}
+		if c.Customer && customerPayments > c.MaxPayments {
+			return false, nil
+		}
+		if c.Merchant && merchantPayments > c.MaxPayments {
+			return false, nil
+		}
+		return true, nil
+	case models.RiskRuleHours:
+		local := now.In(c.location)
+		minute := local.Hour()*60 + local.Minute()
+		if c.start <= c.end {
+			return minute >= c.start && minute < c.end, nil
+		}
+		// The window wraps around midnight, e.g. 22:00 to 05:00.
+		return minute >= c.start || minute < c.end, nil
+	default:
+		return false, nil
+	}
+}
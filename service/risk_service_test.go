@@ -0,0 +1,113 @@
+package service
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/util"
+)
+
+// newDefaultRiskService loads the shipped risk rules and seeded payments into a temporary
+// database and returns a risk service comparing amounts in IDR, with the seeded payments.
+func newDefaultRiskService(t *testing.T) (RiskService, []models.Payment) {
+	t.Helper()
+	rulesFile, err := filepath.Abs("../config/risk_rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratesFile, err := filepath.Abs("../database/fx_rates.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeded := []models.Payment{}
+	if err := util.ReadJSONFile("../database/payment.json", &seeded); err != nil {
+		t.Fatal(err)
+	}
+	if len(seeded) == 0 {
+		t.Fatal("no seeded payments")
+	}
+
+	useTempDatabase(t)
+	writeTestFile(t, paymentsFile, seeded)
+	s, err := NewRiskService(config.RiskConfig{RulesFile: rulesFile}, nil, nil, NewFileRateProvider(ratesFile), "IDR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, seeded
+}
+
+func TestDefaultRiskRulesAllowSeededPayments(t *testing.T) {
+	s, seeded := newDefaultRiskService(t)
+
+	for _, payment := range seeded {
+		assessment, err := s.Assess(models.PaymentRequest{TransactionID: "new-" + payment.TransactionID, CustomerID: payment.CustomerID, MerchantID: payment.MerchantID, Amount: payment.Amount, Currency: "IDR"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assessment.Decision != models.RiskDecisionAllow {
+			t.Errorf("payment of %.0f IDR was %s with rules %v", payment.Amount, assessment.Decision, assessment.TriggeredRules)
+		}
+	}
+
+	// A new customer's first payment of the same size may be reviewed but is never blocked.
+	assessment, err := s.Assess(models.PaymentRequest{TransactionID: "first", CustomerID: "99", MerchantID: "99", Amount: seeded[0].Amount, Currency: "IDR"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assessment.Decision == models.RiskDecisionBlock {
+		t.Errorf("new customer's payment was blocked with rules %v", assessment.TriggeredRules)
+	}
+}
+
+func TestDefaultRiskRulesBlockVeryHighAmounts(t *testing.T) {
+	s, seeded := newDefaultRiskService(t)
+
+	assessment, err := s.Assess(models.PaymentRequest{TransactionID: "large", CustomerID: seeded[0].CustomerID, MerchantID: seeded[0].MerchantID, Amount: 250000000, Currency: "IDR"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assessment.Decision != models.RiskDecisionBlock {
+		t.Errorf("payment of 250000000 IDR was %s with rules %v", assessment.Decision, assessment.TriggeredRules)
+	}
+
+	// Amounts in other currencies are converted into IDR before they are compared.
+	assessment, err = s.Assess(models.PaymentRequest{TransactionID: "usd", CustomerID: seeded[0].CustomerID, MerchantID: seeded[0].MerchantID, Amount: 100, Currency: "USD"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assessment.Decision != models.RiskDecisionAllow {
+		t.Errorf("payment of 100 USD was %s with rules %v", assessment.Decision, assessment.TriggeredRules)
+	}
+}
+
+func TestRiskVelocityCountsPendingPayments(t *testing.T) {
+	s, seeded := newDefaultRiskService(t)
+	request := models.PaymentRequest{TransactionID: "split-4", CustomerID: seeded[0].CustomerID, MerchantID: "4", Amount: 100000000, Currency: "IDR"}
+
+	assessment, err := s.Assess(request, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assessment.Decision != models.RiskDecisionAllow {
+		t.Fatalf("leg on its own was %s with rules %v", assessment.Decision, assessment.TriggeredRules)
+	}
+
+	// The earlier legs of the split take the customer's volume for the day over the limit.
+	now := time.Now().Format(time.RFC3339)
+	pending := []models.Payment{
+		{TransactionID: "split-1", CustomerID: request.CustomerID, MerchantID: "1", Amount: 150000000, Currency: "IDR", Timestamp: now},
+		{TransactionID: "split-2", CustomerID: request.CustomerID, MerchantID: "2", Amount: 150000000, Currency: "IDR", Timestamp: now},
+		{TransactionID: "split-3", CustomerID: request.CustomerID, MerchantID: "3", Amount: 150000000, Currency: "IDR", Timestamp: now},
+	}
+	assessment, err = s.Assess(request, pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(assessment.TriggeredRules, "customer_daily_volume") {
+		t.Fatalf("pending legs were not counted: rules %v", assessment.TriggeredRules)
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// scheduledPaymentsFile stores the scheduled payments.
+const scheduledPaymentsFile = "database/scheduled_payments.json"
+
+// ScheduledPaymentService defines the interface of payments customers schedule for a later time.
+type ScheduledPaymentService interface {
+	// Schedule stores a payment request to be executed at its execution time.
+	Schedule(paymentRequest models.PaymentRequest) (models.ScheduledPayment, error)
+	// GetScheduledPayments returns the scheduled payments the caller may see, soonest first.
+	GetScheduledPayments(caller dto.Caller, filter dto.ScheduledPaymentFilter) ([]models.ScheduledPayment, error)
+	// GetScheduledPayment returns one scheduled payment.
+	GetScheduledPayment(caller dto.Caller, id string) (models.ScheduledPayment, error)
+	// Cancel cancels a payment that has not been executed yet.
+	Cancel(caller dto.Caller, id string) (models.ScheduledPayment, error)
+	// ExecuteDue executes every scheduled payment whose time has come and returns them.
+	ExecuteDue() ([]models.ScheduledPayment, error)
+	// Start executes due payments in the background.
+	Start()
+	// Stop ends the background execution.
+	Stop()
+}
+
+// scheduledPaymentService is a concrete implementation of the ScheduledPaymentService interface.
+// It executes payments through the PaymentService and reads the time from its Clock. The mutex
+// serialises updates of the scheduled payments file, including whole execution runs, so a
+// payment cannot be canceled while it is being executed.
+type scheduledPaymentService struct {
+	conf  config.ScheduledPaymentConfig
+	ps    PaymentService
+	cs    CustomerService
+	ms    MerchantService
+	clock Clock
+	mu    sync.Mutex
+	stop  chan struct{}
+}
+
+// Schedule checks what can be checked ahead of time, namely the merchant, the amount in the
+// payment currency, which defaults to the customer's, and that the transaction ID is unused,
+// and stores the payment. Everything else is checked when it is executed.
+func (s *scheduledPaymentService) Schedule(paymentRequest models.PaymentRequest) (models.ScheduledPayment, error) {
+	now := s.clock.Now()
+	executeAt, err := time.Parse(time.RFC3339, paymentRequest.ExecuteAt)
+	if err != nil || !executeAt.After(now) || executeAt.After(now.Add(s.conf.MaxHorizon)) {
+		message := fmt.Sprintf("must be a future time at most %d days ahead", int(s.conf.MaxHorizon.Hours()/24))
+		return models.ScheduledPayment{}, NewValidationError("invalid execution time", []util.FieldError{{Field: "execute_at", Rule: "future", Message: message}})
+	}
+
+	customers, err := s.cs.GetAllCustomer()
+	if err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	var customer *models.Customer
+	for i := range customers {
+		if customers[i].ID == paymentRequest.CustomerID {
+			customer = &customers[i]
+		}
+	}
+	if customer == nil {
+		return models.ScheduledPayment{}, NewNotFoundError(CodeCustomerNotFound, "customer not found")
+	}
+	if _, err := s.ms.GetMerchant(paymentRequest.MerchantID); err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	if paymentRequest.Currency == "" {
+		paymentRequest.Currency = customer.GetCurrency()
+	}
+	if err := checkCurrencyPrecision(paymentRequest.Amount, paymentRequest.Currency); err != nil {
+		return models.ScheduledPayment{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled, err := loadScheduledPayments()
+	if err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return models.ScheduledPayment{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+	if findPayment(payments, paymentRequest.TransactionID) >= 0 {
+		return models.ScheduledPayment{}, NewConflictError(CodeDuplicateTransaction, "transaction ID has already been used")
+	}
+	for _, other := range scheduled {
+		if other.TransactionID == paymentRequest.TransactionID {
+			return models.ScheduledPayment{}, NewConflictError(CodeDuplicateTransaction, "transaction ID has already been used")
+		}
+	}
+
+	payment := models.ScheduledPayment{
+		ID:            util.NewID("sp_"),
+		TransactionID: paymentRequest.TransactionID,
+		CustomerID:    customer.ID,
+		MerchantID:    paymentRequest.MerchantID,
+		Amount:        paymentRequest.Amount,
+		Currency:      paymentRequest.Currency,
+		ExecuteAt:     executeAt.Format(time.RFC3339),
+		Status:        models.ScheduledPaymentScheduled,
+		CreatedAt:     now.Format(time.RFC3339),
+	}
+	if err := saveScheduledPayments(append(scheduled, payment)); err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	return payment, nil
+}
+
+// GetScheduledPayments returns a customer's or merchant's own scheduled payments, or every one
+// for admins, filtered by status, customer and merchant.
+func (s *scheduledPaymentService) GetScheduledPayments(caller dto.Caller, filter dto.ScheduledPaymentFilter) ([]models.ScheduledPayment, error) {
+	scheduled, err := loadScheduledPayments()
+	if err != nil {
+		return nil, err
+	}
+	result := []models.ScheduledPayment{}
+	for _, payment := range scheduled {
+		if !canViewScheduledPayment(caller, payment) {
+			continue
+		}
+		if filter.Status != "" && payment.Status != filter.Status {
+			continue
+		}
+		if (filter.CustomerID != "" && payment.CustomerID != filter.CustomerID) || (filter.MerchantID != "" && payment.MerchantID != filter.MerchantID) {
+			continue
+		}
+		result = append(result, payment)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExecuteAt < result[j].ExecuteAt
+	})
+	return result, nil
+}
+
+// GetScheduledPayment returns the scheduled payment with the ID if the caller may see it, or a
+// not found error.
+func (s *scheduledPaymentService) GetScheduledPayment(caller dto.Caller, id string) (models.ScheduledPayment, error) {
+	scheduled, err := loadScheduledPayments()
+	if err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	i := findScheduledPayment(scheduled, id)
+	if i < 0 || !canViewScheduledPayment(caller, scheduled[i]) {
+		return models.ScheduledPayment{}, NewNotFoundError(CodeScheduledPaymentNotFound, "scheduled payment not found")
+	}
+	return scheduled[i], nil
+}
+
+// Cancel cancels a payment that is still scheduled. Only its customer and admins may cancel it.
+func (s *scheduledPaymentService) Cancel(caller dto.Caller, id string) (models.ScheduledPayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled, err := loadScheduledPayments()
+	if err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	i := findScheduledPayment(scheduled, id)
+	if i < 0 || !canViewScheduledPayment(caller, scheduled[i]) {
+		return models.ScheduledPayment{}, NewNotFoundError(CodeScheduledPaymentNotFound, "scheduled payment not found")
+	}
+	if caller.Role != models.RoleCustomer && caller.Role != models.RoleAdmin {
+		return models.ScheduledPayment{}, NewForbiddenError(CodeForbidden, "only the customer and admins can cancel scheduled payments")
+	}
+	if scheduled[i].Status != models.ScheduledPaymentScheduled {
+		return models.ScheduledPayment{}, NewConflictError(CodeScheduleNotCancelable, "only payments that have not been executed can be canceled")
+	}
+
+	scheduled[i].Status = models.ScheduledPaymentCanceled
+	scheduled[i].CanceledAt = s.clock.Now().Format(time.RFC3339)
+	if err := saveScheduledPayments(scheduled); err != nil {
+		return models.ScheduledPayment{}, err
+	}
+	return scheduled[i], nil
+}
+
+// ExecuteDue posts every due payment through the payment flow, so it is checked against the
+// customer, merchant, risk rules, sanctions list, verification provider and limits as they are
+// at execution. A payment rejected outright fails with the error's code; one the payment service
+// cannot decide right now, such as when verification is unavailable, stays scheduled and is
+// tried again by the next run.
+func (s *scheduledPaymentService) ExecuteDue() ([]models.ScheduledPayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled, err := loadScheduledPayments()
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	executed := []models.ScheduledPayment{}
+	for i := range scheduled {
+		if scheduled[i].Status != models.ScheduledPaymentScheduled {
+			continue
+		}
+		if executeAt, err := time.Parse(time.RFC3339, scheduled[i].ExecuteAt); err != nil || executeAt.After(now) {
+			continue
+		}
+
+		if err := s.execute(&scheduled[i], now); err != nil {
+			log.Printf("Error executing scheduled payment %s: %v", scheduled[i].ID, err)
+			continue
+		}
+		executed = append(executed, scheduled[i])
+		// Saved after every payment so that a crash never executes one twice.
+		if err := saveScheduledPayments(scheduled); err != nil {
+			return executed, err
+		}
+	}
+	return executed, nil
+}
+
+// Start executes due payments right away and then every poll interval.
+func (s *scheduledPaymentService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.conf.PollInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.ExecuteDue(); err != nil {
+				log.Printf("Error executing scheduled payments: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the background execution.
+func (s *scheduledPaymentService) Stop() {
+	close(s.stop)
+}
+
+// NewScheduledPaymentService creates a new instance of scheduledPaymentService that executes
+// payments through the PaymentService, checks them ahead of time with the CustomerService and
+// MerchantService and tells the time with the Clock.
+func NewScheduledPaymentService(conf config.ScheduledPaymentConfig, ps PaymentService, cs CustomerService, ms MerchantService, clock Clock) ScheduledPaymentService {
+	return &scheduledPaymentService{conf: conf, ps: ps, cs: cs, ms: ms, clock: clock, stop: make(chan struct{})}
+}
+
+// execute posts a due payment and records the outcome. A payment stored before a crash is
+// picked up instead of being posted again. It returns an error only when the payment should be
+// tried again later.
+func (s *scheduledPaymentService) execute(scheduled *models.ScheduledPayment, now time.Time) error {
+	payments, err := loadPayments()
+	if err != nil {
+		return fmt.Errorf("failed to load payments: %v", err)
+	}
+	if i := findPayment(payments, scheduled.TransactionID); i >= 0 && payments[i].ScheduledPaymentID == scheduled.ID {
+		scheduled.Status = models.ScheduledPaymentExecuted
+		scheduled.PaymentStatus = payments[i].Status
+		scheduled.ExecutedAt = now.Format(time.RFC3339)
+		return nil
+	}
+
+	payment, err := s.ps.PostPayment(models.PaymentRequest{
+		TransactionID:      scheduled.TransactionID,
+		CustomerID:         scheduled.CustomerID,
+		MerchantID:         scheduled.MerchantID,
+		Amount:             scheduled.Amount,
+		Currency:           scheduled.Currency,
+		ScheduledPaymentID: scheduled.ID,
+	})
+	if err != nil {
+		de, ok := AsDomainError(err)
+		if !ok || de.Kind == KindUnavailable {
+			return err
+		}
+		scheduled.Status = models.ScheduledPaymentFailed
+		scheduled.Error = de.Code
+		scheduled.ExecutedAt = now.Format(time.RFC3339)
+		return nil
+	}
+	scheduled.Status = models.ScheduledPaymentExecuted
+	scheduled.PaymentStatus = payment.Status
+	scheduled.ExecutedAt = now.Format(time.RFC3339)
+	return nil
+}
+
+// canViewScheduledPayment reports whether the caller may see a scheduled payment: its customer,
+// its merchant and admins.
+func canViewScheduledPayment(caller dto.Caller, scheduled models.ScheduledPayment) bool {
+	return canViewPayment(caller, models.Payment{CustomerID: scheduled.CustomerID, MerchantID: scheduled.MerchantID})
+}
+
+// findScheduledPayment returns the index of the scheduled payment with the ID, or -1.
+func findScheduledPayment(scheduled []models.ScheduledPayment, id string) int {
+	for i, payment := range scheduled {
+		if payment.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadScheduledPayments reads the scheduled payments file.
+func loadScheduledPayments() ([]models.ScheduledPayment, error) {
+	scheduled := []models.ScheduledPayment{}
+	if err := util.ReadJSONFile(scheduledPaymentsFile, &scheduled); err != nil {
+		return nil, fmt.Errorf("failed to read scheduled payments: %v", err)
+	}
+	return scheduled, nil
+}
+
+// saveScheduledPayments writes the scheduled payments file.
+func saveScheduledPayments(scheduled []models.ScheduledPayment) error {
+	if err := util.WriteJSONFile(scheduledPaymentsFile, scheduled); err != nil {
+		return fmt.Errorf("failed to save scheduled payments: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// screeningHitsFile stores the recorded sanctions screening hits.
+const screeningHitsFile = "database/screening_hits.json"
+
+// maxScreeningMatches limits how many matches are reported for one name.
+const maxScreeningMatches = 5
+
+// ScreeningService defines the interface of sanctions list screening.
+type ScreeningService interface {
+	// Screen matches a subject's name against the sanctions list. Matches the subject's earlier
+	// hits were cleared of are left out, and a confirmed hit blocks the subject.
+	Screen(subject models.ScreeningSubject) (models.ScreeningResult, error)
+	// RecordHits stores the result's matches as open hits for manual review. A match already
+	// recorded for the subject is not recorded again.
+	RecordHits(subject models.ScreeningSubject, context, transactionID string, result models.ScreeningResult) error
+	// ScreenPayment screens the paying customer and the merchant and records their hits.
+	ScreenPayment(customer models.Customer, merchant models.Merchant, transactionID string) (models.ScreeningResult, error)
+	// GetHits returns the recorded hits matching the filter, newest first.
+	GetHits(filter dto.ScreeningHitFilter) ([]models.ScreeningHit, error)
+	// ResolveHit settles an open hit as cleared or confirmed.
+	ResolveHit(caller dto.Caller, id string, resolution dto.HitResolution) (models.ScreeningHit, error)
+}
+
+// screeningEntry is a sanctions list entry with its names prepared for matching.
+type screeningEntry struct {
+	models.SanctionsEntry
+	names  []string
+	tokens [][]string
+}
+
+// screeningService is a concrete implementation of the ScreeningService interface.
+// The list is loaded once at startup; the mutex serialises updates of the hits file.
+type screeningService struct {
+	conf    config.ScreeningConfig
+	entries []screeningEntry
+	mu      sync.Mutex
+}
+
+// Screen matches the subject's name and applies the resolutions of its earlier hits.
+func (s *screeningService) Screen(subject models.ScreeningSubject) (models.ScreeningResult, error) {
+	hits, err := s.readHits()
+	if err != nil {
+		return models.ScreeningResult{}, err
+	}
+
+	result := models.ScreeningResult{Decision: models.ScreeningClear}
+	for _, hit := range hits {
+		if hit.Status == models.ScreeningHitConfirmed && sameScreeningSubject(hit.Subject, subject) {
+			result.Decision = models.ScreeningBlock
+			result.Matches = append(result.Matches, hit.Match)
+		}
+	}
+
+	for _, match := range s.match(subject.Name) {
+		if previous := findScreeningHit(hits, subject, match.EntryID); previous != nil && previous.Status != models.ScreeningHitOpen {
+			// Cleared matches are false positives; confirmed ones were added above.
+			continue
+		}
+		result.Matches = append(result.Matches, match)
+		result.Decision = strongerScreeningDecision(result.Decision, s.decisionFor(match))
+	}
+	return result, nil
+}
+
+// RecordHits appends a hit for every match that is not recorded for the subject yet.
+func (s *screeningService) RecordHits(subject models.ScreeningSubject, context, transactionID string, result models.ScreeningResult) error {
+	if len(result.Matches) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hits, err := s.readHits()
+	if err != nil {
+		return err
+	}
+	recorded := false
+	now := time.Now().Format(time.RFC3339)
+	for _, match := range result.Matches {
+		if findScreeningHit(hits, subject, match.EntryID) != nil {
+			continue
+		}
+		hits = append(hits, models.ScreeningHit{
+			ID:            util.NewID("sh_"),
+			Subject:       subject,
+			Context:       context,
+			TransactionID: transactionID,
+			Match:         match,
+			Decision:      s.decisionFor(match),
+			Status:        models.ScreeningHitOpen,
+			CreatedAt:     now,
+		})
+		recorded = true
+	}
+	if !recorded {
+		return nil
+	}
+	if err := util.WriteJSONFile(screeningHitsFile, hits); err != nil {
+		return fmt.Errorf("failed to save screening hits: %v", err)
+	}
+	return nil
+}
+
+// ScreenPayment screens both parties of a payment. The result carries the matches of both and
+// the stronger of their decisions.
+func (s *screeningService) ScreenPayment(customer models.Customer, merchant models.Merchant, transactionID string) (models.ScreeningResult, error) {
+	subjects := []models.ScreeningSubject{
+		{Type: models.PartyCustomer, ID: customer.ID, Name: customer.ScreeningName()},
+		{Type: models.PartyMerchant, ID: merchant.ID, Name: merchant.Name},
+	}
+
+	combined := models.ScreeningResult{Decision: models.ScreeningClear}
+	for _, subject := range subjects {
+		result, err := s.Screen(subject)
+		if err != nil {
+			return models.ScreeningResult{}, err
+		}
+		if err := s.RecordHits(subject, models.ScreeningContextPayment, transactionID, result); err != nil {
+			return models.ScreeningResult{}, err
+		}
+		combined.Decision = strongerScreeningDecision(combined.Decision, result.Decision)
+		combined.Matches = append(combined.Matches, result.Matches...)
+	}
+	return combined, nil
+}
+
+// GetHits returns the hits matching the filter, newest first.
+func (s *screeningService) GetHits(filter dto.ScreeningHitFilter) ([]models.ScreeningHit, error) {
+	hits, err := s.readHits()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.ScreeningHit{}
+	for i := len(hits) - 1; i >= 0; i-- {
+		hit := hits[i]
+		if filter.Status != "" && hit.Status != filter.Status {
+			continue
+		}
+		if filter.SubjectType != "" && hit.Subject.Type != filter.SubjectType {
+			continue
+		}
+		if filter.SubjectID != "" && hit.Subject.ID != filter.SubjectID {
+			continue
+		}
+		result = append(result, hit)
+	}
+	return result, nil
+}
+
+// ResolveHit records the review outcome of an open hit.
+func (s *screeningService) ResolveHit(caller dto.Caller, id string, resolution dto.HitResolution) (models.ScreeningHit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hits, err := s.readHits()
+	if err != nil {
+		return models.ScreeningHit{}, err
+	}
+	for i := range hits {
+		if hits[i].ID != id {
+			continue
+		}
+		if hits[i].Status != models.ScreeningHitOpen {
+			return models.ScreeningHit{}, NewConflictError(CodeScreeningHitResolved, "screening hit has already been resolved")
+		}
+		hits[i].Status = resolution.Status
+		hits[i].Note = resolution.Note
+		hits[i].ReviewedBy = caller.UserID
+		hits[i].ReviewedAt = time.Now().Format(time.RFC3339)
+		if err := util.WriteJSONFile(screeningHitsFile, hits); err != nil {
+			return models.ScreeningHit{}, fmt.Errorf("failed to save screening hits: %v", err)
+		}
+		return hits[i], nil
+	}
+	return models.ScreeningHit{}, NewNotFoundError(CodeScreeningHitNotFound, "screening hit not found")
+}
+
+// NewScreeningService creates a new instance of screeningService with the sanctions list loaded
+// from the configured files. Without a list file nothing is ever matched.
+func NewScreeningService(conf config.ScreeningConfig) (ScreeningService, error) {
+	s := &screeningService{conf: conf}
+	if conf.ListFile == "" {
+		return s, nil
+	}
+
+	entries, err := LoadSanctionsList(conf.ListFile, conf.AliasFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		prepared := screeningEntry{SanctionsEntry: entry}
+		for _, name := range append([]string{entry.Name}, entry.Aliases...) {
+			if tokens := normalizeName(name); len(tokens) > 0 {
+				prepared.names = append(prepared.names, name)
+				prepared.tokens = append(prepared.tokens, tokens)
+			}
+		}
+		s.entries = append(s.entries, prepared)
+	}
+	return s, nil
+}
+
+// LoadSanctionsList reads a sanctions list in the OFAC SDN CSV format: one entry per row with the
+// entry number, name, type and program in the first four columns, and "-0-" for empty values.
+// The optional alias file uses the OFAC ALT format: entry number, alias number, alias type and alias name.
+// A header row, if present, is skipped.
+func LoadSanctionsList(listFile, aliasFile string) ([]models.SanctionsEntry, error) {
+	rows, err := readSanctionsCSV(listFile)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.SanctionsEntry, 0, len(rows))
+	index := map[string]int{}
+	for _, row := range rows {
+		if len(row) < 2 || sanctionsField(row[1]) == "" {
+			continue
+		}
+		entry := models.SanctionsEntry{ID: sanctionsField(row[0]), Name: sanctionsField(row[1])}
+		if len(row) > 2 {
+			entry.Type = sanctionsField(row[2])
+		}
+		if len(row) > 3 {
+			entry.Program = sanctionsField(row[3])
+		}
+		index[entry.ID] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	if aliasFile == "" {
+		return entries, nil
+	}
+	aliases, err := readSanctionsCSV(aliasFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range aliases {
+		if len(row) < 4 {
+			continue
+		}
+		i, ok := index[sanctionsField(row[0])]
+		if alias := sanctionsField(row[3]); ok && alias != "" {
+			entries[i].Aliases = append(entries[i].Aliases, alias)
+		}
+	}
+	return entries, nil
+}
+
+// readSanctionsCSV reads the rows of a sanctions CSV file whose first column is a numeric entry number.
+func readSanctionsCSV(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sanctions list: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sanctions list %s: %v", path, err)
+		}
+		if _, err := strconv.Atoi(sanctionsField(row[0])); err != nil {
+			continue
+		}
+		rows = append(rows, row)
+	}
+}
+
+// sanctionsField trims a sanctions list value and turns the "-0-" placeholder into an empty string.
+func sanctionsField(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "-0-" {
+		return ""
+	}
+	return value
+}
+
+// match returns the list entries whose name or an alias scores at least the review threshold
+// against the name, best first.
+func (s *screeningService) match(name string) []models.ScreeningMatch {
+	tokens := normalizeName(name)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var matches []models.ScreeningMatch
+	for _, entry := range s.entries {
+		best := models.ScreeningMatch{}
+		for i, entryTokens := range entry.tokens {
+			score := nameSimilarity(tokens, entryTokens) * 100
+			if score > best.Score {
+				best = models.ScreeningMatch{
+					EntryID:     entry.ID,
+					EntryName:   entry.Name,
+					MatchedName: entry.names[i],
+					Program:     entry.Program,
+					Score:       float64(int(score*10)) / 10,
+				}
+			}
+		}
+		if best.Score >= s.conf.ReviewThreshold {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > maxScreeningMatches {
+		matches = matches[:maxScreeningMatches]
+	}
+	return matches
+}
+
+// decisionFor returns the decision a single match calls for.
+func (s *screeningService) decisionFor(match models.ScreeningMatch) string {
+	if match.Score >= s.conf.BlockThreshold {
+		return models.ScreeningBlock
+	}
+	return models.ScreeningReview
+}
+
+// readHits reads the recorded screening hits.
+func (s *screeningService) readHits() ([]models.ScreeningHit, error) {
+	hits := []models.ScreeningHit{}
+	if err := util.ReadJSONFile(screeningHitsFile, &hits); err != nil {
+		return nil, fmt.Errorf("failed to read screening hits: %v", err)
+	}
+	return hits, nil
+}
+
+// findScreeningHit returns the hit recorded for the subject and list entry, if any.
+func findScreeningHit(hits []models.ScreeningHit, subject models.ScreeningSubject, entryID string) *models.ScreeningHit {
+	for i := range hits {
+		if hits[i].Match.EntryID == entryID && sameScreeningSubject(hits[i].Subject, subject) {
+			return &hits[i]
+		}
+	}
+	return nil
+}
+
+// sameScreeningSubject reports whether a hit's subject is the given customer or merchant. Hits of
+// rejected applications have no ID and match no one, so their resolutions never carry over to a
+// later customer or merchant with the same name.
+func sameScreeningSubject(recorded, subject models.ScreeningSubject) bool {
+	return recorded.Type == subject.Type && recorded.ID != "" && recorded.ID == subject.ID
+}
+
+// strongerScreeningDecision returns the more restrictive of two decisions.
+func strongerScreeningDecision(a, b string) string {
+	rank := map[string]int{models.ScreeningClear: 0, models.ScreeningReview: 1, models.ScreeningBlock: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
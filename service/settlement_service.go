@@ -0,0 +1,515 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// settlementsFile stores the settlement batches.
+const settlementsFile = "database/settlements.json"
+
+// businessDateLayout is the layout of business dates.
+const businessDateLayout = "2006-01-02"
+
+// SettlementService defines the interface of daily merchant settlement and payouts.
+type SettlementService interface {
+	// Settle creates the batches of a business day for every merchant with something to settle.
+	// Merchants already settled for that day or a later one are skipped.
+	Settle(businessDate, createdBy string) (dto.SettlementRun, error)
+	// PreviousBusinessDate returns the business day before today.
+	PreviousBusinessDate() string
+	// GetBatches returns the batches the caller may see, newest business day first.
+	GetBatches(caller dto.Caller, filter dto.SettlementFilter) ([]models.SettlementBatch, error)
+	// GetBatch returns one batch with its items.
+	GetBatch(caller dto.Caller, id string) (models.SettlementBatch, error)
+	// GetPayouts returns the payout instructions of a business day that pay anything.
+	GetPayouts(businessDate string) ([]models.PayoutInstruction, error)
+	// GetPayout returns the payout instruction with the ID.
+	GetPayout(id string) (models.PayoutInstruction, error)
+	// ExportPayouts submits the pending payouts of a business day in a pain.001 credit transfer message.
+	ExportPayouts(businessDate string) (dto.PayoutExport, error)
+	// ConfirmPayout marks a submitted payout as paid once the bank has booked it. Payouts in any
+	// other status are returned unchanged.
+	ConfirmPayout(payoutID string, bookedOn string) (models.PayoutInstruction, error)
+	// Start runs the daily settlement scheduler in the background.
+	Start()
+	// Stop ends the scheduler.
+	Stop()
+}
+
+// settlementService is a concrete implementation of the SettlementService interface.
+// The mutex serialises settlement runs so a payment is never settled twice.
+type settlementService struct {
+	conf     config.SettlementConfig
+	ms       MerchantService
+	location *time.Location
+	runAt    int
+	schedule bool
+	mu       sync.Mutex
+	stop     chan struct{}
+}
+
+// Settle builds one batch per merchant from the captures, refunds and chargebacks that happened
+// up to the end of the business day and were not settled before. Payments missed by an earlier run are
+// picked up by the next one.
+func (s *settlementService) Settle(businessDate, createdBy string) (dto.SettlementRun, error) {
+	day, err := time.ParseInLocation(businessDateLayout, businessDate, s.location)
+	if err != nil {
+		return dto.SettlementRun{}, NewValidationError("invalid business date", []util.FieldError{{Field: "business_date", Rule: "datetime", Message: "must be a date in the format 2006-01-02"}})
+	}
+	cutoff := day.AddDate(0, 0, 1)
+	if cutoff.After(time.Now()) {
+		return dto.SettlementRun{}, NewValidationError("business day has not ended yet", []util.FieldError{{Field: "business_date", Rule: "past", Message: "must be a business day that has ended"}})
+	}
+
+	merchants, err := s.ms.GetAllMerchant()
+	if err != nil {
+		return dto.SettlementRun{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batches, err := s.loadBatches()
+	if err != nil {
+		return dto.SettlementRun{}, err
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return dto.SettlementRun{}, fmt.Errorf("failed to read payments: %v", err)
+	}
+	disputes, err := loadDisputes()
+	if err != nil {
+		return dto.SettlementRun{}, err
+	}
+
+	settled := map[string]bool{}
+	latest := map[string]models.SettlementBatch{}
+	for _, batch := range batches {
+		for _, item := range batch.Items {
+			settled[item.Type+":"+item.TransactionID] = true
+		}
+		if batch.BusinessDate >= latest[batch.MerchantID].BusinessDate {
+			latest[batch.MerchantID] = batch
+		}
+	}
+
+	run := dto.SettlementRun{BusinessDate: businessDate, Batches: []models.SettlementBatch{}, Skipped: []string{}}
+	for _, merchant := range merchants {
+		previous, ok := latest[merchant.ID]
+		if ok && previous.BusinessDate >= businessDate {
+			run.Skipped = append(run.Skipped, merchant.ID)
+			continue
+		}
+
+		batch := models.SettlementBatch{
+			MerchantID:   merchant.ID,
+			BusinessDate: businessDate,
+			Currency:     merchant.GetCurrency(),
+			CarriedIn:    previous.CarriedOut,
+			Items:        []models.SettlementItem{},
+		}
+		for _, payment := range payments {
+			if payment.MerchantID != merchant.ID {
+				continue
+			}
+			if item, ok := captureItem(payment, cutoff); ok && !settled[item.Type+":"+item.TransactionID] {
+				batch.Items = append(batch.Items, item)
+			}
+			if item, ok := refundItem(payment, cutoff); ok && !settled[item.Type+":"+item.TransactionID] {
+				batch.Items = append(batch.Items, item)
+			}
+		}
+		for _, dispute := range disputes {
+			if dispute.MerchantID != merchant.ID {
+				continue
+			}
+			for _, entry := range dispute.Ledger {
+				if item, ok := chargebackItem(entry, cutoff); ok && !settled[item.Type+":"+item.TransactionID] {
+					batch.Items = append(batch.Items, item)
+				}
+			}
+		}
+		if len(batch.Items) == 0 && batch.CarriedIn == 0 {
+			continue
+		}
+		s.totalBatch(&batch, merchant, cutoff)
+		batch.CreatedBy = createdBy
+		batch.CreatedAt = time.Now().Format(time.RFC3339)
+		run.Batches = append(run.Batches, batch)
+	}
+
+	if len(run.Batches) > 0 {
+		if err := util.WriteJSONFile(settlementsFile, append(batches, run.Batches...)); err != nil {
+			return dto.SettlementRun{}, fmt.Errorf("failed to save settlements: %v", err)
+		}
+	}
+	return run, nil
+}
+
+// PreviousBusinessDate returns yesterday in the settlement time zone.
+func (s *settlementService) PreviousBusinessDate() string {
+	return time.Now().In(s.location).AddDate(0, 0, -1).Format(businessDateLayout)
+}
+
+// GetBatches returns the batches matching the filter. Merchants only see their own batches.
+func (s *settlementService) GetBatches(caller dto.Caller, filter dto.SettlementFilter) ([]models.SettlementBatch, error) {
+	switch caller.Role {
+	case models.RoleAdmin:
+	case models.RoleMerchant:
+		filter.MerchantID = caller.MerchantID
+	default:
+		return nil, NewForbiddenError(CodeForbidden, "only merchants and admins can view settlements")
+	}
+
+	batches, err := s.loadBatches()
+	if err != nil {
+		return nil, err
+	}
+	result := []models.SettlementBatch{}
+	for _, batch := range batches {
+		if filter.MerchantID != "" && batch.MerchantID != filter.MerchantID {
+			continue
+		}
+		if (filter.From != "" && batch.BusinessDate < filter.From) || (filter.To != "" && batch.BusinessDate > filter.To) {
+			continue
+		}
+		result = append(result, batch)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].BusinessDate > result[j].BusinessDate
+	})
+	return result, nil
+}
+
+// GetBatch returns the batch with the ID if the caller may see its merchant's settlements.
+func (s *settlementService) GetBatch(caller dto.Caller, id string) (models.SettlementBatch, error) {
+	batches, err := s.loadBatches()
+	if err != nil {
+		return models.SettlementBatch{}, err
+	}
+	for _, batch := range batches {
+		if batch.ID != id {
+			continue
+		}
+		if err := canManageMerchant(caller, batch.MerchantID); err != nil {
+			return models.SettlementBatch{}, err
+		}
+		return batch, nil
+	}
+	return models.SettlementBatch{}, NewNotFoundError(CodeSettlementNotFound, "settlement batch not found")
+}
+
+// GetPayouts collects the payouts of the business day's batches, leaving out those with status none.
+func (s *settlementService) GetPayouts(businessDate string) ([]models.PayoutInstruction, error) {
+	batches, err := s.loadBatches()
+	if err != nil {
+		return nil, err
+	}
+	payouts := []models.PayoutInstruction{}
+	for _, batch := range batches {
+		if batch.BusinessDate == businessDate && batch.Payout.Status != models.PayoutNone {
+			payouts = append(payouts, batch.Payout)
+		}
+	}
+	return payouts, nil
+}
+
+// GetPayout finds the payout with the ID among the batches, or returns a not found error.
+func (s *settlementService) GetPayout(id string) (models.PayoutInstruction, error) {
+	batches, err := s.loadBatches()
+	if err != nil {
+		return models.PayoutInstruction{}, err
+	}
+	for _, batch := range batches {
+		if batch.Payout.ID == id && id != "" {
+			return batch.Payout, nil
+		}
+	}
+	return models.PayoutInstruction{}, NewNotFoundError(CodePayoutNotFound, "payout not found")
+}
+
+// ExportPayouts builds the pain.001 message of the business day's pending payouts and marks them
+// submitted under its message ID, so a payout is never sent to the bank twice. Every merchant
+// paid needs a payout account.
+func (s *settlementService) ExportPayouts(businessDate string) (dto.PayoutExport, error) {
+	if s.conf.DebtorName == "" || s.conf.DebtorBIC == "" || (s.conf.DebtorIBAN == "" && s.conf.DebtorAccount == "") {
+		return dto.PayoutExport{}, NewUnavailableError(CodePayoutsNotConfigured, "the settlement account payouts are paid from is not configured")
+	}
+	merchants, err := s.ms.GetAllMerchant()
+	if err != nil {
+		return dto.PayoutExport{}, err
+	}
+	accounts := map[string]models.BankAccount{}
+	for _, merchant := range merchants {
+		if merchant.PayoutAccount != nil {
+			accounts[merchant.ID] = *merchant.PayoutAccount
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batches, err := s.loadBatches()
+	if err != nil {
+		return dto.PayoutExport{}, err
+	}
+	var due []int
+	var payouts []models.PayoutInstruction
+	var fields []util.FieldError
+	for i, batch := range batches {
+		if batch.BusinessDate != businessDate || batch.Payout.Status != models.PayoutPending {
+			continue
+		}
+		if _, ok := accounts[batch.MerchantID]; !ok {
+			fields = append(fields, util.FieldError{Field: "merchants[" + batch.MerchantID + "].payout_account", Rule: "required", Message: "is required to pay out " + batch.Payout.ID})
+		}
+		due = append(due, i)
+		payouts = append(payouts, batch.Payout)
+	}
+	if len(fields) > 0 {
+		return dto.PayoutExport{}, NewValidationError("merchants without a payout account cannot be paid", fields)
+	}
+	if len(payouts) == 0 {
+		return dto.PayoutExport{}, NewConflictError(CodeNoPendingPayouts, "the business day has no pending payouts")
+	}
+
+	now := time.Now()
+	messageID := fmt.Sprintf("PAYOUT-%s-%s", strings.ReplaceAll(businessDate, "-", ""), util.RandomHex(6))
+	document, err := buildPain001(s.conf, messageID, payouts, accounts, now.In(s.location))
+	if err != nil {
+		return dto.PayoutExport{}, err
+	}
+	for j, i := range due {
+		batches[i].Payout.Status = models.PayoutSubmitted
+		batches[i].Payout.MessageID = messageID
+		batches[i].Payout.SubmittedAt = now.Format(time.RFC3339)
+		payouts[j] = batches[i].Payout
+	}
+	if err := util.WriteJSONFile(settlementsFile, batches); err != nil {
+		return dto.PayoutExport{}, fmt.Errorf("failed to save settlements: %v", err)
+	}
+	return dto.PayoutExport{MessageID: messageID, Payouts: payouts, Document: document}, nil
+}
+
+// ConfirmPayout marks the submitted payout with the ID as paid on the booking date.
+func (s *settlementService) ConfirmPayout(payoutID string, bookedOn string) (models.PayoutInstruction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batches, err := s.loadBatches()
+	if err != nil {
+		return models.PayoutInstruction{}, err
+	}
+	for i := range batches {
+		payout := &batches[i].Payout
+		if payout.ID != payoutID || payoutID == "" {
+			continue
+		}
+		if payout.Status != models.PayoutSubmitted {
+			return *payout, nil
+		}
+		payout.Status = models.PayoutPaid
+		payout.PaidAt = bookedOn
+		if err := util.WriteJSONFile(settlementsFile, batches); err != nil {
+			return models.PayoutInstruction{}, fmt.Errorf("failed to save settlements: %v", err)
+		}
+		return *payout, nil
+	}
+	return models.PayoutInstruction{}, NewNotFoundError(CodePayoutNotFound, "payout not found")
+}
+
+// Start settles the previous business day every day at the configured time. A run that is
+// already due when the server starts happens straight away; runs are idempotent.
+func (s *settlementService) Start() {
+	if !s.schedule {
+		return
+	}
+	go func() {
+		for {
+			now := time.Now().In(s.location)
+			next := time.Date(now.Year(), now.Month(), now.Day(), 0, s.runAt, 0, 0, s.location)
+			if !next.After(now) {
+				s.runScheduled()
+				next = next.AddDate(0, 0, 1)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(time.Until(next)):
+			}
+		}
+	}()
+}
+
+// Stop ends the scheduler.
+func (s *settlementService) Stop() {
+	close(s.stop)
+}
+
+// NewSettlementService creates a new instance of settlementService. It returns an error when
+// the configured run time is not a time of day.
+func NewSettlementService(conf config.SettlementConfig, ms MerchantService) (SettlementService, error) {
+	s := &settlementService{conf: conf, ms: ms, location: conf.Location, stop: make(chan struct{})}
+	if s.location == nil {
+		s.location = time.Local
+	}
+	if conf.RunAt != "" {
+		runAt, err := parseClock(conf.RunAt)
+		if err != nil {
+			return nil, fmt.Errorf("settlement run time %v", err)
+		}
+		s.runAt, s.schedule = runAt, true
+	}
+	return s, nil
+}
+
+// runScheduled settles the previous business day and logs the outcome.
+func (s *settlementService) runScheduled() {
+	run, err := s.Settle(s.PreviousBusinessDate(), "scheduler")
+	if err != nil {
+		log.Printf("Error settling business day: %v", err)
+		return
+	}
+	log.Printf("Settled business day %s: %d batches, %d merchants skipped", run.BusinessDate, len(run.Batches), len(run.Skipped))
+}
+
+// loadBatches reads the settlements file.
+func (s *settlementService) loadBatches() ([]models.SettlementBatch, error) {
+	batches := []models.SettlementBatch{}
+	if err := util.ReadJSONFile(settlementsFile, &batches); err != nil {
+		return nil, fmt.Errorf("failed to read settlements: %v", err)
+	}
+	return batches, nil
+}
+
+// totalBatch adds up the batch's items and decides its payout. A negative net is carried into
+// the merchant's next batch instead of being paid out.
+func (s *settlementService) totalBatch(batch *models.SettlementBatch, merchant models.Merchant, cutoff time.Time) {
+	currency := batch.Currency
+	for _, item := range batch.Items {
+		switch item.Type {
+		case models.SettlementItemCapture:
+			batch.PaymentCount++
+			batch.GrossAmount += item.GrossAmount
+			batch.FeeAmount += item.FeeAmount
+		case models.SettlementItemRefund:
+			batch.RefundCount++
+			batch.RefundAmount += item.GrossAmount
+		case models.SettlementItemChargeback:
+			batch.ChargebackAmount += item.GrossAmount
+		case models.SettlementItemChargebackReversal:
+			batch.ReversalAmount += item.GrossAmount
+		}
+	}
+	batch.GrossAmount = roundToCurrency(batch.GrossAmount, currency)
+	batch.FeeAmount = roundToCurrency(batch.FeeAmount, currency)
+	batch.RefundAmount = roundToCurrency(batch.RefundAmount, currency)
+	batch.ChargebackAmount = roundToCurrency(batch.ChargebackAmount, currency)
+	batch.ReversalAmount = roundToCurrency(batch.ReversalAmount, currency)
+	batch.NetAmount = roundToCurrency(batch.GrossAmount-batch.FeeAmount-batch.RefundAmount-batch.ChargebackAmount+batch.ReversalAmount+batch.CarriedIn, currency)
+
+	batch.ID = util.NewID("sb_")
+	batch.Payout = models.PayoutInstruction{
+		BatchID:     batch.ID,
+		MerchantID:  merchant.ID,
+		Beneficiary: merchant.Name,
+		Currency:    currency,
+		Reference:   fmt.Sprintf("SETTLE-%s-%s", strings.ToUpper(merchant.ID), strings.ReplaceAll(batch.BusinessDate, "-", "")),
+		ValueDate:   cutoff.Format(businessDateLayout),
+		Status:      models.PayoutNone,
+	}
+	if batch.NetAmount > 0 {
+		batch.Payout.ID = util.NewID("po_")
+		batch.Payout.Amount = batch.NetAmount
+		batch.Payout.Status = models.PayoutPending
+	} else {
+		batch.CarriedOut = batch.NetAmount
+	}
+}
+
+// captureItem returns the capture of a payment captured before the cutoff.
+func captureItem(payment models.Payment, cutoff time.Time) (models.SettlementItem, bool) {
+	if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusRefunded {
+		return models.SettlementItem{}, false
+	}
+	capturedAt, gross := capturedGross(payment)
+	if !occurredBefore(capturedAt, cutoff) {
+		return models.SettlementItem{}, false
+	}
+	return models.SettlementItem{
+		TransactionID: payment.TransactionID,
+		Type:          models.SettlementItemCapture,
+		GrossAmount:   gross,
+		FeeAmount:     payment.FeeAmount,
+		NetAmount:     gross - payment.FeeAmount,
+		OccurredAt:    capturedAt,
+	}, true
+}
+
+// refundItem returns the refund of a payment refunded before the cutoff. The merchant gives back
+// the gross amount; the fee is not returned.
+func refundItem(payment models.Payment, cutoff time.Time) (models.SettlementItem, bool) {
+	if payment.Status != models.PaymentStatusRefunded || !occurredBefore(payment.RefundedAt, cutoff) {
+		return models.SettlementItem{}, false
+	}
+	_, gross := capturedGross(payment)
+	return models.SettlementItem{
+		TransactionID: payment.TransactionID,
+		Type:          models.SettlementItemRefund,
+		GrossAmount:   gross,
+		NetAmount:     -gross,
+		OccurredAt:    payment.RefundedAt,
+	}, true
+}
+
+// chargebackItem returns a dispute ledger entry booked before the cutoff. A chargeback takes the
+// disputed amount back from the merchant and its reversal pays it again.
+func chargebackItem(entry models.LedgerEntry, cutoff time.Time) (models.SettlementItem, bool) {
+	if !occurredBefore(entry.BookedAt, cutoff) {
+		return models.SettlementItem{}, false
+	}
+	item := models.SettlementItem{
+		TransactionID: entry.TransactionID,
+		GrossAmount:   entry.Amount,
+		NetAmount:     entry.Amount,
+		OccurredAt:    entry.BookedAt,
+	}
+	switch entry.Type {
+	case models.LedgerEntryChargeback:
+		item.Type = models.SettlementItemChargeback
+		item.NetAmount = -entry.Amount
+	case models.LedgerEntryChargebackReversal:
+		item.Type = models.SettlementItemChargebackReversal
+	default:
+		return models.SettlementItem{}, false
+	}
+	return item, true
+}
+
+// capturedGross returns when a payment was captured and its gross amount in the settlement
+// currency. Payments captured before fees were charged use their timestamp and settlement amount.
+func capturedGross(payment models.Payment) (string, float64) {
+	if payment.CapturedAt != "" {
+		return payment.CapturedAt, payment.GrossAmount
+	}
+	if payment.SettlementCurrency == "" {
+		return payment.Timestamp, payment.Amount
+	}
+	return payment.Timestamp, payment.SettlementAmount
+}
+
+// occurredBefore reports whether an RFC 3339 timestamp lies before the cutoff.
+func occurredBefore(timestamp string, cutoff time.Time) bool {
+	at, err := time.Parse(time.RFC3339, timestamp)
+	return err == nil && at.Before(cutoff)
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// streamBufferSize is the number of events a subscription holds before the poller waits for the reader.
+const streamBufferSize = 64
+
+// StreamService defines the interface of the real-time payment and history event stream.
+type StreamService interface {
+	// Subscribe opens a subscription to the events visible to the caller. With an empty lastEventID
+	// only events recorded from now on are streamed; otherwise the stream resumes after that event.
+	Subscribe(caller dto.Caller, lastEventID string) (*Subscription, error)
+	// Start runs the store poller that feeds the subscriptions in the background.
+	Start()
+	// Stop ends the background poller.
+	Stop()
+}
+
+// Subscription is an open event stream of one caller.
+type Subscription struct {
+	// Events receives the caller's events in order.
+	Events <-chan models.StreamEvent
+
+	events chan models.StreamEvent
+	caller dto.Caller
+	cursor streamCursor
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// streamCursor is a position in the two stores backing the stream: the number of history entries
+// and the last outbox event ID already streamed. It is encoded as "<history>-<outbox>".
+type streamCursor struct {
+	History int
+	Outbox  uint64
+}
+
+// String encodes the cursor as an event ID.
+func (c streamCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.History, c.Outbox)
+}
+
+// parseStreamCursor decodes an event ID produced by streamCursor.String.
+func parseStreamCursor(id string) (streamCursor, error) {
+	history, outbox, ok := strings.Cut(id, "-")
+	if !ok {
+		return streamCursor{}, invalidEventIDError()
+	}
+	h, err := strconv.Atoi(history)
+	if err != nil || h < 0 {
+		return streamCursor{}, invalidEventIDError()
+	}
+	o, err := strconv.ParseUint(outbox, 10, 64)
+	if err != nil {
+		return streamCursor{}, invalidEventIDError()
+	}
+	return streamCursor{History: h, Outbox: o}, nil
+}
+
+// streamSnapshot is the content of the backing stores read by one poll.
+// Events only holds the outbox events whose payment change is committed, in order.
+type streamSnapshot struct {
+	histories []models.History
+	events    []models.OutboxEvent
+}
+
+// streamService is a concrete implementation of the StreamService interface.
+// It polls the history log and the payment outbox, so every streamed event is durable and a
+// client can resume after any event it has seen, even across server restarts.
+type streamService struct {
+	conf config.StreamConfig
+	mu   sync.Mutex
+	subs []*Subscription
+	wake chan struct{}
+	stop chan struct{}
+}
+
+// Subscribe opens a subscription for the caller, starting at the current head of the stores
+// or right after lastEventID.
+func (s *streamService) Subscribe(caller dto.Caller, lastEventID string) (*Subscription, error) {
+	var cursor streamCursor
+	if lastEventID != "" {
+		c, err := parseStreamCursor(lastEventID)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	} else {
+		snapshot, err := readStreamSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		cursor.History = len(snapshot.histories)
+		if n := len(snapshot.events); n > 0 {
+			cursor.Outbox = snapshot.events[n-1].ID
+		}
+	}
+
+	events := make(chan models.StreamEvent, streamBufferSize)
+	sub := &Subscription{
+		Events: events,
+		events: events,
+		caller: caller,
+		cursor: cursor,
+		done:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.subs = append(s.subs, sub)
+	s.mu.Unlock()
+
+	// Replay anything after a resume cursor right away instead of on the next tick.
+	s.notify()
+	return sub, nil
+}
+
+// Start runs the poller in the background.
+func (s *streamService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.conf.PollInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.poll(); err != nil {
+				log.Printf("Error polling event stream: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Stop ends the background poller.
+func (s *streamService) Stop() {
+	close(s.stop)
+}
+
+// NewStreamService creates a new instance of streamService.
+func NewStreamService(conf config.StreamConfig) StreamService {
+	return &streamService{
+		conf: conf,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// notify wakes the poller without blocking.
+func (s *streamService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// poll reads the stores once and sends every subscription the events after its cursor.
+func (s *streamService) poll() error {
+	subs := s.activeSubscriptions()
+	if len(subs) == 0 {
+		return nil
+	}
+
+	snapshot, err := readStreamSnapshot()
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		feedSubscription(sub, snapshot)
+	}
+	return nil
+}
+
+// activeSubscriptions drops closed subscriptions and returns the open ones.
+func (s *streamService) activeSubscriptions() []*Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open := s.subs[:0]
+	for _, sub := range s.subs {
+		select {
+		case <-sub.done:
+		default:
+			open = append(open, sub)
+		}
+	}
+	for i := len(open); i < len(s.subs); i++ {
+		s.subs[i] = nil
+	}
+	s.subs = open
+	return append([]*Subscription(nil), open...)
+}
+
+// feedSubscription sends the subscription the payment events and then the history entries after
+// its cursor. The cursor only advances past events that were handed over, so a full buffer just
+// defers the rest to the next poll.
+func feedSubscription(sub *Subscription, snapshot streamSnapshot) {
+	for _, event := range snapshot.events {
+		if event.ID <= sub.cursor.Outbox {
+			continue
+		}
+		next := sub.cursor
+		next.Outbox = event.ID
+		payment, err := event.Payment()
+		if err != nil || !canViewPayment(sub.caller, payment) {
+			sub.cursor = next
+			continue
+		}
+		if !sub.send(models.StreamEvent{ID: next.String(), Kind: models.StreamKindPayment, Type: event.Type, Data: payment}) {
+			return
+		}
+		sub.cursor = next
+	}
+
+	for i := sub.cursor.History; i < len(snapshot.histories); i++ {
+		history := snapshot.histories[i]
+		next := sub.cursor
+		next.History = i + 1
+		if !canStreamHistory(sub.caller, history) {
+			sub.cursor = next
+			continue
+		}
+		if !sub.send(models.StreamEvent{ID: next.String(), Kind: models.StreamKindHistory, Type: history.Action, Data: history}) {
+			return
+		}
+		sub.cursor = next
+	}
+}
+
+// send hands an event to the subscription without blocking and reports whether it was accepted.
+func (s *Subscription) send(event models.StreamEvent) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// readStreamSnapshot reads the history log and the committed prefix of the outbox.
+// An outbox event whose payment has not reached the event's version yet may still be in the
+// middle of being committed, so the events from there on wait for a later poll; events the
+// dispatcher discarded were never committed and are skipped.
+func readStreamSnapshot() (streamSnapshot, error) {
+	histories := []models.History{}
+	if err := util.ReadJSONFile(historyFile, &histories); err != nil {
+		return streamSnapshot{}, fmt.Errorf("failed to read histories: %v", err)
+	}
+
+	events, err := readOutboxEvents()
+	if err != nil {
+		return streamSnapshot{}, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	payments, err := loadPayments()
+	if err != nil {
+		return streamSnapshot{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+	versions := make(map[string]int, len(payments))
+	for _, payment := range payments {
+		versions[payment.TransactionID] = payment.Version
+	}
+
+	committed := make([]models.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		if event.Status == models.OutboxStatusDiscarded {
+			continue
+		}
+		if versions[event.AggregateID] < event.Version {
+			break
+		}
+		committed = append(committed, event)
+	}
+	return streamSnapshot{histories: histories, events: committed}, nil
+}
+
+// canStreamHistory reports whether the caller may receive the history entry. Customers receive
+// their own entries, merchants the entries of their payments and admins every entry.
+func canStreamHistory(caller dto.Caller, history models.History) bool {
+	switch caller.Role {
+	case models.RoleAdmin:
+		return true
+	case models.RoleCustomer:
+		return history.CustomerID == caller.UserID
+	case models.RoleMerchant:
+		if caller.MerchantID == "" || len(history.Metadata) == 0 {
+			return false
+		}
+		var metadata struct {
+			MerchantID string `json:"merchant_id"`
+		}
+		if err := json.Unmarshal(history.Metadata, &metadata); err != nil {
+			return false
+		}
+		return metadata.MerchantID == caller.MerchantID
+	default:
+		return false
+	}
+}
+
+// invalidEventIDError reports a Last-Event-ID that was not produced by the stream.
+func invalidEventIDError() error {
+	return NewValidationError("invalid last event id", []util.FieldError{{Field: "last_event_id", Rule: "cursor", Message: "is not a valid event id"}})
+}
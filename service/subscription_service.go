@@ -0,0 +1,533 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+	"merchant-bank-api/util"
+)
+
+// Files storing the subscription plans and the subscriptions.
+const (
+	subscriptionPlansFile = "database/subscription_plans.json"
+	subscriptionsFile     = "database/subscriptions.json"
+)
+
+// SubscriptionService defines the interface of subscription plans, customer subscriptions and
+// their recurring billing.
+type SubscriptionService interface {
+	// CreatePlan creates a subscription plan of a merchant.
+	CreatePlan(caller dto.Caller, payload dto.SubscriptionPlanPayload) (models.SubscriptionPlan, error)
+	// GetPlans returns the subscription plans the caller may see.
+	GetPlans(caller dto.Caller, filter dto.SubscriptionPlanFilter) ([]models.SubscriptionPlan, error)
+	// GetPlan returns one subscription plan.
+	GetPlan(id string) (models.SubscriptionPlan, error)
+	// Subscribe subscribes the calling customer to a plan under a mandate accepted with the request.
+	Subscribe(caller dto.Caller, payload dto.SubscriptionPayload, meta models.RequestMeta) (models.Subscription, error)
+	// GetSubscriptions returns the subscriptions the caller may see, newest first.
+	GetSubscriptions(caller dto.Caller, filter dto.SubscriptionFilter) ([]models.Subscription, error)
+	// GetSubscription returns one subscription.
+	GetSubscription(caller dto.Caller, id string) (models.Subscription, error)
+	// Pause stops billing a subscription until it is resumed.
+	Pause(caller dto.Caller, id string) (models.Subscription, error)
+	// Resume restarts billing a paused subscription.
+	Resume(caller dto.Caller, id string) (models.Subscription, error)
+	// Cancel ends a subscription for good.
+	Cancel(caller dto.Caller, id string, cancellation dto.SubscriptionCancellation) (models.Subscription, error)
+	// BillDue charges every subscription whose billing date or retry is due.
+	BillDue() (dto.BillingRun, error)
+	// Start bills due subscriptions in the background.
+	Start()
+	// Stop ends the background billing.
+	Stop()
+}
+
+// subscriptionService is a concrete implementation of the SubscriptionService interface. It
+// charges subscriptions through the PaymentService and reads the time from its Clock. The mutex
+// serialises updates of the subscriptions file, including whole billing runs.
+type subscriptionService struct {
+	conf  config.SubscriptionConfig
+	ps    PaymentService
+	ms    MerchantService
+	clock Clock
+	mu    sync.Mutex
+	stop  chan struct{}
+}
+
+// CreatePlan creates a plan billed in the merchant's currency unless the payload names another
+// one. Merchants create plans for themselves; admins must name the merchant.
+func (s *subscriptionService) CreatePlan(caller dto.Caller, payload dto.SubscriptionPlanPayload) (models.SubscriptionPlan, error) {
+	merchantID := payload.MerchantID
+	if caller.Role == models.RoleMerchant && merchantID == "" {
+		merchantID = caller.MerchantID
+	}
+	if merchantID == "" {
+		return models.SubscriptionPlan{}, NewValidationError("invalid subscription plan", []util.FieldError{{Field: "merchant_id", Rule: "required", Message: "is required"}})
+	}
+	if err := canManageMerchant(caller, merchantID); err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	merchant, err := s.ms.GetMerchant(merchantID)
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+
+	plan := models.SubscriptionPlan{
+		ID:            util.NewID("plan_"),
+		MerchantID:    merchant.ID,
+		Name:          payload.Name,
+		Amount:        payload.Amount,
+		Currency:      payload.Currency,
+		Interval:      payload.Interval,
+		IntervalCount: max(payload.IntervalCount, 1),
+		CreatedAt:     s.clock.Now().Format(time.RFC3339),
+	}
+	if plan.Currency == "" {
+		plan.Currency = merchant.GetCurrency()
+	}
+	if err := checkCurrencyPrecision(plan.Amount, plan.Currency); err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plans, err := loadSubscriptionPlans()
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	if err := util.WriteJSONFile(subscriptionPlansFile, append(plans, plan)); err != nil {
+		return models.SubscriptionPlan{}, fmt.Errorf("failed to save subscription plans: %v", err)
+	}
+	return plan, nil
+}
+
+// GetPlans returns every plan, or a merchant's own plans, filtered by merchant.
+func (s *subscriptionService) GetPlans(caller dto.Caller, filter dto.SubscriptionPlanFilter) ([]models.SubscriptionPlan, error) {
+	if caller.Role == models.RoleMerchant {
+		if filter.MerchantID != "" && filter.MerchantID != caller.MerchantID {
+			return nil, NewForbiddenError(CodeForbidden, "merchants can only view their own plans")
+		}
+		filter.MerchantID = caller.MerchantID
+	}
+	plans, err := loadSubscriptionPlans()
+	if err != nil {
+		return nil, err
+	}
+	result := []models.SubscriptionPlan{}
+	for _, plan := range plans {
+		if filter.MerchantID == "" || plan.MerchantID == filter.MerchantID {
+			result = append(result, plan)
+		}
+	}
+	return result, nil
+}
+
+// GetPlan returns the plan with the ID, or a not found error.
+func (s *subscriptionService) GetPlan(id string) (models.SubscriptionPlan, error) {
+	plans, err := loadSubscriptionPlans()
+	if err != nil {
+		return models.SubscriptionPlan{}, err
+	}
+	for _, plan := range plans {
+		if plan.ID == id {
+			return plan, nil
+		}
+	}
+	return models.SubscriptionPlan{}, NewNotFoundError(CodeSubscriptionPlanNotFound, "subscription plan not found")
+}
+
+// Subscribe copies the plan's terms into an active subscription whose first period starts on
+// the start date, or now, and is billed by the next billing run once it is due.
+func (s *subscriptionService) Subscribe(caller dto.Caller, payload dto.SubscriptionPayload, meta models.RequestMeta) (models.Subscription, error) {
+	if caller.Role != models.RoleCustomer {
+		return models.Subscription{}, NewForbiddenError(CodeForbidden, "only customers can subscribe")
+	}
+	plan, err := s.GetPlan(payload.PlanID)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	now := s.clock.Now()
+	start := now
+	if payload.StartDate != "" {
+		day, err := time.ParseInLocation("2006-01-02", payload.StartDate, now.Location())
+		if err != nil || day.Before(truncateToDay(now)) {
+			return models.Subscription{}, NewValidationError("invalid subscription", []util.FieldError{{Field: "start_date", Rule: "future", Message: "must be today or a later date"}})
+		}
+		if day.After(now) {
+			start = day
+		}
+	}
+
+	subscription := models.Subscription{
+		ID:            util.NewID("sub_"),
+		PlanID:        plan.ID,
+		MerchantID:    plan.MerchantID,
+		CustomerID:    caller.UserID,
+		Amount:        plan.Amount,
+		Currency:      plan.Currency,
+		Interval:      plan.Interval,
+		IntervalCount: plan.IntervalCount,
+		Status:        models.SubscriptionActive,
+		Mandate: models.Mandate{
+			ID:         util.NewID("md_"),
+			AcceptedAt: now.Format(time.RFC3339),
+			IP:         meta.IP,
+			UserAgent:  meta.UserAgent,
+		},
+		StartedAt:     start.Format(time.RFC3339),
+		NextBillingAt: start.Format(time.RFC3339),
+		Charges:       []models.SubscriptionCharge{},
+		CreatedAt:     now.Format(time.RFC3339),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscriptions, err := loadSubscriptions()
+	if err != nil {
+		return models.Subscription{}, err
+	}
+	if err := saveSubscriptions(append(subscriptions, subscription)); err != nil {
+		return models.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// GetSubscriptions returns a customer's or merchant's own subscriptions, or every subscription
+// for admins, filtered by status, merchant and customer.
+func (s *subscriptionService) GetSubscriptions(caller dto.Caller, filter dto.SubscriptionFilter) ([]models.Subscription, error) {
+	subscriptions, err := loadSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	result := []models.Subscription{}
+	for _, subscription := range subscriptions {
+		if !canViewSubscription(caller, subscription) {
+			continue
+		}
+		if filter.Status != "" && subscription.Status != filter.Status {
+			continue
+		}
+		if (filter.MerchantID != "" && subscription.MerchantID != filter.MerchantID) || (filter.CustomerID != "" && subscription.CustomerID != filter.CustomerID) {
+			continue
+		}
+		result = append(result, subscription)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt > result[j].CreatedAt
+	})
+	return result, nil
+}
+
+// GetSubscription returns the subscription with the ID if the caller may see it, or a not found error.
+func (s *subscriptionService) GetSubscription(caller dto.Caller, id string) (models.Subscription, error) {
+	subscriptions, err := loadSubscriptions()
+	if err != nil {
+		return models.Subscription{}, err
+	}
+	i := findSubscription(subscriptions, id)
+	if i < 0 || !canViewSubscription(caller, subscriptions[i]) {
+		return models.Subscription{}, NewNotFoundError(CodeSubscriptionNotFound, "subscription not found")
+	}
+	return subscriptions[i], nil
+}
+
+// Pause pauses an active or past due subscription, which also stops its retries.
+func (s *subscriptionService) Pause(caller dto.Caller, id string) (models.Subscription, error) {
+	return s.update(caller, id, func(subscription *models.Subscription, now time.Time) error {
+		if subscription.Status != models.SubscriptionActive && subscription.Status != models.SubscriptionPastDue {
+			return NewConflictError(CodeSubscriptionNotActive, "only active subscriptions can be paused")
+		}
+		subscription.Status = models.SubscriptionPaused
+		subscription.PausedAt = now.Format(time.RFC3339)
+		subscription.NextRetryAt = ""
+		return nil
+	})
+}
+
+// Resume reactivates a paused subscription. Periods that fell due while it was paused, and an
+// unpaid period it was paused in, are skipped rather than billed.
+func (s *subscriptionService) Resume(caller dto.Caller, id string) (models.Subscription, error) {
+	return s.update(caller, id, func(subscription *models.Subscription, now time.Time) error {
+		if subscription.Status != models.SubscriptionPaused {
+			return NewConflictError(CodeSubscriptionNotPaused, "only paused subscriptions can be resumed")
+		}
+		start, _ := time.Parse(time.RFC3339, subscription.StartedAt)
+		for billingTime(*subscription, start, subscription.Cycle).Before(now) {
+			subscription.Cycle++
+		}
+		subscription.Status = models.SubscriptionActive
+		subscription.PausedAt = ""
+		subscription.FailedAttempts = 0
+		subscription.NextBillingAt = billingTime(*subscription, start, subscription.Cycle).Format(time.RFC3339)
+		return nil
+	})
+}
+
+// Cancel cancels a subscription that is not canceled yet.
+func (s *subscriptionService) Cancel(caller dto.Caller, id string, cancellation dto.SubscriptionCancellation) (models.Subscription, error) {
+	return s.update(caller, id, func(subscription *models.Subscription, now time.Time) error {
+		reason := cancellation.Reason
+		if reason == "" {
+			reason = "canceled by the " + caller.Role
+		}
+		cancel(subscription, now, reason)
+		return nil
+	})
+}
+
+// BillDue charges each active subscription whose billing date has come and each past due one
+// whose retry has come, one period per run. A succeeded or held payment bills the period; a
+// failed one is retried after the next delay of the retry schedule, and the subscription is
+// canceled once the schedule runs out. Charges the payment service cannot decide right now,
+// such as when verification is unavailable, are tried again by the next run.
+func (s *subscriptionService) BillDue() (dto.BillingRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions, err := loadSubscriptions()
+	if err != nil {
+		return dto.BillingRun{}, err
+	}
+	now := s.clock.Now()
+	run := dto.BillingRun{At: now.Format(time.RFC3339), Succeeded: []string{}, Failed: []string{}, Canceled: []string{}}
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		due := subscription.NextBillingAt
+		switch subscription.Status {
+		case models.SubscriptionActive:
+		case models.SubscriptionPastDue:
+			due = subscription.NextRetryAt
+		default:
+			continue
+		}
+		if dueAt, err := time.Parse(time.RFC3339, due); err != nil || dueAt.After(now) {
+			continue
+		}
+
+		charge, err := s.charge(*subscription, now)
+		if err != nil {
+			log.Printf("Error charging subscription %s: %v", subscription.ID, err)
+			continue
+		}
+		subscription.Charges = append(subscription.Charges, charge)
+		if charge.Status == models.PaymentStatusFailed {
+			s.fail(subscription, now)
+			if subscription.Status == models.SubscriptionCanceled {
+				run.Canceled = append(run.Canceled, subscription.ID)
+			} else {
+				run.Failed = append(run.Failed, subscription.ID)
+			}
+		} else {
+			start, _ := time.Parse(time.RFC3339, subscription.StartedAt)
+			subscription.Cycle++
+			subscription.Status = models.SubscriptionActive
+			subscription.FailedAttempts = 0
+			subscription.NextRetryAt = ""
+			subscription.NextBillingAt = billingTime(*subscription, start, subscription.Cycle).Format(time.RFC3339)
+			run.Succeeded = append(run.Succeeded, subscription.ID)
+		}
+		// Saved after every charge so that a crash never bills a period twice.
+		if err := saveSubscriptions(subscriptions); err != nil {
+			return run, err
+		}
+	}
+	return run, nil
+}
+
+// Start bills due subscriptions right away and then every billing interval.
+func (s *subscriptionService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.conf.BillingInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.BillDue(); err != nil {
+				log.Printf("Error billing subscriptions: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the background billing.
+func (s *subscriptionService) Stop() {
+	close(s.stop)
+}
+
+// NewSubscriptionService creates a new instance of subscriptionService that charges subscriptions
+// through the PaymentService, checks plan merchants with the MerchantService and tells the time
+// with the Clock.
+func NewSubscriptionService(conf config.SubscriptionConfig, ps PaymentService, ms MerchantService, clock Clock) SubscriptionService {
+	return &subscriptionService{conf: conf, ps: ps, ms: ms, clock: clock, stop: make(chan struct{})}
+}
+
+// charge attempts to bill the subscription's current period. Each attempt has its own
+// transaction ID, so an attempt whose payment was stored before a crash is picked up instead of
+// being charged again. It returns an error only when the attempt should be repeated later.
+func (s *subscriptionService) charge(subscription models.Subscription, now time.Time) (models.SubscriptionCharge, error) {
+	charge := models.SubscriptionCharge{
+		Cycle:         subscription.Cycle + 1,
+		Attempt:       subscription.FailedAttempts + 1,
+		TransactionID: fmt.Sprintf("%s-%d-%d", subscription.ID, subscription.Cycle+1, subscription.FailedAttempts+1),
+		At:            now.Format(time.RFC3339),
+	}
+
+	payments, err := loadPayments()
+	if err != nil {
+		return models.SubscriptionCharge{}, fmt.Errorf("failed to load payments: %v", err)
+	}
+	if i := findPayment(payments, charge.TransactionID); i >= 0 {
+		charge.Status = payments[i].Status
+		return charge, nil
+	}
+
+	payment, err := s.ps.PostPayment(models.PaymentRequest{
+		TransactionID:  charge.TransactionID,
+		CustomerID:     subscription.CustomerID,
+		MerchantID:     subscription.MerchantID,
+		Amount:         subscription.Amount,
+		Currency:       subscription.Currency,
+		SubscriptionID: subscription.ID,
+	})
+	if err != nil {
+		de, ok := AsDomainError(err)
+		if !ok || de.Kind == KindUnavailable {
+			return models.SubscriptionCharge{}, err
+		}
+		charge.TransactionID = ""
+		charge.Status = models.PaymentStatusFailed
+		charge.Error = de.Code
+		return charge, nil
+	}
+	charge.Status = payment.Status
+	return charge, nil
+}
+
+// fail schedules the next retry of a subscription whose charge failed, or cancels it when the
+// retry schedule has run out.
+func (s *subscriptionService) fail(subscription *models.Subscription, now time.Time) {
+	subscription.FailedAttempts++
+	if subscription.FailedAttempts > len(s.conf.RetrySchedule) {
+		cancel(subscription, now, fmt.Sprintf("payment failed %d times", subscription.FailedAttempts))
+		return
+	}
+	subscription.Status = models.SubscriptionPastDue
+	subscription.NextRetryAt = now.Add(s.conf.RetrySchedule[subscription.FailedAttempts-1]).Format(time.RFC3339)
+}
+
+// update applies change to a subscription the caller may see and saves it. Canceled
+// subscriptions cannot be changed.
+func (s *subscriptionService) update(caller dto.Caller, id string, change func(*models.Subscription, time.Time) error) (models.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions, err := loadSubscriptions()
+	if err != nil {
+		return models.Subscription{}, err
+	}
+	i := findSubscription(subscriptions, id)
+	if i < 0 || !canViewSubscription(caller, subscriptions[i]) {
+		return models.Subscription{}, NewNotFoundError(CodeSubscriptionNotFound, "subscription not found")
+	}
+	if subscriptions[i].Status == models.SubscriptionCanceled {
+		return models.Subscription{}, NewConflictError(CodeSubscriptionCanceled, "the subscription is canceled")
+	}
+	if err := change(&subscriptions[i], s.clock.Now()); err != nil {
+		return models.Subscription{}, err
+	}
+	if err := saveSubscriptions(subscriptions); err != nil {
+		return models.Subscription{}, err
+	}
+	return subscriptions[i], nil
+}
+
+// cancel ends a subscription, leaving it without a next billing date.
+func cancel(subscription *models.Subscription, now time.Time, reason string) {
+	subscription.Status = models.SubscriptionCanceled
+	subscription.CanceledAt = now.Format(time.RFC3339)
+	subscription.CancelReason = reason
+	subscription.NextBillingAt = ""
+	subscription.NextRetryAt = ""
+}
+
+// billingTime returns when billing period n of a subscription starting at start begins. Monthly
+// and yearly periods keep the start's day of the month, or use the last day of shorter months.
+func billingTime(subscription models.Subscription, start time.Time, n int) time.Time {
+	count := n * max(subscription.IntervalCount, 1)
+	switch subscription.Interval {
+	case models.IntervalDay:
+		return start.AddDate(0, 0, count)
+	case models.IntervalWeek:
+		return start.AddDate(0, 0, 7*count)
+	case models.IntervalYear:
+		return addMonths(start, 12*count)
+	default:
+		return addMonths(start, count)
+	}
+}
+
+// addMonths adds months to t, clamping the day to the length of the resulting month.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, lastDay)-1)
+}
+
+// truncateToDay returns midnight of t's day in t's location.
+func truncateToDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// canViewSubscription reports whether the caller may see and manage a subscription: its
+// customer, its merchant and admins.
+func canViewSubscription(caller dto.Caller, subscription models.Subscription) bool {
+	return canViewPayment(caller, models.Payment{CustomerID: subscription.CustomerID, MerchantID: subscription.MerchantID})
+}
+
+// findSubscription returns the index of the subscription with the ID, or -1.
+func findSubscription(subscriptions []models.Subscription, id string) int {
+	for i, subscription := range subscriptions {
+		if subscription.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadSubscriptionPlans reads the subscription plans file.
+func loadSubscriptionPlans() ([]models.SubscriptionPlan, error) {
+	plans := []models.SubscriptionPlan{}
+	if err := util.ReadJSONFile(subscriptionPlansFile, &plans); err != nil {
+		return nil, fmt.Errorf("failed to read subscription plans: %v", err)
+	}
+	return plans, nil
+}
+
+// loadSubscriptions reads the subscriptions file.
+func loadSubscriptions() ([]models.Subscription, error) {
+	subscriptions := []models.Subscription{}
+	if err := util.ReadJSONFile(subscriptionsFile, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions: %v", err)
+	}
+	return subscriptions, nil
+}
+
+// saveSubscriptions writes the subscriptions file.
+func saveSubscriptions(subscriptions []models.Subscription) error {
+	if err := util.WriteJSONFile(subscriptionsFile, subscriptions); err != nil {
+		return fmt.Errorf("failed to save subscriptions: %v", err)
+	}
+	return nil
+}
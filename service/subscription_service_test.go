@@ -0,0 +1,196 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+)
+
+// stubPayments is a PaymentService that answers every payment with the next of its statuses,
+// repeating the last one, or with err if it is set, and records the requests.
+type stubPayments struct {
+	PaymentService
+	statuses []string
+	err      error
+	requests []models.PaymentRequest
+}
+
+// PostPayment returns a payment with the request's transaction ID and the next status.
+func (p *stubPayments) PostPayment(request models.PaymentRequest) (models.Payment, error) {
+	if p.err != nil {
+		p.requests = append(p.requests, request)
+		return models.Payment{}, p.err
+	}
+	status := p.statuses[min(len(p.requests), len(p.statuses)-1)]
+	p.requests = append(p.requests, request)
+	return models.Payment{TransactionID: request.TransactionID, Status: status}, nil
+}
+
+// subscriptionStart is when the test subscriptions start: the last day of a month, so monthly
+// periods fall on the last day of shorter months.
+var subscriptionStart = time.Date(2026, 1, 31, 10, 0, 0, 0, time.UTC)
+
+// newTestSubscription subscribes customer 2 to a plan of merchant 1 with the interval, billed
+// through payments whose statuses follow the given ones, and returns the service and its clock.
+func newTestSubscription(t *testing.T, interval string, statuses ...string) (*subscriptionService, *FakeClock, *stubPayments, models.Subscription) {
+	t.Helper()
+	useTempDatabase(t)
+	writeTestFile(t, subscriptionPlansFile, []models.SubscriptionPlan{{ID: "plan_1", MerchantID: "1", Name: "Gold", Amount: 50000, Currency: "IDR", Interval: interval, IntervalCount: 1}})
+
+	clock := NewFakeClock(subscriptionStart)
+	payments := &stubPayments{statuses: statuses}
+	conf := config.SubscriptionConfig{BillingInterval: time.Minute, RetrySchedule: []time.Duration{24 * time.Hour, 72 * time.Hour}}
+	s := NewSubscriptionService(conf, payments, nil, clock).(*subscriptionService)
+	subscription, err := s.Subscribe(dto.Caller{Role: models.RoleCustomer, UserID: "2"}, dto.SubscriptionPayload{PlanID: "plan_1"}, models.RequestMeta{IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, clock, payments, subscription
+}
+
+// billDue runs a billing run and returns it with the subscription as it stands afterwards.
+func billDue(t *testing.T, s *subscriptionService, id string) (dto.BillingRun, models.Subscription) {
+	t.Helper()
+	run, err := s.BillDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription, err := s.GetSubscription(dto.Caller{Role: models.RoleAdmin}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return run, subscription
+}
+
+// chargedIDs returns the transaction IDs of the payments requested so far.
+func chargedIDs(payments *stubPayments) []string {
+	ids := []string{}
+	for _, request := range payments.requests {
+		ids = append(ids, request.TransactionID)
+	}
+	return ids
+}
+
+func TestSubscriptionBillsDuePeriods(t *testing.T) {
+	s, clock, payments, subscription := newTestSubscription(t, models.IntervalMonth, models.PaymentStatusSucceeded)
+
+	run, got := billDue(t, s, subscription.ID)
+	if len(run.Succeeded) != 1 || got.Cycle != 1 || got.NextBillingAt != "2026-02-28T10:00:00Z" {
+		t.Fatalf("first run %+v left %+v", run, got)
+	}
+
+	// Nothing is due until the next period starts.
+	clock.Set(time.Date(2026, 2, 28, 9, 59, 0, 0, time.UTC))
+	if run, _ := billDue(t, s, subscription.ID); len(run.Succeeded)+len(run.Failed) != 0 {
+		t.Fatalf("billed before the period started: %+v", run)
+	}
+
+	clock.Set(time.Date(2026, 2, 28, 10, 0, 0, 0, time.UTC))
+	run, got = billDue(t, s, subscription.ID)
+	if len(run.Succeeded) != 1 || got.Cycle != 2 || got.NextBillingAt != "2026-03-31T10:00:00Z" {
+		t.Fatalf("second run %+v left %+v", run, got)
+	}
+
+	want := []string{subscription.ID + "-1-1", subscription.ID + "-2-1"}
+	if ids := chargedIDs(payments); fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("charged %v, want %v", ids, want)
+	}
+	for _, request := range payments.requests {
+		if request.SubscriptionID != subscription.ID || request.Amount != 50000 || request.CustomerID != "2" || request.MerchantID != "1" {
+			t.Fatalf("unexpected charge %+v", request)
+		}
+	}
+}
+
+func TestSubscriptionRetriesFailedCharges(t *testing.T) {
+	s, clock, payments, subscription := newTestSubscription(t, models.IntervalMonth, models.PaymentStatusFailed, models.PaymentStatusSucceeded)
+
+	run, got := billDue(t, s, subscription.ID)
+	if len(run.Failed) != 1 || got.Status != models.SubscriptionPastDue || got.FailedAttempts != 1 || got.NextRetryAt != "2026-02-01T10:00:00Z" {
+		t.Fatalf("failed charge %+v left %+v", run, got)
+	}
+
+	// The retry waits for the first delay of the schedule and then bills the same period.
+	clock.Advance(23 * time.Hour)
+	if run, _ := billDue(t, s, subscription.ID); len(run.Succeeded)+len(run.Failed) != 0 {
+		t.Fatalf("retried early: %+v", run)
+	}
+	clock.Advance(time.Hour)
+	run, got = billDue(t, s, subscription.ID)
+	if len(run.Succeeded) != 1 || got.Status != models.SubscriptionActive || got.Cycle != 1 || got.FailedAttempts != 0 || got.NextRetryAt != "" {
+		t.Fatalf("successful retry %+v left %+v", run, got)
+	}
+	// The next period still starts a month after the start, not after the retry.
+	if got.NextBillingAt != "2026-02-28T10:00:00Z" {
+		t.Fatalf("next billing at %s", got.NextBillingAt)
+	}
+	want := []string{subscription.ID + "-1-1", subscription.ID + "-1-2"}
+	if ids := chargedIDs(payments); fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("charged %v, want %v", ids, want)
+	}
+}
+
+func TestSubscriptionCanceledWhenRetriesRunOut(t *testing.T) {
+	s, clock, payments, subscription := newTestSubscription(t, models.IntervalMonth, models.PaymentStatusFailed)
+
+	billDue(t, s, subscription.ID)
+	clock.Advance(24 * time.Hour)
+	run, got := billDue(t, s, subscription.ID)
+	if len(run.Failed) != 1 || got.FailedAttempts != 2 || got.NextRetryAt != "2026-02-04T10:00:00Z" {
+		t.Fatalf("second failure %+v left %+v", run, got)
+	}
+
+	clock.Advance(72 * time.Hour)
+	run, got = billDue(t, s, subscription.ID)
+	if len(run.Canceled) != 1 || got.Status != models.SubscriptionCanceled || got.NextBillingAt != "" || got.NextRetryAt != "" || got.CancelReason == "" {
+		t.Fatalf("last failure %+v left %+v", run, got)
+	}
+	if len(got.Charges) != 3 || len(payments.requests) != 3 {
+		t.Fatalf("got %d charges and %d payments, want 3", len(got.Charges), len(payments.requests))
+	}
+
+	// A canceled subscription is never billed again.
+	clock.Advance(60 * 24 * time.Hour)
+	if run, _ := billDue(t, s, subscription.ID); len(run.Succeeded)+len(run.Failed)+len(run.Canceled) != 0 || len(payments.requests) != 3 {
+		t.Fatalf("canceled subscription was billed: %+v", run)
+	}
+}
+
+func TestSubscriptionPauseSkipsPeriods(t *testing.T) {
+	s, clock, payments, subscription := newTestSubscription(t, models.IntervalWeek, models.PaymentStatusSucceeded)
+	caller := dto.Caller{Role: models.RoleCustomer, UserID: "2"}
+
+	billDue(t, s, subscription.ID)
+	clock.Advance(24 * time.Hour)
+	if _, err := s.Pause(caller, subscription.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three weekly periods fall due while the subscription is paused and none is billed.
+	clock.Set(subscriptionStart.Add(22 * 24 * time.Hour))
+	if run, _ := billDue(t, s, subscription.ID); len(run.Succeeded)+len(run.Failed) != 0 {
+		t.Fatalf("paused subscription was billed: %+v", run)
+	}
+
+	resumed, err := s.Resume(caller, subscription.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Status != models.SubscriptionActive || resumed.Cycle != 4 || resumed.NextBillingAt != subscriptionStart.Add(28*24*time.Hour).Format(time.RFC3339) {
+		t.Fatalf("resumed subscription %+v", resumed)
+	}
+	if run, _ := billDue(t, s, subscription.ID); len(run.Succeeded) != 0 {
+		t.Fatalf("skipped periods were billed on resume: %+v", run)
+	}
+
+	clock.Set(subscriptionStart.Add(28 * 24 * time.Hour))
+	billDue(t, s, subscription.ID)
+	want := []string{subscription.ID + "-1-1", subscription.ID + "-5-1"}
+	if ids := chargedIDs(payments); fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("charged %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+)
+
+// ErrCircuitOpen is returned while the verifier's circuit breaker rejects calls to a failing provider.
+var ErrCircuitOpen = errors.New("verification provider circuit breaker is open")
+
+// TransactionVerifier verifies transactions with a third-party provider before they are recorded.
+type TransactionVerifier interface {
+	// Verify asks the provider whether the transaction may go ahead. A declined transaction is a
+	// result, not an error; an error means no answer could be obtained.
+	Verify(request models.VerificationRequest) (models.Verification, error)
+}
+
+// noopVerifier approves every transaction. It is used when no provider is configured.
+type noopVerifier struct{}
+
+// Verify approves the transaction without calling a provider.
+func (noopVerifier) Verify(request models.VerificationRequest) (models.Verification, error) {
+	return models.Verification{
+		Provider:   "none",
+		Status:     models.VerificationApproved,
+		VerifiedAt: time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// httpVerifier is a TransactionVerifier that calls a provider over HTTP.
+// Every call is bounded by the configured timeout; network errors and 5xx responses are retried
+// with exponential backoff, and a circuit breaker stops calling a provider that keeps failing.
+type httpVerifier struct {
+	conf    config.VerifierConfig
+	client  *http.Client
+	breaker *circuitBreaker
+}
+
+// Verify posts the transaction to the provider and returns its decision.
+func (v *httpVerifier) Verify(request models.VerificationRequest) (models.Verification, error) {
+	if !v.breaker.allow() {
+		return models.Verification{}, ErrCircuitOpen
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return models.Verification{}, fmt.Errorf("failed to encode verification request: %v", err)
+	}
+
+	backoff := v.conf.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		verification, retryable, err := v.call(body)
+		if err == nil {
+			v.breaker.success()
+			verification.Attempts = attempt
+			return verification, nil
+		}
+		if !retryable {
+			// The provider answered, so it is healthy even though the answer was unusable.
+			v.breaker.success()
+			return models.Verification{}, err
+		}
+		if attempt > v.conf.MaxRetries {
+			v.breaker.failure()
+			return models.Verification{}, fmt.Errorf("verification failed after %d attempts: %v", attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// call makes a single request to the provider. It reports whether a failed call is worth retrying.
+func (v *httpVerifier) call(body []byte) (models.Verification, bool, error) {
+	resp, err := v.client.Post(v.conf.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return models.Verification{}, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		io.Copy(io.Discard, resp.Body)
+		return models.Verification{}, true, fmt.Errorf("provider returned %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return models.Verification{}, false, fmt.Errorf("provider returned %s", resp.Status)
+	}
+
+	var answer struct {
+		Status    string `json:"status"`
+		Reference string `json:"reference"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return models.Verification{}, false, fmt.Errorf("failed to decode provider response: %v", err)
+	}
+	if answer.Status != models.VerificationApproved && answer.Status != models.VerificationDeclined {
+		return models.Verification{}, false, fmt.Errorf("provider returned unknown status %q", answer.Status)
+	}
+
+	return models.Verification{
+		Provider:   "http",
+		Status:     answer.Status,
+		Reference:  answer.Reference,
+		Reason:     answer.Reason,
+		VerifiedAt: time.Now().Format(time.RFC3339),
+	}, false, nil
+}
+
+// NewTransactionVerifier creates the verifier for the configuration: an HTTP client for the
+// configured provider URL, or a verifier that approves everything when no URL is set.
+func NewTransactionVerifier(conf config.VerifierConfig) TransactionVerifier {
+	if conf.URL == "" {
+		return noopVerifier{}
+	}
+	return &httpVerifier{
+		conf:    conf,
+		client:  &http.Client{Timeout: conf.Timeout},
+		breaker: &circuitBreaker{threshold: conf.FailureThreshold, openFor: conf.OpenTimeout},
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures and rejects calls for openFor.
+// After that a single trial call is let through: success closes the breaker, failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// allow reports whether a call may be made now.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.openFor {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success records a call that reached the provider.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// failure records a call that could not reach the provider.
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+)
+
+// mockProvider serves the mock verification provider and counts the requests it receives. The
+// first failFirst requests get a 503 before the mock answers them.
+type mockProvider struct {
+	*httptest.Server
+	requests  atomic.Int32
+	failFirst int32
+}
+
+// newMockProvider starts a mock verification provider with the given configuration.
+func newMockProvider(t *testing.T, conf config.VerifierMockConfig, failFirst int32) *mockProvider {
+	t.Helper()
+	p := &mockProvider{failFirst: failFirst}
+	handler := NewMockVerifierHandler(conf)
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.requests.Add(1) <= p.failFirst {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// newTestVerifier creates an HTTP verifier for the provider with fast retries.
+func newTestVerifier(p *mockProvider, conf config.VerifierConfig) *httpVerifier {
+	conf.URL = p.URL
+	if conf.Timeout == 0 {
+		conf.Timeout = time.Second
+	}
+	if conf.RetryBackoff == 0 {
+		conf.RetryBackoff = time.Millisecond
+	}
+	if conf.FailureThreshold == 0 {
+		conf.FailureThreshold = 5
+	}
+	if conf.OpenTimeout == 0 {
+		conf.OpenTimeout = time.Minute
+	}
+	return NewTransactionVerifier(conf).(*httpVerifier)
+}
+
+// verificationRequest returns a request for a small payment with the transaction ID.
+func verificationRequest(transactionID string) models.VerificationRequest {
+	return models.VerificationRequest{TransactionID: transactionID, CustomerID: "2", MerchantID: "1", Amount: 10, Currency: "IDR"}
+}
+
+func TestVerifierApprovesAndDeclines(t *testing.T) {
+	p := newMockProvider(t, config.VerifierMockConfig{DeclineAbove: 100}, 0)
+	v := newTestVerifier(p, config.VerifierConfig{})
+
+	tests := []struct {
+		request models.VerificationRequest
+		status  string
+	}{
+		{verificationRequest("tx-1"), models.VerificationApproved},
+		{verificationRequest("decline-1"), models.VerificationDeclined},
+		{models.VerificationRequest{TransactionID: "tx-2", Amount: 500}, models.VerificationDeclined},
+	}
+	for _, tt := range tests {
+		verification, err := v.Verify(tt.request)
+		if err != nil {
+			t.Fatalf("Verify(%s): %v", tt.request.TransactionID, err)
+		}
+		if verification.Status != tt.status || verification.Reference == "" || verification.Attempts != 1 {
+			t.Errorf("Verify(%s) = %+v, want status %s", tt.request.TransactionID, verification, tt.status)
+		}
+	}
+}
+
+func TestVerifierRetriesUnavailableProvider(t *testing.T) {
+	p := newMockProvider(t, config.VerifierMockConfig{}, 2)
+	v := newTestVerifier(p, config.VerifierConfig{MaxRetries: 2})
+
+	verification, err := v.Verify(verificationRequest("tx-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Status != models.VerificationApproved || verification.Attempts != 3 {
+		t.Fatalf("Verify = %+v, want approved on the third attempt", verification)
+	}
+	if p.requests.Load() != 3 {
+		t.Fatalf("provider got %d requests, want 3", p.requests.Load())
+	}
+}
+
+func TestVerifierGivesUpAfterRetries(t *testing.T) {
+	p := newMockProvider(t, config.VerifierMockConfig{}, 0)
+	v := newTestVerifier(p, config.VerifierConfig{MaxRetries: 2})
+
+	if _, err := v.Verify(verificationRequest("fail-1")); err == nil {
+		t.Fatal("Verify succeeded against a failing provider")
+	}
+	if p.requests.Load() != 3 {
+		t.Fatalf("provider got %d requests, want 3", p.requests.Load())
+	}
+}
+
+func TestVerifierDoesNotRetryRejectedRequests(t *testing.T) {
+	p := newMockProvider(t, config.VerifierMockConfig{}, 0)
+	v := newTestVerifier(p, config.VerifierConfig{MaxRetries: 2, FailureThreshold: 1})
+
+	// The mock rejects requests without a transaction ID with a 400.
+	if _, err := v.Verify(models.VerificationRequest{}); err == nil {
+		t.Fatal("Verify succeeded for a rejected request")
+	}
+	if p.requests.Load() != 1 {
+		t.Fatalf("provider got %d requests, want 1", p.requests.Load())
+	}
+	// The provider answered, so the breaker stays closed.
+	if _, err := v.Verify(verificationRequest("tx-1")); err != nil {
+		t.Fatalf("breaker opened after a rejected request: %v", err)
+	}
+}
+
+func TestVerifierTimesOut(t *testing.T) {
+	p := newMockProvider(t, config.VerifierMockConfig{Latency: 200 * time.Millisecond}, 0)
+	v := newTestVerifier(p, config.VerifierConfig{Timeout: 20 * time.Millisecond, MaxRetries: 1})
+
+	started := time.Now()
+	if _, err := v.Verify(verificationRequest("tx-1")); err == nil {
+		t.Fatal("Verify succeeded against a slow provider")
+	}
+	if elapsed := time.Since(started); elapsed > 150*time.Millisecond {
+		t.Fatalf("Verify took %v, the timeout did not cut the calls short", elapsed)
+	}
+	if p.requests.Load() != 2 {
+		t.Fatalf("provider got %d requests, want 2", p.requests.Load())
+	}
+}
+
+func TestVerifierCircuitBreaker(t *testing.T) {
+	p := newMockProvider(t, config.VerifierMockConfig{}, 0)
+	v := newTestVerifier(p, config.VerifierConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond})
+
+	// Two failed calls open the breaker, and open it rejects calls without reaching the provider.
+	for i := 0; i < 2; i++ {
+		if _, err := v.Verify(verificationRequest("fail-1")); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: %v, want a provider failure", i+1, err)
+		}
+	}
+	if _, err := v.Verify(verificationRequest("tx-1")); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker: %v, want ErrCircuitOpen", err)
+	}
+	if p.requests.Load() != 2 {
+		t.Fatalf("provider got %d requests, want 2", p.requests.Load())
+	}
+
+	// Half-open: after the open timeout one trial call goes through, and its failure reopens the breaker.
+	time.Sleep(60 * time.Millisecond)
+	if _, err := v.Verify(verificationRequest("fail-2")); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("trial call: %v, want a provider failure", err)
+	}
+	if _, err := v.Verify(verificationRequest("tx-1")); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("reopened breaker: %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful trial call closes the breaker again.
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(verificationRequest("tx-1")); err != nil {
+			t.Fatalf("call %d after recovery: %v", i+1, err)
+		}
+	}
+}
+
+func TestCircuitBreakerAllowsOneTrialCall(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, openFor: time.Millisecond}
+	b.failure()
+	if b.allow() {
+		t.Fatal("open breaker allowed a call")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("half-open breaker rejected the trial call")
+	}
+	if b.allow() {
+		t.Fatal("half-open breaker allowed a second call during the trial")
+	}
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Fatal("closed breaker rejected calls")
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/util"
+)
+
+// NewMockVerifierHandler returns an HTTP handler that imitates the verification provider for
+// development and tests. It approves transactions unless told otherwise:
+//   - transaction IDs starting with "decline" and amounts above DeclineAbove are declined
+//   - transaction IDs starting with "fail", and a FailureRate share of all requests, get a 503
+//   - every response is delayed by Latency
+func NewMockVerifierHandler(conf config.VerifierMockConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var request models.VerificationRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.TransactionID == "" {
+			http.Error(w, "invalid verification request", http.StatusBadRequest)
+			return
+		}
+
+		time.Sleep(conf.Latency)
+
+		if strings.HasPrefix(request.TransactionID, "fail") || rand.Float64() < conf.FailureRate {
+			http.Error(w, "verification provider unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		answer := map[string]string{"status": models.VerificationApproved}
+		switch {
+		case strings.HasPrefix(request.TransactionID, "decline"):
+			answer = map[string]string{"status": models.VerificationDeclined, "reason": "transaction declined by provider"}
+		case conf.DeclineAbove > 0 && request.Amount > conf.DeclineAbove:
+			answer = map[string]string{"status": models.VerificationDeclined, "reason": "amount exceeds provider limit"}
+		}
+		answer["reference"] = util.NewID("vrf_")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(answer)
+	})
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"merchant-bank-api/config"
+	"merchant-bank-api/models"
+	"merchant-bank-api/models/dto"
+)
+
+// newTestWebhookService creates a webhook service for merchant 1 with fast retries.
+func newTestWebhookService(t *testing.T, allowPrivate bool) *webhookService {
+	t.Helper()
+	useTempDatabase(t)
+	writeTestFile(t, merchantsFile, []models.Merchant{{ID: "1", Name: "Merchant A"}})
+	conf := config.WebhookConfig{
+		MaxAttempts:         3,
+		InitialBackoff:      time.Millisecond,
+		MaxBackoff:          4 * time.Millisecond,
+		Timeout:             2 * time.Second,
+		PollInterval:        time.Second,
+		AllowPrivateTargets: allowPrivate,
+	}
+	return NewWebhookService(conf, NewMerchantService(nil)).(*webhookService)
+}
+
+// enqueueTestPayment enqueues the payment.succeeded webhook of a payment to merchant 1.
+func enqueueTestPayment(t *testing.T, s *webhookService) {
+	t.Helper()
+	payload, _ := json.Marshal(models.Payment{TransactionID: "tx-1", MerchantID: "1", Amount: 10, Status: models.PaymentStatusSucceeded, Version: 1})
+	event := models.OutboxEvent{ID: 7, Type: models.EventPaymentCreated, Payload: payload, CreatedAt: time.Now().Format(time.RFC3339Nano)}
+	if err := s.Enqueue(event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// registerTestEndpoint registers an endpoint for merchant 1 as an admin.
+func registerTestEndpoint(t *testing.T, s *webhookService, url string) models.WebhookEndpoint {
+	t.Helper()
+	endpoint, err := s.RegisterEndpoint(dto.Caller{Role: models.RoleAdmin}, "1", dto.WebhookEndpointRequest{URL: url, Events: []string{models.WebhookPaymentSucceeded}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint
+}
+
+// deliveries returns the stored deliveries.
+func deliveries(t *testing.T, s *webhookService) []models.WebhookDelivery {
+	t.Helper()
+	result, err := s.readDeliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	s := newTestWebhookService(t, true)
+
+	var received atomic.Int32
+	var endpoint models.WebhookEndpoint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		if got, want := r.Header.Get(WebhookSignatureHeader), "v1="+SignWebhook(endpoint.Secret, timestamp, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if got := r.Header.Get(WebhookEventHeader); got != models.WebhookPaymentSucceeded {
+			t.Errorf("event header = %q", got)
+		}
+		var message webhookMessage
+		if err := json.Unmarshal(body, &message); err != nil || message.ID != "evt_7" || message.Data.TransactionID != "tx-1" {
+			t.Errorf("unexpected body %s", body)
+		}
+	}))
+	defer server.Close()
+
+	endpoint = registerTestEndpoint(t, s, server.URL)
+	enqueueTestPayment(t, s)
+	enqueueTestPayment(t, s)
+	if err := s.DeliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Load() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", received.Load())
+	}
+	stored := deliveries(t, s)
+	if len(stored) != 1 || stored[0].Status != models.DeliveryStatusSucceeded || stored[0].Attempts != 1 {
+		t.Fatalf("unexpected deliveries %+v", stored)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.{}" keyed with "secret".
+	const want = "b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := SignWebhook("secret", "1700000000", []byte("{}")); got != want {
+		t.Fatalf("SignWebhook = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	s := &webhookService{conf: config.WebhookConfig{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute}}
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{10, time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := s.backoff(tt.attempts)
+			if got < tt.base || got > tt.base+tt.base/10 {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempts, got, tt.base, tt.base+tt.base/10)
+			}
+		}
+	}
+}
+
+func TestWebhookRetriesThenDeadLetters(t *testing.T) {
+	s := newTestWebhookService(t, true)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	registerTestEndpoint(t, s, server.URL)
+	enqueueTestPayment(t, s)
+
+	if err := s.DeliverDue(); err != nil {
+		t.Fatal(err)
+	}
+	stored := deliveries(t, s)[0]
+	if stored.Status != models.DeliveryStatusPending || stored.Attempts != 1 || stored.NextAttemptAt == "" {
+		t.Fatalf("after one failure: %+v", stored)
+	}
+	if stored.Log[0].StatusCode != http.StatusInternalServerError || stored.Log[0].Error == "" {
+		t.Fatalf("attempt log %+v", stored.Log[0])
+	}
+
+	// Retry once the backoff has passed until the attempts run out.
+	next, _ := time.Parse(time.RFC3339Nano, stored.NextAttemptAt)
+	if wait := time.Until(next); wait > 0 {
+		time.Sleep(wait + time.Millisecond)
+	}
+	for i := 0; i < 10 && deliveries(t, s)[0].Status == models.DeliveryStatusPending; i++ {
+		if err := s.DeliverDue(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stored = deliveries(t, s)[0]
+	if stored.Status != models.DeliveryStatusDead || stored.Attempts != 3 || len(stored.Log) != 3 {
+		t.Fatalf("delivery was not dead-lettered after 3 attempts: %+v", stored)
+	}
+	if received.Load() != 3 {
+		t.Fatalf("receiver got %d requests, want 3", received.Load())
+	}
+
+	// Redelivering gives the dead delivery a fresh retry budget and keeps its log.
+	redelivered, err := s.Redeliver(dto.Caller{Role: models.RoleAdmin}, "1", stored.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivered.Status != models.DeliveryStatusPending || redelivered.Attempts != 0 || len(redelivered.Log) != 3 {
+		t.Fatalf("unexpected redelivery %+v", redelivered)
+	}
+}
+
+func TestWebhookRejectsNonPublicEndpoints(t *testing.T) {
+	s := newTestWebhookService(t, false)
+
+	for _, url := range []string{
+		"http://127.0.0.1:8081/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://[::1]/hook",
+		"http://100.64.0.1/hook",
+	} {
+		_, err := s.RegisterEndpoint(dto.Caller{Role: models.RoleAdmin}, "1", dto.WebhookEndpointRequest{URL: url, Events: []string{models.WebhookPaymentSucceeded}})
+		var domainErr *DomainError
+		if !errors.As(err, &domainErr) || domainErr.Kind != KindValidation {
+			t.Errorf("RegisterEndpoint(%s) = %v, want a validation error", url, err)
+		}
+	}
+}
+
+func TestWebhookDeliveryRefusesNonPublicAddress(t *testing.T) {
+	s := newTestWebhookService(t, false)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	// An endpoint that passed registration but now points at a loopback address.
+	writeTestFile(t, webhookEndpointsFile, []models.WebhookEndpoint{{ID: "wh_1", MerchantID: "1", URL: server.URL, Secret: "whsec_x", Events: []string{models.WebhookPaymentSucceeded}, Active: true}})
+	enqueueTestPayment(t, s)
+	if err := s.DeliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := deliveries(t, s)[0]
+	if received.Load() != 0 {
+		t.Fatal("delivery reached a loopback address")
+	}
+	if !strings.Contains(stored.Log[0].Error, "non-public address") {
+		t.Fatalf("attempt error = %q", stored.Log[0].Error)
+	}
+}
+
+func TestWebhookDoesNotFollowRedirects(t *testing.T) {
+	s := newTestWebhookService(t, true)
+
+	var redirected atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	registerTestEndpoint(t, s, server.URL)
+	enqueueTestPayment(t, s)
+	if err := s.DeliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := deliveries(t, s)[0]
+	if redirected.Load() != 0 {
+		t.Fatal("delivery followed the redirect")
+	}
+	if stored.Status != models.DeliveryStatusPending || stored.Log[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("redirect was not a failed attempt: %+v", stored)
+	}
+}
@@ -0,0 +1,9 @@
+// Package templates holds the HTML templates of the pages the server renders.
+package templates
+
+import "embed"
+
+// FS contains the HTML templates.
+//
+//go:embed *.html
+var FS embed.FS
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// cursorSeparator separates the key parts inside an encoded cursor.
+const cursorSeparator = "\x1f"
+
+// EncodeCursor builds an opaque pagination cursor from the sort key of the last returned item.
+func EncodeCursor(parts ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, cursorSeparator)))
+}
+
+// DecodeCursor returns the sort key parts stored in a cursor created by EncodeCursor.
+// It returns an error if the cursor is malformed or does not hold exactly n parts.
+func DecodeCursor(cursor string, n int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	parts := strings.Split(string(raw), cursorSeparator)
+	if len(parts) != n {
+		return nil, errors.New("invalid cursor")
+	}
+	return parts, nil
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// emvCRCID is the ID of the CRC data object that ends every EMV QR code payload.
+const emvCRCID = "63"
+
+// EMVField is a data object of an EMV QR code payload: a two digit ID and its value.
+type EMVField struct {
+	ID    string
+	Value string
+}
+
+// EncodeEMV encodes data objects as ID, two digit length and value, in order. Lengths count
+// characters, not bytes.
+func EncodeEMV(fields []EMVField) string {
+	var b strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&b, "%s%02d%s", field.ID, utf8.RuneCountInString(field.Value), field.Value)
+	}
+	return b.String()
+}
+
+// EncodeEMVWithCRC encodes data objects and appends the CRC data object computed over the
+// payload up to and including the CRC's own ID and length.
+func EncodeEMVWithCRC(fields []EMVField) string {
+	payload := EncodeEMV(fields) + emvCRCID + "04"
+	return payload + fmt.Sprintf("%04X", CRC16CCITT([]byte(payload)))
+}
+
+// ParseEMV decodes a sequence of data objects. Values are not decoded further, so templates are
+// parsed by calling ParseEMV on their value.
+func ParseEMV(payload string) ([]EMVField, error) {
+	var fields []EMVField
+	for rest := []rune(payload); len(rest) > 0; {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("truncated data object at %q", string(rest))
+		}
+		id, header := string(rest[:2]), string(rest[2:4])
+		length, err := strconv.Atoi(header)
+		if err != nil || !isDigits(id) || !isDigits(header) {
+			return nil, fmt.Errorf("invalid data object header %q", string(rest[:4]))
+		}
+		if len(rest) < 4+length {
+			return nil, fmt.Errorf("data object %s is longer than the payload", id)
+		}
+		fields = append(fields, EMVField{ID: id, Value: string(rest[4 : 4+length])})
+		rest = rest[4+length:]
+	}
+	return fields, nil
+}
+
+// ParseEMVWithCRC decodes a payload that must end with a CRC data object matching its content,
+// and returns its data objects without the CRC.
+func ParseEMVWithCRC(payload string) ([]EMVField, error) {
+	fields, err := ParseEMV(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 || fields[len(fields)-1].ID != emvCRCID || len(fields[len(fields)-1].Value) != 4 {
+		return nil, fmt.Errorf("payload does not end with a CRC")
+	}
+	crc := fields[len(fields)-1].Value
+	expected := fmt.Sprintf("%04X", CRC16CCITT([]byte(payload[:len(payload)-4])))
+	if !strings.EqualFold(crc, expected) {
+		return nil, fmt.Errorf("CRC %s does not match the payload", crc)
+	}
+	return fields[:len(fields)-1], nil
+}
+
+// FindEMV returns the value of the first data object with the ID and whether there is one.
+func FindEMV(fields []EMVField, id string) (string, bool) {
+	for _, field := range fields {
+		if field.ID == id {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// CRC16CCITT computes the CRC-16/CCITT-FALSE checksum (polynomial 0x1021, initial value 0xFFFF)
+// EMV QR codes end with.
+func CRC16CCITT(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// isDigits reports whether s consists of ASCII digits only.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCRC16CCITT(t *testing.T) {
+	// The check value of CRC-16/CCITT-FALSE.
+	if crc := CRC16CCITT([]byte("123456789")); crc != 0x29B1 {
+		t.Fatalf("CRC16CCITT(123456789) = %04X, want 29B1", crc)
+	}
+}
+
+func TestEMVRoundTrip(t *testing.T) {
+	fields := []EMVField{
+		{ID: "00", Value: "01"},
+		{ID: "26", Value: EncodeEMV([]EMVField{{ID: "00", Value: "ID.CO.BANK"}, {ID: "01", Value: "42"}})},
+		{ID: "54", Value: "25000.5"},
+		{ID: "59", Value: "Café Żółw"},
+		{ID: "62", Value: ""},
+	}
+	payload := EncodeEMV(fields)
+	if payload[:6] != "000201" {
+		t.Fatalf("payload starts with %q", payload[:6])
+	}
+	got, err := ParseEMV(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Fatalf("ParseEMV = %+v, want %+v", got, fields)
+	}
+	account, err := ParseEMV(got[1].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := FindEMV(account, "01"); id != "42" {
+		t.Fatalf("merchant ID %q, want 42", id)
+	}
+}
+
+func TestParseEMVRejectsMalformedPayloads(t *testing.T) {
+	for _, payload := range []string{"000", "0A0201", "00x201", "000501", "00020101"} {
+		if _, err := ParseEMV(payload); err == nil {
+			t.Errorf("ParseEMV(%q) succeeded", payload)
+		}
+	}
+}
+
+func TestEMVWithCRC(t *testing.T) {
+	fields := []EMVField{{ID: "00", Value: "01"}, {ID: "01", Value: "12"}}
+	payload := EncodeEMVWithCRC(fields)
+	if payload[len(payload)-8:len(payload)-4] != "6304" {
+		t.Fatalf("payload %q does not end with a CRC data object", payload)
+	}
+	got, err := ParseEMVWithCRC(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Fatalf("ParseEMVWithCRC = %+v, want %+v", got, fields)
+	}
+
+	tampered := "000201010211" + payload[12:]
+	for _, payload := range []string{tampered, EncodeEMV(fields), payload[:len(payload)-1] + "G"} {
+		if _, err := ParseEMVWithCRC(payload); err == nil {
+			t.Errorf("ParseEMVWithCRC(%q) succeeded", payload)
+		}
+	}
+}
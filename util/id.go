@@ -0,0 +1,20 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// NewID returns a random identifier made of the prefix and 16 random bytes in hex.
+func NewID(prefix string) string {
+	return prefix + RandomHex(16)
+}
+
+// RandomHex returns n cryptographically random bytes encoded as hex.
+func RandomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
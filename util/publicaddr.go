@@ -0,0 +1,52 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which is not routable on the internet.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicIP reports whether ip is a globally routable unicast address. Loopback, private,
+// link-local (which includes cloud metadata services such as 169.254.169.254), shared,
+// multicast and unspecified addresses are not.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && !sharedAddressSpace.Contains(addr.Unmap())
+}
+
+// CheckPublicHost resolves host and returns an error unless every address it resolves to is public.
+func CheckPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return fmt.Errorf("%s resolves to the non-public address %s", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// PublicOnlyControl is a net.Dialer Control function that refuses to connect to non-public
+// addresses. It runs on the resolved address of every connection, so a host cannot pass a check
+// at one time and resolve to an internal address when it is dialed.
+func PublicOnlyControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return fmt.Errorf("connecting to the non-public address %s is not allowed", host)
+	}
+	return nil
+}
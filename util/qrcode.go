@@ -0,0 +1,482 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrQRDataTooLong is returned when data does not fit in the largest supported QR code.
+var ErrQRDataTooLong = errors.New("data is too long for a QR code")
+
+// qrVersion describes the error correction blocks of a QR code version at level M.
+type qrVersion struct {
+	ecPerBlock int
+	blocks1    int
+	dataWords1 int
+	blocks2    int
+	dataWords2 int
+	alignment  []int
+	totalWords int
+}
+
+// qrVersions lists versions 1 to 20 at error correction level M, which is plenty for payment payloads.
+var qrVersions = []qrVersion{
+	{10, 1, 16, 0, 0, nil, 26},
+	{16, 1, 28, 0, 0, []int{6, 18}, 44},
+	{26, 1, 44, 0, 0, []int{6, 22}, 70},
+	{18, 2, 32, 0, 0, []int{6, 26}, 100},
+	{24, 2, 43, 0, 0, []int{6, 30}, 134},
+	{16, 4, 27, 0, 0, []int{6, 34}, 172},
+	{18, 4, 31, 0, 0, []int{6, 22, 38}, 196},
+	{22, 2, 38, 2, 39, []int{6, 24, 42}, 242},
+	{22, 3, 36, 2, 37, []int{6, 26, 46}, 292},
+	{26, 4, 43, 1, 44, []int{6, 28, 50}, 346},
+	{30, 1, 50, 4, 51, []int{6, 30, 54}, 404},
+	{22, 6, 36, 2, 37, []int{6, 32, 58}, 466},
+	{22, 8, 37, 1, 38, []int{6, 34, 62}, 532},
+	{24, 4, 40, 5, 41, []int{6, 26, 46, 66}, 581},
+	{24, 5, 41, 5, 42, []int{6, 26, 48, 70}, 655},
+	{28, 7, 45, 3, 46, []int{6, 26, 50, 74}, 733},
+	{28, 10, 46, 1, 47, []int{6, 30, 54, 78}, 815},
+	{26, 9, 43, 4, 44, []int{6, 30, 56, 82}, 901},
+	{26, 3, 44, 11, 45, []int{6, 30, 58, 86}, 991},
+	{26, 3, 41, 13, 42, []int{6, 34, 62, 90}, 1085},
+}
+
+// dataWords returns the number of data codewords of the version.
+func (v qrVersion) dataWords() int {
+	return v.blocks1*v.dataWords1 + v.blocks2*v.dataWords2
+}
+
+// qrMatrix is a QR code under construction. dark holds the module colours and function marks
+// the modules of function patterns, which the data and the mask leave alone.
+type qrMatrix struct {
+	size     int
+	dark     [][]bool
+	function [][]bool
+}
+
+// QRCode encodes data in byte mode at error correction level M in the smallest version that
+// fits it and returns the modules, true for dark, indexed by row and then column.
+func QRCode(data []byte) ([][]bool, error) {
+	number := 0
+	for i, v := range qrVersions {
+		countBits := 8
+		if i+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*v.dataWords() {
+			number = i + 1
+			break
+		}
+	}
+	if number == 0 {
+		return nil, ErrQRDataTooLong
+	}
+	version := qrVersions[number-1]
+
+	codewords := qrInterleave(version, qrDataCodewords(version, number, data))
+	size := 17 + 4*number
+	m := &qrMatrix{size: size, dark: qrGrid(size), function: qrGrid(size)}
+	m.drawFunctionPatterns(version, number)
+	m.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormat(mask)
+		if penalty := m.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		m.applyMask(mask)
+	}
+	m.applyMask(best)
+	m.drawFormat(best)
+	return m.dark, nil
+}
+
+// QRCodePNG renders data as a QR code PNG with scale pixels per module and the four module
+// wide quiet zone scanners need.
+func QRCodePNG(data []byte, scale int) ([]byte, error) {
+	modules, err := QRCode(data)
+	if err != nil {
+		return nil, err
+	}
+	const quiet = 4
+	size := (len(modules) + 2*quiet) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quiet)*scale+dx, (y+quiet)*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// qrDataCodewords encodes data as a byte mode segment padded to the version's data capacity.
+func qrDataCodewords(version qrVersion, number int, data []byte) []byte {
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>i&1 == 1)
+		}
+	}
+	countBits := 8
+	if number >= 10 {
+		countBits = 16
+	}
+	appendBits(0b0100, 4)
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	capacity := 8 * version.dataWords()
+	appendBits(0, min(4, capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	words := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			words[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return words
+}
+
+// qrInterleave splits the data codewords into the version's blocks, adds the Reed-Solomon error
+// correction codewords of each block and interleaves them.
+func qrInterleave(version qrVersion, data []byte) []byte {
+	generator := rsGenerator(version.ecPerBlock)
+	var dataBlocks, ecBlocks [][]byte
+	for b := 0; b < version.blocks1+version.blocks2; b++ {
+		n := version.dataWords1
+		if b >= version.blocks1 {
+			n = version.dataWords2
+		}
+		block := data[:n]
+		data = data[n:]
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, generator))
+	}
+
+	result := make([]byte, 0, version.totalWords)
+	for i := 0; i < max(version.dataWords1, version.dataWords2); i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < version.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies two elements of GF(256) with the QR code polynomial 0x11D.
+func gfMultiply(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		carry := z & 0x80
+		z <<= 1
+		if carry != 0 {
+			z ^= 0x1D
+		}
+		if y>>i&1 == 1 {
+			z ^= x
+		}
+	}
+	return z
+}
+
+// rsGenerator returns the coefficients of the Reed-Solomon generator polynomial of the degree,
+// highest power first without the leading 1.
+func rsGenerator(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data for the generator.
+func rsRemainder(data, generator []byte) []byte {
+	result := make([]byte, len(generator))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range generator {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// qrGrid returns a size by size grid of light modules.
+func qrGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// set colours a function module.
+func (m *qrMatrix) set(x, y int, dark bool) {
+	m.dark[y][x] = dark
+	m.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns, reserves the format
+// areas and draws the version information of versions 7 and up.
+func (m *qrMatrix) drawFunctionPatterns(version qrVersion, number int) {
+	for i := 0; i < m.size; i++ {
+		m.set(6, i, i%2 == 0)
+		m.set(i, 6, i%2 == 0)
+	}
+
+	for _, corner := range [][2]int{{3, 3}, {m.size - 4, 3}, {3, m.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := corner[0]+dx, corner[1]+dy
+				if x < 0 || x >= m.size || y < 0 || y >= m.size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				m.set(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	last := len(version.alignment) - 1
+	for i, cx := range version.alignment {
+		for j, cy := range version.alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					m.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	m.drawFormat(0)
+
+	if number >= 7 {
+		rem := number
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := number<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 == 1
+			a, b := m.size-11+i%3, i/3
+			m.set(a, b, dark)
+			m.set(b, a, dark)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information for level M and the mask, and the
+// dark module.
+func (m *qrMatrix) drawFormat(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		m.set(8, i, bit(i))
+	}
+	m.set(8, 7, bit(6))
+	m.set(8, 8, bit(7))
+	m.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.set(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.set(8, m.size-15+i, bit(i))
+	}
+	m.set(8, m.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard, skipping function
+// modules. Modules left over are remainder bits and stay light.
+func (m *qrMatrix) drawCodewords(codewords []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < m.size; vert++ {
+			y := vert
+			if upward {
+				y = m.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if m.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				m.dark[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules the mask pattern selects. Applying a mask twice undoes it.
+func (m *qrMatrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.function[y][x] {
+				continue
+			}
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip {
+				m.dark[y][x] = !m.dark[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four penalty rules of the standard; the mask with the
+// lowest score is used.
+func (m *qrMatrix) penalty() int {
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return m.dark[x][y]
+		}
+		return m.dark[y][x]
+	}
+
+	score := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < m.size; y++ {
+			run := 1
+			for x := 1; x <= m.size; x++ {
+				if x < m.size && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+			for x := 0; x+len(finderLike) <= m.size; x++ {
+				match := true
+				for i, dark := range finderLike {
+					if at(x+i, y, transpose) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (m.lightRun(x-4, x, y, transpose) || m.lightRun(x+7, x+11, y, transpose)) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.dark[y][x] {
+				dark++
+			}
+			if x+1 < m.size && y+1 < m.size {
+				c := m.dark[y][x]
+				if c == m.dark[y][x+1] && c == m.dark[y+1][x] && c == m.dark[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := m.size * m.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return score + k*10
+}
+
+// lightRun reports whether the modules from start up to end of a line are light, counting
+// modules outside the symbol as light.
+func (m *qrMatrix) lightRun(start, end, line int, transpose bool) bool {
+	for i := start; i < end; i++ {
+		if i < 0 || i >= m.size {
+			continue
+		}
+		if (transpose && m.dark[i][line]) || (!transpose && m.dark[line][i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// finderPattern is the 7 by 7 pattern in three corners of every QR code.
+var finderPattern = []string{
+	"#######",
+	"#.....#",
+	"#.###.#",
+	"#.###.#",
+	"#.###.#",
+	"#.....#",
+	"#######",
+}
+
+// assertFinder fails the test unless the modules hold a finder pattern with its top left at x, y.
+func assertFinder(t *testing.T, modules [][]bool, x, y int) {
+	t.Helper()
+	for dy, row := range finderPattern {
+		for dx, c := range row {
+			if modules[y+dy][x+dx] != (c == '#') {
+				t.Fatalf("module %d,%d of the finder pattern at %d,%d is wrong", dx, dy, x, y)
+			}
+		}
+	}
+}
+
+func TestQRCodeVersions(t *testing.T) {
+	tests := []struct {
+		length int
+		size   int
+	}{
+		{1, 21},
+		{14, 21},
+		{15, 25},
+		{150, 49},
+		{500, 85},
+	}
+	for _, tt := range tests {
+		modules, err := QRCode([]byte(strings.Repeat("a", tt.length)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(modules) != tt.size {
+			t.Errorf("%d bytes gave %d modules, want %d", tt.length, len(modules), tt.size)
+			continue
+		}
+		for _, row := range modules {
+			if len(row) != tt.size {
+				t.Fatalf("%d bytes gave a row of %d modules, want %d", tt.length, len(row), tt.size)
+			}
+		}
+		assertFinder(t, modules, 0, 0)
+		assertFinder(t, modules, tt.size-7, 0)
+		assertFinder(t, modules, 0, tt.size-7)
+		// The timing patterns alternate between the finder patterns.
+		for i := 8; i < tt.size-8; i++ {
+			if modules[6][i] != (i%2 == 0) || modules[i][6] != (i%2 == 0) {
+				t.Fatalf("%d bytes: timing pattern is wrong at %d", tt.length, i)
+			}
+		}
+		// The dark module next to the bottom left finder pattern.
+		if !modules[tt.size-8][8] {
+			t.Errorf("%d bytes: dark module is missing", tt.length)
+		}
+	}
+}
+
+func TestQRCodeTooLong(t *testing.T) {
+	if _, err := QRCode(make([]byte, 2000)); !errors.Is(err, ErrQRDataTooLong) {
+		t.Fatalf("error = %v, want ErrQRDataTooLong", err)
+	}
+}
+
+func TestQRCodePNG(t *testing.T) {
+	data := []byte("00020101021226260010ID.CO.BANK01011520400005303360")
+	modules, err := QRCode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := QRCodePNG(data, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (len(modules) + 8) * 3
+	if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+		t.Fatalf("image is %v, want %dx%d", bounds, size, size)
+	}
+	// The quiet zone is light and the top left finder corner dark.
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone is dark")
+	}
+	if r, _, _, _ := img.At(4*3, 4*3).RGBA(); r != 0 {
+		t.Error("finder pattern corner is light")
+	}
+}
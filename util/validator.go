@@ -0,0 +1,158 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// idPattern restricts identifiers to the characters used by the JSON database records.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// FieldError describes a single invalid field in a request payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// RegisterValidators registers the custom validation rules on gin's binding engine.
+// It also makes validation errors report the JSON field name instead of the Go field name.
+func RegisterValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unsupported binding validator engine")
+	}
+
+	v.RegisterTagNameFunc(jsonFieldName)
+
+	if err := v.RegisterValidation("money", validateMoney); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("id", validateID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidationErrors converts validator errors into a list of field errors.
+// It returns nil if err is not a validation error.
+func ValidationErrors(err error) []FieldError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return fields
+}
+
+// validateMoney checks that a number is a positive, finite amount with at most two decimal places.
+func validateMoney(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	var amount float64
+	switch field.Kind() {
+	case reflect.Float32, reflect.Float64:
+		amount = field.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		amount = float64(field.Int())
+	default:
+		return false
+	}
+
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount <= 0 {
+		return false
+	}
+	cents := amount * 100
+	return math.Abs(cents-math.Round(cents)) < 1e-6
+}
+
+// validateID checks that a string is a non-empty identifier made of letters, digits, dashes or underscores.
+func validateID(fl validator.FieldLevel) bool {
+	if fl.Field().Kind() != reflect.String {
+		return false
+	}
+	return idPattern.MatchString(fl.Field().String())
+}
+
+// jsonFieldName returns the JSON name of a struct field, falling back to the Go name.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// snakeCase turns a Go field name such as InvoiceToken or MerchantID into its JSON form, invoice_token or merchant_id.
+func snakeCase(name string) string {
+	var b strings.Builder
+	previous := rune(0)
+	for _, r := range name {
+		if unicode.IsUpper(r) && unicode.IsLower(previous) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+		previous = r
+	}
+	return b.String()
+}
+
+// fieldErrorMessage builds a human readable message for a failed validation rule.
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not given", snakeCase(fe.Param()))
+	case "money":
+		return "must be a positive amount with at most two decimal places"
+	case "id":
+		return "must be 1-64 letters, digits, dashes or underscores"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "datetime":
+		return fmt.Sprintf("must be a date in the format %s", fe.Param())
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters long", fe.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	case "http_url":
+		return "must be an http or https URL"
+	case "iso4217":
+		return "must be an ISO 4217 currency code such as USD"
+	case "alphanum":
+		return "must contain only letters and digits"
+	case "unique":
+		return "must not contain duplicates"
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}